@@ -1,6 +1,9 @@
 package common
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"strings"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
@@ -28,3 +31,19 @@ func HandleValidationError(err error) string {
 	}
 	return ""
 }
+
+// URLやCookieにそのまま載せられる推測困難なランダム文字列を返す(nバイトの乱数を16進表記)
+func RandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// 秘密の値をDBに保存する時のハッシュ(SHA-256のhex)
+// 照合は同じ関数でハッシュにしてから検索する
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+type IAPIKeyController interface {
+	CreateAPIKey(c echo.Context) error
+	GetOwnAPIKeys(c echo.Context) error
+	RevokeAPIKey(c echo.Context) error
+	Authenticate(c echo.Context, key string) (*jwt.Token, error)
+}
+
+type apiKeyController struct {
+	au usecase.IAPIKeyUsecase
+}
+
+func NewAPIKeyController(au usecase.IAPIKeyUsecase) IAPIKeyController {
+	return &apiKeyController{au}
+}
+
+// キー全体はこのレスポンスでしか返さない
+func (ac *apiKeyController) CreateAPIKey(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.APIKeyRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	keyRes, err := ac.au.CreateAPIKey(userID, mfaFromToken(c), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, keyRes)
+}
+
+func (ac *apiKeyController) GetOwnAPIKeys(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	keys, err := ac.au.GetOwnAPIKeys(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+func (ac *apiKeyController) RevokeAPIKey(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := ac.au.RevokeAPIKey(userID, uint(id)); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ルータのAPIキー認証から呼ぶ、戻り値のトークンがJWTと同じく"user"キーに付与される
+func (ac *apiKeyController) Authenticate(c echo.Context, key string) (*jwt.Token, error) {
+	return ac.au.Authenticate(key)
+}
@@ -0,0 +1,169 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IAuctionController interface {
+	CreateListing(c echo.Context) error
+	GetOpenListings(c echo.Context) error
+	GetListing(c echo.Context) error
+	GetOwnWonListings(c echo.Context) error
+	CancelListing(c echo.Context) error
+	PlaceBid(c echo.Context) error
+	MakeOffer(c echo.Context) error
+	GetOffers(c echo.Context) error
+	AcceptOffer(c echo.Context) error
+	DeclineOffer(c echo.Context) error
+	Checkout(c echo.Context) error
+}
+
+type auctionController struct {
+	au usecase.IAuctionUsecase
+}
+
+func NewAuctionController(au usecase.IAuctionUsecase) IAuctionController {
+	return &auctionController{au}
+}
+
+func (ac *auctionController) CreateListing(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.AuctionListingRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	listingRes, err := ac.au.CreateListing(staffID, req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, listingRes)
+}
+
+func (ac *auctionController) GetOpenListings(c echo.Context) error {
+	listings, err := ac.au.GetOpenListings()
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, listings)
+}
+
+func (ac *auctionController) GetListing(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	listingRes, err := ac.au.GetListing(uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, listingRes)
+}
+
+func (ac *auctionController) GetOwnWonListings(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	listings, err := ac.au.GetOwnWonListings(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, listings)
+}
+
+func (ac *auctionController) CancelListing(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := ac.au.CancelListing(staffID, uint(id)); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (ac *auctionController) PlaceBid(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	req := model.AuctionAmountRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	listingRes, err := ac.au.PlaceBid(userID, uint(id), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, listingRes)
+}
+
+func (ac *auctionController) MakeOffer(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	req := model.AuctionAmountRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	offerRes, err := ac.au.MakeOffer(userID, uint(id), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, offerRes)
+}
+
+func (ac *auctionController) GetOffers(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	offers, err := ac.au.GetOffers(uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, offers)
+}
+
+func (ac *auctionController) AcceptOffer(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	offerID, _ := strconv.Atoi(c.Param("offerId"))
+	listingRes, err := ac.au.AcceptOffer(uint(id), uint(offerID))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, listingRes)
+}
+
+func (ac *auctionController) DeclineOffer(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	offerID, _ := strconv.Atoi(c.Param("offerId"))
+	offerRes, err := ac.au.DeclineOffer(uint(id), uint(offerID))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, offerRes)
+}
+
+func (ac *auctionController) Checkout(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	req := model.AuctionCheckoutRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	listingRes, err := ac.au.Checkout(userID, uint(id), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, listingRes)
+}
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/report"
+	"record-shop-rest-api/usecase"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IConsignmentController interface {
+	CreateConsignor(c echo.Context) error
+	GetConsignors(c echo.Context) error
+	GetConsignor(c echo.Context) error
+	CreateItem(c echo.Context) error
+	GetItems(c echo.Context) error
+	SellItem(c echo.Context) error
+	ReturnItem(c echo.Context) error
+	RecordPayout(c echo.Context) error
+	GetStatement(c echo.Context) error
+}
+
+type consignmentController struct {
+	cu usecase.IConsignmentUsecase
+}
+
+func NewConsignmentController(cu usecase.IConsignmentUsecase) IConsignmentController {
+	return &consignmentController{cu}
+}
+
+func (cc *consignmentController) CreateConsignor(c echo.Context) error {
+	consignor := model.Consignor{}
+	if err := c.Bind(&consignor); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	consignorRes, err := cc.cu.CreateConsignor(consignor)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, consignorRes)
+}
+
+func (cc *consignmentController) GetConsignors(c echo.Context) error {
+	consignors, err := cc.cu.GetConsignors()
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, consignors)
+}
+
+func (cc *consignmentController) GetConsignor(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	consignorRes, err := cc.cu.GetConsignor(uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, consignorRes)
+}
+
+func (cc *consignmentController) CreateItem(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	item := model.ConsignmentItem{}
+	if err := c.Bind(&item); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	itemRes, err := cc.cu.CreateItem(uint(id), item)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, itemRes)
+}
+
+func (cc *consignmentController) GetItems(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	items, err := cc.cu.GetItems(uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, items)
+}
+
+func (cc *consignmentController) SellItem(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.ConsignmentSaleRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	entryRes, err := cc.cu.SellItem(staffID, uint(id), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, entryRes)
+}
+
+func (cc *consignmentController) ReturnItem(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	itemRes, err := cc.cu.ReturnItem(uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, itemRes)
+}
+
+func (cc *consignmentController) RecordPayout(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.ConsignmentPayoutRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	entryRes, err := cc.cu.RecordPayout(staffID, uint(id), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, entryRes)
+}
+
+// ?from=2025-01-01&to=2025-01-31&format=csv|pdf|json
+// 期間は日付で指定し、toの日を含む、未指定なら今月の1日から今日まで
+func (cc *consignmentController) GetStatement(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	var err error
+	if v := c.QueryParam("from"); v != "" {
+		if from, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"message": "from must be YYYY-MM-DD."})
+		}
+	}
+	if v := c.QueryParam("to"); v != "" {
+		if to, err = time.ParseInLocation("2006-01-02", v, time.Local); err != nil {
+			return c.JSON(http.StatusBadRequest, map[string]string{"message": "to must be YYYY-MM-DD."})
+		}
+	}
+	if to.Before(from) {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": "from must not be after to."})
+	}
+	statement, err := cc.cu.GetStatement(uint(id), from, to.AddDate(0, 0, 1))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+
+	filename := fmt.Sprintf("consignment-statement-%d-%s", statement.Consignor.ID, from.Format("20060102"))
+	switch c.QueryParam("format") {
+	case "csv":
+		body, err := report.ConsignmentStatementCSV(statement)
+		if err != nil {
+			return errorJSON(c, err)
+		}
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename+".csv"))
+		return c.Blob(http.StatusOK, "text/csv; charset=utf-8", body)
+	case "pdf":
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename+".pdf"))
+		return c.Blob(http.StatusOK, "application/pdf", report.ConsignmentStatementPDF(statement))
+	default:
+		return c.JSON(http.StatusOK, statement)
+	}
+}
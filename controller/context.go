@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+// echojwtのmiddleware内部で"user"キーに付与されたJWTから、ログインユーザのIDを取り出す
+// user_idはLogin時にMapClaimsに入れている、JSONの数値はfloat64で復元される
+func userIDFromToken(c echo.Context) (uint, error) {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		return 0, fmt.Errorf("unauthorized")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return 0, fmt.Errorf("unauthorized")
+	}
+	userID, ok := claims["user_id"].(float64)
+	if !ok {
+		return 0, fmt.Errorf("unauthorized")
+	}
+	return uint(userID), nil
+}
+
+// usecaseのエラーをHTTPステータスに振り分けて返す
+// バリデーションエラー: 400、認証できない: 401、存在しない: 404、状態不正: 409、回数制限: 429、それ以外: 500
+func errorJSON(c echo.Context, err error) error {
+	if message := common.HandleValidationError(err); message != "" {
+		return c.JSON(http.StatusBadRequest, map[string]string{"message": message})
+	}
+	if errors.Is(err, usecase.ErrUnauthorized) {
+		return c.JSON(http.StatusUnauthorized, map[string]string{"message": err.Error()})
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": err.Error()})
+	}
+	if errors.Is(err, usecase.ErrInvalidState) {
+		return c.JSON(http.StatusConflict, map[string]string{"message": err.Error()})
+	}
+	if errors.Is(err, usecase.ErrTooManyRequests) {
+		var retry *usecase.RetryLaterError
+		if errors.As(err, &retry) {
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retry.RetryAfter.Seconds()))))
+		}
+		return c.JSON(http.StatusTooManyRequests, map[string]string{"message": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"message": err.Error()})
+}
+
+// 2段階認証を済ませたセッションか、クレームが無ければ済ませていない扱い
+func mfaFromToken(c echo.Context) bool {
+	token, ok := c.Get("user").(*jwt.Token)
+	if !ok || token == nil {
+		return false
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return false
+	}
+	mfa, _ := claims["mfa"].(bool)
+	return mfa
+}
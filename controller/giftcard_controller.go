@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IGiftCardController interface {
+	IssueGiftCard(c echo.Context) error
+	GetGiftCardBalance(c echo.Context) error
+	GetGiftCardTransactions(c echo.Context) error
+	GetOwnStoreCredit(c echo.Context) error
+	GrantStoreCredit(c echo.Context) error
+	Tender(c echo.Context) error
+	ReverseTender(c echo.Context) error
+}
+
+type giftCardController struct {
+	gu usecase.IGiftCardUsecase
+}
+
+func NewGiftCardController(gu usecase.IGiftCardUsecase) IGiftCardController {
+	return &giftCardController{gu}
+}
+
+func (gc *giftCardController) IssueGiftCard(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.GiftCardIssueRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	cardRes, err := gc.gu.IssueGiftCard(staffID, req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, cardRes)
+}
+
+// コードをURLやアクセスログに残さないようにPOSTのボディで受取る
+func (gc *giftCardController) GetGiftCardBalance(c echo.Context) error {
+	req := model.GiftCardBalanceRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	cardRes, err := gc.gu.GetGiftCardBalance(req.Code)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, cardRes)
+}
+
+func (gc *giftCardController) GetGiftCardTransactions(c echo.Context) error {
+	req := model.GiftCardBalanceRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	transactions, err := gc.gu.GetGiftCardTransactions(req.Code)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, transactions)
+}
+
+func (gc *giftCardController) GetOwnStoreCredit(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	creditRes, err := gc.gu.GetOwnStoreCredit(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, creditRes)
+}
+
+func (gc *giftCardController) GrantStoreCredit(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.StoreCreditGrantRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	entryRes, err := gc.gu.GrantStoreCredit(staffID, req, "", 0)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, entryRes)
+}
+
+func (gc *giftCardController) Tender(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.TenderRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	tenderRes, err := gc.gu.Tender(userID, req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, tenderRes)
+}
+
+// スタッフ用、顧客の充当を取消す
+func (gc *giftCardController) ReverseTender(c echo.Context) error {
+	req := model.TenderReverseRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	reversed, err := gc.gu.ReverseTender(req.UserID, req.Reference)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, reversed)
+}
@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IInventoryController interface {
+	CreateLocation(c echo.Context) error
+	GetLocations(c echo.Context) error
+	GetStock(c echo.Context) error
+	GetRecordAvailability(c echo.Context) error
+	GetMovements(c echo.Context) error
+	Adjust(c echo.Context) error
+	CreateTransfer(c echo.Context) error
+	GetTransfers(c echo.Context) error
+	GetTransfer(c echo.Context) error
+	ShipTransfer(c echo.Context) error
+	ReceiveTransfer(c echo.Context) error
+	CancelTransfer(c echo.Context) error
+}
+
+type inventoryController struct {
+	iu usecase.IInventoryUsecase
+}
+
+func NewInventoryController(iu usecase.IInventoryUsecase) IInventoryController {
+	return &inventoryController{iu}
+}
+
+func (ic *inventoryController) CreateLocation(c echo.Context) error {
+	location := model.Location{}
+	if err := c.Bind(&location); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	locationRes, err := ic.iu.CreateLocation(location)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, locationRes)
+}
+
+func (ic *inventoryController) GetLocations(c echo.Context) error {
+	locations, err := ic.iu.GetLocations()
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, locations)
+}
+
+// ?location=shimokitazawa&record_id=1&grade=VG%2B&in_stock=true
+func (ic *inventoryController) GetStock(c echo.Context) error {
+	recordID, _ := strconv.Atoi(c.QueryParam("record_id"))
+	levels, err := ic.iu.GetStock(model.StockQuery{
+		LocationCode: c.QueryParam("location"),
+		RecordID:     uint(recordID),
+		Grade:        c.QueryParam("grade"),
+		InStockOnly:  c.QueryParam("in_stock") == "true",
+	})
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, levels)
+}
+
+// レコード1件の拠点ごとの在庫、?location=で拠点を絞り込める
+func (ic *inventoryController) GetRecordAvailability(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	levels, err := ic.iu.GetStock(model.StockQuery{
+		LocationCode: c.QueryParam("location"),
+		RecordID:     uint(id),
+		InStockOnly:  true,
+	})
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, levels)
+}
+
+// ?location_id=1&record_id=1
+func (ic *inventoryController) GetMovements(c echo.Context) error {
+	locationID, _ := strconv.Atoi(c.QueryParam("location_id"))
+	recordID, _ := strconv.Atoi(c.QueryParam("record_id"))
+	movements, err := ic.iu.GetMovements(uint(locationID), uint(recordID))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, movements)
+}
+
+func (ic *inventoryController) Adjust(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.StockAdjustmentRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	movementRes, err := ic.iu.Adjust(staffID, req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, movementRes)
+}
+
+func (ic *inventoryController) CreateTransfer(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	order := model.TransferOrder{}
+	if err := c.Bind(&order); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	orderRes, err := ic.iu.CreateTransfer(staffID, order)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, orderRes)
+}
+
+// ?status=in_transit
+func (ic *inventoryController) GetTransfers(c echo.Context) error {
+	orders, err := ic.iu.GetTransfers(c.QueryParam("status"))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, orders)
+}
+
+func (ic *inventoryController) GetTransfer(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	orderRes, err := ic.iu.GetTransfer(uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, orderRes)
+}
+
+func (ic *inventoryController) ShipTransfer(c echo.Context) error {
+	return ic.transition(c, ic.iu.ShipTransfer)
+}
+
+func (ic *inventoryController) ReceiveTransfer(c echo.Context) error {
+	return ic.transition(c, ic.iu.ReceiveTransfer)
+}
+
+func (ic *inventoryController) CancelTransfer(c echo.Context) error {
+	return ic.transition(c, ic.iu.CancelTransfer)
+}
+
+// 出庫・入庫・取消は、リクエストの形が同じなのでまとめる
+func (ic *inventoryController) transition(c echo.Context,
+	action func(staffID uint, id uint) (model.TransferOrder, error)) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	orderRes, err := action(staffID, uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, orderRes)
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ILoyaltyController interface {
+	CreateLoyaltyRule(c echo.Context) error
+	GetLoyaltyRules(c echo.Context) error
+	GetOwnPoints(c echo.Context) error
+	EarnPoints(c echo.Context) error
+	RedeemPoints(c echo.Context) error
+}
+
+type loyaltyController struct {
+	lu usecase.ILoyaltyUsecase
+}
+
+func NewLoyaltyController(lu usecase.ILoyaltyUsecase) ILoyaltyController {
+	return &loyaltyController{lu}
+}
+
+func (lc *loyaltyController) CreateLoyaltyRule(c echo.Context) error {
+	rule := model.LoyaltyRule{}
+	if err := c.Bind(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	ruleRes, err := lc.lu.CreateLoyaltyRule(rule)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, ruleRes)
+}
+
+func (lc *loyaltyController) GetLoyaltyRules(c echo.Context) error {
+	rules, err := lc.lu.GetLoyaltyRules()
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, rules)
+}
+
+func (lc *loyaltyController) GetOwnPoints(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	pointsRes, err := lc.lu.GetOwnPoints(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, pointsRes)
+}
+
+// スタッフ用、付与先は決済の所有者
+func (lc *loyaltyController) EarnPoints(c echo.Context) error {
+	req := model.PointEarnRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	entryRes, err := lc.lu.Earn(req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, entryRes)
+}
+
+func (lc *loyaltyController) RedeemPoints(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.PointRedeemRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	entryRes, err := lc.lu.Redeem(userID, req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, entryRes)
+}
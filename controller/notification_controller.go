@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type INotificationController interface {
+	GetOwnNotifications(c echo.Context) error
+	MarkRead(c echo.Context) error
+}
+
+type notificationController struct {
+	nu usecase.INotificationUsecase
+}
+
+func NewNotificationController(nu usecase.INotificationUsecase) INotificationController {
+	return &notificationController{nu}
+}
+
+func (nc *notificationController) GetOwnNotifications(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	notifications, err := nc.nu.GetOwnNotifications(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, notifications)
+}
+
+func (nc *notificationController) MarkRead(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := nc.nu.MarkRead(userID, uint(id)); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,78 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IOrderController interface {
+	CreateOrder(c echo.Context) error
+	GetOwnOrders(c echo.Context) error
+	GetOwnOrder(c echo.Context) error
+	CancelOrder(c echo.Context) error
+}
+
+type orderController struct {
+	ou usecase.IOrderUsecase
+}
+
+func NewOrderController(ou usecase.IOrderUsecase) IOrderController {
+	return &orderController{ou}
+}
+
+func (oc *orderController) CreateOrder(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.OrderRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	order, err := oc.ou.CreateOrder(userID, req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, order)
+}
+
+func (oc *orderController) GetOwnOrders(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	orders, err := oc.ou.GetOwnOrders(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, orders)
+}
+
+func (oc *orderController) GetOwnOrder(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	order, err := oc.ou.GetOwnOrder(userID, uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, order)
+}
+
+func (oc *orderController) CancelOrder(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := oc.ou.CancelOrder(userID, uint(id)); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
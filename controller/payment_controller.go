@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/payment"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+)
+
+type IPaymentController interface {
+	Authorize(c echo.Context) error
+	Capture(c echo.Context) error
+	Refund(c echo.Context) error
+	Webhook(c echo.Context) error
+}
+
+type paymentController struct {
+	pu usecase.IPaymentUsecase
+}
+
+func NewPaymentController(pu usecase.IPaymentUsecase) IPaymentController {
+	return &paymentController{pu}
+}
+
+func (pc *paymentController) Authorize(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.PaymentRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	paymentRes, err := pc.pu.Authorize(userID, req)
+	if err != nil {
+		return pc.paymentError(c, paymentRes, err)
+	}
+	// 与信拒否は決済として記録した上で402を返す
+	if paymentRes.Status == payment.StatusDeclined {
+		return c.JSON(http.StatusPaymentRequired, paymentRes)
+	}
+	return c.JSON(http.StatusCreated, paymentRes)
+}
+
+func (pc *paymentController) Capture(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	paymentRes, err := pc.pu.Capture(userID, uint(id))
+	if err != nil {
+		return pc.paymentError(c, paymentRes, err)
+	}
+	return c.JSON(http.StatusOK, paymentRes)
+}
+
+// スタッフ用
+func (pc *paymentController) Refund(c echo.Context) error {
+	req := model.RefundRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	paymentRes, err := pc.pu.Refund(uint(id), req)
+	if err != nil {
+		return pc.paymentError(c, paymentRes, err)
+	}
+	return c.JSON(http.StatusOK, paymentRes)
+}
+
+// 決済プロバイダから呼ばれるエンドポイント、JWTもCSRFも無いので署名で検証する
+func (pc *paymentController) Webhook(c echo.Context) error {
+	// 署名は受信したバイト列そのものに対して計算されているので、Bindせずにそのまま読む
+	payload, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	signature := c.Request().Header.Get(payment.SignatureHeader)
+	if err := pc.pu.HandleWebhook(payload, signature); err != nil {
+		if errors.Is(err, payment.ErrInvalidSignature) {
+			return c.JSON(http.StatusUnauthorized, err.Error())
+		}
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.JSON(http.StatusNotFound, err.Error())
+		}
+		// 5xxを返せばプロバイダが再送してくれる
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (pc *paymentController) paymentError(c echo.Context, paymentRes model.PaymentResponse, err error) error {
+	if paymentRes.Error != nil {
+		return c.JSON(http.StatusBadRequest, paymentRes.Error)
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.JSON(http.StatusNotFound, map[string]string{"message": err.Error()})
+	}
+	return c.JSON(http.StatusInternalServerError, map[string]string{"message": err.Error()})
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/report"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IPosController interface {
+	CreatePosItem(c echo.Context) error
+	GetPosItem(c echo.Context) error
+	Sell(c echo.Context) error
+	GetPosSale(c echo.Context) error
+	VoidPosSale(c echo.Context) error
+	ReturnPosSale(c echo.Context) error
+	GetReceipt(c echo.Context) error
+}
+
+type posController struct {
+	pu usecase.IPosUsecase
+}
+
+func NewPosController(pu usecase.IPosUsecase) IPosController {
+	return &posController{pu}
+}
+
+func (pc *posController) CreatePosItem(c echo.Context) error {
+	item := model.PosItem{}
+	if err := c.Bind(&item); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	itemRes, err := pc.pu.CreatePosItem(item)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, itemRes)
+}
+
+// スキャンしたSKUまたはバーコードで商品を引く
+func (pc *posController) GetPosItem(c echo.Context) error {
+	itemRes, err := pc.pu.GetPosItemByCode(c.Param("code"))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, itemRes)
+}
+
+func (pc *posController) Sell(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.PosSaleRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	saleRes, err := pc.pu.Sell(staffID, req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, saleRes)
+}
+
+func (pc *posController) GetPosSale(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	saleRes, err := pc.pu.GetPosSale(uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, saleRes)
+}
+
+func (pc *posController) VoidPosSale(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	saleRes, err := pc.pu.Void(staffID, uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, saleRes)
+}
+
+func (pc *posController) ReturnPosSale(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	req := model.PosReturnRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	returnRes, err := pc.pu.Return(staffID, uint(id), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, returnRes)
+}
+
+// ?format=text|pdf、未指定ならtext
+func (pc *posController) GetReceipt(c echo.Context) error {
+	id, _ := strconv.Atoi(c.Param("id"))
+	sale, err := pc.pu.GetPosSale(uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	if c.QueryParam("format") == "pdf" {
+		c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf("inline; filename=%q", fmt.Sprintf("receipt-%d.pdf", sale.ID)))
+		return c.Blob(http.StatusOK, "application/pdf", report.PosReceiptPDF(sale))
+	}
+	return c.Blob(http.StatusOK, "text/plain; charset=utf-8", report.PosReceiptText(sale))
+}
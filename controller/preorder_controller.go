@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IPreOrderController interface {
+	CreatePreOrder(c echo.Context) error
+	GetOwnPreOrders(c echo.Context) error
+	CancelPreOrder(c echo.Context) error
+	RegisterArrival(c echo.Context) error
+}
+
+type preOrderController struct {
+	pu usecase.IPreOrderUsecase
+}
+
+func NewPreOrderController(pu usecase.IPreOrderUsecase) IPreOrderController {
+	return &preOrderController{pu}
+}
+
+func (pc *preOrderController) CreatePreOrder(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.PreOrderRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	preOrderRes, err := pc.pu.CreatePreOrder(userID, req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, preOrderRes)
+}
+
+func (pc *preOrderController) GetOwnPreOrders(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	preOrders, err := pc.pu.GetOwnPreOrders(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, preOrders)
+}
+
+func (pc *preOrderController) CancelPreOrder(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := pc.pu.CancelPreOrder(userID, uint(id)); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// スタッフが予約商品の入荷数を登録する
+// スタッフ用
+func (pc *preOrderController) RegisterArrival(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.PreOrderArrivalRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	recordID, _ := strconv.Atoi(c.Param("id"))
+	arrivalRes, err := pc.pu.RegisterArrival(staffID, uint(recordID), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, arrivalRes)
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IPromotionController interface {
+	CreatePromotion(c echo.Context) error
+	GetPromotionList(c echo.Context) error
+	Evaluate(c echo.Context) error
+}
+
+type promotionController struct {
+	pu usecase.IPromotionUsecase
+}
+
+func NewPromotionController(pu usecase.IPromotionUsecase) IPromotionController {
+	return &promotionController{pu}
+}
+
+func (pc *promotionController) CreatePromotion(c echo.Context) error {
+	promotion := model.Promotion{}
+	if err := c.Bind(&promotion); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	promotionRes, err := pc.pu.CreatePromotion(promotion)
+	if err != nil {
+		if promotionRes.Error != nil {
+			return c.JSON(http.StatusBadRequest, promotionRes.Error)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": err.Error()})
+	}
+	return c.JSON(http.StatusCreated, promotionRes)
+}
+
+func (pc *promotionController) GetPromotionList(c echo.Context) error {
+	promotions, err := pc.pu.GetPromotionList()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, promotions)
+}
+
+// カートの内容とクーポンコードを受取り、値引の内訳を返す(カート画面の表示用)
+func (pc *promotionController) Evaluate(c echo.Context) error {
+	req := model.PricingRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	pricingRes, err := pc.pu.Evaluate(req)
+	if err != nil {
+		if pricingRes.Error != nil {
+			return c.JSON(http.StatusBadRequest, pricingRes.Error)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": err.Error()})
+	}
+	return c.JSON(http.StatusOK, pricingRes)
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IReturnController interface {
+	CreateReturn(c echo.Context) error
+	GetOwnReturns(c echo.Context) error
+	GetOwnReturn(c echo.Context) error
+	GetPendingReturns(c echo.Context) error
+	Approve(c echo.Context) error
+	Reject(c echo.Context) error
+	Receive(c echo.Context) error
+}
+
+type returnController struct {
+	ru usecase.IReturnUsecase
+}
+
+func NewReturnController(ru usecase.IReturnUsecase) IReturnController {
+	return &returnController{ru}
+}
+
+func (rc *returnController) CreateReturn(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.ReturnCreateRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	returnRes, err := rc.ru.CreateReturn(userID, req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, returnRes)
+}
+
+func (rc *returnController) GetOwnReturns(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	returns, err := rc.ru.GetOwnReturns(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, returns)
+}
+
+func (rc *returnController) GetOwnReturn(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	returnRes, err := rc.ru.GetOwnReturn(userID, uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, returnRes)
+}
+
+func (rc *returnController) GetPendingReturns(c echo.Context) error {
+	returns, err := rc.ru.GetPendingReturns()
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, returns)
+}
+
+func (rc *returnController) Approve(c echo.Context) error {
+	return rc.decide(c, rc.ru.Approve)
+}
+
+func (rc *returnController) Reject(c echo.Context) error {
+	return rc.decide(c, rc.ru.Reject)
+}
+
+func (rc *returnController) Receive(c echo.Context) error {
+	return rc.decide(c, rc.ru.Receive)
+}
+
+// スタッフによる承認・却下・受領は、リクエストの形が同じなのでまとめる
+func (rc *returnController) decide(c echo.Context,
+	action func(staffID uint, id uint, req model.ReturnDecisionRequest) (model.ReturnRequest, error)) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.ReturnDecisionRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	returnRes, err := action(staffID, uint(id), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, returnRes)
+}
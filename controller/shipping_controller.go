@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IShippingController interface {
+	GetShippingMethods(c echo.Context) error
+	CreateShippingMethod(c echo.Context) error
+	CreateShippingRate(c echo.Context) error
+	Quote(c echo.Context) error
+	CreateShipment(c echo.Context) error
+	GetOwnShipments(c echo.Context) error
+	GetOwnShipment(c echo.Context) error
+	RecordShipmentEvent(c echo.Context) error
+}
+
+type shippingController struct {
+	su usecase.IShippingUsecase
+}
+
+func NewShippingController(su usecase.IShippingUsecase) IShippingController {
+	return &shippingController{su}
+}
+
+func (sc *shippingController) GetShippingMethods(c echo.Context) error {
+	methods, err := sc.su.GetShippingMethods()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, methods)
+}
+
+func (sc *shippingController) CreateShippingMethod(c echo.Context) error {
+	method := model.ShippingMethod{}
+	if err := c.Bind(&method); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	methodRes, err := sc.su.CreateShippingMethod(method)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, methodRes)
+}
+
+func (sc *shippingController) CreateShippingRate(c echo.Context) error {
+	rate := model.ShippingRate{}
+	if err := c.Bind(&rate); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	methodID, _ := strconv.Atoi(c.Param("id"))
+	rateRes, err := sc.su.CreateShippingRate(uint(methodID), rate)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, rateRes)
+}
+
+// チェックアウト画面で配送方法ごとの送料を表示するために使う
+func (sc *shippingController) Quote(c echo.Context) error {
+	req := model.ShippingQuoteRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	quoteRes, err := sc.su.Quote(req)
+	if err != nil {
+		if quoteRes.Error != nil {
+			return c.JSON(http.StatusBadRequest, quoteRes.Error)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": err.Error()})
+	}
+	return c.JSON(http.StatusOK, quoteRes)
+}
+
+func (sc *shippingController) CreateShipment(c echo.Context) error {
+	shipment := model.Shipment{}
+	if err := c.Bind(&shipment); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	shipmentRes, err := sc.su.CreateShipment(shipment)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, shipmentRes)
+}
+
+func (sc *shippingController) GetOwnShipments(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	shipments, err := sc.su.GetOwnShipments(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, shipments)
+}
+
+func (sc *shippingController) GetOwnShipment(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	shipmentRes, err := sc.su.GetOwnShipment(userID, uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, shipmentRes)
+}
+
+// スタッフが発送・配達完了などの配送状況を記録する
+func (sc *shippingController) RecordShipmentEvent(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.ShipmentEventRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	shipmentRes, err := sc.su.RecordShipmentEvent(userID, uint(id), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, shipmentRes)
+}
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ITaxController interface {
+	GetTaxRates(c echo.Context) error
+	UpdateTaxRate(c echo.Context) error
+	Calculate(c echo.Context) error
+}
+
+type taxController struct {
+	tu usecase.ITaxUsecase
+}
+
+func NewTaxController(tu usecase.ITaxUsecase) ITaxController {
+	return &taxController{tu}
+}
+
+func (tc *taxController) GetTaxRates(c echo.Context) error {
+	rates, err := tc.tu.GetTaxRates()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, err.Error())
+	}
+	return c.JSON(http.StatusOK, rates)
+}
+
+func (tc *taxController) UpdateTaxRate(c echo.Context) error {
+	rate := model.TaxRate{}
+	if err := c.Bind(&rate); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	// 区分はURLで指定する
+	rate.Category = c.Param("category")
+	rateRes, err := tc.tu.UpdateTaxRate(rate)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, rateRes)
+}
+
+func (tc *taxController) Calculate(c echo.Context) error {
+	req := model.TaxRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	taxRes, err := tc.tu.Calculate(req)
+	if err != nil {
+		if taxRes.Error != nil {
+			return c.JSON(http.StatusBadRequest, taxRes.Error)
+		}
+		return c.JSON(http.StatusInternalServerError, map[string]string{"message": err.Error()})
+	}
+	return c.JSON(http.StatusOK, taxRes)
+}
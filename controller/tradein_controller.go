@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type ITradeInController interface {
+	GetTradeInRules(c echo.Context) error
+	UpdateTradeInRule(c echo.Context) error
+	CreateQuote(c echo.Context) error
+	GetOwnQuotes(c echo.Context) error
+	GetOwnQuote(c echo.Context) error
+	GetPendingQuotes(c echo.Context) error
+	AdjustItem(c echo.Context) error
+	Accept(c echo.Context) error
+	Reject(c echo.Context) error
+}
+
+type tradeInController struct {
+	tu usecase.ITradeInUsecase
+}
+
+func NewTradeInController(tu usecase.ITradeInUsecase) ITradeInController {
+	return &tradeInController{tu}
+}
+
+func (tc *tradeInController) GetTradeInRules(c echo.Context) error {
+	rules, err := tc.tu.GetTradeInRules()
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, rules)
+}
+
+func (tc *tradeInController) UpdateTradeInRule(c echo.Context) error {
+	rule := model.TradeInRule{}
+	if err := c.Bind(&rule); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	// グレードはURLで指定する
+	rule.Grade = c.Param("grade")
+	ruleRes, err := tc.tu.UpdateTradeInRule(rule)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, ruleRes)
+}
+
+func (tc *tradeInController) CreateQuote(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.TradeInCreateRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	quoteRes, err := tc.tu.CreateQuote(userID, req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, quoteRes)
+}
+
+func (tc *tradeInController) GetOwnQuotes(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	quotes, err := tc.tu.GetOwnQuotes(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, quotes)
+}
+
+func (tc *tradeInController) GetOwnQuote(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	quoteRes, err := tc.tu.GetOwnQuote(userID, uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, quoteRes)
+}
+
+func (tc *tradeInController) GetPendingQuotes(c echo.Context) error {
+	quotes, err := tc.tu.GetPendingQuotes()
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, quotes)
+}
+
+func (tc *tradeInController) AdjustItem(c echo.Context) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.TradeInAdjustRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	itemID, _ := strconv.Atoi(c.Param("itemId"))
+	quoteRes, err := tc.tu.AdjustItem(staffID, uint(id), uint(itemID), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, quoteRes)
+}
+
+func (tc *tradeInController) Accept(c echo.Context) error {
+	return tc.decide(c, tc.tu.Accept)
+}
+
+func (tc *tradeInController) Reject(c echo.Context) error {
+	return tc.decide(c, tc.tu.Reject)
+}
+
+// 成立・不成立は、リクエストの形が同じなのでまとめる
+func (tc *tradeInController) decide(c echo.Context,
+	action func(staffID uint, id uint, req model.TradeInDecisionRequest) (model.TradeInQuote, error)) error {
+	staffID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.TradeInDecisionRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	quoteRes, err := action(staffID, uint(id), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, quoteRes)
+}
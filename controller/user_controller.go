@@ -1,20 +1,49 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
+	"net/url"
 	"os"
 	"record-shop-rest-api/model"
 	"record-shop-rest-api/usecase"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
 )
 
 type IUserControler interface {
 	SignUp(c echo.Context) error
 	LogIn(c echo.Context) error
 	LogOut(c echo.Context) error
+	Refresh(c echo.Context) error
+	LogOutAll(c echo.Context) error
+	RevokeUserTokens(c echo.Context) error
+	ParseToken(c echo.Context, auth string) (interface{}, error)
 	CsrfToken(c echo.Context) error
+	AssignRole(c echo.Context) error
+	VerifyEmail(c echo.Context) error
+	ResendVerification(c echo.Context) error
+	ForgotPassword(c echo.Context) error
+	ResetPassword(c echo.Context) error
+	LogInTwoFactor(c echo.Context) error
+	EnrollTwoFactor(c echo.Context) error
+	ConfirmTwoFactor(c echo.Context) error
+	DisableTwoFactor(c echo.Context) error
+	RegenerateRecoveryCodes(c echo.Context) error
+	GetTwoFactorPolicies(c echo.Context) error
+	SetTwoFactorPolicy(c echo.Context) error
+	OIDCLogin(c echo.Context) error
+	OIDCCallback(c echo.Context) error
+	OIDCLink(c echo.Context) error
+	GetOwnIdentities(c echo.Context) error
+	UnlinkIdentity(c echo.Context) error
+	GetMe(c echo.Context) error
+	ChangePassword(c echo.Context) error
+	ChangeEmail(c echo.Context) error
+	DeleteAccount(c echo.Context) error
 }
 
 type userController struct {
@@ -55,36 +84,433 @@ func (uc *userController) LogIn(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, err.Error())
 	}
 	// JWTを生成するので
-	tokenString, err := uc.uu.Login(user)
+	// 認証の失敗は理由に関わらず401、ロック中は429
+	result, err := uc.uu.Login(user, c.RealIP())
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, err.Error())
+		return errorJSON(c, err)
+	}
+	// 2段階認証が有効なユーザは、チャレンジをCookieに入れて/login/2faでコードを受取る
+	if result.TwoFactorRequired {
+		setCookie(c, loginChallengeCookie, result.Challenge, result.ChallengeExpiresAt)
+		return c.JSON(http.StatusOK, echo.Map{"two_factor_required": true, "expires_at": result.ChallengeExpiresAt})
+	}
+	setAuthCookies(c, result.Tokens)
+	// リクエストのUser(パスワードを含む)は返さない
+	return c.JSON(http.StatusCreated, result.User)
+}
+
+// Cookieを消すだけでなく、サーバ側でもトークンを失効させる(盗まれたトークンも使えなくなる)
+func (uc *userController) LogOut(c echo.Context) error {
+	err := uc.uu.Logout(cookieValue(c, accessTokenCookie), cookieValue(c, refreshTokenCookie))
+	setCookie(c, accessTokenCookie, "", time.Now())
+	setCookie(c, refreshTokenCookie, "", time.Now())
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// 全端末からのログアウト、自分の全てのトークンを失効させる
+func (uc *userController) LogOutAll(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	if err := uc.uu.RevokeAllTokens(userID, userID); err != nil {
+		return errorJSON(c, err)
+	}
+	setCookie(c, accessTokenCookie, "", time.Now())
+	setCookie(c, refreshTokenCookie, "", time.Now())
+	return c.NoContent(http.StatusOK)
+}
+
+// 管理者用、指定したユーザの全てのトークンを失効させる(アカウント乗っ取り時など)
+func (uc *userController) RevokeUserTokens(c echo.Context) error {
+	adminID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := uc.uu.RevokeAllTokens(adminID, uint(id)); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// echojwtのParseTokenFuncに渡す、戻り値のトークンが"user"キーに付与される
+func (uc *userController) ParseToken(c echo.Context, auth string) (interface{}, error) {
+	return uc.uu.ParseAccessToken(auth)
+}
+
+// アクセストークンの期限が切れたら、リフレッシュトークンのCookieで取り直す
+// JWTは期限切れでもよいのでjwtAuthは適用しない、POSTなのでCSRFトークンは必要
+func (uc *userController) Refresh(c echo.Context) error {
+	tokens, err := uc.uu.Refresh(cookieValue(c, refreshTokenCookie))
+	if err != nil {
+		// 無効なリフレッシュトークンは残しておいても使えないので消す
+		if errors.Is(err, usecase.ErrUnauthorized) {
+			setCookie(c, accessTokenCookie, "", time.Now())
+			setCookie(c, refreshTokenCookie, "", time.Now())
+		}
+		return errorJSON(c, err)
 	}
-	// JWTをサーバーサイドでCookieに設定
-	// logoutでもNewしているが名前が同じならブラウザは同じものを見る
+	setAuthCookies(c, tokens)
+	return c.NoContent(http.StatusOK)
+}
+
+const (
+	accessTokenCookie    = "token"
+	refreshTokenCookie   = "refresh_token"
+	loginChallengeCookie = "login_challenge"
+	oidcStateCookie      = "oidc_state"
+)
+
+// Cookieが無い場合は空文字
+func cookieValue(c echo.Context, name string) string {
+	if cookie, err := c.Cookie(name); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+// アクセストークンとリフレッシュトークンをそれぞれの有効期限でCookieに設定
+func setAuthCookies(c echo.Context, tokens model.AuthTokens) {
+	setCookie(c, accessTokenCookie, tokens.AccessToken, tokens.AccessExpiresAt)
+	setCookie(c, refreshTokenCookie, tokens.RefreshToken, tokens.RefreshExpiresAt)
+}
+
+// JWTをサーバーサイドでCookieに設定、値を空にして期限を現在にすると削除になる
+// logoutでも同じ名前で設定するので、ブラウザは同じものを見る
+func setCookie(c echo.Context, name string, value string, expires time.Time) {
 	cookie := new(http.Cookie)
-	cookie.Name = "token"
-	cookie.Value = tokenString
-	cookie.Expires = time.Now().Add(24 * time.Hour)
+	cookie.Name = name
+	cookie.Value = value
+	cookie.Expires = expires
 	cookie.Path = "/" // この生成したCookieは"/"パス以下、つまり全てのリクエストで送信"
 	cookie.Domain = os.Getenv("API_DOMAIN")
 	cookie.Secure = true                    // trueにしておく必要があるが、いったんPOSTMANで確認したいのでコメントアウト
 	cookie.HttpOnly = true                  // クライアントのJSからTokenの値が読み取れないように
 	cookie.SameSite = http.SameSiteNoneMode // frontendとbackendのdomainが違うクロスドメイン間のCookie送受信になるので、クロスサイト・スクリプティング攻撃やセッションハイジャックなどのリスクを軽減
 	c.SetCookie(cookie)                     // 上で設定したCookieをHTTPレスポンスに含める
-	// return c.NoContent(http.StatusOK)
-	return c.JSON(http.StatusCreated, user)
 }
 
-func (uc *userController) LogOut(c echo.Context) error {
-	cookie := new(http.Cookie)
-	cookie.Name = "token"
-	cookie.Value = ""           // 値をクリア
-	cookie.Expires = time.Now() // 有効期限がすぐ切れるように
-	cookie.Path = "/"
-	cookie.Domain = os.Getenv("API_DOMAIN")
-	cookie.Secure = true // trueにしておく必要があるが、いったんPOSTMANで確認したいのでコメントアウト
-	cookie.HttpOnly = true
-	cookie.SameSite = http.SameSiteNoneMode
-	c.SetCookie(cookie)
+// 管理者用
+func (uc *userController) AssignRole(c echo.Context) error {
+	adminID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	req := model.RoleRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	userRes, err := uc.uu.AssignRole(adminID, uint(id), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, userRes)
+}
+
+// 確認メールのリンクから開いたフロントエンドの画面が、リンクのトークンを送ってくる
+func (uc *userController) VerifyEmail(c echo.Context) error {
+	req := model.EmailVerificationRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := uc.uu.VerifyEmail(req); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+func (uc *userController) ResendVerification(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	if err := uc.uu.ResendVerification(userID); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+// 登録済みのアドレスかどうかに関わらず200を返す(アカウントの有無を調べられないように)
+func (uc *userController) ForgotPassword(c echo.Context) error {
+	req := model.PasswordForgotRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := uc.uu.ForgotPassword(req); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, echo.Map{"message": "If the address is registered, a reset link has been sent."})
+}
+
+func (uc *userController) ResetPassword(c echo.Context) error {
+	req := model.PasswordResetRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := uc.uu.ResetPassword(req); err != nil {
+		return errorJSON(c, err)
+	}
 	return c.NoContent(http.StatusOK)
 }
+
+// 2段階目のログイン、認証アプリのコードかリカバリーコードを受取る
+func (uc *userController) LogInTwoFactor(c echo.Context) error {
+	req := model.LoginTwoFactorRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	tokens, err := uc.uu.LoginTwoFactor(cookieValue(c, loginChallengeCookie), req, c.RealIP())
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	setCookie(c, loginChallengeCookie, "", time.Now())
+	setAuthCookies(c, tokens)
+	return c.NoContent(http.StatusOK)
+}
+
+func (uc *userController) EnrollTwoFactor(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	enrollment, err := uc.uu.EnrollTwoFactor(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, enrollment)
+}
+
+// 有効にしたら、2段階認証を済ませたセッションのトークンに入替える
+func (uc *userController) ConfirmTwoFactor(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.TwoFactorCodeRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	codes, tokens, err := uc.uu.ConfirmTwoFactor(userID, req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	setAuthCookies(c, tokens)
+	return c.JSON(http.StatusOK, codes)
+}
+
+func (uc *userController) DisableTwoFactor(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.LoginTwoFactorRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := uc.uu.DisableTwoFactor(userID, req); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (uc *userController) RegenerateRecoveryCodes(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.TwoFactorCodeRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	codes, err := uc.uu.RegenerateRecoveryCodes(userID, req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, codes)
+}
+
+// 管理者用
+func (uc *userController) GetTwoFactorPolicies(c echo.Context) error {
+	policies, err := uc.uu.GetTwoFactorPolicies()
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, policies)
+}
+
+// 管理者用
+func (uc *userController) SetTwoFactorPolicy(c echo.Context) error {
+	adminID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.TwoFactorPolicyRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	policy, err := uc.uu.SetTwoFactorPolicy(adminID, c.Param("role"), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, policy)
+}
+
+// 外部のIDプロバイダでのログイン、認可画面へリダイレクトする
+// login_hint: 省略可、プロバイダのログイン画面のメールアドレス欄に入る
+func (uc *userController) OIDCLogin(c echo.Context) error {
+	authURL, state, err := uc.uu.StartOIDCLogin(c.Param("provider"), c.QueryParam("login_hint"))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	setCookie(c, oidcStateCookie, state, time.Now().Add(10*time.Minute))
+	return c.Redirect(http.StatusFound, authURL)
+}
+
+// IDプロバイダからのリダイレクト先、ブラウザの遷移なので結果はフロントエンドへのリダイレクトで返す
+// 成功: FE_URL/、2段階認証が必要: FE_URL/login/2fa、紐付け: FE_URL/settings/accounts
+// 失敗: FE_URL/login?error=<理由>&message=<説明>
+func (uc *userController) OIDCCallback(c echo.Context) error {
+	provider := c.Param("provider")
+	stateCookie := cookieValue(c, oidcStateCookie)
+	setCookie(c, oidcStateCookie, "", time.Now())
+	feURL := os.Getenv("FE_URL")
+	// 利用者が認可画面でキャンセルした場合など
+	if reason := c.QueryParam("error"); reason != "" {
+		return c.Redirect(http.StatusFound, feURL+"/login?"+url.Values{"error": {reason}}.Encode())
+	}
+	result, err := uc.uu.CompleteOIDCLogin(provider, c.QueryParam("code"), c.QueryParam("state"), stateCookie, c.RealIP())
+	if err != nil {
+		q := url.Values{}
+		switch {
+		case errors.Is(err, usecase.ErrUnauthorized):
+			q.Set("error", "login_failed")
+			q.Set("message", err.Error())
+		case errors.Is(err, usecase.ErrInvalidState):
+			q.Set("error", "account_conflict")
+			q.Set("message", err.Error())
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			q.Set("error", "unknown_provider")
+		default:
+			c.Logger().Error(err)
+			q.Set("error", "server_error")
+		}
+		return c.Redirect(http.StatusFound, feURL+"/login?"+q.Encode())
+	}
+	if result.Linked {
+		return c.Redirect(http.StatusFound, feURL+"/settings/accounts?"+url.Values{"linked": {provider}}.Encode())
+	}
+	if result.Login.TwoFactorRequired {
+		setCookie(c, loginChallengeCookie, result.Login.Challenge, result.Login.ChallengeExpiresAt)
+		return c.Redirect(http.StatusFound, feURL+"/login/2fa")
+	}
+	setAuthCookies(c, result.Login.Tokens)
+	return c.Redirect(http.StatusFound, feURL+"/")
+}
+
+// ログイン中の利用者のアカウントにIDプロバイダのアカウントを紐付ける
+// POSTなのでCSRFトークンが必要、返したURLへフロントエンドから遷移させる
+func (uc *userController) OIDCLink(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	authURL, state, err := uc.uu.StartOIDCLink(userID, c.Param("provider"))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	setCookie(c, oidcStateCookie, state, time.Now().Add(10*time.Minute))
+	return c.JSON(http.StatusOK, model.OIDCAuthorizationResponse{AuthorizationURL: authURL})
+}
+
+func (uc *userController) GetOwnIdentities(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	identities, err := uc.uu.GetOwnIdentities(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, identities)
+}
+
+func (uc *userController) UnlinkIdentity(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := uc.uu.UnlinkIdentity(userID, uint(id), c.RealIP()); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// ログイン中のユーザ自身の情報
+func (uc *userController) GetMe(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	userRes, err := uc.uu.GetMe(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, userRes)
+}
+
+// 全端末のトークンが失効するので、Cookieも消してログインし直してもらう
+func (uc *userController) ChangePassword(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.ChangePasswordRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := uc.uu.ChangePassword(userID, req); err != nil {
+		return errorJSON(c, err)
+	}
+	setCookie(c, accessTokenCookie, "", time.Now())
+	setCookie(c, refreshTokenCookie, "", time.Now())
+	return c.NoContent(http.StatusNoContent)
+}
+
+// 新しいアドレスに確認リンクを送る、変更はリンクを開いた時(/email/verify)
+func (uc *userController) ChangeEmail(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.ChangeEmailRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := uc.uu.ChangeEmail(userID, req); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusAccepted)
+}
+
+func (uc *userController) DeleteAccount(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	req := model.DeleteAccountRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	if err := uc.uu.DeleteAccount(userID, req); err != nil {
+		return errorJSON(c, err)
+	}
+	setCookie(c, accessTokenCookie, "", time.Now())
+	setCookie(c, refreshTokenCookie, "", time.Now())
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IWantListController interface {
+	CreateEntry(c echo.Context) error
+	GetOwnEntries(c echo.Context) error
+	DeleteEntry(c echo.Context) error
+}
+
+type wantListController struct {
+	wu usecase.IWantListUsecase
+}
+
+func NewWantListController(wu usecase.IWantListUsecase) IWantListController {
+	return &wantListController{wu}
+}
+
+func (wc *wantListController) CreateEntry(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	entry := model.WantListEntry{}
+	if err := c.Bind(&entry); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	entryRes, err := wc.wu.CreateEntry(userID, entry)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, entryRes)
+}
+
+func (wc *wantListController) GetOwnEntries(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	entries, err := wc.wu.GetOwnEntries(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+func (wc *wantListController) DeleteEntry(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := wc.wu.DeleteEntry(userID, uint(id)); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
@@ -0,0 +1,203 @@
+package controller
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/usecase"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type IWishlistController interface {
+	CreateWishlist(c echo.Context) error
+	GetOwnWishlists(c echo.Context) error
+	GetOwnWishlist(c echo.Context) error
+	RenameWishlist(c echo.Context) error
+	DeleteWishlist(c echo.Context) error
+	AddItem(c echo.Context) error
+	UpdateItemNote(c echo.Context) error
+	DeleteItem(c echo.Context) error
+	ReorderItems(c echo.Context) error
+	Share(c echo.Context) error
+	Unshare(c echo.Context) error
+	GetSharedWishlist(c echo.Context) error
+}
+
+type wishlistController struct {
+	wu usecase.IWishlistUsecase
+}
+
+func NewWishlistController(wu usecase.IWishlistUsecase) IWishlistController {
+	return &wishlistController{wu}
+}
+
+func (wc *wishlistController) CreateWishlist(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	wishlist := model.Wishlist{}
+	if err := c.Bind(&wishlist); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	wishlistRes, err := wc.wu.CreateWishlist(userID, wishlist)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, wishlistRes)
+}
+
+func (wc *wishlistController) GetOwnWishlists(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	wishlists, err := wc.wu.GetOwnWishlists(userID)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, wishlists)
+}
+
+func (wc *wishlistController) GetOwnWishlist(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	wishlistRes, err := wc.wu.GetOwnWishlist(userID, uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, wishlistRes)
+}
+
+func (wc *wishlistController) RenameWishlist(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	wishlist := model.Wishlist{}
+	if err := c.Bind(&wishlist); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	wishlistRes, err := wc.wu.RenameWishlist(userID, uint(id), wishlist)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, wishlistRes)
+}
+
+func (wc *wishlistController) DeleteWishlist(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	if err := wc.wu.DeleteWishlist(userID, uint(id)); err != nil {
+		return errorJSON(c, err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+func (wc *wishlistController) AddItem(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	req := model.WishlistItemRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	wishlistRes, err := wc.wu.AddItem(userID, uint(id), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusCreated, wishlistRes)
+}
+
+func (wc *wishlistController) UpdateItemNote(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	itemID, _ := strconv.Atoi(c.Param("itemId"))
+	req := model.WishlistItemRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	wishlistRes, err := wc.wu.UpdateItemNote(userID, uint(id), uint(itemID), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, wishlistRes)
+}
+
+func (wc *wishlistController) DeleteItem(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	itemID, _ := strconv.Atoi(c.Param("itemId"))
+	wishlistRes, err := wc.wu.DeleteItem(userID, uint(id), uint(itemID))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, wishlistRes)
+}
+
+func (wc *wishlistController) ReorderItems(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	req := model.WishlistReorderRequest{}
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, err.Error())
+	}
+	wishlistRes, err := wc.wu.ReorderItems(userID, uint(id), req)
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, wishlistRes)
+}
+
+func (wc *wishlistController) Share(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	wishlistRes, err := wc.wu.Share(userID, uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, wishlistRes)
+}
+
+func (wc *wishlistController) Unshare(c echo.Context) error {
+	userID, err := userIDFromToken(c)
+	if err != nil {
+		return c.JSON(http.StatusUnauthorized, "Unauthorized")
+	}
+	id, _ := strconv.Atoi(c.Param("id"))
+	wishlistRes, err := wc.wu.Unshare(userID, uint(id))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, wishlistRes)
+}
+
+func (wc *wishlistController) GetSharedWishlist(c echo.Context) error {
+	wishlistRes, err := wc.wu.GetSharedWishlist(c.Param("token"))
+	if err != nil {
+		return errorJSON(c, err)
+	}
+	return c.JSON(http.StatusOK, wishlistRes)
+}
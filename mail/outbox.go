@@ -0,0 +1,42 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type outboxSender struct {
+	dir  string
+	from string
+	mu   sync.Mutex
+	seq  int
+}
+
+// ローカル確認用、SMTPサーバを立てずに送信内容を1通1ファイル(.eml)でdirに書出す
+func NewOutboxSender(dir string, from string) IMailSender {
+	return &outboxSender{dir: dir, from: from}
+}
+
+func (ob *outboxSender) Send(to string, subject string, body string) error {
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+	if err := os.MkdirAll(ob.dir, 0o755); err != nil {
+		return err
+	}
+	// 同じ時刻に複数送っても上書きしないように連番を付ける
+	ob.mu.Lock()
+	ob.seq++
+	name := fmt.Sprintf("%s-%04d.eml", time.Now().Format("20060102T150405.000"), ob.seq)
+	ob.mu.Unlock()
+	msg := "From: " + ob.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"Date: " + time.Now().Format(time.RFC1123Z) + "\r\n" +
+		"\r\n" + body
+	return os.WriteFile(filepath.Join(ob.dir, name), []byte(msg), 0o644)
+}
@@ -0,0 +1,36 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+	"strings"
+)
+
+// メール送信の抽象
+type IMailSender interface {
+	Send(to string, subject string, body string) error
+}
+
+type smtpSender struct {
+	addr string
+	from string
+}
+
+// ローカルではMailHog等のSMTPサーバの代役(localhost:1025)に送る想定なので、認証は行わない
+func NewSMTPSender(addr string, from string) IMailSender {
+	return &smtpSender{addr, from}
+}
+
+func (ss *smtpSender) Send(to string, subject string, body string) error {
+	// ヘッダインジェクションを防ぐため改行を含む宛先・件名は拒否
+	if strings.ContainsAny(to, "\r\n") || strings.ContainsAny(subject, "\r\n") {
+		return fmt.Errorf("invalid mail header")
+	}
+	msg := "From: " + ss.from + "\r\n" +
+		"To: " + to + "\r\n" +
+		"Subject: " + subject + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + body
+	return smtp.SendMail(ss.addr, nil, ss.from, []string{to}, []byte(msg))
+}
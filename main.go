@@ -1,12 +1,20 @@
 package main
 
 import (
+	"log"
+	"net/http"
+	"os"
 	"record-shop-rest-api/controller"
 	"record-shop-rest-api/db"
+	"record-shop-rest-api/mail"
+	"record-shop-rest-api/notification"
+	"record-shop-rest-api/oidc"
+	"record-shop-rest-api/payment"
 	"record-shop-rest-api/repository"
 	"record-shop-rest-api/router"
 	"record-shop-rest-api/usecase"
 	"record-shop-rest-api/validator"
+	"time"
 )
 
 // $env:GO_ENV="dev"; go run main.go
@@ -16,14 +24,151 @@ func main() {
 	db := db.NewDB()
 	userValidator := validator.NewUserValidator()
 	recordValidator := validator.NewRecordValidator()
+	paymentValidator := validator.NewPaymentValidator()
+	promotionValidator := validator.NewPromotionValidator()
+	taxValidator := validator.NewTaxValidator()
+	shippingValidator := validator.NewShippingValidator()
+	returnValidator := validator.NewReturnValidator()
+	preOrderValidator := validator.NewPreOrderValidator()
+	wantListValidator := validator.NewWantListValidator()
+	wishlistValidator := validator.NewWishlistValidator()
+	tradeInValidator := validator.NewTradeInValidator()
+	consignmentValidator := validator.NewConsignmentValidator()
+	inventoryValidator := validator.NewInventoryValidator()
+	giftCardValidator := validator.NewGiftCardValidator()
+	loyaltyValidator := validator.NewLoyaltyValidator()
+	posValidator := validator.NewPosValidator()
+	auctionValidator := validator.NewAuctionValidator()
+	apiKeyValidator := validator.NewAPIKeyValidator()
+	orderValidator := validator.NewOrderValidator()
 	userRepository := repository.NewUserRepository(db)
 	recordRepository := repository.NewRecordRepository(db)
-	userUsecase := usecase.NewUserUsecase(userRepository, userValidator)
+	paymentRepository := repository.NewPaymentRepository(db)
+	promotionRepository := repository.NewPromotionRepository(db)
+	taxRepository := repository.NewTaxRepository(db)
+	shippingRepository := repository.NewShippingRepository(db)
+	returnRepository := repository.NewReturnRepository(db)
+	preOrderRepository := repository.NewPreOrderRepository(db)
+	wantListRepository := repository.NewWantListRepository(db)
+	notificationRepository := repository.NewNotificationRepository(db)
+	wishlistRepository := repository.NewWishlistRepository(db)
+	tradeInRepository := repository.NewTradeInRepository(db)
+	consignmentRepository := repository.NewConsignmentRepository(db)
+	inventoryRepository := repository.NewInventoryRepository(db)
+	giftCardRepository := repository.NewGiftCardRepository(db)
+	tokenRepository := repository.NewTokenRepository(db)
+	securityRepository := repository.NewSecurityRepository(db)
+	twoFactorRepository := repository.NewTwoFactorRepository(db)
+	apiKeyRepository := repository.NewAPIKeyRepository(db)
+	identityRepository := repository.NewIdentityRepository(db)
+	loyaltyRepository := repository.NewLoyaltyRepository(db)
+	posRepository := repository.NewPosRepository(db)
+	auctionRepository := repository.NewAuctionRepository(db)
+	orderRepository := repository.NewOrderRepository(db)
+	// ローカルではSMTP_ADDRにMailHog等の代役(localhost:1025)を立てておく
+	// MAIL_OUTBOX_DIRを設定した場合はSMTPを使わず、そのディレクトリにファイルで書出す
+	mailSender := mail.NewSMTPSender(os.Getenv("SMTP_ADDR"), os.Getenv("MAIL_FROM"))
+	if dir := os.Getenv("MAIL_OUTBOX_DIR"); dir != "" {
+		mailSender = mail.NewOutboxSender(dir, os.Getenv("MAIL_FROM"))
+	}
+	notifiers := []notification.INotifier{
+		notification.NewInAppNotifier(notificationRepository),
+		notification.NewEmailNotifier(mailSender),
+	}
+	// 本番プロバイダ導入まではプロセス内の偽プロバイダを使う
+	// webhookの署名の鍵が無いと誰でも決済を確定済みにできるので、未設定なら起動しない
+	webhookSecret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		log.Fatal("PAYMENT_WEBHOOK_SECRET is not set; refusing to accept unsigned payment webhooks")
+	}
+	paymentProvider := payment.NewFakePaymentProvider(webhookSecret, 5*time.Second)
+	// 外部のIDプロバイダ、クライアントIDを設定したものだけ有効にする
+	// コールバックのURLは API_URL/auth/<名前>/callback をプロバイダ側にも登録しておく
+	oidcProviders := map[string]oidc.IProvider{}
+	callbackURL := func(name string) string {
+		return os.Getenv("API_URL") + "/auth/" + name + "/callback"
+	}
+	if id := os.Getenv("OIDC_GOOGLE_CLIENT_ID"); id != "" {
+		oidcProviders["google"] = oidc.NewGoogleProvider(id, os.Getenv("OIDC_GOOGLE_CLIENT_SECRET"), callbackURL("google"))
+	}
+	if id := os.Getenv("OIDC_LINE_CHANNEL_ID"); id != "" {
+		oidcProviders["line"] = oidc.NewLineProvider(id, os.Getenv("OIDC_LINE_CHANNEL_SECRET"), callbackURL("line"))
+	}
+	// ローカル確認用、OIDC_MOCK_ADDRを設定するとモックのIDプロバイダをそのアドレスで起動する
+	// 誰でも任意のメールアドレスでログインできてしまうので、開発モード以外では起動しない
+	if addr := os.Getenv("OIDC_MOCK_ADDR"); addr != "" {
+		if os.Getenv("GO_ENV") != "dev" {
+			log.Fatal("OIDC_MOCK_ADDR is set but GO_ENV is not dev; refusing to start the mock identity provider")
+		}
+		mockIdP, err := oidc.NewMockIdentityProvider("http://"+addr, "record-shop", "mock-secret")
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			log.Fatal(http.ListenAndServe(addr, mockIdP))
+		}()
+		oidcProviders["mock"] = mockIdP.Provider(callbackURL("mock"))
+	}
+	userUsecase := usecase.NewUserUsecase(userRepository, userValidator, tokenRepository, mailSender, securityRepository,
+		twoFactorRepository, identityRepository, oidcProviders)
 	recordUsecase := usecase.NewRecordUsecase(recordRepository, recordValidator)
+	loyaltyUsecase := usecase.NewLoyaltyUsecase(loyaltyRepository, loyaltyValidator, paymentRepository, recordRepository,
+		returnRepository, posRepository, orderRepository)
+	paymentUsecase := usecase.NewPaymentUsecase(paymentRepository, paymentValidator, paymentProvider, orderRepository, loyaltyUsecase)
+	promotionUsecase := usecase.NewPromotionUsecase(promotionRepository, promotionValidator)
+	taxUsecase := usecase.NewTaxUsecase(taxRepository, taxValidator)
+	shippingUsecase := usecase.NewShippingUsecase(shippingRepository, shippingValidator)
+	notificationUsecase := usecase.NewNotificationUsecase(notificationRepository, userRepository, notifiers)
+	wantListUsecase := usecase.NewWantListUsecase(wantListRepository, wantListValidator, recordRepository, notificationUsecase)
+	wantListUsecase.StartMatcher()
+	giftCardUsecase := usecase.NewGiftCardUsecase(giftCardRepository, giftCardValidator)
+	inventoryUsecase := usecase.NewInventoryUsecase(inventoryRepository, inventoryValidator, recordRepository, wantListUsecase)
+	returnUsecase := usecase.NewReturnUsecase(returnRepository, returnValidator, paymentRepository, orderRepository, paymentUsecase, inventoryUsecase,
+		loyaltyUsecase, giftCardUsecase)
+	preOrderUsecase := usecase.NewPreOrderUsecase(preOrderRepository, preOrderValidator, recordRepository, paymentRepository, paymentUsecase,
+		inventoryRepository, wantListUsecase)
+	wishlistUsecase := usecase.NewWishlistUsecase(wishlistRepository, wishlistValidator, recordRepository)
+	tradeInUsecase := usecase.NewTradeInUsecase(tradeInRepository, tradeInValidator, recordRepository, inventoryUsecase, giftCardUsecase)
+	consignmentUsecase := usecase.NewConsignmentUsecase(consignmentRepository, consignmentValidator, recordRepository)
+	posUsecase := usecase.NewPosUsecase(posRepository, posValidator, recordRepository, inventoryUsecase, paymentUsecase, giftCardUsecase,
+		promotionUsecase, userRepository, loyaltyUsecase, taxUsecase, consignmentUsecase)
+	auctionUsecase := usecase.NewAuctionUsecase(auctionRepository, auctionValidator, recordRepository, inventoryUsecase, paymentUsecase, notificationUsecase, orderRepository)
+	apiKeyUsecase := usecase.NewAPIKeyUsecase(apiKeyRepository, apiKeyValidator, twoFactorRepository)
+	orderUsecase := usecase.NewOrderUsecase(orderRepository, orderValidator, posRepository, recordRepository, loyaltyUsecase)
+	// 入荷した予約商品を1分ごとに先着順で引当てる
+	preOrderUsecase.StartAllocationJob(time.Minute)
+	// 有効期限切れのポイントを1時間ごとに失効させる
+	loyaltyUsecase.StartExpiryJob(time.Hour)
+	// 終了時刻を過ぎたオークションの締めと、支払期限を過ぎた落札の繰上げを1分ごとに行う
+	auctionUsecase.StartCloseJob(time.Minute)
+	// 非同期確定(tok_async)のwebhookを偽プロバイダから直接usecaseへ届ける
+	paymentProvider.SetWebhookHandler(paymentUsecase.HandleWebhook)
 	userController := controller.NewUserController(userUsecase)
 	recordController := controller.NewRecordController(recordUsecase)
+	paymentController := controller.NewPaymentController(paymentUsecase)
+	promotionController := controller.NewPromotionController(promotionUsecase)
+	taxController := controller.NewTaxController(taxUsecase)
+	shippingController := controller.NewShippingController(shippingUsecase)
+	returnController := controller.NewReturnController(returnUsecase)
+	preOrderController := controller.NewPreOrderController(preOrderUsecase)
+	wantListController := controller.NewWantListController(wantListUsecase)
+	notificationController := controller.NewNotificationController(notificationUsecase)
+	wishlistController := controller.NewWishlistController(wishlistUsecase)
+	tradeInController := controller.NewTradeInController(tradeInUsecase)
+	consignmentController := controller.NewConsignmentController(consignmentUsecase)
+	inventoryController := controller.NewInventoryController(inventoryUsecase)
+	giftCardController := controller.NewGiftCardController(giftCardUsecase)
+	loyaltyController := controller.NewLoyaltyController(loyaltyUsecase)
+	posController := controller.NewPosController(posUsecase)
+	auctionController := controller.NewAuctionController(auctionUsecase)
+	apiKeyController := controller.NewAPIKeyController(apiKeyUsecase)
+	orderController := controller.NewOrderController(orderUsecase)
 
-	e := router.NewRouter(userController, recordController)
+	e := router.NewRouter(userController, recordController, paymentController, promotionController, taxController,
+		shippingController, returnController, preOrderController,
+		wantListController, notificationController, wishlistController, tradeInController, consignmentController,
+		inventoryController, giftCardController, loyaltyController, posController, auctionController,
+		apiKeyController, orderController)
 	// server起動
 	// error発生時、log出力して終了
 	e.Logger.Fatal(e.Start(":8080"))
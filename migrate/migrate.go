@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"log"
+	"os"
 	"record-shop-rest-api/db"
 	"record-shop-rest-api/model"
 )
@@ -13,7 +14,27 @@ func main() {
 	defer db.CloseDB(dbConn)
 	// DBに反映させたいModel構造を渡す
 	// {}でフィールドの値を0値にしている
-	err := dbConn.AutoMigrate(&model.User{}, &model.Record{}, &model.Detail{}, &model.Track{})
+	err := dbConn.AutoMigrate(&model.User{}, &model.Record{}, &model.Detail{}, &model.Track{},
+		&model.Order{}, &model.OrderLine{},
+		&model.Payment{}, &model.PaymentEvent{}, &model.Promotion{}, &model.PromotionRedemption{}, &model.TaxRate{},
+		&model.ShippingMethod{}, &model.ShippingRate{}, &model.Shipment{}, &model.ShipmentEvent{},
+		&model.ReturnRequest{}, &model.ReturnPhoto{}, &model.ReturnEvent{},
+		&model.PreOrder{}, &model.PreOrderArrival{},
+		&model.WantListEntry{}, &model.Notification{},
+		&model.Wishlist{}, &model.WishlistItem{},
+		&model.TradeInRule{}, &model.TradeInQuote{}, &model.TradeInItem{},
+		&model.Consignor{}, &model.ConsignmentItem{}, &model.ConsignmentLedgerEntry{},
+		&model.Location{}, &model.StockLevel{}, &model.StockMovement{}, &model.TransferOrder{}, &model.TransferOrderItem{},
+		&model.GiftCard{}, &model.GiftCardTransaction{}, &model.StoreCreditAccount{}, &model.StoreCreditTransaction{},
+		&model.LoyaltyRule{}, &model.PointAccount{}, &model.PointTransaction{},
+		&model.PosItem{}, &model.PosSale{}, &model.PosSaleLine{}, &model.PosSaleDiscount{}, &model.PosSaleTax{}, &model.PosReturn{},
+		&model.AuctionListing{}, &model.AuctionBid{}, &model.AuctionOffer{},
+		&model.RefreshToken{}, &model.RevokedToken{}, &model.UserTokenRevocation{},
+		&model.EmailVerificationToken{}, &model.PasswordResetToken{},
+		&model.LoginThrottle{}, &model.SecurityEvent{},
+		&model.TwoFactor{}, &model.RecoveryCode{}, &model.LoginChallenge{}, &model.TwoFactorPolicy{},
+		&model.APIKey{},
+		&model.UserIdentity{}, &model.OIDCLoginState{})
 	if err != nil {
 		log.Fatalf("failed to migrate database: %v", err)
 	}
@@ -26,4 +47,41 @@ func main() {
 	if err != nil {
 		log.Fatalf("failed to add default timestamps: %v", err)
 	}
+
+	// 消費税率の初期値(標準10%、軽減8%)、既に設定済みの場合は変更しない
+	err = dbConn.Exec(`
+		INSERT INTO tax_rates (category, percent, created_at)
+		VALUES ('standard', 10, CURRENT_TIMESTAMP), ('reduced', 8, CURRENT_TIMESTAMP)
+		ON CONFLICT (category) DO NOTHING;
+	`).Error
+	if err != nil {
+		log.Fatalf("failed to seed tax rates: %v", err)
+	}
+
+	// 買取ルールの初期値、在庫5枚以上は2割減、既に設定済みの場合は変更しない
+	err = dbConn.Exec(`
+		INSERT INTO trade_in_rules (grade, cash_percent, credit_percent, overstock_threshold, overstock_cut_percent, created_at)
+		VALUES
+			('M', 50, 65, 5, 20, CURRENT_TIMESTAMP),
+			('NM', 45, 60, 5, 20, CURRENT_TIMESTAMP),
+			('VG+', 35, 50, 5, 20, CURRENT_TIMESTAMP),
+			('VG', 25, 35, 5, 20, CURRENT_TIMESTAMP),
+			('G+', 15, 20, 5, 20, CURRENT_TIMESTAMP),
+			('G', 10, 15, 5, 20, CURRENT_TIMESTAMP),
+			('F', 0, 5, 0, 0, CURRENT_TIMESTAMP),
+			('P', 0, 0, 0, 0, CURRENT_TIMESTAMP)
+		ON CONFLICT (grade) DO NOTHING;
+	`).Error
+	if err != nil {
+		log.Fatalf("failed to seed trade-in rules: %v", err)
+	}
+
+	// ADMIN_EMAILのユーザを管理者にする、最初の管理者の登録用(以降は管理者が/admin/users/:id/roleで割当てる)
+	// 運用者が指定したアドレスなので、メールアドレスも確認済みにする
+	if email := os.Getenv("ADMIN_EMAIL"); email != "" {
+		if err := dbConn.Model(&model.User{}).Where("email=?", email).
+			Updates(map[string]interface{}{"role": model.RoleAdmin, "email_verified": true}).Error; err != nil {
+			log.Fatalf("failed to grant admin role: %v", err)
+		}
+	}
 }
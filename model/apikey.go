@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+// APIキーのスコープ、キーで呼べる操作を限定する(さらに発行したユーザのロールの権限も必要)
+const (
+	ScopeRecordsRead    = "records:read"
+	ScopeRecordsWrite   = "records:write"
+	ScopeInventoryWrite = "inventory:write"
+)
+
+// キーの先頭に付ける目印、Authorizationヘッダの値がこれで始まればAPIキーとして扱う
+const APIKeyPrefix = "rsk_"
+
+// スクリプト等のためのAPIキー、CookieとCSRFトークンの代わりにAuthorizationヘッダで認証する
+// DBにはキー全体のハッシュと、一覧で見分けるための先頭部分(Prefix)のみ保存する
+// Scopes: スペース区切り
+// MFA: 2段階認証を済ませたセッションで作成したキーか、ロールの設定で2段階認証が必須なら済ませていないキーは読取りのみ
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	Name       string     `json:"name" gorm:"not null"`
+	Prefix     string     `json:"prefix" gorm:"not null;index"`
+	KeyHash    string     `json:"-" gorm:"not null;uniqueIndex"`
+	Scopes     string     `json:"scopes" gorm:"not null"`
+	MFA        bool       `json:"mfa" gorm:"not null;default:false"`
+	ExpiresAt  *time.Time `json:"expires_at" gorm:"default:null"`
+	LastUsedAt *time.Time `json:"last_used_at" gorm:"default:null"`
+	RevokedAt  *time.Time `json:"revoked_at" gorm:"default:null"`
+	CreatedAt  time.Time  `json:"created_at" gorm:"not null"`
+	User       User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// ExpiresAt: 省略すると無期限
+type APIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKeyResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	MFA        bool       `json:"mfa"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// 作成時のみキー全体を返す(以降は再表示できない)
+type APIKeyCreatedResponse struct {
+	APIKeyResponse
+	Key string `json:"key"`
+}
@@ -0,0 +1,115 @@
+package model
+
+import "time"
+
+// 出品の形式
+const (
+	ListingAuction   = "auction"    // 期限付きのオークション
+	ListingBestOffer = "best_offer" // 価格の申し出を受付けて、スタッフが承諾する
+)
+
+// 出品のステータス
+// open -> awarded(落札・申し出の承諾済み、支払待ち) -> paid(支払済み)
+// awarded -> 支払期限切れ: オークションは次点の入札者に繰上げ(awardedのまま)、いなければunsold
+//
+//	価格交渉はopenに戻して申し出を受付け直す
+//
+// open -> unsold(入札なし・最低落札価格に届かず終了)
+// open -> cancelled(入札前の取下げ)
+// 出品中・支払待ちの間は在庫から引当てておき、unsold/cancelledで戻す
+// 落札・承諾で落札者の注文(支払待ち)を作り、支払はその注文に対して行う、繰上げ時は前の落札者の注文を取消す
+const (
+	AuctionOpen      = "open"
+	AuctionAwarded   = "awarded"
+	AuctionPaid      = "paid"
+	AuctionUnsold    = "unsold"
+	AuctionCancelled = "cancelled"
+)
+
+// 申し出のステータス
+const (
+	OfferPending  = "pending"
+	OfferAccepted = "accepted"
+	OfferDeclined = "declined"
+)
+
+// StartPrice: オークションは開始価格、価格交渉は提示価格(この金額以上の申し出は即承諾)
+// ReservePrice: 最低落札価格、入札者には金額を見せずに達したかどうかだけ返す
+// ExtensionMinutes: 終了前この分数以内に入札があったら、終了時刻を入札時刻からこの分数後まで延長する(0は延長なし)
+// MinOfferPrice: この金額未満の申し出は受付けない
+// PaymentDueAt: 落札者の支払期限、過ぎると落札を取消す
+// OrderID: 現在の落札者の注文、繰上げ・申し出の受付に戻すと外す
+type AuctionListing struct {
+	ID               uint           `json:"id" gorm:"primaryKey;autoIncrement"`
+	Type             string         `json:"type" gorm:"not null"`
+	RecordID         uint           `json:"record_id" gorm:"not null;index"`
+	Grade            string         `json:"grade" gorm:"not null"`
+	LocationID       uint           `json:"location_id" gorm:"not null"`
+	Status           string         `json:"status" gorm:"not null;index"`
+	StartPrice       int            `json:"start_price" gorm:"not null"`
+	ReservePrice     int            `json:"-" gorm:"not null;default:0"`
+	ReserveMet       bool           `json:"reserve_met" gorm:"-"`
+	BidIncrement     int            `json:"bid_increment" gorm:"not null;default:0"`
+	ExtensionMinutes int            `json:"extension_minutes" gorm:"not null;default:0"`
+	MinOfferPrice    int            `json:"min_offer_price" gorm:"not null;default:0"`
+	CurrentPrice     int            `json:"current_price" gorm:"not null;default:0"`
+	BidCount         int            `json:"bid_count" gorm:"not null;default:0"`
+	LeaderID         *uint          `json:"-" gorm:"default:null"`
+	EndsAt           *time.Time     `json:"ends_at" gorm:"default:null;index"`
+	WinnerID         *uint          `json:"winner_id" gorm:"default:null;index"`
+	WinningAmount    int            `json:"winning_amount" gorm:"not null;default:0"`
+	AwardedAt        *time.Time     `json:"awarded_at" gorm:"default:null"`
+	PaymentDueAt     *time.Time     `json:"payment_due_at" gorm:"default:null;index"`
+	PaymentID        *uint          `json:"payment_id" gorm:"default:null"`
+	OrderID          *uint          `json:"order_id" gorm:"default:null"`
+	CreatedBy        uint           `json:"created_by" gorm:"not null"`
+	Bids             []AuctionBid   `json:"bids,omitempty" gorm:"foreignKey:ListingID"`
+	Offers           []AuctionOffer `json:"-" gorm:"foreignKey:ListingID"`
+	CreatedAt        time.Time      `json:"created_at" gorm:"not null"`
+	UpdatedAt        *time.Time     `json:"updated_at" gorm:"default:null"`
+	Record           Record         `json:"-" gorm:"foreignKey:RecordID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+// 入札者は公開しない
+// Forfeited: 落札後に支払期限までに支払わなかった入札者の入札、繰上げの対象にしない
+type AuctionBid struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ListingID uint      `json:"listing_id" gorm:"not null;index"`
+	UserID    uint      `json:"-" gorm:"not null;index"`
+	Amount    int       `json:"amount" gorm:"not null"`
+	Forfeited bool      `json:"-" gorm:"not null;default:false"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+type AuctionOffer struct {
+	ID        uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	ListingID uint       `json:"listing_id" gorm:"not null;index"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Amount    int        `json:"amount" gorm:"not null"`
+	Status    string     `json:"status" gorm:"not null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt *time.Time `json:"updated_at" gorm:"default:null"`
+}
+
+// EndsAtはオークションのみ、価格交渉は取下げか承諾まで続く
+type AuctionListingRequest struct {
+	Type             string     `json:"type"`
+	RecordID         uint       `json:"record_id"`
+	Grade            string     `json:"grade"`
+	LocationID       uint       `json:"location_id"`
+	StartPrice       int        `json:"start_price"`
+	ReservePrice     int        `json:"reserve_price"`
+	BidIncrement     int        `json:"bid_increment"`
+	ExtensionMinutes int        `json:"extension_minutes"`
+	MinOfferPrice    int        `json:"min_offer_price"`
+	EndsAt           *time.Time `json:"ends_at"`
+}
+
+// 入札・申し出の金額
+type AuctionAmountRequest struct {
+	Amount int `json:"amount"`
+}
+
+type AuctionCheckoutRequest struct {
+	CardToken string `json:"card_token"`
+}
@@ -0,0 +1,94 @@
+package model
+
+import "time"
+
+// 委託品のステータス
+// available -> sold(販売済み、台帳に委託者への支払額を記録)
+// available -> returned(委託者へ返却)
+// sold -> available(レジでの取消・返品、台帳に支払義務の取消を記録)
+const (
+	ConsignmentAvailable = "available"
+	ConsignmentSold      = "sold"
+	ConsignmentReturned  = "returned"
+)
+
+// 台帳の種別
+const (
+	LedgerSale   = "sale"   // 販売による委託者への支払義務、Amountは正
+	LedgerPayout = "payout" // 委託者への支払、Amountは負
+	// 販売の取消・返品による支払義務の取消、Amount等は元の販売の符号を反転したもの
+	LedgerSaleReversal = "sale_reversal"
+)
+
+// CommissionPercent: 店の手数料率、委託品ごとに指定が無ければこれを使う
+type Consignor struct {
+	ID                uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name              string     `json:"name" gorm:"not null"`
+	Email             string     `json:"email" gorm:"not null;default:''"`
+	CommissionPercent int        `json:"commission_percent" gorm:"not null"`
+	CreatedAt         time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt         *time.Time `json:"updated_at" gorm:"default:null"`
+}
+
+// 委託者から預かっている1枚ごとの商品
+// CommissionPercentがnilなら委託者の手数料率を使う
+type ConsignmentItem struct {
+	ID                uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	ConsignorID       uint       `json:"consignor_id" gorm:"not null;index"`
+	RecordID          uint       `json:"record_id" gorm:"not null;index"`
+	Grade             string     `json:"grade" gorm:"not null"`
+	AskingPrice       int        `json:"asking_price" gorm:"not null"`
+	CommissionPercent *int       `json:"commission_percent" gorm:"default:null"`
+	Status            string     `json:"status" gorm:"not null"`
+	SalePrice         int        `json:"sale_price" gorm:"not null;default:0"`
+	SoldAt            *time.Time `json:"sold_at" gorm:"default:null"`
+	CreatedAt         time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt         *time.Time `json:"updated_at" gorm:"default:null"`
+	Consignor         Consignor  `json:"-" gorm:"foreignKey:ConsignorID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	Record            Record     `json:"-" gorm:"foreignKey:RecordID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+// 委託者ごとの支払残高の台帳、追記のみで更新・削除はしない
+// 残高はAmountの合計
+type ConsignmentLedgerEntry struct {
+	ID                uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ConsignorID       uint      `json:"consignor_id" gorm:"not null;index"`
+	ConsignmentItemID *uint     `json:"consignment_item_id" gorm:"default:null"`
+	Type              string    `json:"type" gorm:"not null"`
+	SaleAmount        int       `json:"sale_amount" gorm:"not null;default:0"`
+	Commission        int       `json:"commission" gorm:"not null;default:0"`
+	Amount            int       `json:"amount" gorm:"not null"`
+	Method            string    `json:"method" gorm:"not null;default:''"` // 支払方法、例: bank_transfer
+	Note              string    `json:"note" gorm:"not null;default:''"`
+	RecordedBy        uint      `json:"recorded_by" gorm:"not null"`
+	CreatedAt         time.Time `json:"created_at" gorm:"not null;index"`
+	Consignor         Consignor `json:"-" gorm:"foreignKey:ConsignorID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+type ConsignorResponse struct {
+	Consignor
+	Balance int `json:"balance"`
+}
+
+type ConsignmentSaleRequest struct {
+	SalePrice int `json:"sale_price"`
+}
+
+type ConsignmentPayoutRequest struct {
+	Amount int    `json:"amount"`
+	Method string `json:"method"`
+	Note   string `json:"note"`
+}
+
+// 期間内の明細と、期首・期末の残高
+type ConsignmentStatement struct {
+	Consignor       Consignor                `json:"consignor"`
+	From            time.Time                `json:"from"`
+	To              time.Time                `json:"to"`
+	OpeningBalance  int                      `json:"opening_balance"`
+	Entries         []ConsignmentLedgerEntry `json:"entries"`
+	TotalSales      int                      `json:"total_sales"`
+	TotalCommission int                      `json:"total_commission"`
+	TotalPayouts    int                      `json:"total_payouts"`
+	ClosingBalance  int                      `json:"closing_balance"`
+}
@@ -0,0 +1,122 @@
+package model
+
+import "time"
+
+// ギフトカード・店内クレジットの取引種別
+const (
+	BalanceIssue    = "issue"    // ギフトカードの発行
+	BalanceGrant    = "grant"    // 店内クレジットの付与(買取代金、お詫びなど)
+	BalanceRedeem   = "redeem"   // 支払への利用、Amountは負
+	BalanceReversal = "reversal" // 支払の取消による戻し
+	BalanceRefund   = "refund"   // 返品による返金、支払に使ったカードに戻す
+)
+
+// コードそのものは発行時に一度だけ返し、DBにはハッシュと末尾4桁だけを持つ
+type GiftCard struct {
+	ID            uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	CodeHash      string     `json:"-" gorm:"not null;uniqueIndex"`
+	Last4         string     `json:"last4" gorm:"not null"`
+	InitialAmount int        `json:"initial_amount" gorm:"not null"`
+	Balance       int        `json:"balance" gorm:"not null"`
+	ExpiresAt     time.Time  `json:"expires_at" gorm:"not null"`
+	IssuedBy      uint       `json:"issued_by" gorm:"not null"`
+	CreatedAt     time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt     *time.Time `json:"updated_at" gorm:"default:null"`
+}
+
+// ギフトカードの取引台帳、追記のみで更新・削除はしない
+// Reference: 支払の識別子(注文番号など)、取消はこの単位で行う
+type GiftCardTransaction struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	GiftCardID   uint      `json:"gift_card_id" gorm:"not null;index"`
+	Type         string    `json:"type" gorm:"not null"`
+	Amount       int       `json:"amount" gorm:"not null"`
+	BalanceAfter int       `json:"balance_after" gorm:"not null"`
+	Reference    string    `json:"reference" gorm:"not null;default:'';index"`
+	ActorID      uint      `json:"actor_id" gorm:"not null"`
+	CreatedAt    time.Time `json:"created_at" gorm:"not null"`
+	GiftCard     GiftCard  `json:"-" gorm:"foreignKey:GiftCardID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+// ユーザごとの店内クレジット残高
+// 付与・利用のたびに有効期限を延長し、最後の利用から一定期間使われなければ失効する
+type StoreCreditAccount struct {
+	UserID    uint       `json:"user_id" gorm:"primaryKey"`
+	Balance   int        `json:"balance" gorm:"not null;default:0"`
+	ExpiresAt *time.Time `json:"expires_at" gorm:"default:null"`
+	UpdatedAt *time.Time `json:"updated_at" gorm:"default:null"`
+	User      User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// 店内クレジットの取引台帳、追記のみで更新・削除はしない
+type StoreCreditTransaction struct {
+	ID            uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID        uint      `json:"user_id" gorm:"not null;index"`
+	Type          string    `json:"type" gorm:"not null"`
+	Amount        int       `json:"amount" gorm:"not null"`
+	BalanceAfter  int       `json:"balance_after" gorm:"not null"`
+	Reference     string    `json:"reference" gorm:"not null;default:'';index"`
+	ReferenceType string    `json:"reference_type" gorm:"not null;default:''"`
+	ReferenceID   uint      `json:"reference_id" gorm:"not null;default:0"`
+	ActorID       uint      `json:"actor_id" gorm:"not null"`
+	Note          string    `json:"note" gorm:"not null;default:''"`
+	CreatedAt     time.Time `json:"created_at" gorm:"not null"`
+}
+
+// ExpiresAtが未指定なら発行から3年
+type GiftCardIssueRequest struct {
+	Amount    int        `json:"amount"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// 発行時のみコードを返す
+type GiftCardIssueResponse struct {
+	GiftCard
+	Code string `json:"code"`
+}
+
+type GiftCardBalanceRequest struct {
+	Code string `json:"code"`
+}
+
+type StoreCreditGrantRequest struct {
+	UserID uint   `json:"user_id"`
+	Amount int    `json:"amount"`
+	Note   string `json:"note"`
+}
+
+type StoreCreditResponse struct {
+	Balance      int                      `json:"balance"`
+	ExpiresAt    *time.Time               `json:"expires_at"`
+	Transactions []StoreCreditTransaction `json:"transactions"`
+}
+
+// チェックアウト時の支払への充当
+// ギフトカードを指定順に使い、残りがあれば店内クレジットを使う
+// 残額(RemainingDue)はカード決済などで支払う
+type TenderRequest struct {
+	AmountDue      int      `json:"amount_due"`
+	GiftCardCodes  []string `json:"gift_card_codes"`
+	UseStoreCredit bool     `json:"use_store_credit"`
+	Reference      string   `json:"reference"`
+}
+
+type TenderApplied struct {
+	Source  string `json:"source"` // gift_card / store_credit
+	Last4   string `json:"last4,omitempty"`
+	Amount  int    `json:"amount"`
+	Balance int    `json:"balance"` // 利用後の残高
+}
+
+type TenderResponse struct {
+	Reference    string          `json:"reference"`
+	AmountDue    int             `json:"amount_due"`
+	Applied      []TenderApplied `json:"applied"`
+	RemainingDue int             `json:"remaining_due"`
+}
+
+// スタッフが顧客(UserID)の充当を取消す
+type TenderReverseRequest struct {
+	UserID    uint   `json:"user_id"`
+	Reference string `json:"reference"`
+}
@@ -0,0 +1,23 @@
+package model
+
+// 中古盤の盤質(Goldmine基準)、値が大きいほど状態が良い
+// 空文字や未知の値は0(判定不能)
+var gradeRanks = map[string]int{
+	"P":   1, // Poor
+	"F":   2, // Fair
+	"G":   3, // Good
+	"G+":  4,
+	"VG":  5, // Very Good
+	"VG+": 6,
+	"NM":  7, // Near Mint
+	"M":   8, // Mint
+}
+
+func GradeRank(grade string) int {
+	return gradeRanks[grade]
+}
+
+func IsValidGrade(grade string) bool {
+	_, ok := gradeRanks[grade]
+	return ok
+}
@@ -0,0 +1,123 @@
+package model
+
+import "time"
+
+// 拠点の種別
+const (
+	LocationShop      = "shop"
+	LocationWarehouse = "warehouse"
+)
+
+// 在庫移動の理由
+const (
+	MovementReceive       = "receive"        // 仕入・入荷
+	MovementAdjust        = "adjust"         // 棚卸し等による手動調整
+	MovementSale          = "sale"           // 販売
+	MovementTransferOut   = "transfer_out"   // 移動の出庫
+	MovementTransferIn    = "transfer_in"    // 移動の入庫
+	MovementTradeIn       = "trade_in"       // 買取
+	MovementReturnRestock = "return_restock" // 返品の在庫戻し
+	MovementVoid          = "void"           // レジでの販売取消の在庫戻し
+	MovementAuction       = "auction"        // オークション・価格交渉の出品による引当と戻し
+	MovementPreOrder      = "pre_order"      // 入荷した予約商品の予約への引当
+)
+
+// 移動指示のステータス
+// pending -> in_transit(出庫済み) -> received(入庫済み)
+// pending -> cancelled
+const (
+	TransferPending   = "pending"
+	TransferInTransit = "in_transit"
+	TransferReceived  = "received"
+	TransferCancelled = "cancelled"
+)
+
+// Code: URLや検索条件で使う識別子、例: shimokitazawa
+type Location struct {
+	ID        uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Code      string     `json:"code" gorm:"not null;uniqueIndex"`
+	Name      string     `json:"name" gorm:"not null"`
+	Type      string     `json:"type" gorm:"not null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt *time.Time `json:"updated_at" gorm:"default:null"`
+}
+
+// 拠点・レコード・盤質ごとの在庫数
+// 数量は直接更新せず、必ずStockMovementの記録と一緒に変更する
+type StockLevel struct {
+	LocationID uint       `json:"location_id" gorm:"primaryKey"`
+	RecordID   uint       `json:"record_id" gorm:"primaryKey;index"`
+	Grade      string     `json:"grade" gorm:"primaryKey"`
+	Quantity   int        `json:"quantity" gorm:"not null;default:0"`
+	UpdatedAt  *time.Time `json:"updated_at" gorm:"default:null"`
+	Location   Location   `json:"-" gorm:"foreignKey:LocationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	Record     Record     `json:"-" gorm:"foreignKey:RecordID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+// 在庫数の増減の台帳、追記のみで更新・削除はしない
+// ReferenceType/ReferenceID: 増減の元になったもの、例: transfer_order, 3
+type StockMovement struct {
+	ID            uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	LocationID    uint      `json:"location_id" gorm:"not null;index"`
+	RecordID      uint      `json:"record_id" gorm:"not null;index"`
+	Grade         string    `json:"grade" gorm:"not null"`
+	Delta         int       `json:"delta" gorm:"not null"`
+	Reason        string    `json:"reason" gorm:"not null"`
+	ReferenceType string    `json:"reference_type" gorm:"not null;default:''"`
+	ReferenceID   uint      `json:"reference_id" gorm:"not null;default:0"`
+	ActorID       uint      `json:"actor_id" gorm:"not null"`
+	Note          string    `json:"note" gorm:"not null;default:''"`
+	CreatedAt     time.Time `json:"created_at" gorm:"not null;index"`
+}
+
+type TransferOrder struct {
+	ID             uint                `json:"id" gorm:"primaryKey;autoIncrement"`
+	FromLocationID uint                `json:"from_location_id" gorm:"not null;index"`
+	ToLocationID   uint                `json:"to_location_id" gorm:"not null;index"`
+	Status         string              `json:"status" gorm:"not null"`
+	CreatedBy      uint                `json:"created_by" gorm:"not null"`
+	Items          []TransferOrderItem `json:"items" gorm:"foreignKey:TransferOrderID"`
+	ShippedAt      *time.Time          `json:"shipped_at" gorm:"default:null"`
+	ReceivedAt     *time.Time          `json:"received_at" gorm:"default:null"`
+	CreatedAt      time.Time           `json:"created_at" gorm:"not null"`
+	UpdatedAt      *time.Time          `json:"updated_at" gorm:"default:null"`
+	FromLocation   Location            `json:"-" gorm:"foreignKey:FromLocationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	ToLocation     Location            `json:"-" gorm:"foreignKey:ToLocationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+type TransferOrderItem struct {
+	ID              uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	TransferOrderID uint   `json:"transfer_order_id" gorm:"not null;index"`
+	RecordID        uint   `json:"record_id" gorm:"not null"`
+	Grade           string `json:"grade" gorm:"not null"`
+	Quantity        int    `json:"quantity" gorm:"not null"`
+	Record          Record `json:"-" gorm:"foreignKey:RecordID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+// 在庫の手動調整、Deltaは増減数(減らす場合は負)
+type StockAdjustmentRequest struct {
+	LocationID uint   `json:"location_id"`
+	RecordID   uint   `json:"record_id"`
+	Grade      string `json:"grade"`
+	Delta      int    `json:"delta"`
+	Reason     string `json:"reason"`
+	Note       string `json:"note"`
+}
+
+// 在庫の照会条件、空の項目は絞り込まない
+type StockQuery struct {
+	LocationCode string
+	RecordID     uint
+	Grade        string
+	InStockOnly  bool
+}
+
+// 照会結果、拠点のコードと名前を合わせて返す
+type StockLevelResponse struct {
+	LocationID   uint   `json:"location_id"`
+	LocationCode string `json:"location_code"`
+	LocationName string `json:"location_name"`
+	RecordID     uint   `json:"record_id"`
+	Grade        string `json:"grade"`
+	Quantity     int    `json:"quantity"`
+}
@@ -0,0 +1,73 @@
+package model
+
+import "time"
+
+// ポイントの取引種別
+const (
+	PointEarn     = "earn"     // 購入による付与
+	PointRedeem   = "redeem"   // 支払への利用、Pointsは負
+	PointReversal = "reversal" // 利用の取消による戻し
+	PointClawback = "clawback" // 返品による付与分の取消、Pointsは負
+	PointExpire   = "expire"   // 失効、Pointsは負
+)
+
+// ジャンル別・キャンペーンのポイント倍率
+// Genreが空なら全ジャンル、期間が空なら常時
+// MultiplierPercent: 200なら2倍、複数当てはまる場合は一番高いものを使う
+type LoyaltyRule struct {
+	ID                uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name              string     `json:"name" gorm:"not null"`
+	Genre             string     `json:"genre" gorm:"not null;default:''"`
+	MultiplierPercent int        `json:"multiplier_percent" gorm:"not null"`
+	StartsAt          *time.Time `json:"starts_at" gorm:"default:null"`
+	EndsAt            *time.Time `json:"ends_at" gorm:"default:null"`
+	CreatedAt         time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt         *time.Time `json:"updated_at" gorm:"default:null"`
+}
+
+// ユーザごとのポイント残高
+// 最後に付与されてから1年でExpiresAtを過ぎ、残高は全て失効する
+// 付与済みのポイントを使った後に返品された場合、残高はマイナスになり得る
+type PointAccount struct {
+	UserID    uint       `json:"user_id" gorm:"primaryKey"`
+	Balance   int        `json:"balance" gorm:"not null;default:0"`
+	ExpiresAt *time.Time `json:"expires_at" gorm:"default:null"`
+	UpdatedAt *time.Time `json:"updated_at" gorm:"default:null"`
+	User      User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// ポイントの履歴、追記のみで更新・削除はしない
+// PaymentID: 付与・返品取消の元になった決済(オンライン)
+// PosSaleID: 付与・返品取消の元になったレジの販売、レジのカード決済はスタッフ名義なのでPaymentIDでは付与しない
+// Reference: 利用の識別子(注文番号など)、取消はこの単位で行う
+type PointTransaction struct {
+	ID           uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID       uint      `json:"user_id" gorm:"not null;index"`
+	Type         string    `json:"type" gorm:"not null"`
+	Points       int       `json:"points" gorm:"not null"`
+	BalanceAfter int       `json:"balance_after" gorm:"not null"`
+	PaymentID    *uint     `json:"payment_id" gorm:"default:null;index"`
+	PosSaleID    *uint     `json:"pos_sale_id" gorm:"default:null;index"`
+	Reference    string    `json:"reference" gorm:"not null;default:'';index"`
+	Note         string    `json:"note" gorm:"not null;default:''"`
+	CreatedAt    time.Time `json:"created_at" gorm:"not null"`
+}
+
+// スタッフによるオンラインの決済に対するポイント付与、明細はジャンル別倍率の計算に使う
+// 付与先は決済の所有者、レジの販売はSellの完了時に自動で付与する
+type PointEarnRequest struct {
+	PaymentID uint       `json:"payment_id"`
+	Lines     []LineItem `json:"lines"`
+}
+
+// 1ポイント = 1円として支払前の注文に充当する、カードで支払う金額がその分減る
+type PointRedeemRequest struct {
+	OrderID uint `json:"order_id"`
+	Points  int  `json:"points"`
+}
+
+type PointAccountResponse struct {
+	Balance      int                `json:"balance"`
+	ExpiresAt    *time.Time         `json:"expires_at"`
+	Transactions []PointTransaction `json:"transactions"`
+}
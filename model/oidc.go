@@ -0,0 +1,42 @@
+package model
+
+import "time"
+
+// 外部のIDプロバイダ(Google、LINE等)のアカウントとの紐付け
+// Subject: プロバイダ内で不変の利用者ID(メールアドレスは変わり得るので紐付けには使わない)
+type UserIdentity struct {
+	ID          uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID      uint       `json:"user_id" gorm:"not null;index"`
+	Provider    string     `json:"provider" gorm:"not null;uniqueIndex:idx_identity_provider_subject"`
+	Subject     string     `json:"-" gorm:"not null;uniqueIndex:idx_identity_provider_subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at" gorm:"default:null"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"not null"`
+	User        User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// 認可リクエストからコールバックまでの間の状態、コールバックで1回だけ使える
+// stateはブラウザにもCookieで渡し、コールバックのクエリと一致することを確認する(ログインCSRF対策)
+// LinkUserID: ログイン中の利用者が自分のアカウントに紐付ける場合のみ
+type OIDCLoginState struct {
+	ID           uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	StateHash    string     `json:"-" gorm:"not null;uniqueIndex"`
+	Provider     string     `json:"provider" gorm:"not null"`
+	Nonce        string     `json:"-" gorm:"not null"`
+	CodeVerifier string     `json:"-" gorm:"not null"`
+	LinkUserID   *uint      `json:"link_user_id" gorm:"default:null"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"not null;index"`
+	UsedAt       *time.Time `json:"used_at" gorm:"default:null"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"not null"`
+}
+
+// 紐付け開始時に返す、フロントエンドはこのURLへ遷移させる
+type OIDCAuthorizationResponse struct {
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+// コールバックの結果、Linked: ログイン中の利用者への紐付けが済んだ(トークンは発行しない)
+type OIDCCallbackResult struct {
+	Login  LoginResult
+	Linked bool
+}
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// オンライン注文のステータス、支払の状態に合わせて決済のwebhook・確定・返金で進む
+// pending(支払待ち) -> authorized(与信確保済み) -> paid(売上確定済み) -> refunded(全額返金済み)
+// pending -> payment_failed(与信拒否、別のカードで支払い直せる)
+// pending / payment_failed -> cancelled(支払前の取消)
+const (
+	OrderPending       = "pending"
+	OrderAuthorized    = "authorized"
+	OrderPaid          = "paid"
+	OrderPaymentFailed = "payment_failed"
+	OrderRefunded      = "refunded"
+	OrderCancelled     = "cancelled"
+)
+
+// 決済のステータス(paymentパッケージの定数と同じ値)に対応する注文のステータス
+var orderStatusByPayment = map[string]string{
+	"pending":    OrderPending,
+	"authorized": OrderAuthorized,
+	"captured":   OrderPaid,
+	"declined":   OrderPaymentFailed,
+	"refunded":   OrderRefunded,
+	"voided":     OrderPaymentFailed,
+}
+
+func OrderStatusForPayment(paymentStatus string) string {
+	return orderStatusByPayment[paymentStatus]
+}
+
+// 注文に充当したポイントの利用の識別子
+func OrderPointReference(orderID uint) string {
+	return fmt.Sprintf("order:%d", orderID)
+}
+
+// カードで支払う金額
+func (o Order) AmountDue() int {
+	return o.Total - o.PointsRedeemed
+}
+
+// Total: 明細の合計、クライアントからは指定させない
+// PointsRedeemed: 支払に充当したポイント(1ポイント = 1円)、カードで支払う金額は Total - PointsRedeemed
+// 支払前の注文にのみ充当でき、注文の取消時に戻す
+// PaymentID: 最後に支払いに使った決済、与信拒否で支払い直した場合は新しい決済に付け替える
+// AuctionListingID: オークション・価格交渉の落札で作った注文、支払は落札の支払からのみ行い、ポイントの充当・本人の取消はできない
+type Order struct {
+	ID               uint        `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID           uint        `json:"user_id" gorm:"not null;index"`
+	Status           string      `json:"status" gorm:"not null;index"`
+	Total            int         `json:"total" gorm:"not null"`
+	PointsRedeemed   int         `json:"points_redeemed" gorm:"not null;default:0"`
+	PaymentID        *uint       `json:"payment_id" gorm:"default:null;uniqueIndex"`
+	AuctionListingID *uint       `json:"auction_listing_id" gorm:"default:null;index"`
+	Lines            []OrderLine `json:"lines" gorm:"foreignKey:OrderID"`
+	CreatedAt        time.Time   `json:"created_at" gorm:"not null"`
+	UpdatedAt        *time.Time  `json:"updated_at" gorm:"default:null"`
+	User             User        `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+// 商品名・売価は注文時点の店頭価格(SKUごとの売価、税込)を控えておく
+type OrderLine struct {
+	ID        uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	OrderID   uint   `json:"order_id" gorm:"not null;index"`
+	PosItemID uint   `json:"pos_item_id" gorm:"not null"`
+	RecordID  uint   `json:"record_id" gorm:"not null;index"`
+	Grade     string `json:"grade" gorm:"not null"`
+	SKU       string `json:"sku" gorm:"not null"`
+	Title     string `json:"title" gorm:"not null;default:''"`
+	UnitPrice int    `json:"unit_price" gorm:"not null"`
+	Quantity  int    `json:"quantity" gorm:"not null"`
+}
+
+type OrderLineRequest struct {
+	SKU      string `json:"sku"`
+	Quantity int    `json:"quantity"`
+}
+
+type OrderRequest struct {
+	Lines []OrderLineRequest `json:"lines"`
+}
@@ -0,0 +1,54 @@
+package model
+
+import "time"
+
+// Statusの値はpaymentパッケージの定数(pending, authorized, captured, declined, refunded, voided)
+// OrderID: オンライン注文の支払、オークション・レジ・予約の内金など金額をサーバ側で決める決済はnull
+// PendingRefundAmount: プロバイダに依頼中の返金額、完了したらRefundedAmountに移す(二重の返金を防ぐための予約)
+type Payment struct {
+	ID                  uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID              uint       `json:"user_id" gorm:"not null;index"`
+	OrderID             *uint      `json:"order_id" gorm:"default:null;index"`
+	Amount              int        `json:"amount" gorm:"not null"`
+	RefundedAmount      int        `json:"refunded_amount" gorm:"not null;default:0"`
+	PendingRefundAmount int        `json:"pending_refund_amount" gorm:"not null;default:0"`
+	Currency            string     `json:"currency" gorm:"not null;default:'JPY'"`
+	Provider            string     `json:"provider" gorm:"not null"`
+	ProviderPaymentID   string     `json:"provider_payment_id" gorm:"not null;uniqueIndex"`
+	Status              string     `json:"status" gorm:"not null"`
+	DeclineReason       string     `json:"decline_reason" gorm:"not null;default:''"`
+	CreatedAt           time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt           *time.Time `json:"updated_at" gorm:"default:null"`
+}
+
+// 処理済みのwebhookイベント
+// EventIDにunique制約を付けて、同じイベントが2回届いても1回しか反映しないようにする
+type PaymentEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	EventID   string    `json:"event_id" gorm:"not null;uniqueIndex"`
+	PaymentID uint      `json:"payment_id" gorm:"not null;index"`
+	Type      string    `json:"type" gorm:"not null"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+	Payment   Payment   `json:"-" gorm:"foreignKey:PaymentID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// 金額は注文の合計から決める
+type PaymentRequest struct {
+	OrderID   uint   `json:"order_id"`
+	CardToken string `json:"card_token"`
+}
+
+type RefundRequest struct {
+	Amount int `json:"amount"`
+}
+
+type PaymentResponse struct {
+	ID             uint           `json:"id"`
+	OrderID        *uint          `json:"order_id,omitempty"`
+	Amount         int            `json:"amount"`
+	RefundedAmount int            `json:"refunded_amount"`
+	Currency       string         `json:"currency"`
+	Status         string         `json:"status"`
+	DeclineReason  string         `json:"decline_reason,omitempty"`
+	Error          *ErrorResponse `json:"error,omitempty"`
+}
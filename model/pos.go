@@ -0,0 +1,146 @@
+package model
+
+import "time"
+
+// POSの販売のステータス
+// pending -> completed(支払完了) -> voided(レジでの取消)
+// pending -> failed(在庫不足・支払失敗など、在庫と支払は戻してある)
+const (
+	PosSalePending   = "pending"
+	PosSaleCompleted = "completed"
+	PosSaleVoided    = "voided"
+	PosSaleFailed    = "failed"
+)
+
+// 店頭で販売する商品、スキャンしたSKUまたはバーコード(JAN等)からレコード・盤質・売価を引く
+// 中古盤は同じレコードでも盤質ごとに売価が違うので、SKUは盤質ごとに登録する
+// Format/Conditionはプロモーションの対象の判定に使う
+// ConsignmentItemID: 委託品(1点もの)のSKU、在庫台帳ではなく委託品の販売として記録する
+type PosItem struct {
+	ID                uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	SKU               string     `json:"sku" gorm:"not null;uniqueIndex"`
+	Barcode           string     `json:"barcode" gorm:"not null;default:'';index"`
+	RecordID          uint       `json:"record_id" gorm:"not null;index"`
+	Grade             string     `json:"grade" gorm:"not null"`
+	Format            string     `json:"format" gorm:"not null;default:''"`    // 例: LP, 7", CD
+	Condition         string     `json:"condition" gorm:"not null;default:''"` // new, used
+	Price             int        `json:"price" gorm:"not null"`
+	ConsignmentItemID *uint      `json:"consignment_item_id" gorm:"default:null;index"`
+	CreatedAt         time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt         *time.Time `json:"updated_at" gorm:"default:null"`
+	Record            Record     `json:"-" gorm:"foreignKey:RecordID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+// Subtotal: 明細の合計、Discount: プロモーションの値引額、Total = Subtotal - Discount
+// CustomerID: 会員証等で会員を特定した場合のみ、1人あたりの利用上限があるプロモーションに必要
+// 支払の内訳: ギフトカード -> カード -> 現金の順に充当する
+// CashAmount: 現金で受取った代金(お預かりからおつりを引いたもの)
+// RefundedAmount: レジでの返品で返した金額の累計
+// CardRefundedAmount / GiftCardRefundedAmountはそのうちカード・ギフトカードに返した分
+type PosSale struct {
+	ID                     uint              `json:"id" gorm:"primaryKey;autoIncrement"`
+	LocationID             uint              `json:"location_id" gorm:"not null;index"`
+	Status                 string            `json:"status" gorm:"not null;index"`
+	CustomerID             *uint             `json:"customer_id" gorm:"default:null;index"`
+	Subtotal               int               `json:"subtotal" gorm:"not null;default:0"`
+	Discount               int               `json:"discount" gorm:"not null;default:0"`
+	Total                  int               `json:"total" gorm:"not null"`
+	GiftCardAmount         int               `json:"gift_card_amount" gorm:"not null;default:0"`
+	CardAmount             int               `json:"card_amount" gorm:"not null;default:0"`
+	CardPaymentID          *uint             `json:"card_payment_id" gorm:"default:null"`
+	CashAmount             int               `json:"cash_amount" gorm:"not null;default:0"`
+	CashReceived           int               `json:"cash_received" gorm:"not null;default:0"`
+	Change                 int               `json:"change" gorm:"not null;default:0"`
+	RefundedAmount         int               `json:"refunded_amount" gorm:"not null;default:0"`
+	CardRefundedAmount     int               `json:"card_refunded_amount" gorm:"not null;default:0"`
+	GiftCardRefundedAmount int               `json:"gift_card_refunded_amount" gorm:"not null;default:0"`
+	FailureReason          string            `json:"failure_reason,omitempty" gorm:"not null;default:''"`
+	CreatedBy              uint              `json:"created_by" gorm:"not null"`
+	VoidedBy               *uint             `json:"voided_by" gorm:"default:null"`
+	VoidedAt               *time.Time        `json:"voided_at" gorm:"default:null"`
+	Lines                  []PosSaleLine     `json:"lines" gorm:"foreignKey:PosSaleID"`
+	Discounts              []PosSaleDiscount `json:"discounts" gorm:"foreignKey:PosSaleID"`
+	Taxes                  []PosSaleTax      `json:"taxes" gorm:"foreignKey:PosSaleID"`
+	Returns                []PosReturn       `json:"returns" gorm:"foreignKey:PosSaleID"`
+	CreatedAt              time.Time         `json:"created_at" gorm:"not null"`
+	UpdatedAt              *time.Time        `json:"updated_at" gorm:"default:null"`
+	Location               Location          `json:"-" gorm:"foreignKey:LocationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+// 商品名・売価は販売時点の内容を控えておく(レシートの再発行で使う)
+// Discount: 販売全体の値引額を明細の金額で按分したもの、返品時はこれを引いた金額を返す
+// ConsignmentItemID: 委託品の明細、数量は常に1
+type PosSaleLine struct {
+	ID                uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	PosSaleID         uint   `json:"pos_sale_id" gorm:"not null;index"`
+	PosItemID         uint   `json:"pos_item_id" gorm:"not null"`
+	RecordID          uint   `json:"record_id" gorm:"not null"`
+	Grade             string `json:"grade" gorm:"not null"`
+	SKU               string `json:"sku" gorm:"not null"`
+	Title             string `json:"title" gorm:"not null;default:''"`
+	UnitPrice         int    `json:"unit_price" gorm:"not null"`
+	Quantity          int    `json:"quantity" gorm:"not null"`
+	Discount          int    `json:"discount" gorm:"not null;default:0"`
+	ReturnedQuantity  int    `json:"returned_quantity" gorm:"not null;default:0"`
+	ConsignmentItemID *uint  `json:"consignment_item_id" gorm:"default:null"`
+}
+
+// 販売に適用したプロモーションの内訳、レシートに印字する
+type PosSaleDiscount struct {
+	ID          uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	PosSaleID   uint   `json:"pos_sale_id" gorm:"not null;index"`
+	PromotionID uint   `json:"promotion_id" gorm:"not null"`
+	Name        string `json:"name" gorm:"not null"`
+	Code        string `json:"code" gorm:"not null;default:''"`
+	Amount      int    `json:"amount" gorm:"not null"`
+}
+
+// 税率ごとの対価の額と消費税額、レシートに印字する
+// 売価は税込なので、値引後の明細の金額を税率ごとに合計して内税で計算する
+type PosSaleTax struct {
+	ID                 uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	PosSaleID          uint   `json:"pos_sale_id" gorm:"not null;index"`
+	TaxCategory        string `json:"tax_category" gorm:"not null"`
+	Percent            int    `json:"percent" gorm:"not null"`
+	AmountExcludingTax int    `json:"amount_excluding_tax" gorm:"not null"`
+	Tax                int    `json:"tax" gorm:"not null"`
+	AmountIncludingTax int    `json:"amount_including_tax" gorm:"not null"`
+}
+
+// レジでの返品、カードで払った分はカードに、ギフトカードで払った分はギフトカードに、残りは現金で返す
+type PosReturn struct {
+	ID             uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	PosSaleID      uint      `json:"pos_sale_id" gorm:"not null;index"`
+	PosSaleLineID  uint      `json:"pos_sale_line_id" gorm:"not null"`
+	Quantity       int       `json:"quantity" gorm:"not null"`
+	Amount         int       `json:"amount" gorm:"not null"`
+	CardRefund     int       `json:"card_refund" gorm:"not null;default:0"`
+	GiftCardRefund int       `json:"gift_card_refund" gorm:"not null;default:0"`
+	CashRefund     int       `json:"cash_refund" gorm:"not null;default:0"`
+	CreatedBy      uint      `json:"created_by" gorm:"not null"`
+	CreatedAt      time.Time `json:"created_at" gorm:"not null"`
+}
+
+// Code: スキャンしたSKUまたはバーコード
+type PosSaleLineRequest struct {
+	Code     string `json:"code"`
+	Quantity int    `json:"quantity"`
+}
+
+// カードで払う金額と現金のお預かりを指定する、ギフトカードは残高の分だけ先に充当する
+// 自動適用のプロモーションは常に適用し、クーポンはPromotionCodesで指定する
+type PosSaleRequest struct {
+	LocationID     uint                 `json:"location_id"`
+	CustomerID     *uint                `json:"customer_id"`
+	Lines          []PosSaleLineRequest `json:"lines"`
+	PromotionCodes []string             `json:"promotion_codes"`
+	GiftCardCodes  []string             `json:"gift_card_codes"`
+	CardAmount     int                  `json:"card_amount"`
+	CardToken      string               `json:"card_token"`
+	CashReceived   int                  `json:"cash_received"`
+}
+
+type PosReturnRequest struct {
+	LineID   uint `json:"line_id"`
+	Quantity int  `json:"quantity"`
+}
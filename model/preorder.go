@@ -0,0 +1,55 @@
+package model
+
+import "time"
+
+// 予約のステータス
+// pending: 入荷待ち、allocated: 入荷分を引当済み(出荷可能)、cancelled: 取消
+const (
+	PreOrderPending   = "pending"
+	PreOrderAllocated = "allocated"
+	PreOrderCancelled = "cancelled"
+)
+
+// DepositPaymentIDは内金を支払った場合のみ、予約の作成時にサーバ側で与信を取った決済を紐付ける
+// DepositAmount: 予約時点の内金の額(数量 × 1点あたりの内金)、決済の金額と一致することを確認してから紐付ける
+// 1つの決済は1件の予約の内金にしか使えない
+// 内金は引当時に売上確定し、取消時は与信の取消(確定済みなら返金)をする
+type PreOrder struct {
+	ID               uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID           uint       `json:"user_id" gorm:"not null;index"`
+	RecordID         uint       `json:"record_id" gorm:"not null;index"`
+	Quantity         int        `json:"quantity" gorm:"not null"`
+	DepositPaymentID *uint      `json:"deposit_payment_id" gorm:"default:null;uniqueIndex"`
+	DepositAmount    int        `json:"deposit_amount" gorm:"not null;default:0"`
+	Status           string     `json:"status" gorm:"not null"`
+	AllocatedAt      *time.Time `json:"allocated_at" gorm:"default:null"`
+	CreatedAt        time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt        *time.Time `json:"updated_at" gorm:"default:null"`
+	Record           Record     `json:"-" gorm:"foreignKey:RecordID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	DepositPayment   *Payment   `json:"-" gorm:"foreignKey:DepositPaymentID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:SET NULL;"`
+}
+
+// 予約商品の入荷、Remainingは予約に引当てられずに残っている数量
+// 入荷した拠点の在庫に入れ、予約に引当てた分はその拠点の在庫から出す
+type PreOrderArrival struct {
+	ID         uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	RecordID   uint      `json:"record_id" gorm:"not null;index"`
+	LocationID uint      `json:"location_id" gorm:"not null"`
+	Quantity   int       `json:"quantity" gorm:"not null"`
+	Remaining  int       `json:"remaining" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at" gorm:"not null"`
+	Record     Record    `json:"-" gorm:"foreignKey:RecordID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	Location   Location  `json:"-" gorm:"foreignKey:LocationID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+// DepositCardTokenを指定した場合のみ内金を払う、金額はサーバ側で決める
+type PreOrderRequest struct {
+	RecordID         uint   `json:"record_id"`
+	Quantity         int    `json:"quantity"`
+	DepositCardToken string `json:"deposit_card_token"`
+}
+
+type PreOrderArrivalRequest struct {
+	LocationID uint `json:"location_id"`
+	Quantity   int  `json:"quantity"`
+}
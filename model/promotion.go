@@ -0,0 +1,99 @@
+package model
+
+import "time"
+
+// プロモーション種別
+const (
+	PromotionPercentOff = "percent_off" // 対象商品の○%引き
+	PromotionFixedOff   = "fixed_off"   // 対象商品の合計から○円引き
+	PromotionBuyXGetY   = "buy_x_get_y" // X点買うとY点無料(安い方から無料)
+)
+
+// Codeが空の場合はクーポン入力不要の自動適用プロモーション
+// Genre/Format/Conditionが空の場合はその条件で絞り込まない
+type Promotion struct {
+	ID           uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	Name         string `json:"name" gorm:"not null"`
+	Code         string `json:"code" gorm:"not null;default:'';uniqueIndex:idx_promotions_code,where:code <> ''"`
+	Type         string `json:"type" gorm:"not null"`
+	Genre        string `json:"genre" gorm:"not null;default:''"`
+	Format       string `json:"format" gorm:"not null;default:''"`    // 例: LP, 7", CD
+	Condition    string `json:"condition" gorm:"not null;default:''"` // 例: new, used
+	MinSubtotal  int    `json:"min_subtotal" gorm:"not null;default:0"`
+	PercentOff   int    `json:"percent_off" gorm:"not null;default:0"`
+	AmountOff    int    `json:"amount_off" gorm:"not null;default:0"`
+	BuyQuantity  int    `json:"buy_quantity" gorm:"not null;default:0"`
+	FreeQuantity int    `json:"free_quantity" gorm:"not null;default:0"`
+	// 0は無制限
+	UsageLimit int `json:"usage_limit" gorm:"not null;default:0"`
+	UsedCount  int `json:"used_count" gorm:"not null;default:0"`
+	// 1人あたりの利用上限、0は無制限
+	// 上限があるものは、会員を特定できない販売では使えない
+	PerUserLimit int `json:"per_user_limit" gorm:"not null;default:0"`
+	// trueの場合、他のプロモーションと併用不可
+	// boolにdefault:trueを付けるとfalseを渡した時にGormがゼロ値として無視してしまうので、falseが既定になる名前にしている
+	Exclusive bool       `json:"exclusive" gorm:"not null;default:false"`
+	StartsAt  *time.Time `json:"starts_at" gorm:"default:null"`
+	EndsAt    *time.Time `json:"ends_at" gorm:"default:null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt *time.Time `json:"updated_at" gorm:"default:null"`
+}
+
+// プロモーションの利用履歴、1人あたりの利用上限の確認と取消に使う
+// UserID: 会員を特定できない販売ではnil
+// Reference: 利用した販売の識別子(例: pos_sale:12)、取消はこの単位で行う
+type PromotionRedemption struct {
+	ID          uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	PromotionID uint      `json:"promotion_id" gorm:"not null;index"`
+	UserID      *uint     `json:"user_id" gorm:"default:null;index"`
+	Reference   string    `json:"reference" gorm:"not null;index"`
+	CreatedAt   time.Time `json:"created_at" gorm:"not null"`
+	Promotion   Promotion `json:"-" gorm:"foreignKey:PromotionID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+// 埋め込んだ構造体のフィールドはJSONで平坦に展開される
+type PromotionResponse struct {
+	Promotion
+	Error *ErrorResponse `json:"error,omitempty"`
+}
+
+// カート・チェックアウトの1明細
+// 価格や形態はレコード単位ではなく在庫単位で決まるので、呼出し側で詰めて渡す
+type LineItem struct {
+	RecordID  uint   `json:"record_id"`
+	Genre     string `json:"genre"`
+	Format    string `json:"format"`
+	Condition string `json:"condition"`
+	UnitPrice int    `json:"unit_price"`
+	Quantity  int    `json:"quantity"`
+}
+
+type PricingRequest struct {
+	Lines []LineItem `json:"lines"`
+	Codes []string   `json:"codes"`
+}
+
+type AppliedPromotion struct {
+	PromotionID uint   `json:"promotion_id"`
+	Name        string `json:"name"`
+	Code        string `json:"code,omitempty"`
+	Amount      int    `json:"amount"`
+	Explanation string `json:"explanation"`
+}
+
+// 適用されなかったプロモーションとその理由
+type SkippedPromotion struct {
+	PromotionID uint   `json:"promotion_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Code        string `json:"code,omitempty"`
+	Reason      string `json:"reason"`
+}
+
+type PricingResponse struct {
+	Subtotal int                `json:"subtotal"`
+	Discount int                `json:"discount"`
+	Total    int                `json:"total"`
+	Applied  []AppliedPromotion `json:"applied"`
+	Skipped  []SkippedPromotion `json:"skipped"`
+	Error    *ErrorResponse     `json:"error,omitempty"`
+}
@@ -4,13 +4,16 @@ import "time"
 
 // Gormはデフォルトでモデル名を複数形でテーブル名として使う
 type Record struct {
-	ID          uint      `json:"id" gorm:"primaryKey;autoIncrement"`
-	Title       string    `json:"title" gorm:"not null; default: ''"`
-	Artist      string    `json:"artist" gorm:"not null; default: ''"`
-	Genre       string    `json:"genre" gorm:"not null; default: ''"`
-	Style       string    `json:"style" gorm:"not null; default: ''"`
-	ReleaseYear int       `json:"release_year" gorm:"not null"`
-	CreatedAt   time.Time `json:"created_at" gorm:"not null"`
+	ID          uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	Title       string `json:"title" gorm:"not null; default: ''"`
+	Artist      string `json:"artist" gorm:"not null; default: ''"`
+	Genre       string `json:"genre" gorm:"not null; default: ''"`
+	Style       string `json:"style" gorm:"not null; default: ''"`
+	ReleaseYear int    `json:"release_year" gorm:"not null"`
+	// 予約受付中の新譜、発売日前のみtrue
+	PreOrder    bool       `json:"pre_order" gorm:"not null;default:false"`
+	ReleaseDate *time.Time `json:"release_date" gorm:"default:null"`
+	CreatedAt   time.Time  `json:"created_at" gorm:"not null"`
 	// time.Time 型の場合、default:nullは扱えない
 	// null を許容したい場合は、*time.Time 型を使う
 	UpdatedAt *time.Time `json:"updated_at" gorm:"default:null"`
@@ -18,12 +21,14 @@ type Record struct {
 
 type RecordResponse struct {
 	// IDはupdateで使うので返す
-	ID          uint   `json:"id"`
-	Title       string `json:"title"`
-	Artist      string `json:"artist"`
-	Genre       string `json:"genre"`
-	Style       string `json:"style"`
-	ReleaseYear int    `json:"release_year"`
+	ID          uint       `json:"id"`
+	Title       string     `json:"title"`
+	Artist      string     `json:"artist"`
+	Genre       string     `json:"genre"`
+	Style       string     `json:"style"`
+	ReleaseYear int        `json:"release_year"`
+	PreOrder    bool       `json:"pre_order"`
+	ReleaseDate *time.Time `json:"release_date,omitempty"`
 	// omitempty: フィールドがゼロ値の場合、JSONエンコード時にそのフィールドは省略
 	// jsonタグのオプションは,区切りの間に空白入れると警告(警告だが入れないほうが無難)
 	Error *ErrorResponse `json:"error,omitempty"` // エラーが無い場合はnil
@@ -0,0 +1,83 @@
+package model
+
+import "time"
+
+// 返品のステータス
+// requested -> approved -> completed(商品到着、返金または店内クレジット付与済み)
+// requested -> rejected
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+	ReturnRejected  = "rejected"
+	ReturnCompleted = "completed"
+)
+
+// 返品された商品の扱い
+const (
+	DispositionRestock  = "restock"   // 在庫に戻す(必要ならグレードを付け直す)
+	DispositionWriteOff = "write_off" // 廃棄・損失処理
+)
+
+// 返金の方法、返品依頼時に顧客が選ぶ
+const (
+	ResolutionRefund      = "refund"       // 元の決済に返金
+	ResolutionStoreCredit = "store_credit" // 店内クレジットとして付与
+)
+
+// 返金対象の決済と、その決済で支払った注文に含まれるレコードで紐付ける
+// 同じ決済の同じレコードの返品依頼は、却下された場合を除いて1件まで
+type ReturnRequest struct {
+	ID           uint          `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID       uint          `json:"user_id" gorm:"not null;index"`
+	PaymentID    uint          `json:"payment_id" gorm:"not null;index"`
+	RecordID     uint          `json:"record_id" gorm:"not null"`
+	Reason       string        `json:"reason" gorm:"not null"`
+	Status       string        `json:"status" gorm:"not null"`
+	Resolution   string        `json:"resolution" gorm:"not null;default:'refund'"`
+	RefundAmount int           `json:"refund_amount" gorm:"not null;default:0"`
+	Disposition  string        `json:"disposition" gorm:"not null;default:''"`
+	Grade        string        `json:"grade" gorm:"not null;default:''"` // 再査定後のグレード、例: VG+
+	Photos       []ReturnPhoto `json:"photos" gorm:"foreignKey:ReturnRequestID"`
+	Events       []ReturnEvent `json:"events,omitempty" gorm:"foreignKey:ReturnRequestID"`
+	CreatedAt    time.Time     `json:"created_at" gorm:"not null"`
+	UpdatedAt    *time.Time    `json:"updated_at" gorm:"default:null"`
+	Payment      Payment       `json:"-" gorm:"foreignKey:PaymentID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	Record       Record        `json:"-" gorm:"foreignKey:RecordID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+// 反り・盤質の証拠写真
+type ReturnPhoto struct {
+	ID              uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	ReturnRequestID uint   `json:"return_request_id" gorm:"not null;index"`
+	URL             string `json:"url" gorm:"not null"`
+}
+
+// 状態変更の監査ログ、追記のみで更新・削除はしない
+type ReturnEvent struct {
+	ID              uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ReturnRequestID uint      `json:"return_request_id" gorm:"not null;index"`
+	FromStatus      string    `json:"from_status" gorm:"not null;default:''"`
+	ToStatus        string    `json:"to_status" gorm:"not null"`
+	ActorID         uint      `json:"actor_id" gorm:"not null"`
+	Note            string    `json:"note" gorm:"not null;default:''"`
+	CreatedAt       time.Time `json:"created_at" gorm:"not null"`
+}
+
+// Resolution: 省略時は返金
+type ReturnCreateRequest struct {
+	PaymentID  uint     `json:"payment_id"`
+	RecordID   uint     `json:"record_id"`
+	Reason     string   `json:"reason"`
+	PhotoURLs  []string `json:"photo_urls"`
+	Resolution string   `json:"resolution"`
+}
+
+// スタッフの承認・却下・受領で共通のリクエスト、使わない項目は無視する
+// LocationID: 在庫に戻す場合の拠点
+type ReturnDecisionRequest struct {
+	RefundAmount int    `json:"refund_amount"`
+	Disposition  string `json:"disposition"`
+	Grade        string `json:"grade"`
+	LocationID   uint   `json:"location_id"`
+	Note         string `json:"note"`
+}
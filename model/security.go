@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+// セキュリティ監査ログのイベント種別
+const (
+	SecurityEventLoginFailed  = "login_failed"
+	SecurityEventLoginLocked  = "login_locked"
+	SecurityEventLoginBlocked = "login_blocked"
+
+	SecurityEventTwoFactorEnabled   = "two_factor_enabled"
+	SecurityEventTwoFactorDisabled  = "two_factor_disabled"
+	SecurityEventRecoveryCodeUsed   = "recovery_code_used"
+	SecurityEventRecoveryCodesReset = "recovery_codes_regenerated"
+	SecurityEventTwoFactorPolicy    = "two_factor_policy_changed"
+
+	SecurityEventOIDCLogin        = "oidc_login"
+	SecurityEventIdentityLinked   = "identity_linked"
+	SecurityEventIdentityUnlinked = "identity_unlinked"
+
+	SecurityEventPasswordChanged      = "password_changed"
+	SecurityEventEmailChangeRequested = "email_change_requested"
+	SecurityEventEmailChanged         = "email_changed"
+	SecurityEventAccountDeleted       = "account_deleted"
+)
+
+// ログイン失敗の回数、アカウント(メールアドレス)単位とIP単位で数える
+// Key: "email:<アドレス>" または "ip:<IPアドレス>"、存在しないアドレスも同じように数える(アカウントの有無が分からないように)
+// 連続失敗が閾値を超えるとLockedUntilまでログインを受付けない
+type LoginThrottle struct {
+	Key           string     `json:"key" gorm:"primaryKey"`
+	Failures      int        `json:"failures" gorm:"not null;default:0"`
+	LastFailureAt time.Time  `json:"last_failure_at" gorm:"not null"`
+	LockedUntil   *time.Time `json:"locked_until" gorm:"default:null"`
+}
+
+// セキュリティ監査ログ、認証の失敗やロックなどを記録する
+// UserID: 存在するアカウントの場合のみ
+type SecurityEvent struct {
+	ID        uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	Type      string    `json:"type" gorm:"not null;index"`
+	UserID    *uint     `json:"user_id" gorm:"index;default:null"`
+	Email     string    `json:"email" gorm:"index"`
+	IP        string    `json:"ip" gorm:"index"`
+	Details   string    `json:"details"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null;index"`
+}
@@ -0,0 +1,96 @@
+package model
+
+import "time"
+
+// 梱包形態、レコードの形態ごとに箱のサイズが変わる
+const (
+	PackageLP     = "lp"     // LP用ダンボール
+	PackageSingle = "single" // 7インチ用
+	PackageCD     = "cd"     // CD用(ネコポス等の薄型で送れる)
+)
+
+// 配送状況
+const (
+	ShipmentPreparing = "preparing"
+	ShipmentShipped   = "shipped"
+	ShipmentInTransit = "in_transit"
+	ShipmentDelivered = "delivered"
+	ShipmentReturned  = "returned"
+)
+
+// 配送業者と配送方法、例: Carrier "ヤマト運輸", Name "宅急便"
+type ShippingMethod struct {
+	ID        uint           `json:"id" gorm:"primaryKey;autoIncrement"`
+	Carrier   string         `json:"carrier" gorm:"not null"`
+	Name      string         `json:"name" gorm:"not null"`
+	Rates     []ShippingRate `json:"rates,omitempty" gorm:"foreignKey:ShippingMethodID"`
+	CreatedAt time.Time      `json:"created_at" gorm:"not null"`
+	UpdatedAt *time.Time     `json:"updated_at" gorm:"default:null"`
+}
+
+// 料金表の1行、重量はMaxWeightGrams以下に適用
+// 同じ配送方法・地域・梱包の中で、重量を満たす一番小さいMaxWeightGramsの行を使う
+type ShippingRate struct {
+	ID               uint           `json:"id" gorm:"primaryKey;autoIncrement"`
+	ShippingMethodID uint           `json:"shipping_method_id" gorm:"not null;index"`
+	Region           string         `json:"region" gorm:"not null"` // 例: kanto, kansai, okinawa
+	PackageType      string         `json:"package_type" gorm:"not null"`
+	MaxWeightGrams   int            `json:"max_weight_grams" gorm:"not null"`
+	Price            int            `json:"price" gorm:"not null"`
+	ShippingMethod   ShippingMethod `json:"-" gorm:"foreignKey:ShippingMethodID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+type ShippingItem struct {
+	Format   string `json:"format"` // LP, 7", CD
+	Quantity int    `json:"quantity"`
+}
+
+type ShippingQuoteRequest struct {
+	Region string         `json:"region"`
+	Items  []ShippingItem `json:"items"`
+}
+
+type ShippingQuote struct {
+	ShippingMethodID uint   `json:"shipping_method_id"`
+	Carrier          string `json:"carrier"`
+	Name             string `json:"name"`
+	PackageType      string `json:"package_type"`
+	WeightGrams      int    `json:"weight_grams"`
+	Price            int    `json:"price"`
+}
+
+type ShippingQuoteResponse struct {
+	Quotes []ShippingQuote `json:"quotes"`
+	Error  *ErrorResponse  `json:"error,omitempty"`
+}
+
+// UserID: 届け先の顧客、本人のみ参照できる
+type Shipment struct {
+	ID               uint            `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID           uint            `json:"user_id" gorm:"not null;index"`
+	ShippingMethodID uint            `json:"shipping_method_id" gorm:"not null;index"`
+	TrackingNumber   string          `json:"tracking_number" gorm:"not null;default:''"`
+	Status           string          `json:"status" gorm:"not null"`
+	Events           []ShipmentEvent `json:"events,omitempty" gorm:"foreignKey:ShipmentID"`
+	CreatedAt        time.Time       `json:"created_at" gorm:"not null"`
+	UpdatedAt        *time.Time      `json:"updated_at" gorm:"default:null"`
+	ShippingMethod   ShippingMethod  `json:"-" gorm:"foreignKey:ShippingMethodID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+	User             User            `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+// スタッフが記録した配送状況の履歴
+type ShipmentEvent struct {
+	ID         uint      `json:"id" gorm:"primaryKey;autoIncrement"`
+	ShipmentID uint      `json:"shipment_id" gorm:"not null;index"`
+	Status     string    `json:"status" gorm:"not null"`
+	Note       string    `json:"note" gorm:"not null;default:''"`
+	RecordedBy uint      `json:"recorded_by" gorm:"not null"`
+	CreatedAt  time.Time `json:"created_at" gorm:"not null"`
+	Shipment   Shipment  `json:"-" gorm:"foreignKey:ShipmentID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+type ShipmentEventRequest struct {
+	Status         string `json:"status"`
+	TrackingNumber string `json:"tracking_number"`
+	Note           string `json:"note"`
+}
@@ -0,0 +1,57 @@
+package model
+
+import "time"
+
+// 税率区分
+const (
+	TaxCategoryStandard = "standard" // 標準税率
+	TaxCategoryReduced  = "reduced"  // 軽減税率
+)
+
+// 区分ごとの税率、税率改定に備えてテーブルで持つ
+type TaxRate struct {
+	Category  string     `json:"category" gorm:"primaryKey"`
+	Percent   int        `json:"percent" gorm:"not null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt *time.Time `json:"updated_at" gorm:"default:null"`
+}
+
+// PricesIncludeTax: 明細の単価が税込(内税)か税抜(外税)か
+type TaxRequest struct {
+	Lines            []TaxLineItem `json:"lines"`
+	PricesIncludeTax bool          `json:"prices_include_tax"`
+}
+
+// TaxCategoryが空の場合は標準税率
+type TaxLineItem struct {
+	LineItem
+	TaxCategory string `json:"tax_category"`
+}
+
+// 総額表示用の明細ごとの税込単価
+// 請求書の消費税額は明細ごとではなく税率ごとに端数処理する(TaxBreakdown)ので、合計が一致しない場合がある
+type TaxedLine struct {
+	RecordID              uint   `json:"record_id"`
+	TaxCategory           string `json:"tax_category"`
+	Percent               int    `json:"percent"`
+	Quantity              int    `json:"quantity"`
+	UnitPriceIncludingTax int    `json:"unit_price_including_tax"`
+}
+
+// 適格請求書の記載事項: 税率ごとに区分した対価の額と消費税額
+type TaxBreakdown struct {
+	TaxCategory        string `json:"tax_category"`
+	Percent            int    `json:"percent"`
+	AmountExcludingTax int    `json:"amount_excluding_tax"`
+	Tax                int    `json:"tax"`
+	AmountIncludingTax int    `json:"amount_including_tax"`
+}
+
+type TaxResponse struct {
+	Lines             []TaxedLine    `json:"lines"`
+	Breakdown         []TaxBreakdown `json:"breakdown"`
+	TotalExcludingTax int            `json:"total_excluding_tax"`
+	TotalTax          int            `json:"total_tax"`
+	TotalIncludingTax int            `json:"total_including_tax"`
+	Error             *ErrorResponse `json:"error,omitempty"`
+}
@@ -0,0 +1,88 @@
+package model
+
+import "time"
+
+// リフレッシュトークン、DBにはハッシュのみ保存する
+// 1回使うと新しいトークンに交換(ローテーション)し、古いものはUsedAtを記録して使えなくする
+// FamilyID: ログイン1回ごとの系列、ローテーションしても引継ぐ
+// 使用済みのトークンが再び提示された場合は漏洩とみなし、系列ごと失効(RevokedAt)させる
+type RefreshToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	FamilyID  string     `json:"family_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at" gorm:"default:null"`
+	RevokedAt *time.Time `json:"revoked_at" gorm:"default:null"`
+	// 2段階認証を済ませたセッションか、ローテーションしても引継ぐ
+	MFA       bool      `json:"mfa" gorm:"not null;default:false"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+	User      User      `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// ログイン・リフレッシュで発行するトークンの組、controllerでそれぞれCookieに設定する
+type AuthTokens struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// ログアウトで失効させたアクセストークン(JWTのjti)
+// 有効期限を過ぎたトークンはJWTの検証で弾かれるので、ExpiresAtまで保持すればよい
+type RevokedToken struct {
+	JTI       string    `json:"jti" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+	CreatedAt time.Time `json:"created_at" gorm:"not null"`
+}
+
+// ユーザ単位の失効、RevokedBefore以前に発行(iat)されたトークンを全て無効にする
+// 全端末からのログアウトと、管理者による強制失効で使う
+type UserTokenRevocation struct {
+	UserID        uint       `json:"user_id" gorm:"primaryKey"`
+	RevokedBefore time.Time  `json:"revoked_before" gorm:"not null;index"`
+	RevokedBy     uint       `json:"revoked_by" gorm:"not null"`
+	UpdatedAt     *time.Time `json:"updated_at" gorm:"default:null"`
+	User          User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// メールアドレス確認用のトークン、DBにはハッシュのみ保存する
+// 1回使うとUsedAtを記録して使えなくする、再送すると未使用の古いトークンは削除する
+// Email: メールアドレス変更の場合の新しいアドレス、確認できたらユーザのアドレスをこれに変える
+// 空ならサインアップ時の確認(ユーザの今のアドレス)
+type EmailVerificationToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Email     string     `json:"email"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at" gorm:"default:null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null"`
+	User      User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+type EmailVerificationRequest struct {
+	Token string `json:"token"`
+}
+
+// パスワード再設定用のトークン、DBにはハッシュのみ保存する
+// 1回使うとUsedAtを記録して使えなくする、再発行すると未使用の古いトークンは削除する
+type PasswordResetToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at" gorm:"default:null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null"`
+	User      User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+type PasswordForgotRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
@@ -0,0 +1,90 @@
+package model
+
+import "time"
+
+// 買取査定のステータス
+// quoted(査定額提示、スタッフが調整可) -> accepted / rejected
+const (
+	TradeInQuoted   = "quoted"
+	TradeInAccepted = "accepted"
+	TradeInRejected = "rejected"
+)
+
+// 買取代金の受取方法
+const (
+	PayoutCash        = "cash"
+	PayoutStoreCredit = "store_credit"
+)
+
+// グレードごとの買取価格の算出ルール
+// 店頭販売価格に対する割合で、店内クレジットの方を現金より高く設定する
+// 在庫がOverstockThreshold枚以上あるレコードは、査定額をOverstockCutPercent%下げる(0なら下げない)
+type TradeInRule struct {
+	Grade               string     `json:"grade" gorm:"primaryKey"`
+	CashPercent         int        `json:"cash_percent" gorm:"not null"`
+	CreditPercent       int        `json:"credit_percent" gorm:"not null"`
+	OverstockThreshold  int        `json:"overstock_threshold" gorm:"not null;default:0"`
+	OverstockCutPercent int        `json:"overstock_cut_percent" gorm:"not null;default:0"`
+	CreatedAt           time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt           *time.Time `json:"updated_at" gorm:"default:null"`
+}
+
+// CashTotal/CreditTotalは明細の合計、PayoutAmountは成立時に選ばれた方の金額
+type TradeInQuote struct {
+	ID           uint          `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID       uint          `json:"user_id" gorm:"not null;index"`
+	Status       string        `json:"status" gorm:"not null"`
+	CashTotal    int           `json:"cash_total" gorm:"not null;default:0"`
+	CreditTotal  int           `json:"credit_total" gorm:"not null;default:0"`
+	Payout       string        `json:"payout" gorm:"not null;default:''"`
+	PayoutAmount int           `json:"payout_amount" gorm:"not null;default:0"`
+	DecidedBy    *uint         `json:"decided_by" gorm:"default:null"`
+	Note         string        `json:"note" gorm:"not null;default:''"`
+	Items        []TradeInItem `json:"items" gorm:"foreignKey:TradeInQuoteID"`
+	CreatedAt    time.Time     `json:"created_at" gorm:"not null"`
+	UpdatedAt    *time.Time    `json:"updated_at" gorm:"default:null"`
+	User         User          `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// SellPrice: 査定の基準にした店頭販売価格、店頭価格が無く0の場合はスタッフが実物を見て付ける
+// StockLevel: 査定時点の在庫枚数
+// Adjusted: スタッフが査定額を手動で変更した
+type TradeInItem struct {
+	ID             uint         `json:"id" gorm:"primaryKey;autoIncrement"`
+	TradeInQuoteID uint         `json:"trade_in_quote_id" gorm:"not null;index"`
+	RecordID       uint         `json:"record_id" gorm:"not null;index"`
+	Grade          string       `json:"grade" gorm:"not null"`
+	SellPrice      int          `json:"sell_price" gorm:"not null"`
+	StockLevel     int          `json:"stock_level" gorm:"not null;default:0"`
+	CashOffer      int          `json:"cash_offer" gorm:"not null"`
+	CreditOffer    int          `json:"credit_offer" gorm:"not null"`
+	Adjusted       bool         `json:"adjusted" gorm:"not null;default:false"`
+	TradeInQuote   TradeInQuote `json:"-" gorm:"foreignKey:TradeInQuoteID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Record         Record       `json:"-" gorm:"foreignKey:RecordID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:RESTRICT;"`
+}
+
+type TradeInCreateRequest struct {
+	Items []TradeInItemRequest `json:"items"`
+}
+
+// 基準にする販売価格はサーバ側で店頭価格から引くので、申込みでは受付けない
+type TradeInItemRequest struct {
+	RecordID uint   `json:"record_id"`
+	Grade    string `json:"grade"`
+}
+
+// スタッフによる明細の調整
+// 実物を見てグレードや販売価格を付け直すとルールで再計算、査定額を直接指定するとそれを優先する
+type TradeInAdjustRequest struct {
+	Grade       string `json:"grade"`
+	SellPrice   int    `json:"sell_price"`
+	CashOffer   *int   `json:"cash_offer"`
+	CreditOffer *int   `json:"credit_offer"`
+}
+
+// LocationID: 成立時に買取品を入庫する拠点
+type TradeInDecisionRequest struct {
+	Payout     string `json:"payout"`
+	LocationID uint   `json:"location_id"`
+	Note       string `json:"note"`
+}
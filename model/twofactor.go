@@ -0,0 +1,84 @@
+package model
+
+import "time"
+
+// TOTPによる2段階認証の設定
+// 登録(enroll)で秘密鍵を作り、認証アプリのコードで確認(confirm)するとEnabledになる
+// LastUsedStep: 最後に使ったコードの時刻ステップ、同じコードを2回使えないようにする
+type TwoFactor struct {
+	UserID       uint       `json:"user_id" gorm:"primaryKey"`
+	Secret       string     `json:"-" gorm:"not null"`
+	Enabled      bool       `json:"enabled" gorm:"not null;default:false"`
+	LastUsedStep int64      `json:"-" gorm:"not null;default:0"`
+	ConfirmedAt  *time.Time `json:"confirmed_at" gorm:"default:null"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt    time.Time  `json:"updated_at" gorm:"not null"`
+	User         User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// 端末を無くした場合のリカバリーコード、それぞれ1回だけ使える、DBにはハッシュのみ保存する
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	CodeHash  string     `json:"-" gorm:"not null;index"`
+	UsedAt    *time.Time `json:"used_at" gorm:"default:null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null"`
+	User      User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// パスワード確認後、2段階目のコード入力を待っている状態
+// Cookieでトークンを渡し、コードが合えばJWTを発行する、Attemptsが上限に達したら使えなくする
+type LoginChallenge struct {
+	ID        uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	TokenHash string     `json:"-" gorm:"not null;uniqueIndex"`
+	Attempts  int        `json:"attempts" gorm:"not null;default:0"`
+	ExpiresAt time.Time  `json:"expires_at" gorm:"not null"`
+	UsedAt    *time.Time `json:"used_at" gorm:"default:null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null"`
+	User      User       `json:"-" gorm:"foreignKey:UserID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// ロールごとの2段階認証の要否(管理者が設定)
+// 必須のロールで2段階認証を済ませていないセッションは、読取り(GET)と2段階認証の登録のみ可能
+type TwoFactorPolicy struct {
+	Role      string    `json:"role" gorm:"primaryKey"`
+	Required  bool      `json:"required" gorm:"not null;default:false"`
+	UpdatedBy uint      `json:"updated_by" gorm:"not null"`
+	UpdatedAt time.Time `json:"updated_at" gorm:"not null"`
+}
+
+// 登録時に返す、QRPayloadをQRコードにして認証アプリで読込む(手入力の場合はSecret)
+type TwoFactorEnrollment struct {
+	Secret     string `json:"secret"`
+	OtpauthURI string `json:"otpauth_uri"`
+	QRPayload  string `json:"qr_payload"`
+}
+
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// 2段階目のログイン、認証アプリのコードかリカバリーコードのどちらか
+type LoginTwoFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// リカバリーコードは発行時に1回だけ返す
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type TwoFactorPolicyRequest struct {
+	Required bool `json:"required"`
+}
+
+// ログインの結果、2段階認証が有効なユーザはUser・Tokensの代わりにChallengeを返す
+type LoginResult struct {
+	User               UserResponse
+	Tokens             AuthTokens
+	TwoFactorRequired  bool
+	Challenge          string
+	ChallengeExpiresAt time.Time
+}
@@ -1,16 +1,58 @@
 package model
 
-import "time"
+import (
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// ユーザのロール、JWTのroleクレームにも入れて権限の確認に使う
+// admin: ロールの割当てを含む全操作、staff: カタログ・在庫・店舗業務の操作、customer: 購入者(サインアップ時の既定)
+const (
+	RoleAdmin    = "admin"
+	RoleStaff    = "staff"
+	RoleCustomer = "customer"
+)
+
+// Password: サインアップ・ログインのリクエストのBind用、レスポンスには必ずUserResponseを使う
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Email     string    `json:"email" gorm:"unique"`
-	Password  string    `json:"password"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	Email    string `json:"email" gorm:"unique"`
+	Password string `json:"password"`
+	Role     string `json:"role" gorm:"not null;default:'customer'"`
+	// メールアドレスの確認が済むまでは読取り専用(GET)の操作のみ許可する
+	EmailVerified   bool       `json:"email_verified" gorm:"not null;default:false"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at" gorm:"default:null"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+	// 退会済み、注文・決済などの履歴が参照するので行は残し、アドレスと認証情報は消す
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 type UserResponse struct {
 	ID    uint   `json:"id" gorm:"primaryKey"`
 	Email string `json:"email" gorm:"unique"`
+	Role  string `json:"role"`
+	// 確認済みかどうか
+	EmailVerified bool `json:"email_verified"`
+}
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+// パスワードの変更、現在のパスワードが必要
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// メールアドレスの変更、新しいアドレスに届いたリンクで確認するまでは変わらない
+type ChangeEmailRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
 }
@@ -0,0 +1,38 @@
+package model
+
+import "time"
+
+// 欲しいレコードの登録
+// RecordID/Title/Artistのいずれかで対象を指定し、指定した条件は全て満たした場合のみ通知する
+type WantListEntry struct {
+	ID       uint   `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID   uint   `json:"user_id" gorm:"not null;index"`
+	RecordID *uint  `json:"record_id" gorm:"default:null;index"`
+	Title    string `json:"title" gorm:"not null;default:''"`
+	Artist   string `json:"artist" gorm:"not null;default:''"`
+	Pressing string `json:"pressing" gorm:"not null;default:''"` // 例: JP初版、US再発
+	// 0は上限なし
+	MaxPrice     int        `json:"max_price" gorm:"not null;default:0"`
+	MinCondition string     `json:"min_condition" gorm:"not null;default:''"`
+	CreatedAt    time.Time  `json:"created_at" gorm:"not null"`
+	UpdatedAt    *time.Time `json:"updated_at" gorm:"default:null"`
+	Record       *Record    `json:"-" gorm:"foreignKey:RecordID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+// 入荷の通知、欲しいものリストとの突合せに使う
+// Priceが0の場合は価格不明として価格条件を判定しない
+type StockNotice struct {
+	RecordID  uint
+	Pressing  string
+	Condition string
+	Price     int
+}
+
+type Notification struct {
+	ID        uint       `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID    uint       `json:"user_id" gorm:"not null;index"`
+	Subject   string     `json:"subject" gorm:"not null"`
+	Body      string     `json:"body" gorm:"not null"`
+	ReadAt    *time.Time `json:"read_at" gorm:"default:null"`
+	CreatedAt time.Time  `json:"created_at" gorm:"not null"`
+}
@@ -0,0 +1,66 @@
+package model
+
+import "time"
+
+// ShareTokenが設定されている間だけ、/shared/wishlists/:tokenで誰でも閲覧できる
+type Wishlist struct {
+	ID         uint           `json:"id" gorm:"primaryKey;autoIncrement"`
+	UserID     uint           `json:"user_id" gorm:"not null;index"`
+	Name       string         `json:"name" gorm:"not null"`
+	ShareToken *string        `json:"share_token" gorm:"default:null;uniqueIndex"`
+	Items      []WishlistItem `json:"items" gorm:"foreignKey:WishlistID"`
+	CreatedAt  time.Time      `json:"created_at" gorm:"not null"`
+	UpdatedAt  *time.Time     `json:"updated_at" gorm:"default:null"`
+}
+
+type WishlistItem struct {
+	ID         uint     `json:"id" gorm:"primaryKey;autoIncrement"`
+	WishlistID uint     `json:"wishlist_id" gorm:"not null;index"`
+	RecordID   uint     `json:"record_id" gorm:"not null"`
+	Position   int      `json:"position" gorm:"not null"`
+	Note       string   `json:"note" gorm:"not null;default:''"`
+	Wishlist   Wishlist `json:"-" gorm:"foreignKey:WishlistID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	Record     Record   `json:"-" gorm:"foreignKey:RecordID;references:ID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+}
+
+type WishlistItemRequest struct {
+	RecordID uint   `json:"record_id"`
+	Note     string `json:"note"`
+}
+
+type WishlistReorderRequest struct {
+	ItemIDs []uint `json:"item_ids"`
+}
+
+// 共有リンクで公開する場合はShareTokenを返さない
+type WishlistResponse struct {
+	ID         uint                   `json:"id"`
+	Name       string                 `json:"name"`
+	ShareToken *string                `json:"share_token,omitempty"`
+	Items      []WishlistItemResponse `json:"items"`
+}
+
+// 各エントリの現在の状況を合わせて返す
+// StockQuantity: 全拠点の在庫数の合計
+// Price: 店頭価格(盤質違いで複数ある場合は最安値)、未登録ならnull
+type WishlistItemResponse struct {
+	ID            uint       `json:"id"`
+	RecordID      uint       `json:"record_id"`
+	Position      int        `json:"position"`
+	Note          string     `json:"note"`
+	Title         string     `json:"title"`
+	Artist        string     `json:"artist"`
+	ReleaseYear   int        `json:"release_year"`
+	PreOrder      bool       `json:"pre_order"`
+	ReleaseDate   *time.Time `json:"release_date,omitempty"`
+	InStock       bool       `json:"in_stock"`
+	StockQuantity int        `json:"stock_quantity"`
+	Price         *int       `json:"price"`
+}
+
+// レコードごとの在庫数と店頭価格、リストの表示用にまとめて引く
+type RecordAvailability struct {
+	RecordID      uint
+	StockQuantity int
+	Price         *int
+}
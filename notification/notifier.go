@@ -0,0 +1,63 @@
+package notification
+
+import (
+	"record-shop-rest-api/mail"
+	"record-shop-rest-api/model"
+)
+
+type Message struct {
+	UserID  uint
+	Email   string
+	Subject string
+	Body    string
+}
+
+// 通知の送り先(チャネル)の抽象、アプリ内通知やメールを同じように扱う
+type INotifier interface {
+	Channel() string
+	Notify(msg Message) error
+}
+
+// アプリ内通知の保存先、repositoryが満たす
+type INotificationStore interface {
+	CreateNotification(notification *model.Notification) error
+}
+
+type inAppNotifier struct {
+	store INotificationStore
+}
+
+func NewInAppNotifier(store INotificationStore) INotifier {
+	return &inAppNotifier{store}
+}
+
+func (in *inAppNotifier) Channel() string {
+	return "in_app"
+}
+
+func (in *inAppNotifier) Notify(msg Message) error {
+	return in.store.CreateNotification(&model.Notification{
+		UserID:  msg.UserID,
+		Subject: msg.Subject,
+		Body:    msg.Body,
+	})
+}
+
+type emailNotifier struct {
+	sender mail.IMailSender
+}
+
+func NewEmailNotifier(sender mail.IMailSender) INotifier {
+	return &emailNotifier{sender}
+}
+
+func (en *emailNotifier) Channel() string {
+	return "email"
+}
+
+func (en *emailNotifier) Notify(msg Message) error {
+	if msg.Email == "" {
+		return nil
+	}
+	return en.sender.Send(msg.Email, msg.Subject, msg.Body)
+}
@@ -0,0 +1,256 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// オフラインで開発・動作確認するためのモックのIDプロバイダ(OpenID Connectの認可サーバ)
+// 鍵はメモリ上で生成し、本物と同じく /authorize /token /jwks をHTTPで提供するので
+// NewProviderで作った本番用の実装をそのまま検証できる
+//
+//	GET  /authorize: login_hintがあればそのアドレスで即座に認可、無ければ入力フォームを表示
+//	POST /authorize: フォームの送信、email_verified=falseで未確認のアドレスを模擬
+//	POST /token:     認可コードとPKCEのcode_verifierを検証してIDトークンを返す
+//	GET  /jwks:      IDトークン検証用の公開鍵
+const (
+	mockKeyID    = "mock-key"
+	mockCodeTTL  = time.Minute
+	mockTokenTTL = 10 * time.Minute
+)
+
+type mockAuthorization struct {
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	email         string
+	emailVerified bool
+	expiresAt     time.Time
+}
+
+// 発行者URLとクライアントの設定が必要なので、interfaceではなく構造体のポインタを返す
+type MockIdentityProvider struct {
+	issuer       string
+	clientID     string
+	clientSecret string
+	key          *rsa.PrivateKey
+	// 並行リクエストから触られるのでMutexで保護
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+}
+
+func NewMockIdentityProvider(issuer string, clientID string, clientSecret string) (*MockIdentityProvider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &MockIdentityProvider{
+		issuer:       issuer,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		key:          key,
+		codes:        map[string]mockAuthorization{},
+	}, nil
+}
+
+// このモックを相手にするプロバイダ、名前は "mock"
+func (m *MockIdentityProvider) Provider(redirectURL string) IProvider {
+	return NewProvider(Config{
+		Name:         "mock",
+		Issuer:       m.issuer,
+		ClientID:     m.clientID,
+		ClientSecret: m.clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      m.issuer + "/authorize",
+		TokenURL:     m.issuer + "/token",
+		JWKSURL:      m.issuer + "/jwks",
+		HTTPClient:   m.Client(),
+	})
+}
+
+// サーバ側からの通信(トークン交換・JWKS取得)をネットワークを通さずにこのモックへ渡すクライアント
+func (m *MockIdentityProvider) Client() *http.Client {
+	return &http.Client{Transport: mockTransport{m}}
+}
+
+type mockTransport struct {
+	handler http.Handler
+}
+
+func (t mockTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rec := httptest.NewRecorder()
+	t.handler.ServeHTTP(rec, req)
+	res := rec.Result()
+	res.Request = req
+	return res, nil
+}
+
+func (m *MockIdentityProvider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/authorize":
+		m.authorize(w, r)
+	case "/token":
+		m.token(w, r)
+	case "/jwks":
+		m.jwks(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+var mockLoginForm = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html><body>
+<h1>Mock identity provider</h1>
+<form method="post" action="authorize">
+{{range $k, $v := .}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}">
+{{end}}<label>Email <input type="email" name="login_hint" required></label>
+<label><input type="checkbox" name="email_verified" value="true" checked> Email verified</label>
+<button type="submit">Sign in</button>
+</form>
+</body></html>`))
+
+func (m *MockIdentityProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("client_id") != m.clientID || r.Form.Get("response_type") != "code" {
+		http.Error(w, "unknown client or unsupported response_type", http.StatusBadRequest)
+		return
+	}
+	if r.Form.Get("code_challenge") == "" || r.Form.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE (S256) is required", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(r.Form.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	email := r.Form.Get("login_hint")
+	if email == "" {
+		params := url.Values{}
+		for _, k := range []string{"response_type", "client_id", "redirect_uri", "scope", "state", "nonce", "code_challenge", "code_challenge_method"} {
+			params.Set(k, r.Form.Get(k))
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		mockLoginForm.Execute(w, params)
+		return
+	}
+	code := randomHex(16)
+	m.mu.Lock()
+	m.codes[code] = mockAuthorization{
+		redirectURI:   redirectURI.String(),
+		codeChallenge: r.Form.Get("code_challenge"),
+		nonce:         r.Form.Get("nonce"),
+		email:         email,
+		// GETのlogin_hintは確認済み扱い、フォームはチェックボックスで切替える
+		emailVerified: r.Method == http.MethodGet || r.Form.Get("email_verified") == "true",
+		expiresAt:     time.Now().Add(mockCodeTTL),
+	}
+	m.mu.Unlock()
+	q := redirectURI.Query()
+	q.Set("code", code)
+	q.Set("state", r.Form.Get("state"))
+	redirectURI.RawQuery = q.Encode()
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+func (m *MockIdentityProvider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil || r.Form.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+	if r.Form.Get("client_id") != m.clientID ||
+		subtle.ConstantTimeCompare([]byte(r.Form.Get("client_secret")), []byte(m.clientSecret)) != 1 {
+		tokenError(w, "invalid_client")
+		return
+	}
+	// 認可コードは1回限り、検証に失敗しても消す
+	m.mu.Lock()
+	auth, ok := m.codes[r.Form.Get("code")]
+	delete(m.codes, r.Form.Get("code"))
+	m.mu.Unlock()
+	if !ok || time.Now().After(auth.expiresAt) || auth.redirectURI != r.Form.Get("redirect_uri") {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	verifier := r.Form.Get("code_verifier")
+	if verifier == "" || CodeChallenge(verifier) != auth.codeChallenge {
+		tokenError(w, "invalid_grant")
+		return
+	}
+	now := time.Now()
+	sum := sha256.Sum256([]byte(auth.email))
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            m.issuer,
+		"sub":            "mock-" + hex.EncodeToString(sum[:8]),
+		"aud":            m.clientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(mockTokenTTL).Unix(),
+		"nonce":          auth.nonce,
+		"email":          auth.email,
+		"email_verified": auth.emailVerified,
+		"name":           auth.email,
+	})
+	idToken.Header["kid"] = mockKeyID
+	signed, err := idToken.SignedString(m.key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomHex(16),
+		"token_type":   "Bearer",
+		"expires_in":   int(mockTokenTTL.Seconds()),
+		"id_token":     signed,
+	})
+}
+
+func (m *MockIdentityProvider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := m.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": mockKeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,224 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrExchangeFailed = errors.New("authorization code exchange failed")
+	ErrInvalidIDToken = errors.New("invalid id token")
+)
+
+// IDトークンから取出す、ログインに必要な情報
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OpenID Connectのプロバイダ(Google、LINE等)の抽象
+// 認可コードフロー + PKCE、本番用のプロバイダを追加する場合もこのinterfaceを実装すれば、usecase側は変更不要
+type IProvider interface {
+	Name() string
+	// 利用者をリダイレクトする認可画面のURL、loginHintは省略可(メールアドレスの入力補助)
+	AuthCodeURL(state string, nonce string, codeChallenge string, loginHint string) string
+	// 認可コードをトークンに交換し、IDトークンの署名・発行者・宛先・期限・nonceを検証して返す
+	Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (Claims, error)
+}
+
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	AuthURL      string
+	TokenURL     string
+	JWKSURL      string
+	Scopes       []string
+	// IDトークンの署名方式、HS256はクライアントシークレットで、それ以外はJWKSの公開鍵で検証する
+	SigningAlgs []string
+	// email_verifiedクレームを返さず、確認済みのアドレスのみ返すプロバイダ(LINE)用
+	AssumeEmailVerified bool
+	// 省略時はタイムアウト10秒のクライアント、テストではモックIdPのClient()を渡す
+	HTTPClient *http.Client
+}
+
+type provider struct {
+	cfg  Config
+	keys *keySet
+}
+
+func NewProvider(cfg Config) IProvider {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+	if len(cfg.SigningAlgs) == 0 {
+		cfg.SigningAlgs = []string{"RS256"}
+	}
+	return &provider{cfg, newKeySet(cfg.JWKSURL, cfg.HTTPClient)}
+}
+
+func NewGoogleProvider(clientID string, clientSecret string, redirectURL string) IProvider {
+	return NewProvider(Config{
+		Name:         "google",
+		Issuer:       "https://accounts.google.com",
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		AuthURL:      "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:     "https://oauth2.googleapis.com/token",
+		JWKSURL:      "https://www.googleapis.com/oauth2/v3/certs",
+	})
+}
+
+// LINEログイン(v2.1)、ウェブログインのIDトークンはチャネルシークレットによるHS256
+// メールアドレスはLINEで確認済みのものしか返らず、email_verifiedクレームは無い
+func NewLineProvider(channelID string, channelSecret string, redirectURL string) IProvider {
+	return NewProvider(Config{
+		Name:                "line",
+		Issuer:              "https://access.line.me",
+		ClientID:            channelID,
+		ClientSecret:        channelSecret,
+		RedirectURL:         redirectURL,
+		AuthURL:             "https://access.line.me/oauth2/v2.1/authorize",
+		TokenURL:            "https://api.line.me/oauth2/v2.1/token",
+		JWKSURL:             "https://api.line.me/oauth2/v2.1/certs",
+		SigningAlgs:         []string{"HS256", "ES256"},
+		AssumeEmailVerified: true,
+	})
+}
+
+func (p *provider) Name() string {
+	return p.cfg.Name
+}
+
+func (p *provider) AuthCodeURL(state string, nonce string, codeChallenge string, loginHint string) string {
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.cfg.ClientID)
+	q.Set("redirect_uri", p.cfg.RedirectURL)
+	q.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", codeChallenge)
+	q.Set("code_challenge_method", "S256")
+	if loginHint != "" {
+		q.Set("login_hint", loginHint)
+	}
+	return p.cfg.AuthURL + "?" + q.Encode()
+}
+
+func (p *provider) Exchange(ctx context.Context, code string, codeVerifier string, nonce string) (Claims, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("client_secret", p.cfg.ClientSecret)
+	form.Set("code_verifier", codeVerifier)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	res, err := p.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrExchangeFailed, err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrExchangeFailed, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return Claims{}, fmt.Errorf("%w: status %d: %s", ErrExchangeFailed, res.StatusCode, body)
+	}
+	var tokenRes struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokenRes); err != nil || tokenRes.IDToken == "" {
+		return Claims{}, fmt.Errorf("%w: response has no id_token", ErrExchangeFailed)
+	}
+	return p.verifyIDToken(ctx, tokenRes.IDToken, nonce)
+}
+
+func (p *provider) verifyIDToken(ctx context.Context, rawIDToken string, nonce string) (Claims, error) {
+	token, err := jwt.Parse(rawIDToken, func(token *jwt.Token) (interface{}, error) {
+		if strings.HasPrefix(token.Method.Alg(), "HS") {
+			return []byte(p.cfg.ClientSecret), nil
+		}
+		kid, _ := token.Header["kid"].(string)
+		return p.keys.get(ctx, kid)
+	},
+		jwt.WithValidMethods(p.cfg.SigningAlgs),
+		jwt.WithIssuer(p.cfg.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %v", ErrInvalidIDToken, err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	// リプレイ対策、認可リクエストで渡したnonceと一致すること
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return Claims{}, fmt.Errorf("%w: nonce mismatch", ErrInvalidIDToken)
+	}
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return Claims{}, fmt.Errorf("%w: no subject", ErrInvalidIDToken)
+	}
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+	return Claims{
+		Subject:       subject,
+		Email:         email,
+		EmailVerified: email != "" && (p.cfg.AssumeEmailVerified || boolClaim(claims["email_verified"])),
+		Name:          name,
+	}, nil
+}
+
+// プロバイダによってはemail_verifiedが文字列("true")で返る
+func boolClaim(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// PKCEのcode_verifier(43文字以上のランダムな文字列)
+func NewCodeVerifier() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// PKCEのcode_challenge(S256)
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
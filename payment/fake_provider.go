@@ -0,0 +1,198 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// オフラインで開発・動作確認するためのプロセス内完結の偽プロバイダ
+// CardTokenで挙動を切り替える
+//
+//	"tok_decline": 与信拒否
+//	"tok_async":   pendingで返し、confirmDelay後にwebhookでauthorizedを通知
+//	それ以外:       即時authorized
+const (
+	FakeTokenDecline = "tok_decline"
+	FakeTokenAsync   = "tok_async"
+)
+
+// webhookの受け手、usecaseのHandleWebhookを渡す想定
+type WebhookHandler func(payload []byte, signature string) error
+
+type fakePayment struct {
+	amount   int
+	status   string
+	refunded int
+}
+
+// 偽プロバイダはwebhook送信先の設定が必要なので、interfaceではなく構造体のポインタを返す
+type FakePaymentProvider struct {
+	secret       []byte
+	confirmDelay time.Duration
+	handler      WebhookHandler
+	// 並行リクエストから触られるのでMutexで保護
+	mu       sync.Mutex
+	payments map[string]*fakePayment
+}
+
+func NewFakePaymentProvider(secret string, confirmDelay time.Duration) *FakePaymentProvider {
+	return &FakePaymentProvider{
+		secret:       []byte(secret),
+		confirmDelay: confirmDelay,
+		payments:     map[string]*fakePayment{},
+	}
+}
+
+// usecase生成後に呼ぶ(usecaseがproviderに依存しているため、constructorでは渡せない)
+func (fp *FakePaymentProvider) SetWebhookHandler(handler WebhookHandler) {
+	fp.handler = handler
+}
+
+func (fp *FakePaymentProvider) Name() string {
+	return "fake"
+}
+
+func (fp *FakePaymentProvider) Authorize(req AuthorizeRequest) (AuthorizeResult, error) {
+	if req.Amount <= 0 {
+		return AuthorizeResult{}, fmt.Errorf("amount must be positive")
+	}
+	id := "fake_pay_" + randomHex(8)
+	result := AuthorizeResult{ProviderPaymentID: id}
+
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	switch req.CardToken {
+	case FakeTokenDecline:
+		result.Status = StatusDeclined
+		result.DeclineReason = "card_declined"
+	case FakeTokenAsync:
+		result.Status = StatusPending
+		// 3Dセキュア等で確定が後から届くケースを模擬
+		time.AfterFunc(fp.confirmDelay, func() {
+			fp.confirm(id)
+		})
+	default:
+		result.Status = StatusAuthorized
+	}
+	fp.payments[id] = &fakePayment{amount: req.Amount, status: result.Status}
+	return result, nil
+}
+
+func (fp *FakePaymentProvider) Capture(providerPaymentID string) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	p, ok := fp.payments[providerPaymentID]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+	if p.status != StatusAuthorized {
+		return fmt.Errorf("cannot capture payment in status %s", p.status)
+	}
+	p.status = StatusCaptured
+	return nil
+}
+
+func (fp *FakePaymentProvider) Void(providerPaymentID string) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	p, ok := fp.payments[providerPaymentID]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+	if p.status != StatusAuthorized {
+		return fmt.Errorf("cannot void payment in status %s", p.status)
+	}
+	p.status = StatusVoided
+	return nil
+}
+
+func (fp *FakePaymentProvider) Refund(providerPaymentID string, amount int) error {
+	fp.mu.Lock()
+	defer fp.mu.Unlock()
+	p, ok := fp.payments[providerPaymentID]
+	if !ok {
+		return ErrPaymentNotFound
+	}
+	if p.status != StatusCaptured {
+		return fmt.Errorf("cannot refund payment in status %s", p.status)
+	}
+	if amount <= 0 || p.refunded+amount > p.amount {
+		return fmt.Errorf("refund amount exceeds captured amount")
+	}
+	p.refunded += amount
+	if p.refunded == p.amount {
+		p.status = StatusRefunded
+	}
+	return nil
+}
+
+func (fp *FakePaymentProvider) VerifyWebhook(payload []byte, signature string) (WebhookEvent, error) {
+	// 鍵が空だと誰でも署名を作れるので、全て拒否する
+	if len(fp.secret) == 0 {
+		return WebhookEvent{}, ErrInvalidSignature
+	}
+	expected := fp.Sign(payload)
+	// 比較にかかる時間から署名を推測されないように、hmac.Equalで比較する
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return WebhookEvent{}, ErrInvalidSignature
+	}
+	var event WebhookEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return WebhookEvent{}, err
+	}
+	return event, nil
+}
+
+// payloadのHMAC-SHA256を16進文字列で返す
+// curl等で手動でwebhookを送って確認したい時にも使える
+func (fp *FakePaymentProvider) Sign(payload []byte) string {
+	mac := hmac.New(sha256.New, fp.secret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// pendingの決済をauthorizedにして、署名付きwebhookをhandlerへ送る
+func (fp *FakePaymentProvider) confirm(providerPaymentID string) {
+	fp.mu.Lock()
+	p, ok := fp.payments[providerPaymentID]
+	if !ok || p.status != StatusPending {
+		fp.mu.Unlock()
+		return
+	}
+	p.status = StatusAuthorized
+	amount := p.amount
+	fp.mu.Unlock()
+
+	if fp.handler == nil {
+		return
+	}
+	payload, err := json.Marshal(WebhookEvent{
+		EventID:           "fake_evt_" + randomHex(8),
+		Type:              EventAuthorized,
+		ProviderPaymentID: providerPaymentID,
+		Amount:            amount,
+	})
+	if err != nil {
+		log.Printf("fake payment provider: failed to marshal webhook: %v", err)
+		return
+	}
+	if err := fp.handler(payload, fp.Sign(payload)); err != nil {
+		log.Printf("fake payment provider: webhook delivery failed: %v", err)
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/randが失敗するのは実質OSの異常時のみ
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
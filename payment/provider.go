@@ -0,0 +1,66 @@
+package payment
+
+import "errors"
+
+// 決済プロバイダ側のステータス
+// model.Paymentのステータスもこの値をそのまま使う
+const (
+	StatusPending    = "pending"    // 非同期確認待ち(webhookで確定する)
+	StatusAuthorized = "authorized" // 与信確保済み
+	StatusCaptured   = "captured"   // 売上確定済み
+	StatusDeclined   = "declined"   // 与信拒否
+	StatusRefunded   = "refunded"   // 全額返金済み
+	StatusVoided     = "voided"     // 売上確定前に与信を取消済み
+)
+
+// webhookで通知されるイベント種別
+const (
+	EventAuthorized = "payment.authorized"
+	EventDeclined   = "payment.declined"
+	EventCaptured   = "payment.captured"
+	EventRefunded   = "payment.refunded"
+)
+
+// webhookの署名を載せるHTTPヘッダ名
+const SignatureHeader = "X-Payment-Signature"
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrPaymentNotFound  = errors.New("payment does not exist at provider")
+)
+
+type AuthorizeRequest struct {
+	Amount   int    // 円単位
+	Currency string // 現状"JPY"のみ
+	// カード番号そのものではなく、フロントでプロバイダが発行したトークンを受取る想定
+	CardToken string
+}
+
+type AuthorizeResult struct {
+	ProviderPaymentID string
+	Status            string // StatusAuthorized / StatusDeclined / StatusPending
+	DeclineReason     string
+}
+
+// プロバイダから送られてくるwebhookの中身
+// EventIDはプロバイダ側で一意、同じイベントが複数回届くことがあるので冪等性の判定に使う
+type WebhookEvent struct {
+	EventID           string `json:"event_id"`
+	Type              string `json:"type"`
+	ProviderPaymentID string `json:"provider_payment_id"`
+	// payment.refundedの場合はその時点での返金累計額
+	Amount int `json:"amount"`
+}
+
+// 決済プロバイダの抽象
+// 本番用のプロバイダを追加する場合もこのinterfaceを実装すれば、usecase側は変更不要
+type IPaymentProvider interface {
+	Name() string
+	Authorize(req AuthorizeRequest) (AuthorizeResult, error)
+	Capture(providerPaymentID string) error
+	Refund(providerPaymentID string, amount int) error
+	// 売上確定前の与信の取消
+	Void(providerPaymentID string) error
+	// 署名を検証してからイベントを返す、改竄されていればErrInvalidSignature
+	VerifyWebhook(payload []byte, signature string) (WebhookEvent, error)
+}
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"record-shop-rest-api/model"
+	"strconv"
+)
+
+const statementDateLayout = "2006-01-02"
+
+var statementHeader = []string{"date", "type", "item_id", "sale_amount", "commission", "amount", "method", "note"}
+
+// 委託者への支払明細書(CSV)、1行目はヘッダ、期首・期末残高は明細の前後の行に出す
+func ConsignmentStatementCSV(statement model.ConsignmentStatement) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	rows := [][]string{statementHeader}
+	rows = append(rows, []string{statement.From.Format(statementDateLayout), "opening_balance", "", "", "", strconv.Itoa(statement.OpeningBalance), "", ""})
+	for _, entry := range statement.Entries {
+		itemID := ""
+		if entry.ConsignmentItemID != nil {
+			itemID = strconv.Itoa(int(*entry.ConsignmentItemID))
+		}
+		rows = append(rows, []string{
+			entry.CreatedAt.Format(statementDateLayout),
+			entry.Type,
+			itemID,
+			strconv.Itoa(entry.SaleAmount),
+			strconv.Itoa(entry.Commission),
+			strconv.Itoa(entry.Amount),
+			entry.Method,
+			entry.Note,
+		})
+	}
+	rows = append(rows, []string{statement.To.AddDate(0, 0, -1).Format(statementDateLayout), "closing_balance", "", "", "", strconv.Itoa(statement.ClosingBalance), "", ""})
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 委託者への支払明細書(PDF)
+func ConsignmentStatementPDF(statement model.ConsignmentStatement) []byte {
+	lines := []string{
+		"Consignment statement",
+		"",
+		fmt.Sprintf("Consignor: %s (#%d)", statement.Consignor.Name, statement.Consignor.ID),
+		fmt.Sprintf("Period:    %s - %s", statement.From.Format(statementDateLayout), statement.To.AddDate(0, 0, -1).Format(statementDateLayout)),
+		"",
+		fmt.Sprintf("%-10s  %-7s  %7s  %10s  %10s  %10s", "Date", "Type", "Item", "Sale", "Commission", "Amount"),
+		fmt.Sprintf("%-10s  %-7s  %7s  %10s  %10s  %10d", "", "opening", "", "", "", statement.OpeningBalance),
+	}
+	for _, entry := range statement.Entries {
+		itemID := ""
+		if entry.ConsignmentItemID != nil {
+			itemID = strconv.Itoa(int(*entry.ConsignmentItemID))
+		}
+		lines = append(lines, fmt.Sprintf("%-10s  %-7s  %7s  %10d  %10d  %10d",
+			entry.CreatedAt.Format(statementDateLayout), entry.Type, itemID, entry.SaleAmount, entry.Commission, entry.Amount))
+	}
+	lines = append(lines,
+		"",
+		fmt.Sprintf("Total sales:       %10d", statement.TotalSales),
+		fmt.Sprintf("Total commission:  %10d", statement.TotalCommission),
+		fmt.Sprintf("Total payouts:     %10d", statement.TotalPayouts),
+		fmt.Sprintf("Closing balance:   %10d", statement.ClosingBalance),
+	)
+	return TextPDF(lines)
+}
@@ -0,0 +1,79 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// 1ページあたりの行数、A4縦・Courier 10ptで余白を取った値
+const pdfLinesPerPage = 60
+
+// テキスト行だけのPDFを組み立てる、表は等幅フォント(Courier)で桁を揃えて表現する
+// 標準フォントはラテン文字しか持たないので、ASCII以外の文字は?に置き換える
+// (日本語を出すにはフォントの埋め込みが必要)
+func TextPDF(lines []string) []byte {
+	var pages [][]string
+	for start := 0; start < len(lines); start += pdfLinesPerPage {
+		end := min(start+pdfLinesPerPage, len(lines))
+		pages = append(pages, lines[start:end])
+	}
+	if len(pages) == 0 {
+		pages = append(pages, []string{})
+	}
+
+	// オブジェクト番号: 1 カタログ、2 ページツリー、3 フォント、以降ページごとに(ページ, 内容)
+	var objects []string
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+i*2)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>",
+	)
+	for i, page := range pages {
+		var content bytes.Buffer
+		content.WriteString("BT\n/F1 10 Tf\n12 TL\n40 800 Td\n")
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", escapePDFText(line))
+		}
+		content.WriteString("ET")
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+i*2),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return buf.Bytes()
+}
+
+func escapePDFText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			b.WriteRune('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package report
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+	"strings"
+)
+
+// レシートの1行の桁数、58mm幅のレシートプリンタに合わせる
+const receiptWidth = 32
+
+// レジのレシート(テキスト)、レシートプリンタにそのまま送れる
+func PosReceiptText(sale model.PosSale) []byte {
+	return []byte(strings.Join(posReceiptLines(sale), "\n") + "\n")
+}
+
+// レジのレシート(PDF)、再発行やメールでの送付用
+func PosReceiptPDF(sale model.PosSale) []byte {
+	return TextPDF(posReceiptLines(sale))
+}
+
+func posReceiptLines(sale model.PosSale) []string {
+	rule := strings.Repeat("-", receiptWidth)
+	lines := []string{
+		sale.Location.Name,
+		receiptRow(fmt.Sprintf("Sale #%d", sale.ID), sale.CreatedAt.Format("2006-01-02 15:04")),
+		rule,
+	}
+	for _, line := range sale.Lines {
+		lines = append(lines,
+			truncateRunes(line.Title, receiptWidth),
+			receiptRow(fmt.Sprintf("  %s %s %dx%s", line.SKU, line.Grade, line.Quantity, formatAmount(line.UnitPrice)),
+				formatAmount(line.UnitPrice*line.Quantity)),
+		)
+	}
+	lines = append(lines, rule)
+	if sale.Discount > 0 {
+		lines = append(lines, receiptRow("Subtotal", formatAmount(sale.Subtotal)))
+		for _, discount := range sale.Discounts {
+			lines = append(lines, receiptRow(discount.Name, formatAmount(-discount.Amount)))
+		}
+	}
+	lines = append(lines, receiptRow("TOTAL", formatAmount(sale.Total)))
+	// 適格簡易請求書の記載事項: 税率ごとの対価の額(税込)と消費税額
+	for _, tax := range sale.Taxes {
+		lines = append(lines,
+			receiptRow(fmt.Sprintf("  %d%% taxable", tax.Percent), formatAmount(tax.AmountIncludingTax)),
+			receiptRow(fmt.Sprintf("  (incl. tax %d%%)", tax.Percent), formatAmount(tax.Tax)),
+		)
+	}
+	if sale.GiftCardAmount > 0 {
+		lines = append(lines, receiptRow("Gift card", formatAmount(sale.GiftCardAmount)))
+	}
+	if sale.CardAmount > 0 {
+		lines = append(lines, receiptRow("Card", formatAmount(sale.CardAmount)))
+	}
+	if sale.CashReceived > 0 {
+		lines = append(lines,
+			receiptRow("Cash", formatAmount(sale.CashReceived)),
+			receiptRow("Change", formatAmount(sale.Change)),
+		)
+	}
+	for _, ret := range sale.Returns {
+		lines = append(lines, receiptRow(fmt.Sprintf("Returned %s", ret.CreatedAt.Format("01-02")), formatAmount(-ret.Amount)))
+	}
+	if sale.Status == model.PosSaleVoided {
+		lines = append(lines, rule, "*** VOIDED ***")
+	}
+	return append(lines, rule, "Thank you!")
+}
+
+// 左に項目、右に金額を寄せた1行
+func receiptRow(label string, value string) string {
+	width := receiptWidth - len([]rune(value)) - 1
+	return fmt.Sprintf("%-*s %s", width, truncateRunes(label, width), value)
+}
+
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
+
+// 3桁ごとにカンマを入れる、例: 12,800
+func formatAmount(amount int) string {
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	digits := fmt.Sprint(amount)
+	var b strings.Builder
+	for i, r := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(r)
+	}
+	return sign + b.String()
+}
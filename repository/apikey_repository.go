@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"record-shop-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IAPIKeyRepository interface {
+	CreateAPIKey(key *model.APIKey) error
+	GetAPIKeysByUser(userID uint) ([]model.APIKey, error)
+	CountActiveAPIKeys(userID uint, now time.Time) (int64, error)
+	GetAPIKeyByHash(key *model.APIKey, keyHash string) error
+	RevokeAPIKey(userID uint, id uint, now time.Time) error
+	TouchAPIKey(id uint, now time.Time, interval time.Duration) error
+}
+
+type apiKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewAPIKeyRepository(db *gorm.DB) IAPIKeyRepository {
+	return &apiKeyRepository{db}
+}
+
+func (ar *apiKeyRepository) CreateAPIKey(key *model.APIKey) error {
+	if err := ar.db.Create(key).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 失効済み・期限切れも含めて新しい順
+func (ar *apiKeyRepository) GetAPIKeysByUser(userID uint) ([]model.APIKey, error) {
+	var keys []model.APIKey
+	if err := ar.db.Where("user_id=?", userID).Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (ar *apiKeyRepository) CountActiveAPIKeys(userID uint, now time.Time) (int64, error) {
+	var count int64
+	if err := ar.db.Model(&model.APIKey{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, now).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (ar *apiKeyRepository) GetAPIKeyByHash(key *model.APIKey, keyHash string) error {
+	if err := ar.db.Preload("User").Where("key_hash=?", keyHash).First(key).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 自分のキーのみ失効できる、他人のキーや失効済みのキーはErrRecordNotFound
+func (ar *apiKeyRepository) RevokeAPIKey(userID uint, id uint, now time.Time) error {
+	result := ar.db.Model(&model.APIKey{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// 最終使用日時の記録、リクエストごとに書込まないようにinterval以上経っている場合のみ更新する
+func (ar *apiKeyRepository) TouchAPIKey(id uint, now time.Time, interval time.Duration) error {
+	if err := ar.db.Model(&model.APIKey{}).
+		Where("id = ? AND (last_used_at IS NULL OR last_used_at < ?)", id, now.Add(-interval)).
+		Update("last_used_at", now).Error; err != nil {
+		return err
+	}
+	return nil
+}
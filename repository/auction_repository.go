@@ -0,0 +1,394 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"record-shop-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IAuctionRepository interface {
+	CreateListing(listing *model.AuctionListing) error
+	GetListingByID(listing *model.AuctionListing, id uint) error
+	GetOpenListings() ([]model.AuctionListing, error)
+	GetListingsByWinner(userID uint) ([]model.AuctionListing, error)
+	GetDueAuctions(now time.Time) ([]model.AuctionListing, error)
+	GetOverdueAwards(now time.Time) ([]model.AuctionListing, error)
+	UpdateListingStatus(listing *model.AuctionListing, fromStatus string) error
+	MarkListingPaid(listing *model.AuctionListing, now time.Time) error
+	SetListingOrder(listing *model.AuctionListing) error
+	CancelListing(id uint) error
+	PlaceBid(bid *model.AuctionBid, now time.Time) (model.AuctionListing, *uint, error)
+	CloseAuction(listing *model.AuctionListing, now time.Time, paymentWindow time.Duration) error
+	ReassignAward(listing *model.AuctionListing, now time.Time, paymentWindow time.Duration) (uint, error)
+	CreateOffer(offer *model.AuctionOffer) error
+	GetOffersByListing(listingID uint) ([]model.AuctionOffer, error)
+	AcceptOffer(listing *model.AuctionListing, offerID uint, now time.Time, paymentWindow time.Duration) (model.AuctionOffer, error)
+	DeclineOffer(listingID uint, offerID uint) (model.AuctionOffer, error)
+}
+
+type auctionRepository struct {
+	db *gorm.DB
+}
+
+func NewAuctionRepository(db *gorm.DB) IAuctionRepository {
+	return &auctionRepository{db}
+}
+
+func (ar *auctionRepository) CreateListing(listing *model.AuctionListing) error {
+	if err := ar.db.Create(listing).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 入札は高い順
+func (ar *auctionRepository) GetListingByID(listing *model.AuctionListing, id uint) error {
+	if err := ar.db.
+		Preload("Bids", func(db *gorm.DB) *gorm.DB {
+			return db.Order("amount DESC, id ASC")
+		}).
+		First(listing, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 終了が近い順、価格交渉(終了時刻なし)は最後
+func (ar *auctionRepository) GetOpenListings() ([]model.AuctionListing, error) {
+	var listings []model.AuctionListing
+	if err := ar.db.Where("status=?", model.AuctionOpen).
+		Order("ends_at ASC NULLS LAST, id ASC").
+		Find(&listings).Error; err != nil {
+		return nil, err
+	}
+	return listings, nil
+}
+
+func (ar *auctionRepository) GetListingsByWinner(userID uint) ([]model.AuctionListing, error) {
+	var listings []model.AuctionListing
+	if err := ar.db.Where("winner_id=?", userID).
+		Order("awarded_at DESC").
+		Find(&listings).Error; err != nil {
+		return nil, err
+	}
+	return listings, nil
+}
+
+func (ar *auctionRepository) GetDueAuctions(now time.Time) ([]model.AuctionListing, error) {
+	var listings []model.AuctionListing
+	if err := ar.db.Where("type = ? AND status = ? AND ends_at <= ?", model.ListingAuction, model.AuctionOpen, now).
+		Order("ends_at ASC").
+		Find(&listings).Error; err != nil {
+		return nil, err
+	}
+	return listings, nil
+}
+
+// 支払期限を過ぎた落札済みの出品
+func (ar *auctionRepository) GetOverdueAwards(now time.Time) ([]model.AuctionListing, error) {
+	var listings []model.AuctionListing
+	if err := ar.db.Where("status = ? AND payment_due_at <= ?", model.AuctionAwarded, now).
+		Order("payment_due_at ASC").
+		Find(&listings).Error; err != nil {
+		return nil, err
+	}
+	return listings, nil
+}
+
+// 更新条件にfromStatusを含めて、同時に別のリクエストで状態が変わった場合は更新しない(楽観ロック)
+func (ar *auctionRepository) UpdateListingStatus(listing *model.AuctionListing, fromStatus string) error {
+	result := ar.db.Model(&model.AuctionListing{}).
+		Where("id = ? AND status = ?", listing.ID, fromStatus).
+		Updates(map[string]interface{}{
+			"status":     listing.Status,
+			"payment_id": listing.PaymentID,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+// 落札者の支払済みへの更新、落札者と支払期限を更新条件に含める
+// 支払期限切れで次点に繰上げられた後に、前の落札者の支払で支払済みにならないようにする
+func (ar *auctionRepository) MarkListingPaid(listing *model.AuctionListing, now time.Time) error {
+	result := ar.db.Model(&model.AuctionListing{}).
+		Where("id = ? AND status = ? AND winner_id = ? AND payment_due_at > ?",
+			listing.ID, model.AuctionAwarded, listing.WinnerID, now).
+		Updates(map[string]interface{}{
+			"status":     model.AuctionPaid,
+			"payment_id": listing.PaymentID,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return fmt.Errorf("%w: listing is no longer awaiting your payment", ErrStaleObject)
+	}
+	listing.Status = model.AuctionPaid
+	return nil
+}
+
+// 入札が入っていない出品のみ取下げられる、保留中の申し出は全て断る
+// 落札者の注文を紐付ける、その間に繰上げられた・既に紐付いている場合はErrStaleObject
+func (ar *auctionRepository) SetListingOrder(listing *model.AuctionListing) error {
+	result := ar.db.Model(&model.AuctionListing{}).
+		Where("id = ? AND status = ? AND winner_id = ? AND order_id IS NULL", listing.ID, model.AuctionAwarded, listing.WinnerID).
+		Update("order_id", listing.OrderID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+func (ar *auctionRepository) CancelListing(id uint) error {
+	return ar.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.AuctionListing{}).
+			Where("id = ? AND status = ? AND bid_count = 0", id, model.AuctionOpen).
+			Update("status", model.AuctionCancelled)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return fmt.Errorf("%w: listing is not open or already has bids", ErrStaleObject)
+		}
+		return tx.Model(&model.AuctionOffer{}).
+			Where("listing_id = ? AND status = ?", id, model.OfferPending).
+			Update("status", model.OfferDeclined).Error
+	})
+}
+
+// 出品の行をFOR UPDATEでロックしてから、現在価格と終了時刻を確認して入札を記録する
+// 同時に入札しても、同じ価格で2人がトップになったり、終了後の入札が通ったりしない
+// 入札前のトップ入札者を返す(上回られたことの通知用)
+func (ar *auctionRepository) PlaceBid(bid *model.AuctionBid, now time.Time) (model.AuctionListing, *uint, error) {
+	var listing model.AuctionListing
+	var previousLeader *uint
+	err := ar.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&listing, bid.ListingID).Error; err != nil {
+			return err
+		}
+		if listing.Type != model.ListingAuction || listing.Status != model.AuctionOpen {
+			return fmt.Errorf("%w: listing is not an open auction", ErrStaleObject)
+		}
+		if !now.Before(*listing.EndsAt) {
+			return fmt.Errorf("%w: auction ended at %s", ErrExpired, listing.EndsAt.Format(time.RFC3339))
+		}
+		if listing.LeaderID != nil && *listing.LeaderID == bid.UserID {
+			return fmt.Errorf("%w: you are already the highest bidder", ErrStaleObject)
+		}
+		minimum := listing.StartPrice
+		if listing.BidCount > 0 {
+			minimum = listing.CurrentPrice + listing.BidIncrement
+		}
+		if bid.Amount < minimum {
+			return fmt.Errorf("%w: bid must be at least %d", ErrStaleObject, minimum)
+		}
+		previousLeader = listing.LeaderID
+		// 終了間際の入札は終了時刻を延長して、締切直前の駆込み入札(スナイピング)で決まらないようにする
+		window := time.Duration(listing.ExtensionMinutes) * time.Minute
+		if window > 0 && listing.EndsAt.Sub(now) < window {
+			endsAt := now.Add(window)
+			listing.EndsAt = &endsAt
+		}
+		listing.CurrentPrice = bid.Amount
+		listing.BidCount++
+		listing.LeaderID = &bid.UserID
+		if err := tx.Model(&model.AuctionListing{}).Where("id=?", listing.ID).
+			Updates(map[string]interface{}{
+				"current_price": listing.CurrentPrice,
+				"bid_count":     listing.BidCount,
+				"leader_id":     listing.LeaderID,
+				"ends_at":       listing.EndsAt,
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Create(bid).Error
+	})
+	if err != nil {
+		return model.AuctionListing{}, nil, err
+	}
+	return listing, previousLeader, nil
+}
+
+// 終了時刻を過ぎたオークションを締める
+// 最低落札価格以上の入札があればトップ入札者の落札、なければ不成立
+// 行をロックして終了時刻を確認し直すので、延長された直後のオークションを締めることはない
+func (ar *auctionRepository) CloseAuction(listing *model.AuctionListing, now time.Time, paymentWindow time.Duration) error {
+	return ar.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(listing, listing.ID).Error; err != nil {
+			return err
+		}
+		if listing.Status != model.AuctionOpen || now.Before(*listing.EndsAt) {
+			return ErrStaleObject
+		}
+		if listing.BidCount > 0 && listing.CurrentPrice >= listing.ReservePrice {
+			listing.WinnerID = listing.LeaderID
+			listing.WinningAmount = listing.CurrentPrice
+			award(listing, now, paymentWindow)
+		} else {
+			listing.Status = model.AuctionUnsold
+		}
+		return updateAward(tx, listing)
+	})
+}
+
+// 支払期限を過ぎた落札を取消し、前の落札者を返す
+// オークション: 前の落札者の入札を無効にして、最低落札価格以上の次点の入札者に繰上げる、いなければ不成立
+// 価格交渉: 出品を受付中に戻して、申し出を受付け直す
+// 行をロックして期限を確認し直すので、期限直前に支払われた出品を取消すことはない
+func (ar *auctionRepository) ReassignAward(listing *model.AuctionListing, now time.Time, paymentWindow time.Duration) (uint, error) {
+	var previousWinner uint
+	err := ar.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(listing, listing.ID).Error; err != nil {
+			return err
+		}
+		if listing.Status != model.AuctionAwarded || listing.PaymentDueAt == nil || now.Before(*listing.PaymentDueAt) {
+			return ErrStaleObject
+		}
+		previousWinner = *listing.WinnerID
+		listing.WinnerID = nil
+		listing.OrderID = nil
+		listing.WinningAmount = 0
+		listing.AwardedAt = nil
+		listing.PaymentDueAt = nil
+		if listing.Type == model.ListingBestOffer {
+			listing.Status = model.AuctionOpen
+			return updateAward(tx, listing)
+		}
+		if err := tx.Model(&model.AuctionBid{}).
+			Where("listing_id = ? AND user_id = ?", listing.ID, previousWinner).
+			Update("forfeited", true).Error; err != nil {
+			return err
+		}
+		var next model.AuctionBid
+		err := tx.Where("listing_id = ? AND forfeited = ? AND amount >= ?", listing.ID, false, listing.ReservePrice).
+			Order("amount DESC, id ASC").First(&next).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			listing.Status = model.AuctionUnsold
+			return updateAward(tx, listing)
+		}
+		if err != nil {
+			return err
+		}
+		// 次点は自分の入札額で落札する
+		listing.WinnerID = &next.UserID
+		listing.WinningAmount = next.Amount
+		award(listing, now, paymentWindow)
+		return updateAward(tx, listing)
+	})
+	if err != nil {
+		return 0, err
+	}
+	return previousWinner, nil
+}
+
+// 出品の行をロックして、承諾・取下げと同時に申し出が入らないようにする
+func (ar *auctionRepository) CreateOffer(offer *model.AuctionOffer) error {
+	return ar.db.Transaction(func(tx *gorm.DB) error {
+		var listing model.AuctionListing
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&listing, offer.ListingID).Error; err != nil {
+			return err
+		}
+		if listing.Type != model.ListingBestOffer || listing.Status != model.AuctionOpen {
+			return fmt.Errorf("%w: listing is not accepting offers", ErrStaleObject)
+		}
+		return tx.Create(offer).Error
+	})
+}
+
+func (ar *auctionRepository) GetOffersByListing(listingID uint) ([]model.AuctionOffer, error) {
+	var offers []model.AuctionOffer
+	if err := ar.db.Where("listing_id=?", listingID).
+		Order("amount DESC, id ASC").
+		Find(&offers).Error; err != nil {
+		return nil, err
+	}
+	return offers, nil
+}
+
+// 申し出を承諾して出品を落札済みにする、他の保留中の申し出は全て断る
+func (ar *auctionRepository) AcceptOffer(listing *model.AuctionListing, offerID uint, now time.Time, paymentWindow time.Duration) (model.AuctionOffer, error) {
+	var offer model.AuctionOffer
+	err := ar.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(listing, listing.ID).Error; err != nil {
+			return err
+		}
+		if listing.Type != model.ListingBestOffer || listing.Status != model.AuctionOpen {
+			return fmt.Errorf("%w: listing is not accepting offers", ErrStaleObject)
+		}
+		if err := tx.Where("id = ? AND listing_id = ?", offerID, listing.ID).First(&offer).Error; err != nil {
+			return err
+		}
+		if offer.Status != model.OfferPending {
+			return fmt.Errorf("%w: offer is %s", ErrStaleObject, offer.Status)
+		}
+		offer.Status = model.OfferAccepted
+		if err := tx.Model(&model.AuctionOffer{}).Where("id=?", offer.ID).
+			Update("status", offer.Status).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.AuctionOffer{}).
+			Where("listing_id = ? AND status = ?", listing.ID, model.OfferPending).
+			Update("status", model.OfferDeclined).Error; err != nil {
+			return err
+		}
+		listing.WinnerID = &offer.UserID
+		listing.WinningAmount = offer.Amount
+		award(listing, now, paymentWindow)
+		return updateAward(tx, listing)
+	})
+	if err != nil {
+		return model.AuctionOffer{}, err
+	}
+	return offer, nil
+}
+
+func (ar *auctionRepository) DeclineOffer(listingID uint, offerID uint) (model.AuctionOffer, error) {
+	var offer model.AuctionOffer
+	if err := ar.db.Where("id = ? AND listing_id = ?", offerID, listingID).First(&offer).Error; err != nil {
+		return model.AuctionOffer{}, err
+	}
+	result := ar.db.Model(&model.AuctionOffer{}).
+		Where("id = ? AND status = ?", offer.ID, model.OfferPending).
+		Update("status", model.OfferDeclined)
+	if result.Error != nil {
+		return model.AuctionOffer{}, result.Error
+	}
+	if result.RowsAffected < 1 {
+		return model.AuctionOffer{}, fmt.Errorf("%w: offer is %s", ErrStaleObject, offer.Status)
+	}
+	offer.Status = model.OfferDeclined
+	return offer, nil
+}
+
+// 落札済みにして、支払期限を付ける
+func award(listing *model.AuctionListing, now time.Time, paymentWindow time.Duration) {
+	dueAt := now.Add(paymentWindow)
+	listing.Status = model.AuctionAwarded
+	listing.AwardedAt = &now
+	listing.PaymentDueAt = &dueAt
+}
+
+// ロック済みの出品の落札に関する項目を更新する
+func updateAward(tx *gorm.DB, listing *model.AuctionListing) error {
+	return tx.Model(&model.AuctionListing{}).Where("id=?", listing.ID).
+		Updates(map[string]interface{}{
+			"status":         listing.Status,
+			"winner_id":      listing.WinnerID,
+			"winning_amount": listing.WinningAmount,
+			"awarded_at":     listing.AwardedAt,
+			"payment_due_at": listing.PaymentDueAt,
+			"order_id":       listing.OrderID,
+		}).Error
+}
@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IConsignmentRepository interface {
+	CreateConsignor(consignor *model.Consignor) error
+	GetConsignors() ([]model.Consignor, error)
+	GetConsignorByID(consignor *model.Consignor, id uint) error
+	GetBalance(consignorID uint, before *time.Time) (int, error)
+	CreateItem(item *model.ConsignmentItem) error
+	GetItemsByConsignor(consignorID uint) ([]model.ConsignmentItem, error)
+	GetItemByID(item *model.ConsignmentItem, id uint) error
+	SellItem(item *model.ConsignmentItem, entry *model.ConsignmentLedgerEntry) error
+	CancelSale(itemID uint, entry *model.ConsignmentLedgerEntry) error
+	ReturnItem(id uint) error
+	RecordPayout(entry *model.ConsignmentLedgerEntry) error
+	GetLedgerEntries(consignorID uint, from time.Time, to time.Time) ([]model.ConsignmentLedgerEntry, error)
+}
+
+type consignmentRepository struct {
+	db *gorm.DB
+}
+
+func NewConsignmentRepository(db *gorm.DB) IConsignmentRepository {
+	return &consignmentRepository{db}
+}
+
+func (cr *consignmentRepository) CreateConsignor(consignor *model.Consignor) error {
+	if err := cr.db.Create(consignor).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cr *consignmentRepository) GetConsignors() ([]model.Consignor, error) {
+	var consignors []model.Consignor
+	if err := cr.db.Order("id ASC").Find(&consignors).Error; err != nil {
+		return nil, err
+	}
+	return consignors, nil
+}
+
+func (cr *consignmentRepository) GetConsignorByID(consignor *model.Consignor, id uint) error {
+	if err := cr.db.First(consignor, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 台帳の合計、beforeを指定するとその時刻より前の分だけ(期首残高)
+func (cr *consignmentRepository) GetBalance(consignorID uint, before *time.Time) (int, error) {
+	var balance int
+	query := cr.db.Model(&model.ConsignmentLedgerEntry{}).
+		Select("COALESCE(SUM(amount), 0)").
+		Where("consignor_id=?", consignorID)
+	if before != nil {
+		query = query.Where("created_at < ?", *before)
+	}
+	if err := query.Scan(&balance).Error; err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+func (cr *consignmentRepository) CreateItem(item *model.ConsignmentItem) error {
+	if err := cr.db.Create(item).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (cr *consignmentRepository) GetItemsByConsignor(consignorID uint) ([]model.ConsignmentItem, error) {
+	var items []model.ConsignmentItem
+	if err := cr.db.Where("consignor_id=?", consignorID).Order("id ASC").Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (cr *consignmentRepository) GetItemByID(item *model.ConsignmentItem, id uint) error {
+	if err := cr.db.First(item, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 販売済みへの更新と台帳への記録を1トランザクションで行う
+// 販売中の場合のみ更新するので、同じ委託品が二重に計上されることはない
+func (cr *consignmentRepository) SellItem(item *model.ConsignmentItem, entry *model.ConsignmentLedgerEntry) error {
+	return cr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.ConsignmentItem{}).
+			Where("id = ? AND status = ?", item.ID, model.ConsignmentAvailable).
+			Updates(map[string]interface{}{
+				"status":     model.ConsignmentSold,
+				"sale_price": item.SalePrice,
+				"sold_at":    item.SoldAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		return tx.Create(entry).Error
+	})
+}
+
+// 販売済みを販売中に戻し、直近の販売の記録を打消す取消を台帳に記録する
+// entryにはRecordedBy・Noteを入れて渡す、金額は元の販売の記録から埋める
+// 販売済みの場合のみ更新するので、二重に取消されることはない
+func (cr *consignmentRepository) CancelSale(itemID uint, entry *model.ConsignmentLedgerEntry) error {
+	return cr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.ConsignmentItem{}).
+			Where("id = ? AND status = ?", itemID, model.ConsignmentSold).
+			Updates(map[string]interface{}{
+				"status":     model.ConsignmentAvailable,
+				"sale_price": 0,
+				"sold_at":    nil,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		var sale model.ConsignmentLedgerEntry
+		if err := tx.Where("consignment_item_id = ? AND type = ?", itemID, model.LedgerSale).
+			Order("id DESC").First(&sale).Error; err != nil {
+			return err
+		}
+		entry.ConsignorID = sale.ConsignorID
+		entry.ConsignmentItemID = &itemID
+		entry.Type = model.LedgerSaleReversal
+		entry.SaleAmount = -sale.SaleAmount
+		entry.Commission = -sale.Commission
+		entry.Amount = -sale.Amount
+		return tx.Create(entry).Error
+	})
+}
+
+func (cr *consignmentRepository) ReturnItem(id uint) error {
+	result := cr.db.Model(&model.ConsignmentItem{}).
+		Where("id = ? AND status = ?", id, model.ConsignmentAvailable).
+		Update("status", model.ConsignmentReturned)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+// 委託者の行をFOR UPDATEでロックして残高を確認してから支払を記録する
+// 同時に支払を記録しても、残高を超えて支払うことはない
+func (cr *consignmentRepository) RecordPayout(entry *model.ConsignmentLedgerEntry) error {
+	return cr.db.Transaction(func(tx *gorm.DB) error {
+		var consignor model.Consignor
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&consignor, entry.ConsignorID).Error; err != nil {
+			return err
+		}
+		var balance int
+		if err := tx.Model(&model.ConsignmentLedgerEntry{}).
+			Select("COALESCE(SUM(amount), 0)").
+			Where("consignor_id=?", entry.ConsignorID).
+			Scan(&balance).Error; err != nil {
+			return err
+		}
+		if balance+entry.Amount < 0 {
+			return fmt.Errorf("%w: payout exceeds balance of %d", ErrInsufficientBalance, balance)
+		}
+		return tx.Create(entry).Error
+	})
+}
+
+// fromを含み、toを含まない期間の明細
+func (cr *consignmentRepository) GetLedgerEntries(consignorID uint, from time.Time, to time.Time) ([]model.ConsignmentLedgerEntry, error) {
+	var entries []model.ConsignmentLedgerEntry
+	if err := cr.db.
+		Where("consignor_id = ? AND created_at >= ? AND created_at < ?", consignorID, from, to).
+		Order("created_at ASC, id ASC").
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,16 @@
+package repository
+
+import "errors"
+
+var (
+	// 同じwebhookイベントが既に処理済みの場合に返す
+	ErrDuplicateEvent = errors.New("event already processed")
+	// 読み込んだ後に別のリクエストで状態が変わっていて、更新できなかった場合に返す
+	ErrStaleObject = errors.New("object was changed by another request")
+	// 残高を超えて支払・利用しようとした場合に返す
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	// 在庫数を超えて出庫しようとした場合に返す
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// 有効期限切れのギフトカード・店内クレジットを使おうとした場合に返す
+	ErrExpired = errors.New("expired")
+)
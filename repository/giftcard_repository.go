@@ -0,0 +1,360 @@
+package repository
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IGiftCardRepository interface {
+	CreateGiftCard(card *model.GiftCard, actorID uint) error
+	GetGiftCardByCodeHash(card *model.GiftCard, codeHash string) error
+	GetGiftCardTransactions(cardID uint) ([]model.GiftCardTransaction, error)
+	GetStoreCredit(userID uint) (model.StoreCreditAccount, []model.StoreCreditTransaction, error)
+	GrantStoreCredit(entry *model.StoreCreditTransaction, expiresAt time.Time) error
+	Redeem(userID uint, codeHashes []string, useStoreCredit bool, amountDue int, reference string,
+		now time.Time, creditExpiresAt time.Time) ([]model.TenderApplied, error)
+	Reverse(userID uint, reference string) ([]model.TenderApplied, error)
+	Refund(userID uint, reference string, amount int, actorID uint) ([]model.TenderApplied, error)
+}
+
+type giftCardRepository struct {
+	db *gorm.DB
+}
+
+func NewGiftCardRepository(db *gorm.DB) IGiftCardRepository {
+	return &giftCardRepository{db}
+}
+
+// カードと発行の取引を1トランザクションで作成
+func (gr *giftCardRepository) CreateGiftCard(card *model.GiftCard, actorID uint) error {
+	return gr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(card).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.GiftCardTransaction{
+			GiftCardID:   card.ID,
+			Type:         model.BalanceIssue,
+			Amount:       card.InitialAmount,
+			BalanceAfter: card.Balance,
+			ActorID:      actorID,
+		}).Error
+	})
+}
+
+func (gr *giftCardRepository) GetGiftCardByCodeHash(card *model.GiftCard, codeHash string) error {
+	if err := gr.db.Where("code_hash=?", codeHash).First(card).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (gr *giftCardRepository) GetGiftCardTransactions(cardID uint) ([]model.GiftCardTransaction, error) {
+	var transactions []model.GiftCardTransaction
+	if err := gr.db.Where("gift_card_id=?", cardID).Order("id ASC").Find(&transactions).Error; err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
+
+// 口座が無ければ残高0として返す
+func (gr *giftCardRepository) GetStoreCredit(userID uint) (model.StoreCreditAccount, []model.StoreCreditTransaction, error) {
+	account := model.StoreCreditAccount{UserID: userID}
+	if err := gr.db.Where("user_id=?", userID).Limit(1).Find(&account).Error; err != nil {
+		return model.StoreCreditAccount{}, nil, err
+	}
+	var transactions []model.StoreCreditTransaction
+	if err := gr.db.Where("user_id=?", userID).Order("id DESC").Find(&transactions).Error; err != nil {
+		return model.StoreCreditAccount{}, nil, err
+	}
+	return account, transactions, nil
+}
+
+// 店内クレジットの付与、有効期限はexpiresAtまで延長する
+func (gr *giftCardRepository) GrantStoreCredit(entry *model.StoreCreditTransaction, expiresAt time.Time) error {
+	return gr.db.Transaction(func(tx *gorm.DB) error {
+		account, err := lockStoreCreditAccount(tx, entry.UserID)
+		if err != nil {
+			return err
+		}
+		account.Balance += entry.Amount
+		account.ExpiresAt = &expiresAt
+		if err := tx.Model(&model.StoreCreditAccount{}).Where("user_id=?", account.UserID).
+			Updates(map[string]interface{}{"balance": account.Balance, "expires_at": account.ExpiresAt}).Error; err != nil {
+			return err
+		}
+		entry.BalanceAfter = account.Balance
+		return tx.Create(entry).Error
+	})
+}
+
+// ギフトカード・店内クレジットを支払に充当する
+// 全て1トランザクションで行い、カード・口座の行はFOR UPDATEでロックする
+// 並行したリクエストで同じカードを使っても、後のリクエストは前の利用後の残高を見るので二重に使われない
+// 同じreferenceで既に利用済みならErrDuplicateEventを返す(二重送信対策)
+func (gr *giftCardRepository) Redeem(userID uint, codeHashes []string, useStoreCredit bool, amountDue int, reference string,
+	now time.Time, creditExpiresAt time.Time) ([]model.TenderApplied, error) {
+	applied := []model.TenderApplied{}
+	err := gr.db.Transaction(func(tx *gorm.DB) error {
+		remaining := amountDue
+		// デッドロックを避けるため、ロックは指定順ではなくIDの順に取る
+		var cards []model.GiftCard
+		if len(codeHashes) > 0 {
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+				Where("code_hash IN ?", codeHashes).Order("id ASC").Find(&cards).Error; err != nil {
+				return err
+			}
+		}
+		cardsByHash := map[string]model.GiftCard{}
+		for _, card := range cards {
+			cardsByHash[card.CodeHash] = card
+		}
+		for _, codeHash := range codeHashes {
+			card, ok := cardsByHash[codeHash]
+			if !ok {
+				return fmt.Errorf("gift card: %w", gorm.ErrRecordNotFound)
+			}
+			if !now.Before(card.ExpiresAt) {
+				return fmt.Errorf("%w: gift card ending in %s expired at %s", ErrExpired, card.Last4, card.ExpiresAt.Format(time.DateOnly))
+			}
+			var used int64
+			if err := tx.Model(&model.GiftCardTransaction{}).
+				Where("gift_card_id = ? AND type = ? AND reference = ?", card.ID, model.BalanceRedeem, reference).
+				Count(&used).Error; err != nil {
+				return err
+			}
+			if used > 0 {
+				return fmt.Errorf("%w: reference %s", ErrDuplicateEvent, reference)
+			}
+			amount := min(card.Balance, remaining)
+			if amount == 0 {
+				continue
+			}
+			card.Balance -= amount
+			if err := tx.Model(&model.GiftCard{}).Where("id=?", card.ID).
+				Update("balance", card.Balance).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&model.GiftCardTransaction{
+				GiftCardID:   card.ID,
+				Type:         model.BalanceRedeem,
+				Amount:       -amount,
+				BalanceAfter: card.Balance,
+				Reference:    reference,
+				ActorID:      userID,
+			}).Error; err != nil {
+				return err
+			}
+			remaining -= amount
+			applied = append(applied, model.TenderApplied{Source: "gift_card", Last4: card.Last4, Amount: amount, Balance: card.Balance})
+		}
+
+		if !useStoreCredit || remaining == 0 {
+			return nil
+		}
+		account, err := lockStoreCreditAccount(tx, userID)
+		if err != nil {
+			return err
+		}
+		var used int64
+		if err := tx.Model(&model.StoreCreditTransaction{}).
+			Where("user_id = ? AND type = ? AND reference = ?", userID, model.BalanceRedeem, reference).
+			Count(&used).Error; err != nil {
+			return err
+		}
+		if used > 0 {
+			return fmt.Errorf("%w: reference %s", ErrDuplicateEvent, reference)
+		}
+		if account.Balance > 0 && account.ExpiresAt != nil && !now.Before(*account.ExpiresAt) {
+			return fmt.Errorf("%w: store credit expired at %s", ErrExpired, account.ExpiresAt.Format(time.DateOnly))
+		}
+		amount := min(account.Balance, remaining)
+		if amount == 0 {
+			return nil
+		}
+		account.Balance -= amount
+		if err := tx.Model(&model.StoreCreditAccount{}).Where("user_id=?", userID).
+			Updates(map[string]interface{}{"balance": account.Balance, "expires_at": creditExpiresAt}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&model.StoreCreditTransaction{
+			UserID:       userID,
+			Type:         model.BalanceRedeem,
+			Amount:       -amount,
+			BalanceAfter: account.Balance,
+			Reference:    reference,
+			ActorID:      userID,
+		}).Error; err != nil {
+			return err
+		}
+		applied = append(applied, model.TenderApplied{Source: "store_credit", Amount: amount, Balance: account.Balance})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return applied, nil
+}
+
+// referenceで利用した分を全て残高に戻す、カード決済が失敗した場合や注文の取消で使う
+// 期限切れのカードにも戻す(期限の延長はしない)
+// 既に戻し済みならErrDuplicateEventを返す
+func (gr *giftCardRepository) Reverse(userID uint, reference string) ([]model.TenderApplied, error) {
+	reversed := []model.TenderApplied{}
+	err := gr.db.Transaction(func(tx *gorm.DB) error {
+		var cardTransactions []model.GiftCardTransaction
+		if err := tx.Where("actor_id = ? AND reference = ? AND type IN ?", userID, reference,
+			[]string{model.BalanceRedeem, model.BalanceReversal}).
+			Order("gift_card_id ASC, id ASC").Find(&cardTransactions).Error; err != nil {
+			return err
+		}
+		var creditTransactions []model.StoreCreditTransaction
+		if err := tx.Where("user_id = ? AND reference = ? AND type IN ?", userID, reference,
+			[]string{model.BalanceRedeem, model.BalanceReversal}).
+			Find(&creditTransactions).Error; err != nil {
+			return err
+		}
+		for _, t := range cardTransactions {
+			if t.Type == model.BalanceReversal {
+				return fmt.Errorf("%w: reference %s", ErrDuplicateEvent, reference)
+			}
+		}
+		for _, t := range creditTransactions {
+			if t.Type == model.BalanceReversal {
+				return fmt.Errorf("%w: reference %s", ErrDuplicateEvent, reference)
+			}
+		}
+		if len(cardTransactions) == 0 && len(creditTransactions) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		for _, t := range cardTransactions {
+			var card model.GiftCard
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&card, t.GiftCardID).Error; err != nil {
+				return err
+			}
+			card.Balance += -t.Amount
+			if err := tx.Model(&model.GiftCard{}).Where("id=?", card.ID).
+				Update("balance", card.Balance).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&model.GiftCardTransaction{
+				GiftCardID:   card.ID,
+				Type:         model.BalanceReversal,
+				Amount:       -t.Amount,
+				BalanceAfter: card.Balance,
+				Reference:    reference,
+				ActorID:      userID,
+			}).Error; err != nil {
+				return err
+			}
+			reversed = append(reversed, model.TenderApplied{Source: "gift_card", Last4: card.Last4, Amount: -t.Amount, Balance: card.Balance})
+		}
+		for _, t := range creditTransactions {
+			account, err := lockStoreCreditAccount(tx, userID)
+			if err != nil {
+				return err
+			}
+			account.Balance += -t.Amount
+			if err := tx.Model(&model.StoreCreditAccount{}).Where("user_id=?", userID).
+				Update("balance", account.Balance).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&model.StoreCreditTransaction{
+				UserID:       userID,
+				Type:         model.BalanceReversal,
+				Amount:       -t.Amount,
+				BalanceAfter: account.Balance,
+				Reference:    reference,
+				ActorID:      userID,
+			}).Error; err != nil {
+				return err
+			}
+			reversed = append(reversed, model.TenderApplied{Source: "store_credit", Amount: -t.Amount, Balance: account.Balance})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversed, nil
+}
+
+// 返品の返金、userIDがreferenceで利用したギフトカードにamountまで戻す
+// カードごとに、利用した額からそれまでに返金した額を引いた分まで、利用した順に戻す
+// 期限切れのカードにも戻す(期限の延長はしない)
+func (gr *giftCardRepository) Refund(userID uint, reference string, amount int, actorID uint) ([]model.TenderApplied, error) {
+	refunded := []model.TenderApplied{}
+	err := gr.db.Transaction(func(tx *gorm.DB) error {
+		var redeems []model.GiftCardTransaction
+		if err := tx.Where("actor_id = ? AND reference = ? AND type = ?", userID, reference, model.BalanceRedeem).
+			Order("id ASC").Find(&redeems).Error; err != nil {
+			return err
+		}
+		if len(redeems) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		remaining := amount
+		for _, redeem := range redeems {
+			if remaining == 0 {
+				break
+			}
+			var card model.GiftCard
+			if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&card, redeem.GiftCardID).Error; err != nil {
+				return err
+			}
+			var alreadyRefunded int
+			if err := tx.Model(&model.GiftCardTransaction{}).
+				Where("gift_card_id = ? AND reference = ? AND type = ?", card.ID, reference, model.BalanceRefund).
+				Select("COALESCE(SUM(amount), 0)").Scan(&alreadyRefunded).Error; err != nil {
+				return err
+			}
+			credit := min(remaining, -redeem.Amount-alreadyRefunded)
+			if credit <= 0 {
+				continue
+			}
+			card.Balance += credit
+			if err := tx.Model(&model.GiftCard{}).Where("id=?", card.ID).
+				Update("balance", card.Balance).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&model.GiftCardTransaction{
+				GiftCardID:   card.ID,
+				Type:         model.BalanceRefund,
+				Amount:       credit,
+				BalanceAfter: card.Balance,
+				Reference:    reference,
+				ActorID:      actorID,
+			}).Error; err != nil {
+				return err
+			}
+			remaining -= credit
+			refunded = append(refunded, model.TenderApplied{Source: "gift_card", Last4: card.Last4, Amount: credit, Balance: card.Balance})
+		}
+		if remaining > 0 {
+			return fmt.Errorf("%w: %d exceeds the gift card amount left to refund", ErrInsufficientBalance, remaining)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return refunded, nil
+}
+
+// 口座の行をFOR UPDATEでロックして返す、無ければ残高0で作る
+func lockStoreCreditAccount(tx *gorm.DB, userID uint) (model.StoreCreditAccount, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.StoreCreditAccount{UserID: userID}).Error; err != nil {
+		return model.StoreCreditAccount{}, err
+	}
+	var account model.StoreCreditAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id=?", userID).First(&account).Error; err != nil {
+		return model.StoreCreditAccount{}, err
+	}
+	return account, nil
+}
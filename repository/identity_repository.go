@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"record-shop-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IIdentityRepository interface {
+	CreateLoginState(state *model.OIDCLoginState) error
+	GetLoginStateByHash(state *model.OIDCLoginState, stateHash string) error
+	UseLoginState(state *model.OIDCLoginState, now time.Time) error
+	GetIdentity(identity *model.UserIdentity, provider string, subject string) error
+	GetIdentitiesByUser(userID uint) ([]model.UserIdentity, error)
+	LinkIdentity(identity *model.UserIdentity, verifyEmail bool, now time.Time) error
+	CreateUserWithIdentity(user *model.User, identity *model.UserIdentity) error
+	TouchIdentity(identity *model.UserIdentity, now time.Time) error
+	DeleteIdentity(userID uint, id uint) error
+}
+
+type identityRepository struct {
+	db *gorm.DB
+}
+
+func NewIdentityRepository(db *gorm.DB) IIdentityRepository {
+	return &identityRepository{db}
+}
+
+func (ir *identityRepository) CreateLoginState(state *model.OIDCLoginState) error {
+	if err := ir.db.Create(state).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ir *identityRepository) GetLoginStateByHash(state *model.OIDCLoginState, stateHash string) error {
+	if err := ir.db.Where("state_hash=?", stateHash).First(state).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 未使用なら使用済みにする、同じコールバックが2回届いた場合はErrStaleObject
+func (ir *identityRepository) UseLoginState(state *model.OIDCLoginState, now time.Time) error {
+	result := ir.db.Model(&model.OIDCLoginState{}).
+		Where("id = ? AND used_at IS NULL", state.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	state.UsedAt = &now
+	return nil
+}
+
+func (ir *identityRepository) GetIdentity(identity *model.UserIdentity, provider string, subject string) error {
+	if err := ir.db.Where("provider = ? AND subject = ?", provider, subject).First(identity).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ir *identityRepository) GetIdentitiesByUser(userID uint) ([]model.UserIdentity, error) {
+	var identities []model.UserIdentity
+	if err := ir.db.Where("user_id=?", userID).Order("created_at").Find(&identities).Error; err != nil {
+		return nil, err
+	}
+	return identities, nil
+}
+
+// 既存のユーザに紐付ける
+// verifyEmail: IDプロバイダで確認済みの同じアドレスなら、ユーザのアドレスも確認済みにする
+// 同じアカウントが(別のリクエストで)既に紐付けられていればErrStaleObject
+func (ir *identityRepository) LinkIdentity(identity *model.UserIdentity, verifyEmail bool, now time.Time) error {
+	return ir.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(identity)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		if !verifyEmail {
+			return nil
+		}
+		return tx.Model(&model.User{}).
+			Where("id = ? AND email = ? AND email_verified = ?", identity.UserID, identity.Email, false).
+			Updates(map[string]interface{}{"email_verified": true, "email_verified_at": now}).Error
+	})
+}
+
+// IDプロバイダのアカウントで新規登録する
+// 同じアドレスのユーザが(別のリクエストで)先に作られていればErrStaleObject
+func (ir *identityRepository) CreateUserWithIdentity(user *model.User, identity *model.UserIdentity) error {
+	return ir.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(user)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		identity.UserID = user.ID
+		result = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(identity)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		return nil
+	})
+}
+
+func (ir *identityRepository) TouchIdentity(identity *model.UserIdentity, now time.Time) error {
+	if err := ir.db.Model(&model.UserIdentity{}).Where("id=?", identity.ID).
+		Updates(map[string]interface{}{"last_login_at": now, "email": identity.Email}).Error; err != nil {
+		return err
+	}
+	identity.LastLoginAt = &now
+	return nil
+}
+
+func (ir *identityRepository) DeleteIdentity(userID uint, id uint) error {
+	result := ir.db.Where("id = ? AND user_id = ?", id, userID).Delete(&model.UserIdentity{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
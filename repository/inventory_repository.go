@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IInventoryRepository interface {
+	CreateLocation(location *model.Location) error
+	GetLocations() ([]model.Location, error)
+	GetLocationByID(location *model.Location, id uint) error
+	GetStockLevels(query model.StockQuery) ([]model.StockLevelResponse, error)
+	GetMovements(locationID uint, recordID uint) ([]model.StockMovement, error)
+	ApplyMovements(movements []model.StockMovement) error
+	CreateTransfer(order *model.TransferOrder) error
+	GetTransferByID(order *model.TransferOrder, id uint) error
+	GetTransfers(status string) ([]model.TransferOrder, error)
+	UpdateTransferStatus(order *model.TransferOrder, fromStatus string, movements []model.StockMovement) error
+}
+
+type inventoryRepository struct {
+	db *gorm.DB
+}
+
+func NewInventoryRepository(db *gorm.DB) IInventoryRepository {
+	return &inventoryRepository{db}
+}
+
+func (ir *inventoryRepository) CreateLocation(location *model.Location) error {
+	if err := ir.db.Create(location).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ir *inventoryRepository) GetLocations() ([]model.Location, error) {
+	var locations []model.Location
+	if err := ir.db.Order("id ASC").Find(&locations).Error; err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+func (ir *inventoryRepository) GetLocationByID(location *model.Location, id uint) error {
+	if err := ir.db.First(location, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ir *inventoryRepository) GetStockLevels(query model.StockQuery) ([]model.StockLevelResponse, error) {
+	var levels []model.StockLevelResponse
+	db := ir.db.Table("stock_levels").
+		Select("stock_levels.location_id, locations.code AS location_code, locations.name AS location_name, " +
+			"stock_levels.record_id, stock_levels.grade, stock_levels.quantity").
+		Joins("JOIN locations ON locations.id = stock_levels.location_id")
+	if query.LocationCode != "" {
+		db = db.Where("locations.code = ?", query.LocationCode)
+	}
+	if query.RecordID != 0 {
+		db = db.Where("stock_levels.record_id = ?", query.RecordID)
+	}
+	if query.Grade != "" {
+		db = db.Where("stock_levels.grade = ?", query.Grade)
+	}
+	if query.InStockOnly {
+		db = db.Where("stock_levels.quantity > 0")
+	}
+	if err := db.Order("stock_levels.record_id ASC, locations.id ASC, stock_levels.grade ASC").
+		Scan(&levels).Error; err != nil {
+		return nil, err
+	}
+	return levels, nil
+}
+
+// 0を指定した条件は絞り込まない、新しい順
+func (ir *inventoryRepository) GetMovements(locationID uint, recordID uint) ([]model.StockMovement, error) {
+	var movements []model.StockMovement
+	db := ir.db.Model(&model.StockMovement{})
+	if locationID != 0 {
+		db = db.Where("location_id = ?", locationID)
+	}
+	if recordID != 0 {
+		db = db.Where("record_id = ?", recordID)
+	}
+	if err := db.Order("created_at DESC, id DESC").Limit(500).Find(&movements).Error; err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
+
+func (ir *inventoryRepository) ApplyMovements(movements []model.StockMovement) error {
+	return ir.db.Transaction(func(tx *gorm.DB) error {
+		return applyMovements(tx, movements)
+	})
+}
+
+// Itemsも関連として一緒にINSERTされる
+func (ir *inventoryRepository) CreateTransfer(order *model.TransferOrder) error {
+	if err := ir.db.Create(order).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ir *inventoryRepository) GetTransferByID(order *model.TransferOrder, id uint) error {
+	if err := ir.db.Preload("Items").First(order, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// statusが空なら全件、新しい順
+func (ir *inventoryRepository) GetTransfers(status string) ([]model.TransferOrder, error) {
+	var orders []model.TransferOrder
+	db := ir.db.Preload("Items")
+	if status != "" {
+		db = db.Where("status = ?", status)
+	}
+	if err := db.Order("created_at DESC").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// 移動指示の状態変更と、それに伴う在庫の増減を1トランザクションで行う
+// 更新条件にfromStatusを含めて、二重に出庫・入庫されないようにする(楽観ロック)
+func (ir *inventoryRepository) UpdateTransferStatus(order *model.TransferOrder, fromStatus string, movements []model.StockMovement) error {
+	return ir.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.TransferOrder{}).
+			Where("id = ? AND status = ?", order.ID, fromStatus).
+			Updates(map[string]interface{}{
+				"status":      order.Status,
+				"shipped_at":  order.ShippedAt,
+				"received_at": order.ReceivedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		return applyMovements(tx, movements)
+	})
+}
+
+// 在庫数の増減と台帳への記録
+// 在庫行をFOR UPDATEでロックしてから数量を変える、行が無ければ数量0で作る
+// デッドロックを避けるため、ロックは常に(拠点, レコード, 盤質)の順に取る
+// 1件でも在庫が足りなければErrInsufficientStockを返し、全て取り消す
+func applyMovements(tx *gorm.DB, movements []model.StockMovement) error {
+	order := make([]int, len(movements))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := movements[order[i]], movements[order[j]]
+		if a.LocationID != b.LocationID {
+			return a.LocationID < b.LocationID
+		}
+		if a.RecordID != b.RecordID {
+			return a.RecordID < b.RecordID
+		}
+		return a.Grade < b.Grade
+	})
+	now := time.Now()
+	for _, i := range order {
+		movement := &movements[i]
+		key := model.StockLevel{LocationID: movement.LocationID, RecordID: movement.RecordID, Grade: movement.Grade}
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&key).Error; err != nil {
+			return err
+		}
+		var level model.StockLevel
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("location_id = ? AND record_id = ? AND grade = ?", movement.LocationID, movement.RecordID, movement.Grade).
+			First(&level).Error; err != nil {
+			return err
+		}
+		if level.Quantity+movement.Delta < 0 {
+			return fmt.Errorf("%w: record %d (%s) has %d at location %d",
+				ErrInsufficientStock, movement.RecordID, movement.Grade, level.Quantity, movement.LocationID)
+		}
+		if err := tx.Model(&model.StockLevel{}).
+			Where("location_id = ? AND record_id = ? AND grade = ?", movement.LocationID, movement.RecordID, movement.Grade).
+			Updates(map[string]interface{}{"quantity": level.Quantity + movement.Delta, "updated_at": now}).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(movement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
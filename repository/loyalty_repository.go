@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ILoyaltyRepository interface {
+	CreateLoyaltyRule(rule *model.LoyaltyRule) error
+	GetLoyaltyRules() ([]model.LoyaltyRule, error)
+	GetActiveLoyaltyRules(now time.Time) ([]model.LoyaltyRule, error)
+	GetPointAccount(userID uint) (model.PointAccount, []model.PointTransaction, error)
+	Earn(entry *model.PointTransaction, expiresAt time.Time) error
+	Redeem(entry *model.PointTransaction, now time.Time) error
+	Reverse(userID uint, reference string) (model.PointTransaction, error)
+	Clawback(entry *model.PointTransaction, calc func(earned int, clawedBack int) int) error
+	ExpirePoints(now time.Time) (int, error)
+}
+
+type loyaltyRepository struct {
+	db *gorm.DB
+}
+
+func NewLoyaltyRepository(db *gorm.DB) ILoyaltyRepository {
+	return &loyaltyRepository{db}
+}
+
+func (lr *loyaltyRepository) CreateLoyaltyRule(rule *model.LoyaltyRule) error {
+	if err := lr.db.Create(rule).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (lr *loyaltyRepository) GetLoyaltyRules() ([]model.LoyaltyRule, error) {
+	var rules []model.LoyaltyRule
+	if err := lr.db.Order("id ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+func (lr *loyaltyRepository) GetActiveLoyaltyRules(now time.Time) ([]model.LoyaltyRule, error) {
+	var rules []model.LoyaltyRule
+	if err := lr.db.
+		Where("(starts_at IS NULL OR starts_at <= ?) AND (ends_at IS NULL OR ends_at > ?)", now, now).
+		Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// 口座が無ければ残高0として返す、履歴は新しい順
+func (lr *loyaltyRepository) GetPointAccount(userID uint) (model.PointAccount, []model.PointTransaction, error) {
+	account := model.PointAccount{UserID: userID}
+	if err := lr.db.Where("user_id=?", userID).Limit(1).Find(&account).Error; err != nil {
+		return model.PointAccount{}, nil, err
+	}
+	var transactions []model.PointTransaction
+	if err := lr.db.Where("user_id=?", userID).Order("id DESC").Find(&transactions).Error; err != nil {
+		return model.PointAccount{}, nil, err
+	}
+	return account, transactions, nil
+}
+
+// 同じ決済・販売に2回付与しない、既に付与済みならErrDuplicateEvent
+// 付与のたびに有効期限をexpiresAtまで延長する
+func (lr *loyaltyRepository) Earn(entry *model.PointTransaction, expiresAt time.Time) error {
+	return lr.db.Transaction(func(tx *gorm.DB) error {
+		account, err := lockPointAccount(tx, entry.UserID)
+		if err != nil {
+			return err
+		}
+		var earned int64
+		if err := pointSource(tx.Model(&model.PointTransaction{}), entry).
+			Where("type = ?", model.PointEarn).
+			Count(&earned).Error; err != nil {
+			return err
+		}
+		if earned > 0 {
+			return fmt.Errorf("%w: points already earned", ErrDuplicateEvent)
+		}
+		account.ExpiresAt = &expiresAt
+		return applyPoints(tx, &account, entry)
+	})
+}
+
+// 残高を超えては使えない、失効済みの場合はErrExpired
+// 同じreferenceで既に利用済みならErrDuplicateEvent(二重送信対策)
+func (lr *loyaltyRepository) Redeem(entry *model.PointTransaction, now time.Time) error {
+	return lr.db.Transaction(func(tx *gorm.DB) error {
+		account, err := lockPointAccount(tx, entry.UserID)
+		if err != nil {
+			return err
+		}
+		var used int64
+		if err := tx.Model(&model.PointTransaction{}).
+			Where("user_id = ? AND type = ? AND reference = ?", entry.UserID, model.PointRedeem, entry.Reference).
+			Count(&used).Error; err != nil {
+			return err
+		}
+		if used > 0 {
+			return fmt.Errorf("%w: reference %s", ErrDuplicateEvent, entry.Reference)
+		}
+		if account.ExpiresAt != nil && !now.Before(*account.ExpiresAt) {
+			return fmt.Errorf("%w: points expired at %s", ErrExpired, account.ExpiresAt.Format(time.DateOnly))
+		}
+		if account.Balance+entry.Points < 0 {
+			return fmt.Errorf("%w: %d points available", ErrInsufficientBalance, account.Balance)
+		}
+		return applyPoints(tx, &account, entry)
+	})
+}
+
+// referenceで利用したポイントを戻す、既に戻し済みならErrDuplicateEvent
+func (lr *loyaltyRepository) Reverse(userID uint, reference string) (model.PointTransaction, error) {
+	entry := model.PointTransaction{}
+	err := lr.db.Transaction(func(tx *gorm.DB) error {
+		account, err := lockPointAccount(tx, userID)
+		if err != nil {
+			return err
+		}
+		var transactions []model.PointTransaction
+		if err := tx.Where("user_id = ? AND reference = ? AND type IN ?", userID, reference,
+			[]string{model.PointRedeem, model.PointReversal}).
+			Find(&transactions).Error; err != nil {
+			return err
+		}
+		redeemed := 0
+		for _, t := range transactions {
+			if t.Type == model.PointReversal {
+				return fmt.Errorf("%w: reference %s", ErrDuplicateEvent, reference)
+			}
+			redeemed += -t.Points
+		}
+		if len(transactions) == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		entry = model.PointTransaction{UserID: userID, Type: model.PointReversal, Points: redeemed, Reference: reference}
+		return applyPoints(tx, &account, &entry)
+	})
+	if err != nil {
+		return model.PointTransaction{}, err
+	}
+	return entry, nil
+}
+
+// 返品・返金による付与分の取消
+// entryにはUserID・付与元(PaymentIDかPosSaleID)・Noteを入れて渡す
+// calcに付与済みのポイントとこれまでの取消累計を渡し、今回取消すポイントを決めてもらう
+// 付与が無い場合、取消すポイントが0の場合はgorm.ErrRecordNotFound
+func (lr *loyaltyRepository) Clawback(entry *model.PointTransaction, calc func(earned int, clawedBack int) int) error {
+	return lr.db.Transaction(func(tx *gorm.DB) error {
+		account, err := lockPointAccount(tx, entry.UserID)
+		if err != nil {
+			return err
+		}
+		var transactions []model.PointTransaction
+		if err := pointSource(tx, entry).Where("type IN ?", []string{model.PointEarn, model.PointClawback}).
+			Find(&transactions).Error; err != nil {
+			return err
+		}
+		earned, clawedBack := 0, 0
+		for _, t := range transactions {
+			if t.Type == model.PointEarn {
+				earned += t.Points
+			} else {
+				clawedBack += -t.Points
+			}
+		}
+		points := calc(earned, clawedBack)
+		if points <= 0 {
+			return gorm.ErrRecordNotFound
+		}
+		entry.Type = model.PointClawback
+		entry.Points = -points
+		return applyPoints(tx, &account, entry)
+	})
+}
+
+// 有効期限を過ぎた口座の残高を失効させ、件数を返す
+// 口座ごとにロックを取り直して期限を再確認するので、直前に付与されて延長された口座は失効させない
+func (lr *loyaltyRepository) ExpirePoints(now time.Time) (int, error) {
+	var userIDs []uint
+	if err := lr.db.Model(&model.PointAccount{}).
+		Where("expires_at <= ? AND balance > 0", now).
+		Pluck("user_id", &userIDs).Error; err != nil {
+		return 0, err
+	}
+	expired := 0
+	for _, userID := range userIDs {
+		err := lr.db.Transaction(func(tx *gorm.DB) error {
+			account, err := lockPointAccount(tx, userID)
+			if err != nil {
+				return err
+			}
+			if account.ExpiresAt == nil || now.Before(*account.ExpiresAt) || account.Balance <= 0 {
+				return nil
+			}
+			expired++
+			return applyPoints(tx, &account, &model.PointTransaction{
+				UserID: userID,
+				Type:   model.PointExpire,
+				Points: -account.Balance,
+			})
+		})
+		if err != nil {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// 付与元(レジの販売または決済)の履歴に絞込む
+func pointSource(tx *gorm.DB, entry *model.PointTransaction) *gorm.DB {
+	if entry.PosSaleID != nil {
+		return tx.Where("pos_sale_id = ?", *entry.PosSaleID)
+	}
+	return tx.Where("payment_id = ?", entry.PaymentID)
+}
+
+// 口座の行をFOR UPDATEでロックして返す、無ければ残高0で作る
+func lockPointAccount(tx *gorm.DB, userID uint) (model.PointAccount, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&model.PointAccount{UserID: userID}).Error; err != nil {
+		return model.PointAccount{}, err
+	}
+	var account model.PointAccount
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("user_id=?", userID).First(&account).Error; err != nil {
+		return model.PointAccount{}, err
+	}
+	return account, nil
+}
+
+// ロック済みの口座の残高を変更し、履歴を追記する
+func applyPoints(tx *gorm.DB, account *model.PointAccount, entry *model.PointTransaction) error {
+	account.Balance += entry.Points
+	if err := tx.Model(&model.PointAccount{}).Where("user_id=?", account.UserID).
+		Updates(map[string]interface{}{"balance": account.Balance, "expires_at": account.ExpiresAt}).Error; err != nil {
+		return err
+	}
+	entry.BalanceAfter = account.Balance
+	return tx.Create(entry).Error
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type INotificationRepository interface {
+	CreateNotification(notification *model.Notification) error
+	GetNotificationsByUser(userID uint) ([]model.Notification, error)
+	MarkRead(userID uint, id uint, now time.Time) error
+}
+
+type notificationRepository struct {
+	db *gorm.DB
+}
+
+func NewNotificationRepository(db *gorm.DB) INotificationRepository {
+	return &notificationRepository{db}
+}
+
+func (nr *notificationRepository) CreateNotification(notification *model.Notification) error {
+	if err := nr.db.Create(notification).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (nr *notificationRepository) GetNotificationsByUser(userID uint) ([]model.Notification, error) {
+	var notifications []model.Notification
+	if err := nr.db.Where("user_id=?", userID).
+		Order("created_at DESC").
+		Limit(100).
+		Find(&notifications).Error; err != nil {
+		return nil, err
+	}
+	return notifications, nil
+}
+
+func (nr *notificationRepository) MarkRead(userID uint, id uint, now time.Time) error {
+	result := nr.db.Model(&model.Notification{}).
+		Where("id=? AND user_id=?", id, userID).
+		Update("read_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return fmt.Errorf("object does not exist")
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"record-shop-rest-api/model"
+
+	"gorm.io/gorm"
+)
+
+type IOrderRepository interface {
+	CreateOrder(order *model.Order) error
+	GetOrderByID(order *model.Order, id uint) error
+	GetOrderByPayment(order *model.Order, paymentID uint) error
+	GetOrdersByUser(userID uint) ([]model.Order, error)
+	CancelOrder(userID uint, id uint) error
+	CancelAuctionOrder(id uint) error
+	RedeemOrderPoints(userID uint, id uint, points int) error
+}
+
+type orderRepository struct {
+	db *gorm.DB
+}
+
+func NewOrderRepository(db *gorm.DB) IOrderRepository {
+	return &orderRepository{db}
+}
+
+// Linesも関連として一緒にINSERTされる
+func (or *orderRepository) CreateOrder(order *model.Order) error {
+	if err := or.db.Create(order).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (or *orderRepository) GetOrderByID(order *model.Order, id uint) error {
+	if err := or.db.Preload("Lines").First(order, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (or *orderRepository) GetOrderByPayment(order *model.Order, paymentID uint) error {
+	if err := or.db.Preload("Lines").Where("payment_id=?", paymentID).First(order).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (or *orderRepository) GetOrdersByUser(userID uint) ([]model.Order, error) {
+	var orders []model.Order
+	if err := or.db.Preload("Lines").Where("user_id=?", userID).Order("created_at DESC").Find(&orders).Error; err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+// 取消できるのは本人の支払前(支払待ち・与信拒否)の注文のみ、落札の注文は繰上げでのみ取消す
+func (or *orderRepository) CancelOrder(userID uint, id uint) error {
+	result := or.db.Model(&model.Order{}).
+		Where("id = ? AND user_id = ? AND auction_listing_id IS NULL AND status IN ?",
+			id, userID, []string{model.OrderPending, model.OrderPaymentFailed}).
+		Update("status", model.OrderCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+// 支払期限切れで繰上げた落札の注文を取消す、支払前のもののみ
+func (or *orderRepository) CancelAuctionOrder(id uint) error {
+	result := or.db.Model(&model.Order{}).
+		Where("id = ? AND auction_listing_id IS NOT NULL AND status IN ?",
+			id, []string{model.OrderPending, model.OrderPaymentFailed}).
+		Update("status", model.OrderCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+// 充当できるのは本人の支払前の注文に1回のみ、カードで払う分が残るように合計未満まで
+// 落札の注文は繰上げで取消されるため充当できない
+func (or *orderRepository) RedeemOrderPoints(userID uint, id uint, points int) error {
+	result := or.db.Model(&model.Order{}).
+		Where("id = ? AND user_id = ? AND auction_listing_id IS NULL AND points_redeemed = 0 AND total > ? AND ((status = ? AND payment_id IS NULL) OR status = ?)",
+			id, userID, points, model.OrderPending, model.OrderPaymentFailed).
+		Update("points_redeemed", points)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IPaymentRepository interface {
+	CreatePayment(payment *model.Payment) error
+	AttachOrderPayment(payment *model.Payment) error
+	GetPaymentByID(payment *model.Payment, id uint) error
+	UpdatePayment(payment *model.Payment) error
+	LockPayment(id uint, apply func(payment *model.Payment) error) error
+	ApplyEvent(providerPaymentID string, event *model.PaymentEvent, apply func(payment *model.Payment) error) error
+}
+
+type paymentRepository struct {
+	db *gorm.DB
+}
+
+func NewPaymentRepository(db *gorm.DB) IPaymentRepository {
+	return &paymentRepository{db}
+}
+
+func (pr *paymentRepository) CreatePayment(payment *model.Payment) error {
+	if err := pr.db.Create(payment).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 注文の支払に決済を紐付けて、注文のステータスを決済に合わせる
+// 紐付けられるのは未払い(決済無し)か与信拒否の注文のみ、同時に支払われた場合はErrStaleObject
+func (pr *paymentRepository) AttachOrderPayment(payment *model.Payment) error {
+	result := pr.db.Model(&model.Order{}).
+		Where("id = ? AND ((status = ? AND payment_id IS NULL) OR status = ?)",
+			*payment.OrderID, model.OrderPending, model.OrderPaymentFailed).
+		Updates(map[string]interface{}{"payment_id": payment.ID, "status": model.OrderStatusForPayment(payment.Status)})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+func (pr *paymentRepository) GetPaymentByID(payment *model.Payment, id uint) error {
+	if err := pr.db.First(payment, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pr *paymentRepository) UpdatePayment(payment *model.Payment) error {
+	result := pr.db.Model(payment).Omit("CreatedAt").Save(payment)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return fmt.Errorf("object does not exist")
+	}
+	return nil
+}
+
+// 決済行をSELECT ... FOR UPDATEでロックしてapplyを呼び、結果を保存する
+// 状態の確認と更新を直列化し、同じ決済への同時の確定・返金やwebhookと競合しないようにする
+// プロバイダの呼出しはロックを持ったまま行わない(通信の間DBの接続と行ロックを握り続けないように)
+// applyがエラーを返した場合は何も保存しない
+func (pr *paymentRepository) LockPayment(id uint, apply func(payment *model.Payment) error) error {
+	return pr.db.Transaction(func(tx *gorm.DB) error {
+		var payment model.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, id).Error; err != nil {
+			return err
+		}
+		if err := apply(&payment); err != nil {
+			return err
+		}
+		if err := tx.Model(&payment).Omit("CreatedAt").Save(&payment).Error; err != nil {
+			return err
+		}
+		return syncOrderStatus(tx, &payment)
+	})
+}
+
+// webhookイベントの記録と決済ステータスの更新を1トランザクションで行う
+// 決済行はSELECT ... FOR UPDATEでロックし、同じ決済への同時webhookを直列化する
+// イベントIDが既に記録済みならErrDuplicateEventを返し、何も更新しない
+func (pr *paymentRepository) ApplyEvent(providerPaymentID string, event *model.PaymentEvent, apply func(payment *model.Payment) error) error {
+	return pr.db.Transaction(func(tx *gorm.DB) error {
+		var payment model.Payment
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("provider_payment_id=?", providerPaymentID).
+			First(&payment).Error; err != nil {
+			return err
+		}
+		event.PaymentID = payment.ID
+		// ON CONFLICT DO NOTHINGで重複時はRowsAffectedが0になる
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(event)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrDuplicateEvent
+		}
+		if err := apply(&payment); err != nil {
+			return err
+		}
+		if err := tx.Model(&payment).Omit("CreatedAt").Save(&payment).Error; err != nil {
+			return err
+		}
+		return syncOrderStatus(tx, &payment)
+	})
+}
+
+// 注文の支払に使われている決済なら、注文のステータスを決済に合わせる
+// 支払い直して付け替えられた古い決済や、取消済みの注文は変えない
+func syncOrderStatus(tx *gorm.DB, payment *model.Payment) error {
+	if payment.OrderID == nil {
+		return nil
+	}
+	return tx.Model(&model.Order{}).
+		Where("id = ? AND payment_id = ? AND status <> ?", *payment.OrderID, payment.ID, model.OrderCancelled).
+		Update("status", model.OrderStatusForPayment(payment.Status)).Error
+}
@@ -0,0 +1,170 @@
+package repository
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IPosRepository interface {
+	CreatePosItem(item *model.PosItem) error
+	GetPosItemByCode(item *model.PosItem, code string) error
+	CreatePosSale(sale *model.PosSale) error
+	GetPosSaleByID(sale *model.PosSale, id uint) error
+	GetPosSaleByCardPayment(sale *model.PosSale, paymentID uint) error
+	UpdatePosSale(sale *model.PosSale, fromStatus string) error
+	CreatePosReturn(ret *model.PosReturn) error
+	CancelPosReturn(ret *model.PosReturn) error
+}
+
+type posRepository struct {
+	db *gorm.DB
+}
+
+func NewPosRepository(db *gorm.DB) IPosRepository {
+	return &posRepository{db}
+}
+
+func (pr *posRepository) CreatePosItem(item *model.PosItem) error {
+	if err := pr.db.Create(item).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// SKUを優先し、無ければバーコードで探す
+func (pr *posRepository) GetPosItemByCode(item *model.PosItem, code string) error {
+	if err := pr.db.Where("sku=? OR barcode=?", code, code).
+		Order(clause.Expr{SQL: "sku = ? DESC, id ASC", Vars: []interface{}{code}}).
+		First(item).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// Lines・Discounts・Taxesも関連として一緒にINSERTされる
+func (pr *posRepository) CreatePosSale(sale *model.PosSale) error {
+	if err := pr.db.Create(sale).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// Locationはレシートの店名に使う
+func (pr *posRepository) GetPosSaleByID(sale *model.PosSale, id uint) error {
+	if err := pr.db.
+		Preload("Location").
+		Preload("Lines", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id ASC")
+		}).
+		Preload("Discounts", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id ASC")
+		}).
+		Preload("Taxes", func(db *gorm.DB) *gorm.DB {
+			return db.Order("percent DESC")
+		}).
+		Preload("Returns", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id ASC")
+		}).
+		First(sale, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// カードで払った販売を探す、レジの決済かどうかの確認に使う
+func (pr *posRepository) GetPosSaleByCardPayment(sale *model.PosSale, paymentID uint) error {
+	if err := pr.db.Where("card_payment_id=?", paymentID).First(sale).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 更新条件にfromStatusを含めて、同時に別のレジで処理した場合は更新しない(楽観ロック)
+func (pr *posRepository) UpdatePosSale(sale *model.PosSale, fromStatus string) error {
+	result := pr.db.Model(&model.PosSale{}).
+		Where("id = ? AND status = ?", sale.ID, fromStatus).
+		Updates(map[string]interface{}{
+			"status":           sale.Status,
+			"gift_card_amount": sale.GiftCardAmount,
+			"card_amount":      sale.CardAmount,
+			"card_payment_id":  sale.CardPaymentID,
+			"cash_amount":      sale.CashAmount,
+			"cash_received":    sale.CashReceived,
+			"change":           sale.Change,
+			"failure_reason":   sale.FailureReason,
+			"voided_by":        sale.VoidedBy,
+			"voided_at":        sale.VoidedAt,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+// 販売と明細の行をFOR UPDATEでロックして、返品できる数量を確認してから返品を記録する
+// 返金額は明細の値引後の金額を数量で割ったもの、端数は返品の累計で合うように割当てる
+// カードで払った分(返金済みを除く)を先に、残りを現金に割当てる
+// 同時に返品しても、販売した数量・金額を超えて返すことはない
+func (pr *posRepository) CreatePosReturn(ret *model.PosReturn) error {
+	return pr.db.Transaction(func(tx *gorm.DB) error {
+		var sale model.PosSale
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&sale, ret.PosSaleID).Error; err != nil {
+			return err
+		}
+		if sale.Status != model.PosSaleCompleted {
+			return fmt.Errorf("%w: sale is %s", ErrStaleObject, sale.Status)
+		}
+		var line model.PosSaleLine
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND pos_sale_id = ?", ret.PosSaleLineID, sale.ID).
+			First(&line).Error; err != nil {
+			return err
+		}
+		if line.ReturnedQuantity+ret.Quantity > line.Quantity {
+			return fmt.Errorf("%w: only %d left to return", ErrStaleObject, line.Quantity-line.ReturnedQuantity)
+		}
+		net := line.UnitPrice*line.Quantity - line.Discount
+		ret.Amount = net*(line.ReturnedQuantity+ret.Quantity)/line.Quantity - net*line.ReturnedQuantity/line.Quantity
+		ret.CardRefund = min(ret.Amount, sale.CardAmount-sale.CardRefundedAmount)
+		ret.GiftCardRefund = min(ret.Amount-ret.CardRefund, sale.GiftCardAmount-sale.GiftCardRefundedAmount)
+		ret.CashRefund = ret.Amount - ret.CardRefund - ret.GiftCardRefund
+		if err := tx.Model(&model.PosSaleLine{}).Where("id=?", line.ID).
+			Update("returned_quantity", gorm.Expr("returned_quantity + ?", ret.Quantity)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.PosSale{}).Where("id=?", sale.ID).
+			Updates(map[string]interface{}{
+				"refunded_amount":           gorm.Expr("refunded_amount + ?", ret.Amount),
+				"card_refunded_amount":      gorm.Expr("card_refunded_amount + ?", ret.CardRefund),
+				"gift_card_refunded_amount": gorm.Expr("gift_card_refunded_amount + ?", ret.GiftCardRefund),
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Create(ret).Error
+	})
+}
+
+// カードの返金に失敗した場合に、記録した返品を取消す
+func (pr *posRepository) CancelPosReturn(ret *model.PosReturn) error {
+	return pr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.PosSaleLine{}).Where("id=?", ret.PosSaleLineID).
+			Update("returned_quantity", gorm.Expr("returned_quantity - ?", ret.Quantity)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.PosSale{}).Where("id=?", ret.PosSaleID).
+			Updates(map[string]interface{}{
+				"refunded_amount":           gorm.Expr("refunded_amount - ?", ret.Amount),
+				"card_refunded_amount":      gorm.Expr("card_refunded_amount - ?", ret.CardRefund),
+				"gift_card_refunded_amount": gorm.Expr("gift_card_refunded_amount - ?", ret.GiftCardRefund),
+			}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.PosReturn{}, ret.ID).Error
+	})
+}
@@ -0,0 +1,225 @@
+package repository
+
+import (
+	"errors"
+	"log"
+	"record-shop-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IPreOrderRepository interface {
+	CreatePreOrder(preOrder *model.PreOrder) error
+	GetPreOrderByID(preOrder *model.PreOrder, id uint) error
+	GetPreOrdersByUser(userID uint) ([]model.PreOrder, error)
+	CancelPreOrder(userID uint, id uint) error
+	ReopenPreOrder(id uint) error
+	CreateArrival(arrival *model.PreOrderArrival, actorID uint) error
+	AllocateArrivals(now time.Time) ([]model.PreOrder, error)
+}
+
+type preOrderRepository struct {
+	db *gorm.DB
+}
+
+func NewPreOrderRepository(db *gorm.DB) IPreOrderRepository {
+	return &preOrderRepository{db}
+}
+
+func (pr *preOrderRepository) CreatePreOrder(preOrder *model.PreOrder) error {
+	if err := pr.db.Create(preOrder).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pr *preOrderRepository) GetPreOrderByID(preOrder *model.PreOrder, id uint) error {
+	if err := pr.db.First(preOrder, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pr *preOrderRepository) GetPreOrdersByUser(userID uint) ([]model.PreOrder, error) {
+	var preOrders []model.PreOrder
+	if err := pr.db.Where("user_id=?", userID).Order("created_at DESC").Find(&preOrders).Error; err != nil {
+		return nil, err
+	}
+	return preOrders, nil
+}
+
+// 取消できるのは本人の入荷待ちの予約のみ、引当済みのものは取消せない
+func (pr *preOrderRepository) CancelPreOrder(userID uint, id uint) error {
+	result := pr.db.Model(&model.PreOrder{}).
+		Where("id = ? AND user_id = ? AND status = ?", id, userID, model.PreOrderPending).
+		Update("status", model.PreOrderCancelled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+// 内金の取消に失敗した場合に、取消した予約を入荷待ちに戻す
+func (pr *preOrderRepository) ReopenPreOrder(id uint) error {
+	result := pr.db.Model(&model.PreOrder{}).
+		Where("id = ? AND status = ?", id, model.PreOrderCancelled).
+		Update("status", model.PreOrderPending)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+// 入荷の登録と、入荷した拠点への入庫(新品なので盤質はM)を同時に行う
+func (pr *preOrderRepository) CreateArrival(arrival *model.PreOrderArrival, actorID uint) error {
+	return pr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(arrival).Error; err != nil {
+			return err
+		}
+		return applyMovements(tx, []model.StockMovement{{
+			LocationID:    arrival.LocationID,
+			RecordID:      arrival.RecordID,
+			Grade:         "M",
+			Delta:         arrival.Quantity,
+			Reason:        model.MovementReceive,
+			ReferenceType: "pre_order_arrival",
+			ReferenceID:   arrival.ID,
+			ActorID:       actorID,
+		}})
+	})
+}
+
+// 未引当の入荷数量を、予約の古い順(先着順)に引当てる
+// 先頭の予約の数量が足りない場合はそこで止め、後の予約が追い越さないようにする
+// 入荷と予約の行はFOR UPDATEでロックするので、ジョブが多重に動いても二重に引当てない
+// 引当てた分は入荷した拠点の在庫から出庫する
+// 入荷後に店頭で売れるなどして在庫が足りないレコードは引当てずに次回に回す(他のレコードの引当は続ける)
+// 入荷待ちの予約が無いレコードの入荷は見ない(毎回ロックして走査しないように)
+// 引当てた予約を返す
+func (pr *preOrderRepository) AllocateArrivals(now time.Time) ([]model.PreOrder, error) {
+	var allocated []model.PreOrder
+	err := pr.db.Transaction(func(tx *gorm.DB) error {
+		var arrivals []model.PreOrderArrival
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("remaining > 0 AND EXISTS (SELECT 1 FROM pre_orders WHERE pre_orders.record_id = pre_order_arrivals.record_id AND pre_orders.status = ?)",
+				model.PreOrderPending).
+			Order("created_at ASC, id ASC").
+			Find(&arrivals).Error; err != nil {
+			return err
+		}
+		// レコードごとに入荷をまとめる、処理順を安定させるためにIDの出現順も保持
+		var recordIDs []uint
+		arrivalsByRecord := map[uint][]*model.PreOrderArrival{}
+		for i := range arrivals {
+			recordID := arrivals[i].RecordID
+			if _, ok := arrivalsByRecord[recordID]; !ok {
+				recordIDs = append(recordIDs, recordID)
+			}
+			arrivalsByRecord[recordID] = append(arrivalsByRecord[recordID], &arrivals[i])
+		}
+
+		for _, recordID := range recordIDs {
+			// レコード単位でSAVEPOINTを切り、在庫不足ならそのレコードの分だけ戻す
+			var recordAllocated []model.PreOrder
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				var err error
+				recordAllocated, err = allocateRecord(tx, arrivalsByRecord[recordID], recordID, now)
+				return err
+			})
+			if errors.Is(err, ErrInsufficientStock) {
+				log.Printf("pre-order allocation for record %d skipped: %v", recordID, err)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			allocated = append(allocated, recordAllocated...)
+		}
+		return nil
+	})
+	return allocated, err
+}
+
+// 1レコード分の引当、入荷の消し込みと予約ごとの出庫を行う
+// 全ての予約に引当てて残った入荷分は店頭の在庫として扱い、以降の引当の対象から外す
+func allocateRecord(tx *gorm.DB, arrivals []*model.PreOrderArrival, recordID uint, now time.Time) ([]model.PreOrder, error) {
+	available := 0
+	for _, arrival := range arrivals {
+		available += arrival.Remaining
+	}
+	var preOrders []model.PreOrder
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("record_id = ? AND status = ?", recordID, model.PreOrderPending).
+		Order("created_at ASC, id ASC").
+		Find(&preOrders).Error; err != nil {
+		return nil, err
+	}
+	var allocated []model.PreOrder
+	remaining := make([]int, len(arrivals))
+	for i, arrival := range arrivals {
+		remaining[i] = arrival.Remaining
+	}
+	var movements []model.StockMovement
+	for _, preOrder := range preOrders {
+		if preOrder.Quantity > available {
+			break
+		}
+		if err := tx.Model(&preOrder).Updates(map[string]interface{}{
+			"status":       model.PreOrderAllocated,
+			"allocated_at": now,
+		}).Error; err != nil {
+			return nil, err
+		}
+		available -= preOrder.Quantity
+		allocated = append(allocated, preOrder)
+		// 古い入荷から消し込み、入荷した拠点ごとに出庫する
+		need := preOrder.Quantity
+		for i, arrival := range arrivals {
+			if need == 0 {
+				break
+			}
+			take := min(remaining[i], need)
+			if take == 0 {
+				continue
+			}
+			remaining[i] -= take
+			need -= take
+			movements = append(movements, model.StockMovement{
+				LocationID:    arrival.LocationID,
+				RecordID:      recordID,
+				Grade:         "M",
+				Delta:         -take,
+				Reason:        model.MovementPreOrder,
+				ReferenceType: "pre_order",
+				ReferenceID:   preOrder.ID,
+			})
+		}
+	}
+	if len(allocated) == len(preOrders) {
+		for i := range remaining {
+			remaining[i] = 0
+		}
+	}
+	for i, arrival := range arrivals {
+		if remaining[i] == arrival.Remaining {
+			continue
+		}
+		if err := tx.Model(arrival).Update("remaining", remaining[i]).Error; err != nil {
+			return nil, err
+		}
+	}
+	if len(movements) > 0 {
+		if err := applyMovements(tx, movements); err != nil {
+			return nil, err
+		}
+	}
+	return allocated, nil
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IPromotionRepository interface {
+	CreatePromotion(promotion *model.Promotion) error
+	GetPromotionList() ([]model.Promotion, error)
+	GetCandidatePromotions(codes []string, now time.Time) ([]model.Promotion, error)
+	IncrementUsage(redemptions []model.PromotionRedemption) error
+	DecrementUsage(reference string) error
+}
+
+type promotionRepository struct {
+	db *gorm.DB
+}
+
+func NewPromotionRepository(db *gorm.DB) IPromotionRepository {
+	return &promotionRepository{db}
+}
+
+func (pr *promotionRepository) CreatePromotion(promotion *model.Promotion) error {
+	if err := pr.db.Create(promotion).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (pr *promotionRepository) GetPromotionList() ([]model.Promotion, error) {
+	var promotions []model.Promotion
+	if err := pr.db.Order("id ASC").Find(&promotions).Error; err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+// 自動適用のもの(codeが空文字)と、入力されたコードに一致するもののうち、有効期間内のものを返す
+// 利用上限のチェックは理由を返したいのでusecase側で行う
+func (pr *promotionRepository) GetCandidatePromotions(codes []string, now time.Time) ([]model.Promotion, error) {
+	var promotions []model.Promotion
+	query := pr.db.
+		Where("starts_at IS NULL OR starts_at <= ?", now).
+		Where("ends_at IS NULL OR ends_at > ?", now)
+	if len(codes) > 0 {
+		query = query.Where("code = '' OR code IN ?", codes)
+	} else {
+		query = query.Where("code = ''")
+	}
+	if err := query.Order("id ASC").Find(&promotions).Error; err != nil {
+		return nil, err
+	}
+	return promotions, nil
+}
+
+// 利用回数を1増やして利用履歴を記録する、上限に達しているものがあれば全体をロールバックしてエラーにする
+// 条件付きUPDATE文で行うので、同時に使われても上限を超えない
+// UPDATEでプロモーションの行がロックされるので、1人あたりの利用回数の確認も同時に使われた分を含めて数えられる
+func (pr *promotionRepository) IncrementUsage(redemptions []model.PromotionRedemption) error {
+	return pr.db.Transaction(func(tx *gorm.DB) error {
+		for i := range redemptions {
+			redemption := &redemptions[i]
+			result := tx.Model(&model.Promotion{}).
+				Where("id = ? AND (usage_limit = 0 OR used_count < usage_limit)", redemption.PromotionID).
+				Update("used_count", gorm.Expr("used_count + 1"))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected < 1 {
+				return fmt.Errorf("%w: promotion %d usage limit reached", ErrStaleObject, redemption.PromotionID)
+			}
+			var promotion model.Promotion
+			if err := tx.First(&promotion, redemption.PromotionID).Error; err != nil {
+				return err
+			}
+			if promotion.PerUserLimit > 0 {
+				if redemption.UserID == nil {
+					return fmt.Errorf("%w: promotion %q is for members only", ErrStaleObject, promotion.Name)
+				}
+				var used int64
+				if err := tx.Model(&model.PromotionRedemption{}).
+					Where("promotion_id = ? AND user_id = ?", promotion.ID, *redemption.UserID).
+					Count(&used).Error; err != nil {
+					return err
+				}
+				if used >= int64(promotion.PerUserLimit) {
+					return fmt.Errorf("%w: promotion %q can be used %d time(s) per customer", ErrStaleObject, promotion.Name, promotion.PerUserLimit)
+				}
+			}
+			if err := tx.Create(redemption).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// 販売の取消・失敗時に、その販売で使った分の利用回数を戻して利用履歴を消す
+func (pr *promotionRepository) DecrementUsage(reference string) error {
+	return pr.db.Transaction(func(tx *gorm.DB) error {
+		var redemptions []model.PromotionRedemption
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("reference = ?", reference).Find(&redemptions).Error; err != nil {
+			return err
+		}
+		for _, redemption := range redemptions {
+			if err := tx.Model(&model.Promotion{}).
+				Where("id = ? AND used_count > 0", redemption.PromotionID).
+				Update("used_count", gorm.Expr("used_count - 1")).Error; err != nil {
+				return err
+			}
+			if err := tx.Delete(&redemption).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
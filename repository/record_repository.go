@@ -10,6 +10,7 @@ import (
 type IRecordRepository interface {
 	CreateRecord(record *model.Record) error
 	GetRecordList() ([]model.Record, error)
+	GetRecordByID(record *model.Record, id uint) error
 	GetDetail(title string) (model.DetailResponse, error)
 	GetRecordByTitle(title string) ([]model.Record, error)
 	GetRecordByArtist(artist string) ([]model.Record, error)
@@ -45,6 +46,13 @@ func (rr *recordRepository) GetRecordList() ([]model.Record, error) {
 	return records, nil
 }
 
+func (rr *recordRepository) GetRecordByID(record *model.Record, id uint) error {
+	if err := rr.db.First(record, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
 func (rr *recordRepository) GetDetail(title string) (model.DetailResponse, error) {
 	var records []struct {
 		RecordTitle    string
@@ -0,0 +1,173 @@
+package repository
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type IReturnRepository interface {
+	CreateReturn(returnRequest *model.ReturnRequest, event *model.ReturnEvent) error
+	GetReturnByID(returnRequest *model.ReturnRequest, id uint) error
+	GetReturnsByUser(userID uint) ([]model.ReturnRequest, error)
+	GetReturnsByStatus(status string) ([]model.ReturnRequest, error)
+	UpdateReturnStatus(returnRequest *model.ReturnRequest, event *model.ReturnEvent) error
+	SumStoreCreditByPayment(paymentID uint) (int, error)
+	ApproveReturn(returnRequest *model.ReturnRequest, event *model.ReturnEvent,
+		check func(payment model.Payment, returned int, refundedByReturns int) error) error
+}
+
+type returnRepository struct {
+	db *gorm.DB
+}
+
+func NewReturnRepository(db *gorm.DB) IReturnRepository {
+	return &returnRepository{db}
+}
+
+// 返品依頼と写真、最初の監査ログを1トランザクションで作成
+// 同じ決済の同じレコードに却下以外の返品依頼が既にあればErrDuplicateEvent
+// 決済行をロックして、同時の依頼を直列化する
+func (rr *returnRepository) CreateReturn(returnRequest *model.ReturnRequest, event *model.ReturnEvent) error {
+	return rr.db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockReturnPayment(tx, returnRequest.PaymentID); err != nil {
+			return err
+		}
+		var existing int64
+		if err := tx.Model(&model.ReturnRequest{}).
+			Where("payment_id = ? AND record_id = ? AND status <> ?", returnRequest.PaymentID, returnRequest.RecordID, model.ReturnRejected).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return fmt.Errorf("%w: record %d is already being returned", ErrDuplicateEvent, returnRequest.RecordID)
+		}
+		// Photosも関連として一緒にINSERTされる
+		if err := tx.Create(returnRequest).Error; err != nil {
+			return err
+		}
+		event.ReturnRequestID = returnRequest.ID
+		return tx.Create(event).Error
+	})
+}
+
+func (rr *returnRepository) GetReturnByID(returnRequest *model.ReturnRequest, id uint) error {
+	if err := rr.db.
+		Preload("Photos").
+		Preload("Events", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id ASC")
+		}).
+		First(returnRequest, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (rr *returnRepository) GetReturnsByUser(userID uint) ([]model.ReturnRequest, error) {
+	var returns []model.ReturnRequest
+	if err := rr.db.Preload("Photos").
+		Where("user_id=?", userID).
+		Order("created_at DESC").
+		Find(&returns).Error; err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
+
+func (rr *returnRepository) GetReturnsByStatus(status string) ([]model.ReturnRequest, error) {
+	var returns []model.ReturnRequest
+	if err := rr.db.Preload("Photos").
+		Where("status=?", status).
+		Order("created_at ASC").
+		Find(&returns).Error; err != nil {
+		return nil, err
+	}
+	return returns, nil
+}
+
+// 状態の更新と監査ログの追記を同時に行う
+// 更新条件にevent.FromStatusを含めて、同時に別のスタッフが処理した場合は更新しない(楽観ロック)
+func (rr *returnRepository) UpdateReturnStatus(returnRequest *model.ReturnRequest, event *model.ReturnEvent) error {
+	return rr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.ReturnRequest{}).
+			Where("id = ? AND status = ?", returnRequest.ID, event.FromStatus).
+			Updates(map[string]interface{}{
+				"status":        returnRequest.Status,
+				"refund_amount": returnRequest.RefundAmount,
+				"disposition":   returnRequest.Disposition,
+				"grade":         returnRequest.Grade,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		return tx.Create(event).Error
+	})
+}
+
+// 返品の承認、決済行をロックしてから返金できる残額をcheckで確認し、状態を進める
+// returned: その決済の承認済み・完了の返品の返金額の合計(返金・店内クレジットの両方)
+// refundedByReturns: そのうち完了して元の決済に返金した分(決済の返金累計に含まれている)
+// 同じ決済の返品の同時の承認は直列化され、合計で決済額を超えて承認されない
+func (rr *returnRepository) ApproveReturn(returnRequest *model.ReturnRequest, event *model.ReturnEvent,
+	check func(payment model.Payment, returned int, refundedByReturns int) error) error {
+	return rr.db.Transaction(func(tx *gorm.DB) error {
+		payment, err := lockReturnPayment(tx, returnRequest.PaymentID)
+		if err != nil {
+			return err
+		}
+		var sums struct {
+			Returned          int
+			RefundedByReturns int
+		}
+		if err := tx.Model(&model.ReturnRequest{}).
+			Where("payment_id = ? AND status IN ?", returnRequest.PaymentID, []string{model.ReturnApproved, model.ReturnCompleted}).
+			Select("COALESCE(SUM(refund_amount), 0) AS returned, "+
+				"COALESCE(SUM(CASE WHEN status = ? AND resolution = ? THEN refund_amount ELSE 0 END), 0) AS refunded_by_returns",
+				model.ReturnCompleted, model.ResolutionRefund).
+			Scan(&sums).Error; err != nil {
+			return err
+		}
+		if err := check(payment, sums.Returned, sums.RefundedByReturns); err != nil {
+			return err
+		}
+		result := tx.Model(&model.ReturnRequest{}).
+			Where("id = ? AND status = ?", returnRequest.ID, event.FromStatus).
+			Updates(map[string]interface{}{
+				"status":        returnRequest.Status,
+				"refund_amount": returnRequest.RefundAmount,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		return tx.Create(event).Error
+	})
+}
+
+// 決済に対して店内クレジットで返した金額の合計、完了した返品のみ
+// 店内クレジットは決済の返金額に反映されないので、ポイントの取消の割合の計算で足す
+func (rr *returnRepository) SumStoreCreditByPayment(paymentID uint) (int, error) {
+	var total int
+	if err := rr.db.Model(&model.ReturnRequest{}).
+		Where("payment_id = ? AND resolution = ? AND status = ?", paymentID, model.ResolutionStoreCredit, model.ReturnCompleted).
+		Select("COALESCE(SUM(refund_amount), 0)").
+		Scan(&total).Error; err != nil {
+		return 0, err
+	}
+	return total, nil
+}
+
+func lockReturnPayment(tx *gorm.DB, paymentID uint) (model.Payment, error) {
+	var payment model.Payment
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&payment, paymentID).Error; err != nil {
+		return model.Payment{}, err
+	}
+	return payment, nil
+}
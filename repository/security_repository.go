@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"record-shop-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ISecurityRepository interface {
+	GetLoginThrottles(keys []string) ([]model.LoginThrottle, error)
+	RecordLoginFailure(throttle *model.LoginThrottle, now time.Time, window time.Duration) error
+	LockLogin(key string, until time.Time) error
+	ResetLoginThrottle(key string) error
+	CreateSecurityEvent(event *model.SecurityEvent) error
+}
+
+type securityRepository struct {
+	db *gorm.DB
+}
+
+func NewSecurityRepository(db *gorm.DB) ISecurityRepository {
+	return &securityRepository{db}
+}
+
+func (sr *securityRepository) GetLoginThrottles(keys []string) ([]model.LoginThrottle, error) {
+	var throttles []model.LoginThrottle
+	if err := sr.db.Where("key IN ?", keys).Find(&throttles).Error; err != nil {
+		return nil, err
+	}
+	return throttles, nil
+}
+
+// 失敗回数を1増やす、前回の失敗からwindow以上空いていれば1からやり直す
+// 同時に失敗した場合も数え漏れが無いように、行をロックしてから更新する
+func (sr *securityRepository) RecordLoginFailure(throttle *model.LoginThrottle, now time.Time, window time.Duration) error {
+	return sr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&model.LoginThrottle{Key: throttle.Key, LastFailureAt: now}).Error; err != nil {
+			return err
+		}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("key=?", throttle.Key).First(throttle).Error; err != nil {
+			return err
+		}
+		if now.Sub(throttle.LastFailureAt) >= window {
+			throttle.Failures = 0
+		}
+		throttle.Failures++
+		throttle.LastFailureAt = now
+		return tx.Model(&model.LoginThrottle{}).Where("key=?", throttle.Key).
+			Updates(map[string]interface{}{"failures": throttle.Failures, "last_failure_at": now}).Error
+	})
+}
+
+func (sr *securityRepository) LockLogin(key string, until time.Time) error {
+	if err := sr.db.Model(&model.LoginThrottle{}).Where("key=?", key).
+		Update("locked_until", until).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// ログイン成功時、アカウントの失敗回数とロックを消す
+func (sr *securityRepository) ResetLoginThrottle(key string) error {
+	if err := sr.db.Where("key=?", key).Delete(&model.LoginThrottle{}).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (sr *securityRepository) CreateSecurityEvent(event *model.SecurityEvent) error {
+	if err := sr.db.Create(event).Error; err != nil {
+		return err
+	}
+	return nil
+}
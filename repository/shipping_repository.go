@@ -0,0 +1,133 @@
+package repository
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+
+	"gorm.io/gorm"
+)
+
+type IShippingRepository interface {
+	CreateShippingMethod(method *model.ShippingMethod) error
+	GetShippingMethods() ([]model.ShippingMethod, error)
+	CreateShippingRate(rate *model.ShippingRate) error
+	GetShippingRates(region string, packageType string, weightGrams int) ([]model.ShippingRate, error)
+	CreateShipment(shipment *model.Shipment) error
+	GetShipmentByID(shipment *model.Shipment, id uint) error
+	GetShipmentsByUser(userID uint) ([]model.Shipment, error)
+	AddShipmentEvent(shipment *model.Shipment, event *model.ShipmentEvent) error
+}
+
+type shippingRepository struct {
+	db *gorm.DB
+}
+
+func NewShippingRepository(db *gorm.DB) IShippingRepository {
+	return &shippingRepository{db}
+}
+
+func (sr *shippingRepository) CreateShippingMethod(method *model.ShippingMethod) error {
+	if err := sr.db.Create(method).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (sr *shippingRepository) GetShippingMethods() ([]model.ShippingMethod, error) {
+	var methods []model.ShippingMethod
+	// Preload: 関連する料金表を別クエリでまとめて取得してRatesに詰める
+	if err := sr.db.
+		Preload("Rates", func(db *gorm.DB) *gorm.DB {
+			return db.Order("region ASC, package_type ASC, max_weight_grams ASC")
+		}).
+		Order("id ASC").
+		Find(&methods).Error; err != nil {
+		return nil, err
+	}
+	return methods, nil
+}
+
+func (sr *shippingRepository) CreateShippingRate(rate *model.ShippingRate) error {
+	if err := sr.db.Create(rate).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 配送方法ごとに、重量を満たす一番安い(=一番小さい重量帯の)料金行を返す
+func (sr *shippingRepository) GetShippingRates(region string, packageType string, weightGrams int) ([]model.ShippingRate, error) {
+	var rates []model.ShippingRate
+	// DISTINCT ON: PostgreSQL固有、ORDER BYの先頭の列ごとに最初の1行だけ残す
+	if err := sr.db.
+		Raw(`SELECT DISTINCT ON (shipping_method_id) *
+			FROM shipping_rates
+			WHERE region = ? AND package_type = ? AND max_weight_grams >= ?
+			ORDER BY shipping_method_id, max_weight_grams ASC`,
+			region, packageType, weightGrams).
+		Scan(&rates).Error; err != nil {
+		return nil, err
+	}
+	if len(rates) == 0 {
+		return rates, nil
+	}
+	// 業者名・配送方法名もレスポンスに含めたいのでまとめて取得
+	methodIDs := make([]uint, 0, len(rates))
+	for _, rate := range rates {
+		methodIDs = append(methodIDs, rate.ShippingMethodID)
+	}
+	var methods []model.ShippingMethod
+	if err := sr.db.Where("id IN ?", methodIDs).Find(&methods).Error; err != nil {
+		return nil, err
+	}
+	methodByID := map[uint]model.ShippingMethod{}
+	for _, method := range methods {
+		methodByID[method.ID] = method
+	}
+	for i := range rates {
+		rates[i].ShippingMethod = methodByID[rates[i].ShippingMethodID]
+	}
+	return rates, nil
+}
+
+func (sr *shippingRepository) CreateShipment(shipment *model.Shipment) error {
+	if err := sr.db.Create(shipment).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (sr *shippingRepository) GetShipmentByID(shipment *model.Shipment, id uint) error {
+	if err := sr.db.
+		Preload("Events", func(db *gorm.DB) *gorm.DB {
+			return db.Order("created_at ASC, id ASC")
+		}).
+		First(shipment, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (sr *shippingRepository) GetShipmentsByUser(userID uint) ([]model.Shipment, error) {
+	var shipments []model.Shipment
+	if err := sr.db.Where("user_id=?", userID).Order("created_at DESC, id DESC").Find(&shipments).Error; err != nil {
+		return nil, err
+	}
+	return shipments, nil
+}
+
+// 配送状況の記録と、Shipmentの現在ステータスの更新を同時に行う
+func (sr *shippingRepository) AddShipmentEvent(shipment *model.Shipment, event *model.ShipmentEvent) error {
+	return sr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(shipment).Updates(map[string]interface{}{
+			"status":          shipment.Status,
+			"tracking_number": shipment.TrackingNumber,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return fmt.Errorf("object does not exist")
+		}
+		return tx.Create(event).Error
+	})
+}
@@ -0,0 +1,40 @@
+package repository
+
+import (
+	"record-shop-rest-api/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ITaxRepository interface {
+	GetTaxRates() ([]model.TaxRate, error)
+	UpsertTaxRate(rate *model.TaxRate) error
+}
+
+type taxRepository struct {
+	db *gorm.DB
+}
+
+func NewTaxRepository(db *gorm.DB) ITaxRepository {
+	return &taxRepository{db}
+}
+
+func (tr *taxRepository) GetTaxRates() ([]model.TaxRate, error) {
+	var rates []model.TaxRate
+	if err := tr.db.Order("category ASC").Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// 区分が既にあれば税率を更新、無ければ作成
+func (tr *taxRepository) UpsertTaxRate(rate *model.TaxRate) error {
+	if err := tr.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "category"}},
+		DoUpdates: clause.AssignmentColumns([]string{"percent", "updated_at"}),
+	}).Create(rate).Error; err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"record-shop-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ITokenRepository interface {
+	CreateRefreshToken(token *model.RefreshToken) error
+	GetRefreshTokenByHash(token *model.RefreshToken, tokenHash string) error
+	RotateRefreshToken(old *model.RefreshToken, next *model.RefreshToken, now time.Time) error
+	RevokeFamily(familyID string, now time.Time) error
+	RevokeAccessToken(revoked *model.RevokedToken) error
+	RevokeUserTokens(revocation *model.UserTokenRevocation) error
+	GetRevocations(now time.Time, since time.Time) ([]model.RevokedToken, []model.UserTokenRevocation, error)
+	CreateVerificationToken(token *model.EmailVerificationToken) error
+	GetVerificationTokenByHash(token *model.EmailVerificationToken, tokenHash string) error
+	GetLatestVerificationToken(token *model.EmailVerificationToken, userID uint) error
+	VerifyEmail(token *model.EmailVerificationToken, now time.Time) error
+	CreatePasswordResetToken(token *model.PasswordResetToken) error
+	GetPasswordResetTokenByHash(token *model.PasswordResetToken, tokenHash string) error
+	GetLatestPasswordResetToken(token *model.PasswordResetToken, userID uint) error
+	ResetPassword(token *model.PasswordResetToken, passwordHash string, now time.Time) error
+}
+
+type tokenRepository struct {
+	db *gorm.DB
+}
+
+func NewTokenRepository(db *gorm.DB) ITokenRepository {
+	return &tokenRepository{db}
+}
+
+func (tr *tokenRepository) CreateRefreshToken(token *model.RefreshToken) error {
+	if err := tr.db.Create(token).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (tr *tokenRepository) GetRefreshTokenByHash(token *model.RefreshToken, tokenHash string) error {
+	if err := tr.db.Where("token_hash=?", tokenHash).First(token).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 古いトークンを使用済みにして、新しいトークンを同じ系列で作る
+// 更新条件に未使用・未失効を含めて、同じトークンで同時にリフレッシュされた場合は片方だけ成功させる
+func (tr *tokenRepository) RotateRefreshToken(old *model.RefreshToken, next *model.RefreshToken, now time.Time) error {
+	return tr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", old.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		old.UsedAt = &now
+		return tx.Create(next).Error
+	})
+}
+
+func (tr *tokenRepository) RevokeFamily(familyID string, now time.Time) error {
+	if err := tr.db.Model(&model.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", now).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 同じトークンで2回ログアウトしても1件だけ残す
+func (tr *tokenRepository) RevokeAccessToken(revoked *model.RevokedToken) error {
+	if err := tr.db.Clauses(clause.OnConflict{DoNothing: true}).Create(revoked).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// ユーザの失効時刻を更新して、リフレッシュトークン・APIキーも全て失効させる
+func (tr *tokenRepository) RevokeUserTokens(revocation *model.UserTokenRevocation) error {
+	return tr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "user_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"revoked_before", "revoked_by", "updated_at"}),
+		}).Create(revocation).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", revocation.UserID).
+			Update("revoked_at", revocation.RevokedBefore).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.APIKey{}).
+			Where("user_id = ? AND revoked_at IS NULL", revocation.UserID).
+			Update("revoked_at", revocation.RevokedBefore).Error
+	})
+}
+
+// まだ意味のある失効の一覧、期限切れのアクセストークンの失効は削除する
+// since: ユーザ単位の失効はこれ以降のもののみ(それより前に発行されたトークンは既に期限切れ)
+func (tr *tokenRepository) GetRevocations(now time.Time, since time.Time) ([]model.RevokedToken, []model.UserTokenRevocation, error) {
+	if err := tr.db.Where("expires_at <= ?", now).Delete(&model.RevokedToken{}).Error; err != nil {
+		return nil, nil, err
+	}
+	var tokens []model.RevokedToken
+	if err := tr.db.Find(&tokens).Error; err != nil {
+		return nil, nil, err
+	}
+	var users []model.UserTokenRevocation
+	if err := tr.db.Where("revoked_before > ?", since).Find(&users).Error; err != nil {
+		return nil, nil, err
+	}
+	return tokens, users, nil
+}
+
+// 新しい確認トークンを作る、同じユーザの未使用のトークンは削除して最新のリンクだけ有効にする
+func (tr *tokenRepository) CreateVerificationToken(token *model.EmailVerificationToken) error {
+	return tr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Delete(&model.EmailVerificationToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+func (tr *tokenRepository) GetVerificationTokenByHash(token *model.EmailVerificationToken, tokenHash string) error {
+	if err := tr.db.Where("token_hash=?", tokenHash).First(token).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 再送の間隔の確認に使う
+func (tr *tokenRepository) GetLatestVerificationToken(token *model.EmailVerificationToken, userID uint) error {
+	if err := tr.db.Where("user_id=?", userID).Order("created_at DESC").First(token).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// トークンを使用済みにして、ユーザを確認済みにする
+// 更新条件に未使用を含めて、同じリンクが同時に開かれた場合は片方だけ成功させる
+func (tr *tokenRepository) VerifyEmail(token *model.EmailVerificationToken, now time.Time) error {
+	return tr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.EmailVerificationToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		token.UsedAt = &now
+		updates := map[string]interface{}{"email_verified": true, "email_verified_at": now}
+		// メールアドレスの変更の場合は、確認できた新しいアドレスに変える
+		if token.Email != "" {
+			updates["email"] = token.Email
+		}
+		return tx.Model(&model.User{}).Where("id=?", token.UserID).Updates(updates).Error
+	})
+}
+
+// 新しい再設定トークンを作る、同じユーザの未使用のトークンは削除して最新のリンクだけ有効にする
+func (tr *tokenRepository) CreatePasswordResetToken(token *model.PasswordResetToken) error {
+	return tr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", token.UserID).
+			Delete(&model.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(token).Error
+	})
+}
+
+func (tr *tokenRepository) GetPasswordResetTokenByHash(token *model.PasswordResetToken, tokenHash string) error {
+	if err := tr.db.Where("token_hash=?", tokenHash).First(token).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (tr *tokenRepository) GetLatestPasswordResetToken(token *model.PasswordResetToken, userID uint) error {
+	if err := tr.db.Where("user_id=?", userID).Order("created_at DESC").First(token).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// トークンを使用済みにして、パスワードを更新する
+// メールのリンクを開けた＝アドレスの持ち主なので、未確認だった場合は確認済みにする
+func (tr *tokenRepository) ResetPassword(token *model.PasswordResetToken, passwordHash string, now time.Time) error {
+	return tr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.PasswordResetToken{}).
+			Where("id = ? AND used_at IS NULL", token.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		token.UsedAt = &now
+		if err := tx.Model(&model.User{}).Where("id=?", token.UserID).
+			Update("password", passwordHash).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.User{}).Where("id = ? AND email_verified = ?", token.UserID, false).
+			Updates(map[string]interface{}{"email_verified": true, "email_verified_at": now}).Error
+	})
+}
@@ -0,0 +1,145 @@
+package repository
+
+import (
+	"record-shop-rest-api/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ITradeInRepository interface {
+	GetTradeInRules() ([]model.TradeInRule, error)
+	UpsertTradeInRule(rule *model.TradeInRule) error
+	CountStock(recordID uint) (int, error)
+	GetReferencePrice(recordID uint, grade string) (int, error)
+	CreateQuote(quote *model.TradeInQuote) error
+	GetQuoteByID(quote *model.TradeInQuote, id uint) error
+	GetQuotesByUser(userID uint) ([]model.TradeInQuote, error)
+	GetQuotesByStatus(status string) ([]model.TradeInQuote, error)
+	UpdateQuote(quote *model.TradeInQuote, fromStatus string) error
+}
+
+type tradeInRepository struct {
+	db *gorm.DB
+}
+
+func NewTradeInRepository(db *gorm.DB) ITradeInRepository {
+	return &tradeInRepository{db}
+}
+
+func (tr *tradeInRepository) GetTradeInRules() ([]model.TradeInRule, error) {
+	var rules []model.TradeInRule
+	if err := tr.db.Order("grade ASC").Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return rules, nil
+}
+
+// グレードが既にあれば更新、無ければ作成
+func (tr *tradeInRepository) UpsertTradeInRule(rule *model.TradeInRule) error {
+	if err := tr.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "grade"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"cash_percent", "credit_percent", "overstock_threshold", "overstock_cut_percent", "updated_at",
+		}),
+	}).Create(rule).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 全拠点・全盤質の在庫数の合計
+func (tr *tradeInRepository) CountStock(recordID uint) (int, error) {
+	var count int
+	if err := tr.db.Model(&model.StockLevel{}).
+		Select("COALESCE(SUM(quantity), 0)").
+		Where("record_id=?", recordID).
+		Scan(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// 査定の基準にする店頭販売価格、同じレコード・盤質のPOS商品の売価(複数あれば安い方)
+// 店頭で扱ったことが無い場合は0
+func (tr *tradeInRepository) GetReferencePrice(recordID uint, grade string) (int, error) {
+	var price int
+	if err := tr.db.Model(&model.PosItem{}).
+		Select("COALESCE(MIN(price), 0)").
+		Where("record_id=? AND grade=?", recordID, grade).
+		Scan(&price).Error; err != nil {
+		return 0, err
+	}
+	return price, nil
+}
+
+// Itemsも関連として一緒にINSERTされる
+func (tr *tradeInRepository) CreateQuote(quote *model.TradeInQuote) error {
+	if err := tr.db.Create(quote).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (tr *tradeInRepository) GetQuoteByID(quote *model.TradeInQuote, id uint) error {
+	if err := tr.db.
+		Preload("Items", func(db *gorm.DB) *gorm.DB {
+			return db.Order("id ASC")
+		}).
+		First(quote, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (tr *tradeInRepository) GetQuotesByUser(userID uint) ([]model.TradeInQuote, error) {
+	var quotes []model.TradeInQuote
+	if err := tr.db.Preload("Items").
+		Where("user_id=?", userID).
+		Order("created_at DESC").
+		Find(&quotes).Error; err != nil {
+		return nil, err
+	}
+	return quotes, nil
+}
+
+func (tr *tradeInRepository) GetQuotesByStatus(status string) ([]model.TradeInQuote, error) {
+	var quotes []model.TradeInQuote
+	if err := tr.db.Preload("Items").
+		Where("status=?", status).
+		Order("created_at ASC").
+		Find(&quotes).Error; err != nil {
+		return nil, err
+	}
+	return quotes, nil
+}
+
+// 査定と明細を1トランザクションで更新する
+// 更新条件にfromStatusを含めて、同時に別のスタッフが処理した場合は更新しない(楽観ロック)
+func (tr *tradeInRepository) UpdateQuote(quote *model.TradeInQuote, fromStatus string) error {
+	return tr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.TradeInQuote{}).
+			Where("id = ? AND status = ?", quote.ID, fromStatus).
+			Updates(map[string]interface{}{
+				"status":        quote.Status,
+				"cash_total":    quote.CashTotal,
+				"credit_total":  quote.CreditTotal,
+				"payout":        quote.Payout,
+				"payout_amount": quote.PayoutAmount,
+				"decided_by":    quote.DecidedBy,
+				"note":          quote.Note,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		for i := range quote.Items {
+			if err := tx.Omit(clause.Associations).Save(&quote.Items[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
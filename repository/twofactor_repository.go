@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"record-shop-rest-api/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ITwoFactorRepository interface {
+	GetTwoFactor(twoFactor *model.TwoFactor, userID uint) error
+	SaveTwoFactorSecret(twoFactor *model.TwoFactor) error
+	EnableTwoFactor(twoFactor *model.TwoFactor, step int64, codes []model.RecoveryCode, now time.Time) error
+	UseTwoFactorStep(userID uint, step int64) error
+	DeleteTwoFactor(userID uint) error
+	ReplaceRecoveryCodes(userID uint, codes []model.RecoveryCode) error
+	UseRecoveryCode(userID uint, codeHash string, now time.Time) error
+	CreateLoginChallenge(challenge *model.LoginChallenge) error
+	GetLoginChallengeByHash(challenge *model.LoginChallenge, tokenHash string) error
+	CountChallengeAttempt(challenge *model.LoginChallenge, maxAttempts int) error
+	UseLoginChallenge(challenge *model.LoginChallenge, now time.Time) error
+	GetTwoFactorPolicies() ([]model.TwoFactorPolicy, error)
+	GetTwoFactorPolicy(policy *model.TwoFactorPolicy, role string) error
+	SaveTwoFactorPolicy(policy *model.TwoFactorPolicy) error
+}
+
+type twoFactorRepository struct {
+	db *gorm.DB
+}
+
+func NewTwoFactorRepository(db *gorm.DB) ITwoFactorRepository {
+	return &twoFactorRepository{db}
+}
+
+func (fr *twoFactorRepository) GetTwoFactor(twoFactor *model.TwoFactor, userID uint) error {
+	if err := fr.db.Where("user_id=?", userID).First(twoFactor).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 登録(やり直し)で秘密鍵を保存する、有効化済みの設定は上書きしない
+func (fr *twoFactorRepository) SaveTwoFactorSecret(twoFactor *model.TwoFactor) error {
+	result := fr.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "last_used_step", "updated_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Eq{Column: "two_factors.enabled", Value: false}}},
+	}).Create(twoFactor)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+// 確認済みにして、リカバリーコードを作り直す
+func (fr *twoFactorRepository) EnableTwoFactor(twoFactor *model.TwoFactor, step int64, codes []model.RecoveryCode, now time.Time) error {
+	return fr.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.TwoFactor{}).
+			Where("user_id = ? AND enabled = ? AND last_used_step < ?", twoFactor.UserID, false, step).
+			Updates(map[string]interface{}{"enabled": true, "last_used_step": step, "confirmed_at": now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return ErrStaleObject
+		}
+		twoFactor.Enabled = true
+		twoFactor.LastUsedStep = step
+		twoFactor.ConfirmedAt = &now
+		return replaceRecoveryCodes(tx, twoFactor.UserID, codes)
+	})
+}
+
+// コードを使用済みにする、同じか古いステップのコードは使えない(盗み見たコードの再利用を防ぐ)
+func (fr *twoFactorRepository) UseTwoFactorStep(userID uint, step int64) error {
+	result := fr.db.Model(&model.TwoFactor{}).
+		Where("user_id = ? AND enabled = ? AND last_used_step < ?", userID, true, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+func (fr *twoFactorRepository) DeleteTwoFactor(userID uint) error {
+	return fr.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id=?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id=?", userID).Delete(&model.TwoFactor{}).Error
+	})
+}
+
+func (fr *twoFactorRepository) ReplaceRecoveryCodes(userID uint, codes []model.RecoveryCode) error {
+	return fr.db.Transaction(func(tx *gorm.DB) error {
+		return replaceRecoveryCodes(tx, userID, codes)
+	})
+}
+
+// 古いコードは使用済みかどうかに関わらず全て消す
+func replaceRecoveryCodes(tx *gorm.DB, userID uint, codes []model.RecoveryCode) error {
+	if err := tx.Where("user_id=?", userID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return err
+	}
+	if len(codes) == 0 {
+		return nil
+	}
+	return tx.Create(&codes).Error
+}
+
+// 未使用のコードなら使用済みにする、該当が無ければErrStaleObject
+func (fr *twoFactorRepository) UseRecoveryCode(userID uint, codeHash string, now time.Time) error {
+	result := fr.db.Model(&model.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	return nil
+}
+
+func (fr *twoFactorRepository) CreateLoginChallenge(challenge *model.LoginChallenge) error {
+	if err := fr.db.Create(challenge).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (fr *twoFactorRepository) GetLoginChallengeByHash(challenge *model.LoginChallenge, tokenHash string) error {
+	if err := fr.db.Where("token_hash=?", tokenHash).First(challenge).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// コードの入力回数を数える、上限に達していればErrStaleObject
+func (fr *twoFactorRepository) CountChallengeAttempt(challenge *model.LoginChallenge, maxAttempts int) error {
+	result := fr.db.Model(&model.LoginChallenge{}).
+		Where("id = ? AND used_at IS NULL AND attempts < ?", challenge.ID, maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	challenge.Attempts++
+	return nil
+}
+
+func (fr *twoFactorRepository) UseLoginChallenge(challenge *model.LoginChallenge, now time.Time) error {
+	result := fr.db.Model(&model.LoginChallenge{}).
+		Where("id = ? AND used_at IS NULL", challenge.ID).
+		Update("used_at", now)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return ErrStaleObject
+	}
+	challenge.UsedAt = &now
+	return nil
+}
+
+func (fr *twoFactorRepository) GetTwoFactorPolicies() ([]model.TwoFactorPolicy, error) {
+	var policies []model.TwoFactorPolicy
+	if err := fr.db.Order("role").Find(&policies).Error; err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (fr *twoFactorRepository) GetTwoFactorPolicy(policy *model.TwoFactorPolicy, role string) error {
+	if err := fr.db.Where("role=?", role).First(policy).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (fr *twoFactorRepository) SaveTwoFactorPolicy(policy *model.TwoFactorPolicy) error {
+	if err := fr.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "role"}},
+		DoUpdates: clause.AssignmentColumns([]string{"required", "updated_by", "updated_at"}),
+	}).Create(policy).Error; err != nil {
+		return err
+	}
+	return nil
+}
@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"fmt"
 	"record-shop-rest-api/model"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -9,6 +11,11 @@ import (
 type IUserRepository interface {
 	CreateUser(user *model.User) error
 	GetUserByEmail(user *model.User, email string) error
+	GetUserByID(user *model.User, id uint) error
+	UpdateUserRole(user *model.User, role string) error
+	UpdatePassword(userID uint, passwordHash string) error
+	CountUsersByRole(role string) (int64, error)
+	DeleteUser(user *model.User, now time.Time) error
 }
 
 type userRepository struct {
@@ -41,3 +48,73 @@ func (ur *userRepository) GetUserByEmail(user *model.User, email string) error {
 	}
 	return nil
 }
+
+func (ur *userRepository) GetUserByID(user *model.User, id uint) error {
+	if err := ur.db.First(user, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ur *userRepository) UpdateUserRole(user *model.User, role string) error {
+	result := ur.db.Model(user).Where("id=?", user.ID).Update("role", role)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (ur *userRepository) UpdatePassword(userID uint, passwordHash string) error {
+	result := ur.db.Model(&model.User{}).Where("id=?", userID).Update("password", passwordHash)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func (ur *userRepository) CountUsersByRole(role string) (int64, error) {
+	var count int64
+	if err := ur.db.Model(&model.User{}).Where("role=?", role).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// 退会、注文・決済などの履歴が参照するので行は論理削除で残し、個人情報と認証情報を消す
+// アドレスは同じアドレスで登録し直せるように置き換える
+// ログイン手段(パスワード・外部アカウントの紐付け・2段階認証・APIキー)と未使用のリンクも消す
+func (ur *userRepository) DeleteUser(user *model.User, now time.Time) error {
+	return ur.db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.User{}).Where("id=?", user.ID).Updates(map[string]interface{}{
+			"email":             fmt.Sprintf("deleted-%d@invalid", user.ID),
+			"password":          "",
+			"email_verified":    false,
+			"email_verified_at": nil,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected < 1 {
+			return gorm.ErrRecordNotFound
+		}
+		if err := tx.Delete(&model.User{}, user.ID).Error; err != nil {
+			return err
+		}
+		for _, table := range []interface{}{
+			&model.UserIdentity{}, &model.RecoveryCode{}, &model.TwoFactor{}, &model.LoginChallenge{},
+			&model.EmailVerificationToken{}, &model.PasswordResetToken{},
+		} {
+			if err := tx.Where("user_id=?", user.ID).Delete(table).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&model.APIKey{}).Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Update("revoked_at", now).Error
+	})
+}
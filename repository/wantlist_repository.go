@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+
+	"gorm.io/gorm"
+)
+
+type IWantListRepository interface {
+	CreateEntry(entry *model.WantListEntry) error
+	GetEntriesByUser(userID uint) ([]model.WantListEntry, error)
+	DeleteEntry(userID uint, id uint) error
+	GetCandidateEntries(record model.Record) ([]model.WantListEntry, error)
+}
+
+type wantListRepository struct {
+	db *gorm.DB
+}
+
+func NewWantListRepository(db *gorm.DB) IWantListRepository {
+	return &wantListRepository{db}
+}
+
+func (wr *wantListRepository) CreateEntry(entry *model.WantListEntry) error {
+	if err := wr.db.Create(entry).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (wr *wantListRepository) GetEntriesByUser(userID uint) ([]model.WantListEntry, error) {
+	var entries []model.WantListEntry
+	if err := wr.db.Where("user_id=?", userID).Order("created_at DESC").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func (wr *wantListRepository) DeleteEntry(userID uint, id uint) error {
+	result := wr.db.Where("id=? AND user_id=?", id, userID).Delete(&model.WantListEntry{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return fmt.Errorf("object does not exist")
+	}
+	return nil
+}
+
+// レコードID、またはタイトル・アーティストのどちらかが一致する登録を大まかに絞り込む
+// 価格・盤質などの細かい条件はusecase側で判定する
+func (wr *wantListRepository) GetCandidateEntries(record model.Record) ([]model.WantListEntry, error) {
+	var entries []model.WantListEntry
+	if err := wr.db.
+		Where("record_id = ? OR LOWER(title) = LOWER(?) OR LOWER(artist) = LOWER(?)",
+			record.ID, record.Title, record.Artist).
+		Find(&entries).Error; err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
@@ -0,0 +1,192 @@
+package repository
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+
+	"gorm.io/gorm"
+)
+
+type IWishlistRepository interface {
+	CreateWishlist(wishlist *model.Wishlist) error
+	GetWishlistsByUser(userID uint) ([]model.Wishlist, error)
+	GetWishlistByID(wishlist *model.Wishlist, id uint) error
+	GetWishlistByShareToken(wishlist *model.Wishlist, token string) error
+	UpdateWishlist(wishlist *model.Wishlist) error
+	DeleteWishlist(id uint) error
+	AddItem(item *model.WishlistItem) error
+	UpdateItemNote(wishlistID uint, itemID uint, note string) error
+	DeleteItem(wishlistID uint, itemID uint) error
+	ReorderItems(wishlistID uint, itemIDs []uint) error
+	GetRecordAvailabilities(recordIDs []uint) (map[uint]model.RecordAvailability, error)
+}
+
+type wishlistRepository struct {
+	db *gorm.DB
+}
+
+func NewWishlistRepository(db *gorm.DB) IWishlistRepository {
+	return &wishlistRepository{db}
+}
+
+// エントリを並び順で、レコード情報も合わせて読み込む
+func preloadWishlistItems(db *gorm.DB) *gorm.DB {
+	return db.
+		Preload("Items", func(db *gorm.DB) *gorm.DB {
+			return db.Order("position ASC, id ASC")
+		}).
+		Preload("Items.Record")
+}
+
+func (wr *wishlistRepository) CreateWishlist(wishlist *model.Wishlist) error {
+	if err := wr.db.Create(wishlist).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (wr *wishlistRepository) GetWishlistsByUser(userID uint) ([]model.Wishlist, error) {
+	var wishlists []model.Wishlist
+	if err := preloadWishlistItems(wr.db).
+		Where("user_id=?", userID).
+		Order("created_at ASC").
+		Find(&wishlists).Error; err != nil {
+		return nil, err
+	}
+	return wishlists, nil
+}
+
+func (wr *wishlistRepository) GetWishlistByID(wishlist *model.Wishlist, id uint) error {
+	if err := preloadWishlistItems(wr.db).First(wishlist, id).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+func (wr *wishlistRepository) GetWishlistByShareToken(wishlist *model.Wishlist, token string) error {
+	if err := preloadWishlistItems(wr.db).Where("share_token=?", token).First(wishlist).Error; err != nil {
+		return err
+	}
+	return nil
+}
+
+// 名前と共有トークンのみ更新、Selectで指定するとnil(共有解除)も更新される
+func (wr *wishlistRepository) UpdateWishlist(wishlist *model.Wishlist) error {
+	result := wr.db.Model(wishlist).Select("name", "share_token").Updates(wishlist)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return fmt.Errorf("object does not exist")
+	}
+	return nil
+}
+
+func (wr *wishlistRepository) DeleteWishlist(id uint) error {
+	result := wr.db.Where("id=?", id).Delete(&model.Wishlist{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return fmt.Errorf("object does not exist")
+	}
+	return nil
+}
+
+// 末尾に追加する
+func (wr *wishlistRepository) AddItem(item *model.WishlistItem) error {
+	return wr.db.Transaction(func(tx *gorm.DB) error {
+		var maxPosition int
+		if err := tx.Model(&model.WishlistItem{}).
+			Where("wishlist_id=?", item.WishlistID).
+			Select("COALESCE(MAX(position), 0)").
+			Scan(&maxPosition).Error; err != nil {
+			return err
+		}
+		item.Position = maxPosition + 1
+		return tx.Create(item).Error
+	})
+}
+
+func (wr *wishlistRepository) UpdateItemNote(wishlistID uint, itemID uint, note string) error {
+	result := wr.db.Model(&model.WishlistItem{}).
+		Where("id=? AND wishlist_id=?", itemID, wishlistID).
+		Update("note", note)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return fmt.Errorf("object does not exist")
+	}
+	return nil
+}
+
+func (wr *wishlistRepository) DeleteItem(wishlistID uint, itemID uint) error {
+	result := wr.db.Where("id=? AND wishlist_id=?", itemID, wishlistID).Delete(&model.WishlistItem{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected < 1 {
+		return fmt.Errorf("object does not exist")
+	}
+	return nil
+}
+
+// itemIDsの順に1から振り直す
+func (wr *wishlistRepository) ReorderItems(wishlistID uint, itemIDs []uint) error {
+	return wr.db.Transaction(func(tx *gorm.DB) error {
+		for i, itemID := range itemIDs {
+			result := tx.Model(&model.WishlistItem{}).
+				Where("id=? AND wishlist_id=?", itemID, wishlistID).
+				Update("position", i+1)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected < 1 {
+				return fmt.Errorf("item %d does not exist in the wishlist", itemID)
+			}
+		}
+		return nil
+	})
+}
+
+// 在庫数(全拠点の合計)と店頭価格の最安値をレコードごとに返す
+// 在庫も店頭価格も無いレコードはmapに含まれない
+func (wr *wishlistRepository) GetRecordAvailabilities(recordIDs []uint) (map[uint]model.RecordAvailability, error) {
+	availabilities := map[uint]model.RecordAvailability{}
+	if len(recordIDs) == 0 {
+		return availabilities, nil
+	}
+	var stocks []struct {
+		RecordID uint
+		Quantity int
+	}
+	if err := wr.db.Model(&model.StockLevel{}).
+		Select("record_id, SUM(quantity) AS quantity").
+		Where("record_id IN ? AND quantity > 0", recordIDs).
+		Group("record_id").
+		Scan(&stocks).Error; err != nil {
+		return nil, err
+	}
+	for _, stock := range stocks {
+		availabilities[stock.RecordID] = model.RecordAvailability{RecordID: stock.RecordID, StockQuantity: stock.Quantity}
+	}
+	var prices []struct {
+		RecordID uint
+		Price    int
+	}
+	if err := wr.db.Model(&model.PosItem{}).
+		Select("record_id, MIN(price) AS price").
+		Where("record_id IN ?", recordIDs).
+		Group("record_id").
+		Scan(&prices).Error; err != nil {
+		return nil, err
+	}
+	for _, price := range prices {
+		availability := availabilities[price.RecordID]
+		availability.RecordID = price.RecordID
+		availability.Price = &price.Price
+		availabilities[price.RecordID] = availability
+	}
+	return availabilities, nil
+}
@@ -0,0 +1,85 @@
+package router
+
+import (
+	"net/http"
+	"record-shop-rest-api/model"
+	"slices"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/labstack/echo/v4"
+)
+
+// JWTのroleクレームが指定したロールのどれかでなければ403を返す
+// jwtAuthで"user"キーにトークンが入っている前提なので、必ずjwtAuthの後に適用する
+// ロールはトークン発行時のもので、変更は次のログイン・リフレッシュから反映される(roleクレームの無い古いトークンはcustomer扱い)
+func requireRole(roles ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			role := model.RoleCustomer
+			if token, ok := c.Get("user").(*jwt.Token); ok && token != nil {
+				if claims, ok := token.Claims.(jwt.MapClaims); ok {
+					if r, ok := claims["role"].(string); ok && r != "" {
+						role = r
+					}
+				}
+			}
+			if !slices.Contains(roles, role) {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": model.ErrorResponse{
+					Code:    "Forbidden",
+					Message: "You do not have permission to perform this action.",
+					Details: "required role: " + strings.Join(roles, " or "),
+				}})
+			}
+			return next(c)
+		}
+	}
+}
+
+// メールアドレスが未確認のユーザは読取り(GET)のみ許可し、それ以外は403を返す
+// JWTのemail_verifiedクレームで判定する(クレームの無い古いトークンは未確認扱い)
+func readOnlyUntilVerified(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		method := c.Request().Method
+		if method == http.MethodGet || method == http.MethodHead {
+			return next(c)
+		}
+		if token, ok := c.Get("user").(*jwt.Token); ok && token != nil {
+			if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				if verified, ok := claims["email_verified"].(bool); ok && verified {
+					return next(c)
+				}
+			}
+		}
+		return c.JSON(http.StatusForbidden, echo.Map{"error": model.ErrorResponse{
+			Code:    "EmailNotVerified",
+			Message: "Please confirm your email address before making changes.",
+			Details: "a confirmation mail can be resent via POST /email/verification/resend",
+		}})
+	}
+}
+
+// ロールの設定で2段階認証が必須なのに、2段階認証を済ませていないセッションは読取り(GET)のみ許可する
+// JWTのmfa_required・mfaクレームで判定する(設定の変更は次のログイン・リフレッシュから反映される)
+func requireTwoFactor(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		method := c.Request().Method
+		if method == http.MethodGet || method == http.MethodHead {
+			return next(c)
+		}
+		if token, ok := c.Get("user").(*jwt.Token); ok && token != nil {
+			if claims, ok := token.Claims.(jwt.MapClaims); ok {
+				required, _ := claims["mfa_required"].(bool)
+				mfa, _ := claims["mfa"].(bool)
+				if !required || mfa {
+					return next(c)
+				}
+			}
+		}
+		return c.JSON(http.StatusForbidden, echo.Map{"error": model.ErrorResponse{
+			Code:    "TwoFactorRequired",
+			Message: "Two-factor authentication is required for your role.",
+			Details: "enable it via POST /2fa/enroll and /2fa/confirm, or log in again with a two-factor code",
+		}})
+	}
+}
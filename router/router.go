@@ -4,14 +4,26 @@ import (
 	"net/http"
 	"os"
 	"record-shop-rest-api/controller"
+	"record-shop-rest-api/model"
 
 	echojwt "github.com/labstack/echo-jwt/v4"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 )
 
-func NewRouter(uc controller.IUserControler, rc controller.IRecordController) *echo.Echo {
+func NewRouter(uc controller.IUserControler, rc controller.IRecordController, pc controller.IPaymentController,
+	prc controller.IPromotionController, tc controller.ITaxController,
+	sc controller.IShippingController, rtc controller.IReturnController,
+	poc controller.IPreOrderController, wc controller.IWantListController,
+	nc controller.INotificationController, wlc controller.IWishlistController,
+	tic controller.ITradeInController, cc controller.IConsignmentController,
+	ic controller.IInventoryController, gc controller.IGiftCardController,
+	lc controller.ILoyaltyController, posc controller.IPosController,
+	ac controller.IAuctionController, akc controller.IAPIKeyController, oc controller.IOrderController) *echo.Echo {
 	e := echo.New()
+	// c.RealIP()で使うクライアントのIP、X-Forwarded-Forはプライベート・ループバックのプロキシから来た場合のみ信用する
+	// (クライアントが自分で付けたヘッダでログイン失敗のIP単位の制限を回避できないように)
+	e.IPExtractor = echo.ExtractIPFromXFFHeader()
 	// CORS middleware
 	// クロスオリジンリソース共有 (CORS) は、悪意のあるウェブサイトが明示的な権限を持たずに
 	// 他のサイト(クロスドメイン)のデータ (Box APIなど) にアクセスするのを防ぐために、
@@ -38,6 +50,11 @@ func NewRouter(uc controller.IUserControler, rc controller.IRecordController) *e
 		CookieSameSite: http.SameSiteNoneMode,
 		// CookieSameSite: http.SameSiteDefaultMode, // POSTMAN動作確認用(SecudeMode: false)
 		// CookieMaxAge: 60,　// csrf tokenの有効期限、デフォルト24H、秒単位
+		// 決済プロバイダからのwebhookはcsrf tokenを持たない(署名で検証する)ので対象外
+		// APIキーでの呼出しもCookieを使わないので対象外(Authorizationヘッダはクロスサイトからは付けられない)
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/payments/webhook" || hasAPIKey(c)
+		},
 	}))
 
 	// "image"ディレクトリを"/images"パスでホスティング
@@ -45,7 +62,9 @@ func NewRouter(uc controller.IUserControler, rc controller.IRecordController) *e
 
 	e.POST("/signup", uc.SignUp)
 	e.POST("/login", uc.LogIn)
+	e.POST("/login/2fa", uc.LogInTwoFactor)
 	e.POST("/logout", uc.LogOut)
+	e.POST("/token/refresh", uc.Refresh)
 	e.GET("/csrf", uc.CsrfToken)
 
 	r := e.Group("/records")
@@ -58,19 +77,286 @@ func NewRouter(uc controller.IUserControler, rc controller.IRecordController) *e
 	// JWTトークンが検証され、認証情報がリクエストに追加される
 	// つまりloginしていないと/records以下にはアクセス出来ない
 	// これは先頭にlogin画面を配備し、loginしていないと以降の処理を許可しない場合に有効
-	r.Use(echojwt.WithConfig(echojwt.Config{
-		// Jwtを生成した時と同じ秘密鍵
-		SigningKey: []byte(os.Getenv("SECRET")),
+	// 他のGroupやルートでも同じ設定で使うので変数にしておく
+	cookieAuth := echojwt.WithConfig(echojwt.Config{
+		// Jwtを生成した時と同じ秘密鍵で署名と有効期限を検証し、さらにログアウト等で失効したトークンを拒否する
+		ParseTokenFunc: uc.ParseToken,
 		// クライアントから送られてくるJWTがどこに格納されているか
 		// 今回はCookieにtokenという形で実装している
 		TokenLookup: "cookie:token",
-	}))
+	})
+	// スクリプト等はCookieの代わりにAuthorizationヘッダのAPIキーで認証する(呼べるルートはスコープで限定)
+	keyAuth := apiKeyAuth(akc.Authenticate)
+	// メールアドレスの確認前でも使えるルート(確認メールの再送、全端末ログアウト)はこちらを使う
+	jwtAuthUnverified := func(next echo.HandlerFunc) echo.HandlerFunc {
+		withCookie, withKey := cookieAuth(next), keyAuth(next)
+		return func(c echo.Context) error {
+			if hasAPIKey(c) {
+				return withKey(c)
+			}
+			return withCookie(c)
+		}
+	}
+	// 2段階認証の登録・確認は、2段階認証が必須のロールでも済ませる前に使うのでこちらを使う
+	jwtAuthWithout2FA := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return jwtAuthUnverified(readOnlyUntilVerified(next))
+	}
+	// 通常はメールアドレスが未確認なら読取りのみ、2段階認証が必須のロールで済ませていない場合も読取りのみ
+	jwtAuth := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return jwtAuthWithout2FA(requireTwoFactor(next))
+	}
+	r.Use(jwtAuth)
+	// カタログの変更はスタッフ・管理者のみ、それ以外は403
+	// 他のGroupやルートのスタッフ用の操作にも同じ設定で使う
+	staffOnly := requireRole(model.RoleStaff, model.RoleAdmin)
 
 	// 実質これでPOST: /records
-	r.POST("", rc.CreateRecord)
+	r.POST("", rc.CreateRecord, staffOnly)
 	// /records/idのidいらないだろうと思ったけどupdateのwhere条件にいる)
 	// TODO：：でも結局idはc.BindでBodyから取得しているから不要
-	r.PUT("/:id", rc.UpdateRecord)
-	r.DELETE("/:id", rc.DeleteRecord)
+	r.PUT("/:id", rc.UpdateRecord, staffOnly)
+	r.DELETE("/:id", rc.DeleteRecord, staffOnly)
+	// 予約商品の入荷登録(スタッフ用)
+	r.POST("/:id/arrivals", poc.RegisterArrival, staffOnly)
+
+	// 注文を作ってから、注文のIDを指定して支払う(金額は注文の合計)
+	o := e.Group("/orders")
+	o.Use(jwtAuth)
+	o.POST("", oc.CreateOrder)
+	o.GET("", oc.GetOwnOrders)
+	o.GET("/:id", oc.GetOwnOrder)
+	o.PUT("/:id/cancel", oc.CancelOrder)
+
+	// webhookはプロバイダから呼ばれるのでJWT不要、JWTを適用するGroupより先に登録
+	e.POST("/payments/webhook", pc.Webhook)
+	p := e.Group("/payments")
+	p.Use(jwtAuth)
+	p.POST("", pc.Authorize)
+	p.PUT("/:id/capture", pc.Capture)
+	// 返金はスタッフのみ、顧客の返金は返品(/returns)の承認を経て行う
+	p.PUT("/:id/refund", pc.Refund, staffOnly)
+
+	// 値引の計算はカート画面からログイン前でも呼ばれるので公開
+	e.POST("/promotions/evaluate", prc.Evaluate)
+	pr := e.Group("/promotions")
+	pr.Use(jwtAuth)
+	pr.GET("", prc.GetPromotionList)
+	pr.POST("", prc.CreatePromotion, staffOnly)
+
+	// 税率の参照と税額計算は公開、税率の変更はログイン必須
+	e.GET("/tax/rates", tc.GetTaxRates)
+	e.POST("/tax/calculate", tc.Calculate)
+	t := e.Group("/tax")
+	t.Use(jwtAuth)
+	t.PUT("/rates/:category", tc.UpdateTaxRate, staffOnly)
+
+	// 配送方法の一覧と送料見積りは公開
+	e.GET("/shipping/methods", sc.GetShippingMethods)
+	e.POST("/shipping/quote", sc.Quote)
+	// 配送方法の登録はルート単位でJWTを適用
+	e.POST("/shipping/methods", sc.CreateShippingMethod, jwtAuth, staffOnly)
+	e.POST("/shipping/methods/:id/rates", sc.CreateShippingRate, jwtAuth, staffOnly)
+	sh := e.Group("/shipments")
+	sh.Use(jwtAuth)
+	sh.GET("", sc.GetOwnShipments)
+	sh.GET("/:id", sc.GetOwnShipment)
+	// 以下はスタッフ用
+	sh.POST("", sc.CreateShipment, staffOnly)
+	sh.POST("/:id/events", sc.RecordShipmentEvent, staffOnly)
+
+	rt := e.Group("/returns")
+	rt.Use(jwtAuth)
+	rt.POST("", rtc.CreateReturn)
+	rt.GET("", rtc.GetOwnReturns)
+	rt.GET("/:id", rtc.GetOwnReturn)
+	// 以下はスタッフ用
+	rt.GET("/pending", rtc.GetPendingReturns, staffOnly)
+	rt.PUT("/:id/approve", rtc.Approve, staffOnly)
+	rt.PUT("/:id/reject", rtc.Reject, staffOnly)
+	rt.PUT("/:id/receive", rtc.Receive, staffOnly)
+
+	po := e.Group("/preorders")
+	po.Use(jwtAuth)
+	po.POST("", poc.CreatePreOrder)
+	po.GET("", poc.GetOwnPreOrders)
+	po.DELETE("/:id", poc.CancelPreOrder)
+
+	w := e.Group("/wantlist")
+	w.Use(jwtAuth)
+	w.POST("", wc.CreateEntry)
+	w.GET("", wc.GetOwnEntries)
+	w.DELETE("/:id", wc.DeleteEntry)
+
+	n := e.Group("/notifications")
+	n.Use(jwtAuth)
+	n.GET("", nc.GetOwnNotifications)
+	n.PUT("/:id/read", nc.MarkRead)
+
+	// 共有リンクはログイン不要、読取り専用
+	e.GET("/shared/wishlists/:token", wlc.GetSharedWishlist)
+	wl := e.Group("/wishlists")
+	wl.Use(jwtAuth)
+	wl.POST("", wlc.CreateWishlist)
+	wl.GET("", wlc.GetOwnWishlists)
+	wl.GET("/:id", wlc.GetOwnWishlist)
+	wl.PUT("/:id", wlc.RenameWishlist)
+	wl.DELETE("/:id", wlc.DeleteWishlist)
+	wl.POST("/:id/items", wlc.AddItem)
+	wl.PUT("/:id/items/:itemId", wlc.UpdateItemNote)
+	wl.DELETE("/:id/items/:itemId", wlc.DeleteItem)
+	wl.PUT("/:id/order", wlc.ReorderItems)
+	wl.POST("/:id/share", wlc.Share)
+	wl.DELETE("/:id/share", wlc.Unshare)
+
+	// 買取価格のルールは公開(買取価格表として表示する)
+	e.GET("/tradeins/rules", tic.GetTradeInRules)
+	ti := e.Group("/tradeins")
+	ti.Use(jwtAuth)
+	ti.POST("", tic.CreateQuote)
+	ti.GET("", tic.GetOwnQuotes)
+	ti.GET("/:id", tic.GetOwnQuote)
+	// 以下はスタッフ用
+	ti.PUT("/rules/:grade", tic.UpdateTradeInRule, staffOnly)
+	ti.GET("/pending", tic.GetPendingQuotes, staffOnly)
+	ti.PUT("/:id/items/:itemId", tic.AdjustItem, staffOnly)
+	ti.PUT("/:id/accept", tic.Accept, staffOnly)
+	ti.PUT("/:id/reject", tic.Reject, staffOnly)
+
+	// 委託販売はスタッフ用
+	cs := e.Group("/consignors")
+	cs.Use(jwtAuth, staffOnly)
+	cs.POST("", cc.CreateConsignor)
+	cs.GET("", cc.GetConsignors)
+	cs.GET("/:id", cc.GetConsignor)
+	cs.POST("/:id/items", cc.CreateItem)
+	cs.GET("/:id/items", cc.GetItems)
+	cs.POST("/:id/payouts", cc.RecordPayout)
+	cs.GET("/:id/statement", cc.GetStatement)
+	ci := e.Group("/consignments")
+	ci.Use(jwtAuth, staffOnly)
+	ci.PUT("/:id/sell", cc.SellItem)
+	ci.PUT("/:id/return", cc.ReturnItem)
+
+	// 拠点の一覧と在庫の照会は公開(「下北沢店に在庫あり」の表示に使う)
+	e.GET("/locations", ic.GetLocations)
+	e.GET("/inventory/stock", ic.GetStock)
+	e.GET("/inventory/records/:id", ic.GetRecordAvailability)
+	// 以下はスタッフ用
+	e.POST("/locations", ic.CreateLocation, jwtAuth, staffOnly)
+	inv := e.Group("/inventory")
+	inv.Use(jwtAuth, staffOnly)
+	inv.GET("/movements", ic.GetMovements)
+	inv.POST("/adjustments", ic.Adjust)
+	inv.POST("/transfers", ic.CreateTransfer)
+	inv.GET("/transfers", ic.GetTransfers)
+	inv.GET("/transfers/:id", ic.GetTransfer)
+	inv.PUT("/transfers/:id/ship", ic.ShipTransfer)
+	inv.PUT("/transfers/:id/receive", ic.ReceiveTransfer)
+	inv.PUT("/transfers/:id/cancel", ic.CancelTransfer)
+
+	g := e.Group("/giftcards")
+	g.Use(jwtAuth)
+	g.POST("/balance", gc.GetGiftCardBalance)
+	// 以下はスタッフ用
+	g.POST("", gc.IssueGiftCard, staffOnly)
+	g.POST("/transactions", gc.GetGiftCardTransactions, staffOnly)
+	s := e.Group("/storecredit")
+	s.Use(jwtAuth)
+	s.GET("", gc.GetOwnStoreCredit)
+	// スタッフ用
+	s.POST("/grants", gc.GrantStoreCredit, staffOnly)
+	// チェックアウト時のギフトカード・店内クレジットの充当と取消
+	// 取消はスタッフ用、顧客が支払に使った後で残高を戻せないように
+	// カード決済の失敗時の取消はサーバ側(レジの販売処理)で行う
+	co := e.Group("/checkout")
+	co.Use(jwtAuth)
+	co.POST("/tenders", gc.Tender)
+	co.POST("/tenders/reverse", gc.ReverseTender, staffOnly)
+
+	e.GET("/loyalty/rules", lc.GetLoyaltyRules)
+	l := e.Group("/loyalty")
+	l.Use(jwtAuth)
+	l.GET("/points", lc.GetOwnPoints)
+	// 充当したポイントは注文の取消時にサーバ側で戻す
+	l.POST("/redeem", lc.RedeemPoints)
+	// スタッフ用
+	l.POST("/earn", lc.EarnPoints, staffOnly)
+	l.POST("/rules", lc.CreateLoyaltyRule, staffOnly)
+
+	// レジ(店頭販売)、すべてスタッフ用
+	pos := e.Group("/pos")
+	pos.Use(jwtAuth, staffOnly)
+	pos.POST("/items", posc.CreatePosItem)
+	pos.GET("/items/:code", posc.GetPosItem)
+	pos.POST("/sales", posc.Sell)
+	pos.GET("/sales/:id", posc.GetPosSale)
+	pos.PUT("/sales/:id/void", posc.VoidPosSale)
+	pos.POST("/sales/:id/returns", posc.ReturnPosSale)
+	pos.GET("/sales/:id/receipt", posc.GetReceipt)
+
+	e.GET("/auctions", ac.GetOpenListings)
+	e.GET("/auctions/:id", ac.GetListing)
+	a := e.Group("/auctions")
+	a.Use(jwtAuth)
+	a.GET("/won", ac.GetOwnWonListings)
+	a.POST("/:id/bids", ac.PlaceBid)
+	a.POST("/:id/offers", ac.MakeOffer)
+	a.POST("/:id/checkout", ac.Checkout)
+	// 以下はスタッフ用
+	a.POST("", ac.CreateListing, staffOnly)
+	a.PUT("/:id/cancel", ac.CancelListing, staffOnly)
+	a.GET("/:id/offers", ac.GetOffers, staffOnly)
+	a.PUT("/:id/offers/:offerId/accept", ac.AcceptOffer, staffOnly)
+	a.PUT("/:id/offers/:offerId/decline", ac.DeclineOffer, staffOnly)
+
+	// 全端末からのログアウト
+	e.POST("/logout/all", uc.LogOutAll, jwtAuthUnverified)
+
+	// メールアドレスの確認はリンクのトークンで行うのでログイン不要
+	e.POST("/email/verify", uc.VerifyEmail)
+	e.POST("/email/verification/resend", uc.ResendVerification, jwtAuthUnverified)
+
+	// 自分のアカウントの確認・変更・退会
+	// アドレスの確認前でも見られて、アドレスの誤りを直せるように、GETとアドレスの変更は確認前も可能
+	me := e.Group("/me")
+	me.GET("", uc.GetMe, jwtAuthUnverified)
+	me.PUT("/email", uc.ChangeEmail, jwtAuthUnverified)
+	me.PUT("/password", uc.ChangePassword, jwtAuth)
+	me.DELETE("", uc.DeleteAccount, jwtAuth)
+
+	// パスワードを忘れた場合の再設定、ログインできない状態から使うのでログイン不要
+	e.POST("/password/forgot", uc.ForgotPassword)
+	e.POST("/password/reset", uc.ResetPassword)
+
+	// 外部のIDプロバイダ(Google、LINE等)でのログイン、ブラウザの遷移なのでGET(CSRFトークン不要)
+	e.GET("/auth/:provider/login", uc.OIDCLogin)
+	e.GET("/auth/:provider/callback", uc.OIDCCallback)
+	// ログイン中のアカウントへの紐付け・一覧・解除(ブラウザのログインのみ)
+	e.POST("/auth/:provider/link", uc.OIDCLink, jwtAuth)
+	e.GET("/auth/identities", uc.GetOwnIdentities, jwtAuth)
+	e.DELETE("/auth/identities/:id", uc.UnlinkIdentity, jwtAuth)
+
+	// APIキーの作成・一覧・失効(ブラウザのログインのみ)
+	ak := e.Group("/apikeys")
+	ak.Use(jwtAuth)
+	ak.POST("", akc.CreateAPIKey)
+	ak.GET("", akc.GetOwnAPIKeys)
+	ak.DELETE("/:id", akc.RevokeAPIKey)
+
+	// 2段階認証の登録・無効化・リカバリーコードの再発行
+	tf := e.Group("/2fa")
+	tf.Use(jwtAuthWithout2FA)
+	tf.POST("/enroll", uc.EnrollTwoFactor)
+	tf.POST("/confirm", uc.ConfirmTwoFactor)
+	tf.POST("/disable", uc.DisableTwoFactor)
+	tf.POST("/recovery-codes", uc.RegenerateRecoveryCodes)
+
+	// ロールの割当て、トークンの強制失効、2段階認証の要否の設定は管理者のみ
+	ad := e.Group("/admin")
+	ad.Use(jwtAuth, requireRole(model.RoleAdmin))
+	ad.PUT("/users/:id/role", uc.AssignRole)
+	ad.POST("/users/:id/revoke-tokens", uc.RevokeUserTokens)
+	ad.GET("/2fa/policies", uc.GetTwoFactorPolicies)
+	ad.PUT("/2fa/policies/:role", uc.SetTwoFactorPolicy)
 	return e
 }
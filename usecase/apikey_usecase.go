@@ -0,0 +1,174 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+type IAPIKeyUsecase interface {
+	CreateAPIKey(userID uint, mfa bool, req model.APIKeyRequest) (model.APIKeyCreatedResponse, error)
+	GetOwnAPIKeys(userID uint) ([]model.APIKeyResponse, error)
+	RevokeAPIKey(userID uint, id uint) error
+	Authenticate(rawKey string) (*jwt.Token, error)
+}
+
+type apiKeyUsecase struct {
+	ar repository.IAPIKeyRepository
+	av validator.IAPIKeyValidator
+	fr repository.ITwoFactorRepository
+}
+
+func NewAPIKeyUsecase(ar repository.IAPIKeyRepository, av validator.IAPIKeyValidator, fr repository.ITwoFactorRepository) IAPIKeyUsecase {
+	return &apiKeyUsecase{ar, av, fr}
+}
+
+// 1ユーザが同時に持てる有効なキーの数と、最終使用日時を更新する間隔
+const (
+	maxActiveAPIKeys    = 10
+	apiKeyTouchInterval = time.Minute
+)
+
+// キーは"rsk_<先頭8桁>_<秘密64桁>"、先頭部分は一覧で見分けるためにそのまま保存する
+// mfa: 作成したセッションが2段階認証を済ませているか、キーにも引継ぐ
+func (au *apiKeyUsecase) CreateAPIKey(userID uint, mfa bool, req model.APIKeyRequest) (model.APIKeyCreatedResponse, error) {
+	if err := au.av.APIKeyValidate(req); err != nil {
+		return model.APIKeyCreatedResponse{}, err
+	}
+	now := time.Now()
+	count, err := au.ar.CountActiveAPIKeys(userID, now)
+	if err != nil {
+		return model.APIKeyCreatedResponse{}, err
+	}
+	if count >= maxActiveAPIKeys {
+		return model.APIKeyCreatedResponse{}, fmt.Errorf("%w: up to %d active API keys are allowed, revoke one first", ErrInvalidState, maxActiveAPIKeys)
+	}
+	id, err := common.RandomToken(4)
+	if err != nil {
+		return model.APIKeyCreatedResponse{}, err
+	}
+	secret, err := common.RandomToken(32)
+	if err != nil {
+		return model.APIKeyCreatedResponse{}, err
+	}
+	prefix := model.APIKeyPrefix + id
+	rawKey := prefix + "_" + secret
+	key := model.APIKey{
+		UserID:    userID,
+		Name:      req.Name,
+		Prefix:    prefix,
+		KeyHash:   common.HashToken(rawKey),
+		Scopes:    strings.Join(dedupe(req.Scopes), " "),
+		MFA:       mfa,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := au.ar.CreateAPIKey(&key); err != nil {
+		return model.APIKeyCreatedResponse{}, err
+	}
+	return model.APIKeyCreatedResponse{APIKeyResponse: apiKeyResponse(key), Key: rawKey}, nil
+}
+
+func (au *apiKeyUsecase) GetOwnAPIKeys(userID uint) ([]model.APIKeyResponse, error) {
+	keys, err := au.ar.GetAPIKeysByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	resKeys := []model.APIKeyResponse{}
+	for _, key := range keys {
+		resKeys = append(resKeys, apiKeyResponse(key))
+	}
+	return resKeys, nil
+}
+
+func (au *apiKeyUsecase) RevokeAPIKey(userID uint, id uint) error {
+	return au.ar.RevokeAPIKey(userID, id, time.Now())
+}
+
+// Authorizationヘッダのキーを確認して、JWTと同じクレームを持つトークンを返す(controllerの処理はJWTと共通にする)
+// ロール・メールアドレスの確認状態・2段階認証が必須かは現在のユーザ・ロールの設定の値を使う
+// mfaはキーを作成したセッションの値、必須になる前に済ませずに作ったキーはJWTと同じく読取りのみになる
+// scopes: ルータでルートごとに必要なスコープと照合する
+func (au *apiKeyUsecase) Authenticate(rawKey string) (*jwt.Token, error) {
+	key := model.APIKey{}
+	if err := au.ar.GetAPIKeyByHash(&key, common.HashToken(rawKey)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: invalid API key", ErrUnauthorized)
+		}
+		return nil, err
+	}
+	now := time.Now()
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("%w: API key is revoked", ErrUnauthorized)
+	}
+	if key.ExpiresAt != nil && !now.Before(*key.ExpiresAt) {
+		return nil, fmt.Errorf("%w: API key is expired", ErrUnauthorized)
+	}
+	mfaRequired, err := au.twoFactorRequired(key.User.Role)
+	if err != nil {
+		return nil, err
+	}
+	if err := au.ar.TouchAPIKey(key.ID, now, apiKeyTouchInterval); err != nil {
+		log.Printf("recording last use of API key %d failed: %v", key.ID, err)
+	}
+	return &jwt.Token{
+		Valid: true,
+		Claims: jwt.MapClaims{
+			// JSONから復元したJWTのクレームと同じく数値はfloat64にする
+			"user_id":        float64(key.UserID),
+			"role":           key.User.Role,
+			"email_verified": key.User.EmailVerified,
+			"mfa":            key.MFA,
+			"mfa_required":   mfaRequired,
+			"api_key_id":     float64(key.ID),
+			"scopes":         strings.Fields(key.Scopes),
+		},
+	}, nil
+}
+
+// ロールの設定で2段階認証が必須か、設定が無ければ任意
+func (au *apiKeyUsecase) twoFactorRequired(role string) (bool, error) {
+	policy := model.TwoFactorPolicy{}
+	if err := au.fr.GetTwoFactorPolicy(&policy, role); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return policy.Required, nil
+}
+
+func apiKeyResponse(key model.APIKey) model.APIKeyResponse {
+	return model.APIKeyResponse{
+		ID:         key.ID,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     strings.Fields(key.Scopes),
+		MFA:        key.MFA,
+		ExpiresAt:  key.ExpiresAt,
+		LastUsedAt: key.LastUsedAt,
+		RevokedAt:  key.RevokedAt,
+		CreatedAt:  key.CreatedAt,
+	}
+}
+
+// 同じスコープの重複指定を除く(順序は保つ)
+func dedupe(values []string) []string {
+	seen := map[string]bool{}
+	result := []string{}
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
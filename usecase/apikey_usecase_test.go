@@ -0,0 +1,54 @@
+package usecase
+
+import (
+	"errors"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/model"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestAPIKeyAuthenticateTwoFactorPolicy(t *testing.T) {
+	staff := model.User{ID: 1, Role: model.RoleStaff, EmailVerified: true}
+	tests := []struct {
+		name         string
+		policies     map[string]bool
+		keyMFA       bool
+		wantMFA      bool
+		wantRequired bool
+	}{
+		{"policy not set", nil, false, false, false},
+		{"required, key created without 2FA", map[string]bool{model.RoleStaff: true}, false, false, true},
+		{"required, key created with 2FA", map[string]bool{model.RoleStaff: true}, true, true, true},
+		{"required for another role", map[string]bool{model.RoleAdmin: true}, false, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys := &fakeAPIKeyRepository{keys: []model.APIKey{{
+				ID: 1, UserID: staff.ID, KeyHash: common.HashToken("rsk_test"), Scopes: model.ScopeRecordsWrite, MFA: tt.keyMFA, User: staff,
+			}}}
+			au := NewAPIKeyUsecase(keys, nil, &fakeTwoFactorRepository{policies: tt.policies})
+			token, err := au.Authenticate("rsk_test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			claims := token.Claims.(jwt.MapClaims)
+			if claims["mfa"] != tt.wantMFA || claims["mfa_required"] != tt.wantRequired {
+				t.Errorf("mfa = %v, mfa_required = %v, want %v, %v", claims["mfa"], claims["mfa_required"], tt.wantMFA, tt.wantRequired)
+			}
+		})
+	}
+}
+
+func TestAPIKeyAuthenticateRejectsRevokedKey(t *testing.T) {
+	revokedAt := time.Now().Add(-time.Minute)
+	keys := &fakeAPIKeyRepository{keys: []model.APIKey{{
+		ID: 1, UserID: 1, KeyHash: common.HashToken("rsk_test"), RevokedAt: &revokedAt, User: model.User{ID: 1, Role: model.RoleStaff},
+	}}}
+	au := NewAPIKeyUsecase(keys, nil, &fakeTwoFactorRepository{})
+	if _, err := au.Authenticate("rsk_test"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("revoked key: got %v, want ErrUnauthorized", err)
+	}
+}
@@ -0,0 +1,439 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/payment"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IAuctionUsecase interface {
+	CreateListing(staffID uint, req model.AuctionListingRequest) (model.AuctionListing, error)
+	GetOpenListings() ([]model.AuctionListing, error)
+	GetListing(id uint) (model.AuctionListing, error)
+	GetOwnWonListings(userID uint) ([]model.AuctionListing, error)
+	CancelListing(staffID uint, id uint) error
+	PlaceBid(userID uint, id uint, req model.AuctionAmountRequest) (model.AuctionListing, error)
+	MakeOffer(userID uint, id uint, req model.AuctionAmountRequest) (model.AuctionOffer, error)
+	GetOffers(id uint) ([]model.AuctionOffer, error)
+	AcceptOffer(id uint, offerID uint) (model.AuctionListing, error)
+	DeclineOffer(id uint, offerID uint) (model.AuctionOffer, error)
+	Checkout(userID uint, id uint, req model.AuctionCheckoutRequest) (model.AuctionListing, error)
+	CloseDueAuctions() (int, error)
+	ReassignOverdueAwards() (int, error)
+	StartCloseJob(interval time.Duration)
+}
+
+type auctionUsecase struct {
+	ar repository.IAuctionRepository
+	av validator.IAuctionValidator
+	rr repository.IRecordRepository
+	iu IInventoryUsecase
+	pu IPaymentUsecase
+	nu INotificationUsecase
+	or repository.IOrderRepository
+}
+
+func NewAuctionUsecase(ar repository.IAuctionRepository, av validator.IAuctionValidator, rr repository.IRecordRepository,
+	iu IInventoryUsecase, pu IPaymentUsecase, nu INotificationUsecase, or repository.IOrderRepository) IAuctionUsecase {
+	return &auctionUsecase{ar, av, rr, iu, pu, nu, or}
+}
+
+// 出品した盤は出品中・支払待ちの間、他の販売に回らないように在庫から引当てておく
+func (au *auctionUsecase) CreateListing(staffID uint, req model.AuctionListingRequest) (model.AuctionListing, error) {
+	if err := au.av.AuctionListingValidate(req); err != nil {
+		return model.AuctionListing{}, err
+	}
+	if err := au.rr.GetRecordByID(&model.Record{}, req.RecordID); err != nil {
+		return model.AuctionListing{}, err
+	}
+	newListing := model.AuctionListing{
+		Type:             req.Type,
+		RecordID:         req.RecordID,
+		Grade:            req.Grade,
+		LocationID:       req.LocationID,
+		Status:           model.AuctionOpen,
+		StartPrice:       req.StartPrice,
+		ReservePrice:     req.ReservePrice,
+		MinOfferPrice:    req.MinOfferPrice,
+		ExtensionMinutes: req.ExtensionMinutes,
+		CreatedBy:        staffID,
+	}
+	if req.Type == model.ListingAuction {
+		newListing.BidIncrement = req.BidIncrement
+		newListing.EndsAt = req.EndsAt
+	}
+	if err := au.ar.CreateListing(&newListing); err != nil {
+		return model.AuctionListing{}, err
+	}
+	if err := au.moveStock(newListing, staffID, -1, ""); err != nil {
+		newListing.Status = model.AuctionCancelled
+		if cancelErr := au.ar.UpdateListingStatus(&newListing, model.AuctionOpen); cancelErr != nil {
+			err = errors.Join(err, cancelErr)
+		}
+		return model.AuctionListing{}, err
+	}
+	return withReserveMet(newListing), nil
+}
+
+func (au *auctionUsecase) GetOpenListings() ([]model.AuctionListing, error) {
+	listings, err := au.ar.GetOpenListings()
+	if err != nil {
+		return nil, err
+	}
+	for i := range listings {
+		listings[i] = withReserveMet(listings[i])
+	}
+	return listings, nil
+}
+
+func (au *auctionUsecase) GetListing(id uint) (model.AuctionListing, error) {
+	listing := model.AuctionListing{}
+	if err := au.ar.GetListingByID(&listing, id); err != nil {
+		return model.AuctionListing{}, err
+	}
+	return withReserveMet(listing), nil
+}
+
+func (au *auctionUsecase) GetOwnWonListings(userID uint) ([]model.AuctionListing, error) {
+	listings, err := au.ar.GetListingsByWinner(userID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range listings {
+		listings[i] = withReserveMet(listings[i])
+	}
+	return listings, nil
+}
+
+func (au *auctionUsecase) CancelListing(staffID uint, id uint) error {
+	listing := model.AuctionListing{}
+	if err := au.ar.GetListingByID(&listing, id); err != nil {
+		return err
+	}
+	if err := au.ar.CancelListing(id); err != nil {
+		return auctionError(err)
+	}
+	return au.moveStock(listing, staffID, 1, "cancelled")
+}
+
+// 入札の受付、金額の確認と終了間際の延長はリポジトリで出品の行をロックして行う
+// 上回られた前のトップ入札者には通知する
+func (au *auctionUsecase) PlaceBid(userID uint, id uint, req model.AuctionAmountRequest) (model.AuctionListing, error) {
+	if err := au.av.AuctionAmountValidate(req); err != nil {
+		return model.AuctionListing{}, err
+	}
+	bid := model.AuctionBid{
+		ListingID: id,
+		UserID:    userID,
+		Amount:    req.Amount,
+	}
+	listing, previousLeader, err := au.ar.PlaceBid(&bid, time.Now())
+	if err != nil {
+		return model.AuctionListing{}, auctionError(err)
+	}
+	if previousLeader != nil {
+		au.notify(*previousLeader, listing, "You have been outbid",
+			fmt.Sprintf("The current bid is ¥%d. The auction ends at %s.", listing.CurrentPrice, listing.EndsAt.Format("2006-01-02 15:04")))
+	}
+	return withReserveMet(listing), nil
+}
+
+// 価格交渉の申し出、提示価格以上ならその場で承諾する
+func (au *auctionUsecase) MakeOffer(userID uint, id uint, req model.AuctionAmountRequest) (model.AuctionOffer, error) {
+	if err := au.av.AuctionAmountValidate(req); err != nil {
+		return model.AuctionOffer{}, err
+	}
+	listing := model.AuctionListing{}
+	if err := au.ar.GetListingByID(&listing, id); err != nil {
+		return model.AuctionOffer{}, err
+	}
+	if req.Amount < listing.MinOfferPrice {
+		return model.AuctionOffer{}, fmt.Errorf("%w: offer must be at least %d", ErrInvalidState, listing.MinOfferPrice)
+	}
+	offer := model.AuctionOffer{
+		ListingID: id,
+		UserID:    userID,
+		Amount:    req.Amount,
+		Status:    model.OfferPending,
+	}
+	if err := au.ar.CreateOffer(&offer); err != nil {
+		return model.AuctionOffer{}, auctionError(err)
+	}
+	if offer.Amount >= listing.StartPrice {
+		if _, err := au.AcceptOffer(id, offer.ID); err != nil {
+			return model.AuctionOffer{}, err
+		}
+		offer.Status = model.OfferAccepted
+	}
+	return offer, nil
+}
+
+func (au *auctionUsecase) GetOffers(id uint) ([]model.AuctionOffer, error) {
+	return au.ar.GetOffersByListing(id)
+}
+
+func (au *auctionUsecase) AcceptOffer(id uint, offerID uint) (model.AuctionListing, error) {
+	listing := model.AuctionListing{ID: id}
+	if _, err := au.ar.AcceptOffer(&listing, offerID, time.Now(), auctionPaymentWindow()); err != nil {
+		return model.AuctionListing{}, auctionError(err)
+	}
+	au.award(&listing)
+	return withReserveMet(listing), nil
+}
+
+func (au *auctionUsecase) DeclineOffer(id uint, offerID uint) (model.AuctionOffer, error) {
+	offer, err := au.ar.DeclineOffer(id, offerID)
+	if err != nil {
+		return model.AuctionOffer{}, auctionError(err)
+	}
+	listing := model.AuctionListing{}
+	if err := au.ar.GetListingByID(&listing, id); err == nil {
+		au.notify(offer.UserID, listing, "Your offer was declined", fmt.Sprintf("Your offer of ¥%d was declined.", offer.Amount))
+	}
+	return offer, nil
+}
+
+// 落札者の支払、落札の注文をカードで決済して売上確定まで行う
+// 落札時に注文を作れなかった場合はここで作る
+// 同時に2回支払われた場合や、決済中に支払期限が切れて次点に繰上げられた場合は、状態を更新できなかった方を返金する
+func (au *auctionUsecase) Checkout(userID uint, id uint, req model.AuctionCheckoutRequest) (model.AuctionListing, error) {
+	if err := au.av.AuctionCheckoutValidate(req); err != nil {
+		return model.AuctionListing{}, err
+	}
+	listing := model.AuctionListing{}
+	if err := au.ar.GetListingByID(&listing, id); err != nil {
+		return model.AuctionListing{}, err
+	}
+	if listing.WinnerID == nil || *listing.WinnerID != userID {
+		return model.AuctionListing{}, gorm.ErrRecordNotFound
+	}
+	if listing.Status != model.AuctionAwarded {
+		return model.AuctionListing{}, fmt.Errorf("%w: listing is %s", ErrInvalidState, listing.Status)
+	}
+	if listing.PaymentDueAt != nil && !time.Now().Before(*listing.PaymentDueAt) {
+		return model.AuctionListing{}, fmt.Errorf("%w: payment was due at %s", ErrInvalidState, listing.PaymentDueAt.Format("2006-01-02 15:04"))
+	}
+	if listing.OrderID == nil {
+		if err := au.createWinnerOrder(&listing); err != nil {
+			return model.AuctionListing{}, auctionError(err)
+		}
+	}
+	order := model.Order{}
+	if err := au.or.GetOrderByID(&order, *listing.OrderID); err != nil {
+		return model.AuctionListing{}, err
+	}
+	authRes, err := au.pu.AuthorizeOrder(userID, order, req.CardToken)
+	if err != nil {
+		// 支払中・支払済みの注文
+		if authRes.Error != nil {
+			return model.AuctionListing{}, fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		return model.AuctionListing{}, err
+	}
+	if authRes.Status != payment.StatusAuthorized {
+		return model.AuctionListing{}, fmt.Errorf("%w: card payment is %s %s", ErrInvalidState, authRes.Status, authRes.DeclineReason)
+	}
+	if _, err := au.pu.Capture(userID, authRes.ID); err != nil {
+		return model.AuctionListing{}, err
+	}
+	listing.PaymentID = &authRes.ID
+	if err := au.ar.MarkListingPaid(&listing, time.Now()); err != nil {
+		if _, refundErr := au.pu.RefundPayment(authRes.ID, authRes.Amount); refundErr != nil {
+			err = errors.Join(err, refundErr)
+		}
+		return model.AuctionListing{}, auctionError(err)
+	}
+	return withReserveMet(listing), nil
+}
+
+// 終了時刻を過ぎたオークションを締めて、落札者に通知する(不成立なら在庫に戻す)
+// 延長された直後などで締められなかったものは次回に回す
+func (au *auctionUsecase) CloseDueAuctions() (int, error) {
+	now := time.Now()
+	listings, err := au.ar.GetDueAuctions(now)
+	if err != nil {
+		return 0, err
+	}
+	closed := 0
+	for _, listing := range listings {
+		if err := au.ar.CloseAuction(&listing, now, auctionPaymentWindow()); err != nil {
+			if !errors.Is(err, repository.ErrStaleObject) {
+				log.Printf("closing auction %d failed: %v", listing.ID, err)
+			}
+			continue
+		}
+		closed++
+		if listing.Status == model.AuctionAwarded {
+			au.award(&listing)
+			continue
+		}
+		if err := au.moveStock(listing, listing.CreatedBy, 1, "unsold"); err != nil {
+			log.Printf("releasing stock for unsold auction %d failed: %v", listing.ID, err)
+		}
+	}
+	return closed, nil
+}
+
+// 支払期限を過ぎた落札を取消して、次点の入札者に繰上げる(いなければ不成立で在庫に戻す)
+// 価格交渉は申し出の受付に戻す、在庫は引当てたまま
+func (au *auctionUsecase) ReassignOverdueAwards() (int, error) {
+	now := time.Now()
+	listings, err := au.ar.GetOverdueAwards(now)
+	if err != nil {
+		return 0, err
+	}
+	reassigned := 0
+	for _, listing := range listings {
+		previousOrderID := listing.OrderID
+		previousWinner, err := au.ar.ReassignAward(&listing, now, auctionPaymentWindow())
+		if err != nil {
+			if !errors.Is(err, repository.ErrStaleObject) {
+				log.Printf("reassigning auction %d failed: %v", listing.ID, err)
+			}
+			continue
+		}
+		reassigned++
+		if previousOrderID != nil {
+			if err := au.or.CancelAuctionOrder(*previousOrderID); err != nil {
+				log.Printf("cancelling order %d of unpaid auction %d failed: %v", *previousOrderID, listing.ID, err)
+			}
+		}
+		au.notify(previousWinner, listing, "Your win was cancelled",
+			fmt.Sprintf("Payment for listing #%d was not completed by the deadline.", listing.ID))
+		switch listing.Status {
+		case model.AuctionAwarded:
+			au.award(&listing)
+		case model.AuctionUnsold:
+			if err := au.moveStock(listing, listing.CreatedBy, 1, "unpaid"); err != nil {
+				log.Printf("releasing stock for unpaid auction %d failed: %v", listing.ID, err)
+			}
+		}
+	}
+	return reassigned, nil
+}
+
+// 一定間隔で終了時刻を過ぎたオークションを締め、支払期限を過ぎた落札を繰上げるバックグラウンドジョブを開始する
+func (au *auctionUsecase) StartCloseJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			closed, err := au.CloseDueAuctions()
+			if err != nil {
+				log.Printf("closing auctions failed: %v", err)
+			} else if closed > 0 {
+				log.Printf("closed %d auction(s)", closed)
+			}
+			reassigned, err := au.ReassignOverdueAwards()
+			if err != nil {
+				log.Printf("reassigning unpaid auctions failed: %v", err)
+			} else if reassigned > 0 {
+				log.Printf("reassigned %d unpaid auction(s)", reassigned)
+			}
+		}
+	}()
+}
+
+// 出品による在庫の引当(-1)と戻し(1)
+func (au *auctionUsecase) moveStock(listing model.AuctionListing, actorID uint, delta int, note string) error {
+	return au.iu.ApplyMovements([]model.StockMovement{{
+		LocationID:    listing.LocationID,
+		RecordID:      listing.RecordID,
+		Grade:         listing.Grade,
+		Delta:         delta,
+		Reason:        model.MovementAuction,
+		ReferenceType: "auction_listing",
+		ReferenceID:   listing.ID,
+		ActorID:       actorID,
+		Note:          note,
+	}})
+}
+
+// 落札者の注文を作って通知する、注文を作れなくても支払時に作り直せるので落札は止めない
+func (au *auctionUsecase) award(listing *model.AuctionListing) {
+	if err := au.createWinnerOrder(listing); err != nil {
+		log.Printf("creating order for auction %d failed: %v", listing.ID, err)
+	}
+	au.notifyAwarded(*listing)
+}
+
+// 落札額で1点の注文を作って出品に紐付ける、紐付けられなかった(繰上げられた・同時に作られた)注文は取消す
+func (au *auctionUsecase) createWinnerOrder(listing *model.AuctionListing) error {
+	line := model.OrderLine{
+		RecordID:  listing.RecordID,
+		Grade:     listing.Grade,
+		UnitPrice: listing.WinningAmount,
+		Quantity:  1,
+	}
+	record := model.Record{}
+	if err := au.rr.GetRecordByID(&record, listing.RecordID); err == nil {
+		line.Title = record.Title
+	}
+	order := model.Order{
+		UserID:           *listing.WinnerID,
+		Status:           model.OrderPending,
+		Total:            listing.WinningAmount,
+		AuctionListingID: &listing.ID,
+		Lines:            []model.OrderLine{line},
+	}
+	if err := au.or.CreateOrder(&order); err != nil {
+		return err
+	}
+	listing.OrderID = &order.ID
+	if err := au.ar.SetListingOrder(listing); err != nil {
+		listing.OrderID = nil
+		if cancelErr := au.or.CancelAuctionOrder(order.ID); cancelErr != nil {
+			err = errors.Join(err, cancelErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func (au *auctionUsecase) notifyAwarded(listing model.AuctionListing) {
+	au.notify(*listing.WinnerID, listing, "You won",
+		fmt.Sprintf("Your winning price is ¥%d.\nPlease complete payment from your won listings (listing #%d) by %s.",
+			listing.WinningAmount, listing.ID, listing.PaymentDueAt.Format("2006-01-02 15:04")))
+}
+
+// 通知の失敗で入札・落札の処理は止めない
+func (au *auctionUsecase) notify(userID uint, listing model.AuctionListing, subject string, body string) {
+	record := model.Record{}
+	if err := au.rr.GetRecordByID(&record, listing.RecordID); err == nil {
+		subject = fmt.Sprintf("%s: %s - %s", subject, record.Artist, record.Title)
+	}
+	if err := au.nu.Send(userID, subject, body); err != nil {
+		log.Printf("auction notification to user %d failed: %v", userID, err)
+	}
+}
+
+// 落札から支払期限までの時間、AUCTION_PAYMENT_HOURSで変更(未設定は72時間)
+func auctionPaymentWindow() time.Duration {
+	if v, err := strconv.Atoi(os.Getenv("AUCTION_PAYMENT_HOURS")); err == nil && v > 0 {
+		return time.Duration(v) * time.Hour
+	}
+	return 72 * time.Hour
+}
+
+// 最低落札価格は金額を見せずに、達したかどうかだけ返す
+func withReserveMet(listing model.AuctionListing) model.AuctionListing {
+	listing.ReserveMet = listing.BidCount > 0 && listing.CurrentPrice >= listing.ReservePrice
+	return listing
+}
+
+// 同時更新・終了後の入札は利用者が状況を確認して再操作するものなので409にする
+func auctionError(err error) error {
+	if errors.Is(err, repository.ErrStaleObject) || errors.Is(err, repository.ErrExpired) {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	return err
+}
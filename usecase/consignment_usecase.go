@@ -0,0 +1,258 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"time"
+)
+
+type IConsignmentUsecase interface {
+	CreateConsignor(consignor model.Consignor) (model.Consignor, error)
+	GetConsignors() ([]model.ConsignorResponse, error)
+	GetConsignor(id uint) (model.ConsignorResponse, error)
+	CreateItem(consignorID uint, item model.ConsignmentItem) (model.ConsignmentItem, error)
+	GetItems(consignorID uint) ([]model.ConsignmentItem, error)
+	GetItem(id uint) (model.ConsignmentItem, error)
+	SellItem(staffID uint, id uint, req model.ConsignmentSaleRequest) (model.ConsignmentLedgerEntry, error)
+	RecordSale(staffID uint, id uint, salePrice int, note string) (model.ConsignmentLedgerEntry, error)
+	CancelSale(staffID uint, id uint, note string) (model.ConsignmentLedgerEntry, error)
+	ReturnItem(id uint) (model.ConsignmentItem, error)
+	RecordPayout(staffID uint, consignorID uint, req model.ConsignmentPayoutRequest) (model.ConsignmentLedgerEntry, error)
+	GetStatement(consignorID uint, from time.Time, to time.Time) (model.ConsignmentStatement, error)
+}
+
+type consignmentUsecase struct {
+	cr repository.IConsignmentRepository
+	cv validator.IConsignmentValidator
+	rr repository.IRecordRepository
+}
+
+func NewConsignmentUsecase(cr repository.IConsignmentRepository, cv validator.IConsignmentValidator,
+	rr repository.IRecordRepository) IConsignmentUsecase {
+	return &consignmentUsecase{cr, cv, rr}
+}
+
+func (cu *consignmentUsecase) CreateConsignor(consignor model.Consignor) (model.Consignor, error) {
+	if err := cu.cv.ConsignorValidate(consignor); err != nil {
+		return model.Consignor{}, err
+	}
+	newConsignor := model.Consignor{
+		Name:              consignor.Name,
+		Email:             consignor.Email,
+		CommissionPercent: consignor.CommissionPercent,
+	}
+	if err := cu.cr.CreateConsignor(&newConsignor); err != nil {
+		return model.Consignor{}, err
+	}
+	return newConsignor, nil
+}
+
+func (cu *consignmentUsecase) GetConsignors() ([]model.ConsignorResponse, error) {
+	consignors, err := cu.cr.GetConsignors()
+	if err != nil {
+		return nil, err
+	}
+	res := []model.ConsignorResponse{}
+	for _, consignor := range consignors {
+		balance, err := cu.cr.GetBalance(consignor.ID, nil)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, model.ConsignorResponse{Consignor: consignor, Balance: balance})
+	}
+	return res, nil
+}
+
+func (cu *consignmentUsecase) GetConsignor(id uint) (model.ConsignorResponse, error) {
+	consignor := model.Consignor{}
+	if err := cu.cr.GetConsignorByID(&consignor, id); err != nil {
+		return model.ConsignorResponse{}, err
+	}
+	balance, err := cu.cr.GetBalance(consignor.ID, nil)
+	if err != nil {
+		return model.ConsignorResponse{}, err
+	}
+	return model.ConsignorResponse{Consignor: consignor, Balance: balance}, nil
+}
+
+// 委託品の受入れ
+func (cu *consignmentUsecase) CreateItem(consignorID uint, item model.ConsignmentItem) (model.ConsignmentItem, error) {
+	if err := cu.cv.ConsignmentItemValidate(item); err != nil {
+		return model.ConsignmentItem{}, err
+	}
+	consignor := model.Consignor{}
+	if err := cu.cr.GetConsignorByID(&consignor, consignorID); err != nil {
+		return model.ConsignmentItem{}, err
+	}
+	record := model.Record{}
+	if err := cu.rr.GetRecordByID(&record, item.RecordID); err != nil {
+		return model.ConsignmentItem{}, err
+	}
+	newItem := model.ConsignmentItem{
+		ConsignorID:       consignor.ID,
+		RecordID:          record.ID,
+		Grade:             item.Grade,
+		AskingPrice:       item.AskingPrice,
+		CommissionPercent: item.CommissionPercent,
+		Status:            model.ConsignmentAvailable,
+	}
+	if err := cu.cr.CreateItem(&newItem); err != nil {
+		return model.ConsignmentItem{}, err
+	}
+	return newItem, nil
+}
+
+func (cu *consignmentUsecase) GetItems(consignorID uint) ([]model.ConsignmentItem, error) {
+	return cu.cr.GetItemsByConsignor(consignorID)
+}
+
+func (cu *consignmentUsecase) GetItem(id uint) (model.ConsignmentItem, error) {
+	item := model.ConsignmentItem{}
+	if err := cu.cr.GetItemByID(&item, id); err != nil {
+		return model.ConsignmentItem{}, err
+	}
+	return item, nil
+}
+
+// 店頭以外(通販など)で売れた委託品の販売を手動で記録する、レジで売れたものはレジの販売時に記録される
+func (cu *consignmentUsecase) SellItem(staffID uint, id uint, req model.ConsignmentSaleRequest) (model.ConsignmentLedgerEntry, error) {
+	if err := cu.cv.ConsignmentSaleValidate(req); err != nil {
+		return model.ConsignmentLedgerEntry{}, err
+	}
+	return cu.RecordSale(staffID, id, req.SalePrice, "")
+}
+
+// 委託品の販売を記録し、販売額から手数料を引いた額を委託者への支払義務として台帳に積む
+// 手数料は円未満を切捨て(委託者に有利な方)
+// レジの販売では値引後の明細の金額を販売額にするので、全額値引で0になる場合がある
+func (cu *consignmentUsecase) RecordSale(staffID uint, id uint, salePrice int, note string) (model.ConsignmentLedgerEntry, error) {
+	item := model.ConsignmentItem{}
+	if err := cu.cr.GetItemByID(&item, id); err != nil {
+		return model.ConsignmentLedgerEntry{}, err
+	}
+	if item.Status != model.ConsignmentAvailable {
+		return model.ConsignmentLedgerEntry{}, fmt.Errorf("%w: consignment item is %s", ErrInvalidState, item.Status)
+	}
+	percent := 0
+	if item.CommissionPercent != nil {
+		percent = *item.CommissionPercent
+	} else {
+		consignor := model.Consignor{}
+		if err := cu.cr.GetConsignorByID(&consignor, item.ConsignorID); err != nil {
+			return model.ConsignmentLedgerEntry{}, err
+		}
+		percent = consignor.CommissionPercent
+	}
+	now := time.Now()
+	item.SalePrice = salePrice
+	item.SoldAt = &now
+	commission := salePrice * percent / 100
+	entry := model.ConsignmentLedgerEntry{
+		ConsignorID:       item.ConsignorID,
+		ConsignmentItemID: &item.ID,
+		Type:              model.LedgerSale,
+		SaleAmount:        salePrice,
+		Commission:        commission,
+		Amount:            salePrice - commission,
+		Note:              note,
+		RecordedBy:        staffID,
+	}
+	if err := cu.cr.SellItem(&item, &entry); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.ConsignmentLedgerEntry{}, fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		return model.ConsignmentLedgerEntry{}, err
+	}
+	return entry, nil
+}
+
+// レジでの取消・返品で販売を取消し、委託品を販売中に戻す
+// 委託者へ支払済みの場合は残高がマイナスになり、次回の支払で相殺する
+func (cu *consignmentUsecase) CancelSale(staffID uint, id uint, note string) (model.ConsignmentLedgerEntry, error) {
+	entry := model.ConsignmentLedgerEntry{RecordedBy: staffID, Note: note}
+	if err := cu.cr.CancelSale(id, &entry); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.ConsignmentLedgerEntry{}, fmt.Errorf("%w: consignment item is not sold", ErrInvalidState)
+		}
+		return model.ConsignmentLedgerEntry{}, err
+	}
+	return entry, nil
+}
+
+// 売れ残った委託品を委託者に返却する
+func (cu *consignmentUsecase) ReturnItem(id uint) (model.ConsignmentItem, error) {
+	if err := cu.cr.ReturnItem(id); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.ConsignmentItem{}, fmt.Errorf("%w: consignment item is not available", ErrInvalidState)
+		}
+		return model.ConsignmentItem{}, err
+	}
+	item := model.ConsignmentItem{}
+	if err := cu.cr.GetItemByID(&item, id); err != nil {
+		return model.ConsignmentItem{}, err
+	}
+	return item, nil
+}
+
+// 委託者への支払を記録する、残高を超える支払はできない
+func (cu *consignmentUsecase) RecordPayout(staffID uint, consignorID uint, req model.ConsignmentPayoutRequest) (model.ConsignmentLedgerEntry, error) {
+	if err := cu.cv.ConsignmentPayoutValidate(req); err != nil {
+		return model.ConsignmentLedgerEntry{}, err
+	}
+	entry := model.ConsignmentLedgerEntry{
+		ConsignorID: consignorID,
+		Type:        model.LedgerPayout,
+		Amount:      -req.Amount,
+		Method:      req.Method,
+		Note:        req.Note,
+		RecordedBy:  staffID,
+	}
+	if err := cu.cr.RecordPayout(&entry); err != nil {
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			return model.ConsignmentLedgerEntry{}, fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		return model.ConsignmentLedgerEntry{}, err
+	}
+	return entry, nil
+}
+
+// 期間[from, to)の支払明細書
+func (cu *consignmentUsecase) GetStatement(consignorID uint, from time.Time, to time.Time) (model.ConsignmentStatement, error) {
+	if !from.Before(to) {
+		return model.ConsignmentStatement{}, fmt.Errorf("%w: from must be before to", ErrInvalidState)
+	}
+	consignor := model.Consignor{}
+	if err := cu.cr.GetConsignorByID(&consignor, consignorID); err != nil {
+		return model.ConsignmentStatement{}, err
+	}
+	opening, err := cu.cr.GetBalance(consignorID, &from)
+	if err != nil {
+		return model.ConsignmentStatement{}, err
+	}
+	entries, err := cu.cr.GetLedgerEntries(consignorID, from, to)
+	if err != nil {
+		return model.ConsignmentStatement{}, err
+	}
+	statement := model.ConsignmentStatement{
+		Consignor:      consignor,
+		From:           from,
+		To:             to,
+		OpeningBalance: opening,
+		Entries:        entries,
+		ClosingBalance: opening,
+	}
+	for _, entry := range entries {
+		switch entry.Type {
+		case model.LedgerSale, model.LedgerSaleReversal:
+			statement.TotalSales += entry.SaleAmount
+			statement.TotalCommission += entry.Commission
+		case model.LedgerPayout:
+			statement.TotalPayouts += -entry.Amount
+		}
+		statement.ClosingBalance += entry.Amount
+	}
+	return statement, nil
+}
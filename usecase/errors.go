@@ -0,0 +1,32 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// 現在の状態では実行できない操作(状態遷移が許可されていない等)
+// controllerでは409 Conflictとして返す
+var ErrInvalidState = errors.New("invalid state")
+
+// 認証できない(リフレッシュトークンが無効・期限切れ・再利用された等)
+// controllerでは401 Unauthorizedとして返す
+var ErrUnauthorized = errors.New("unauthorized")
+
+// 短時間に失敗を繰返したためロック中(ログインの総当たり対策など)
+// controllerでは429 Too Many Requestsとして返し、RetryAfterをRetry-Afterヘッダに入れる
+var ErrTooManyRequests = errors.New("too many requests")
+
+type RetryLaterError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RetryLaterError) Error() string {
+	return fmt.Sprintf("%v: retry after %d seconds", ErrTooManyRequests, int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+func (e *RetryLaterError) Unwrap() error {
+	return ErrTooManyRequests
+}
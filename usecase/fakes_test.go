@@ -0,0 +1,408 @@
+package usecase
+
+import (
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/oidc"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// テスト用のメモリ上のリポジトリ
+// interfaceを埋込んで、テストで使うメソッドだけ実装する(それ以外を呼ぶとnilの呼出しでpanicするので気付ける)
+
+type fakeUserRepository struct {
+	repository.IUserRepository
+	users  map[uint]*model.User
+	nextID uint
+}
+
+func newFakeUserRepository(users ...model.User) *fakeUserRepository {
+	r := &fakeUserRepository{users: map[uint]*model.User{}}
+	for _, u := range users {
+		u := u
+		r.users[u.ID] = &u
+		r.nextID = max(r.nextID, u.ID)
+	}
+	return r
+}
+
+func (r *fakeUserRepository) GetUserByEmail(user *model.User, email string) error {
+	for _, u := range r.users {
+		if strings.EqualFold(u.Email, email) {
+			*user = *u
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *fakeUserRepository) GetUserByID(user *model.User, id uint) error {
+	u, ok := r.users[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	*user = *u
+	return nil
+}
+
+func (r *fakeUserRepository) create(user *model.User) error {
+	if err := r.GetUserByEmail(&model.User{}, user.Email); err == nil {
+		return repository.ErrStaleObject
+	}
+	r.nextID++
+	user.ID = r.nextID
+	u := *user
+	r.users[u.ID] = &u
+	return nil
+}
+
+type fakeTokenRepository struct {
+	repository.ITokenRepository
+	refreshTokens []*model.RefreshToken
+	revoked       []model.RevokedToken
+	revocations   []model.UserTokenRevocation
+}
+
+func (r *fakeTokenRepository) CreateRefreshToken(token *model.RefreshToken) error {
+	token.ID = uint(len(r.refreshTokens) + 1)
+	t := *token
+	r.refreshTokens = append(r.refreshTokens, &t)
+	return nil
+}
+
+func (r *fakeTokenRepository) GetRefreshTokenByHash(token *model.RefreshToken, tokenHash string) error {
+	for _, t := range r.refreshTokens {
+		if t.TokenHash == tokenHash {
+			*token = *t
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// 本物と同じく、使用済み・失効済みならErrStaleObject
+func (r *fakeTokenRepository) RotateRefreshToken(old *model.RefreshToken, next *model.RefreshToken, now time.Time) error {
+	for _, t := range r.refreshTokens {
+		if t.ID != old.ID {
+			continue
+		}
+		if t.UsedAt != nil || t.RevokedAt != nil {
+			return repository.ErrStaleObject
+		}
+		t.UsedAt = &now
+		old.UsedAt = &now
+		return r.CreateRefreshToken(next)
+	}
+	return repository.ErrStaleObject
+}
+
+func (r *fakeTokenRepository) RevokeFamily(familyID string, now time.Time) error {
+	for _, t := range r.refreshTokens {
+		if t.FamilyID == familyID && t.RevokedAt == nil {
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeTokenRepository) RevokeAccessToken(revoked *model.RevokedToken) error {
+	r.revoked = append(r.revoked, *revoked)
+	return nil
+}
+
+func (r *fakeTokenRepository) RevokeUserTokens(revocation *model.UserTokenRevocation) error {
+	r.revocations = append(r.revocations, *revocation)
+	for _, t := range r.refreshTokens {
+		if t.UserID == revocation.UserID && t.RevokedAt == nil {
+			t.RevokedAt = &revocation.RevokedBefore
+		}
+	}
+	return nil
+}
+
+func (r *fakeTokenRepository) GetRevocations(now time.Time, since time.Time) ([]model.RevokedToken, []model.UserTokenRevocation, error) {
+	return r.revoked, r.revocations, nil
+}
+
+type fakeSecurityRepository struct {
+	repository.ISecurityRepository
+	throttles map[string]*model.LoginThrottle
+	events    []model.SecurityEvent
+}
+
+func (r *fakeSecurityRepository) GetLoginThrottles(keys []string) ([]model.LoginThrottle, error) {
+	throttles := []model.LoginThrottle{}
+	for _, k := range keys {
+		if t, ok := r.throttles[k]; ok {
+			throttles = append(throttles, *t)
+		}
+	}
+	return throttles, nil
+}
+
+func (r *fakeSecurityRepository) RecordLoginFailure(throttle *model.LoginThrottle, now time.Time, window time.Duration) error {
+	t, ok := r.throttles[throttle.Key]
+	if !ok || now.Sub(t.LastFailureAt) > window {
+		t = &model.LoginThrottle{Key: throttle.Key}
+		r.throttles[throttle.Key] = t
+	}
+	t.Failures++
+	t.LastFailureAt = now
+	*throttle = *t
+	return nil
+}
+
+func (r *fakeSecurityRepository) LockLogin(key string, until time.Time) error {
+	r.throttles[key].LockedUntil = &until
+	return nil
+}
+
+func (r *fakeSecurityRepository) ResetLoginThrottle(key string) error {
+	delete(r.throttles, key)
+	return nil
+}
+
+func (r *fakeSecurityRepository) CreateSecurityEvent(event *model.SecurityEvent) error {
+	r.events = append(r.events, *event)
+	return nil
+}
+
+func (r *fakeSecurityRepository) countEvents(eventType string) int {
+	n := 0
+	for _, e := range r.events {
+		if e.Type == eventType {
+			n++
+		}
+	}
+	return n
+}
+
+type fakeTwoFactorRepository struct {
+	repository.ITwoFactorRepository
+	twoFactors map[uint]*model.TwoFactor
+	challenges []*model.LoginChallenge
+	// ロールごとの2段階認証の必須設定、無いロールは任意
+	policies map[string]bool
+}
+
+func (r *fakeTwoFactorRepository) GetTwoFactor(twoFactor *model.TwoFactor, userID uint) error {
+	t, ok := r.twoFactors[userID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	*twoFactor = *t
+	return nil
+}
+
+// 本物と同じく、前回より後のステップでなければErrStaleObject
+func (r *fakeTwoFactorRepository) UseTwoFactorStep(userID uint, step int64) error {
+	t, ok := r.twoFactors[userID]
+	if !ok || !t.Enabled || t.LastUsedStep >= step {
+		return repository.ErrStaleObject
+	}
+	t.LastUsedStep = step
+	return nil
+}
+
+func (r *fakeTwoFactorRepository) CreateLoginChallenge(challenge *model.LoginChallenge) error {
+	challenge.ID = uint(len(r.challenges) + 1)
+	c := *challenge
+	r.challenges = append(r.challenges, &c)
+	return nil
+}
+
+func (r *fakeTwoFactorRepository) GetLoginChallengeByHash(challenge *model.LoginChallenge, tokenHash string) error {
+	for _, c := range r.challenges {
+		if c.TokenHash == tokenHash {
+			*challenge = *c
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *fakeTwoFactorRepository) CountChallengeAttempt(challenge *model.LoginChallenge, maxAttempts int) error {
+	c := r.challenges[challenge.ID-1]
+	if c.UsedAt != nil || c.Attempts >= maxAttempts {
+		return repository.ErrStaleObject
+	}
+	c.Attempts++
+	challenge.Attempts++
+	return nil
+}
+
+func (r *fakeTwoFactorRepository) UseLoginChallenge(challenge *model.LoginChallenge, now time.Time) error {
+	c := r.challenges[challenge.ID-1]
+	if c.UsedAt != nil {
+		return repository.ErrStaleObject
+	}
+	c.UsedAt = &now
+	challenge.UsedAt = &now
+	return nil
+}
+
+func (r *fakeTwoFactorRepository) GetTwoFactorPolicy(policy *model.TwoFactorPolicy, role string) error {
+	required, ok := r.policies[role]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	*policy = model.TwoFactorPolicy{Role: role, Required: required}
+	return nil
+}
+
+type fakeAPIKeyRepository struct {
+	repository.IAPIKeyRepository
+	keys []model.APIKey
+}
+
+// 本物と同じく、発行したユーザも一緒に読込む
+func (r *fakeAPIKeyRepository) GetAPIKeyByHash(key *model.APIKey, keyHash string) error {
+	for _, k := range r.keys {
+		if k.KeyHash == keyHash {
+			*key = k
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *fakeAPIKeyRepository) TouchAPIKey(id uint, now time.Time, interval time.Duration) error {
+	return nil
+}
+
+type fakeIdentityRepository struct {
+	repository.IIdentityRepository
+	ur         *fakeUserRepository
+	states     []*model.OIDCLoginState
+	identities []*model.UserIdentity
+}
+
+func (r *fakeIdentityRepository) CreateLoginState(state *model.OIDCLoginState) error {
+	state.ID = uint(len(r.states) + 1)
+	s := *state
+	r.states = append(r.states, &s)
+	return nil
+}
+
+func (r *fakeIdentityRepository) GetLoginStateByHash(state *model.OIDCLoginState, stateHash string) error {
+	for _, s := range r.states {
+		if s.StateHash == stateHash {
+			*state = *s
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (r *fakeIdentityRepository) UseLoginState(state *model.OIDCLoginState, now time.Time) error {
+	for _, s := range r.states {
+		if s.ID == state.ID {
+			if s.UsedAt != nil {
+				return repository.ErrStaleObject
+			}
+			s.UsedAt = &now
+			state.UsedAt = &now
+			return nil
+		}
+	}
+	return repository.ErrStaleObject
+}
+
+func (r *fakeIdentityRepository) GetIdentity(identity *model.UserIdentity, provider string, subject string) error {
+	for _, i := range r.identities {
+		if i.Provider == provider && i.Subject == subject {
+			*identity = *i
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// 本物と同じく、verifyEmailなら同じアドレスの未確認のユーザを確認済みにする
+func (r *fakeIdentityRepository) LinkIdentity(identity *model.UserIdentity, verifyEmail bool, now time.Time) error {
+	if err := r.GetIdentity(&model.UserIdentity{}, identity.Provider, identity.Subject); err == nil {
+		return repository.ErrStaleObject
+	}
+	r.add(identity)
+	if u, ok := r.ur.users[identity.UserID]; ok && verifyEmail && u.Email == identity.Email && !u.EmailVerified {
+		u.EmailVerified = true
+		u.EmailVerifiedAt = &now
+	}
+	return nil
+}
+
+func (r *fakeIdentityRepository) CreateUserWithIdentity(user *model.User, identity *model.UserIdentity) error {
+	if err := r.ur.create(user); err != nil {
+		return err
+	}
+	identity.UserID = user.ID
+	r.add(identity)
+	return nil
+}
+
+func (r *fakeIdentityRepository) TouchIdentity(identity *model.UserIdentity, now time.Time) error {
+	identity.LastLoginAt = &now
+	return nil
+}
+
+func (r *fakeIdentityRepository) add(identity *model.UserIdentity) {
+	identity.ID = uint(len(r.identities) + 1)
+	i := *identity
+	r.identities = append(r.identities, &i)
+}
+
+// ユーザ関連のテストで使う、フェイクのリポジトリを繋いだuserUsecase
+type userFixture struct {
+	uu         *userUsecase
+	users      *fakeUserRepository
+	tokens     *fakeTokenRepository
+	security   *fakeSecurityRepository
+	twoFactors *fakeTwoFactorRepository
+	identities *fakeIdentityRepository
+}
+
+func newUserFixture(t *testing.T, providers map[string]oidc.IProvider, users ...model.User) userFixture {
+	t.Helper()
+	t.Setenv("SECRET", "test-secret")
+	f := userFixture{
+		users:      newFakeUserRepository(users...),
+		tokens:     &fakeTokenRepository{},
+		security:   &fakeSecurityRepository{throttles: map[string]*model.LoginThrottle{}},
+		twoFactors: &fakeTwoFactorRepository{twoFactors: map[uint]*model.TwoFactor{}},
+	}
+	f.identities = &fakeIdentityRepository{ur: f.users}
+	f.uu = NewUserUsecase(f.users, validator.NewUserValidator(), f.tokens, nil, f.security, f.twoFactors,
+		f.identities, providers).(*userUsecase)
+	return f
+}
+
+type fakePromotionRepository struct {
+	repository.IPromotionRepository
+	promotions []model.Promotion
+}
+
+// 本物と同じく、自動適用(コード無し)と入力されたコードのものを候補にする
+func (r *fakePromotionRepository) GetCandidatePromotions(codes []string, now time.Time) ([]model.Promotion, error) {
+	var candidates []model.Promotion
+	for _, p := range r.promotions {
+		if p.Code == "" || slices.Contains(codes, p.Code) {
+			candidates = append(candidates, p)
+		}
+	}
+	return candidates, nil
+}
+
+type fakeTaxRepository struct {
+	repository.ITaxRepository
+	rates []model.TaxRate
+}
+
+func (r *fakeTaxRepository) GetTaxRates() ([]model.TaxRate, error) {
+	return r.rates, nil
+}
@@ -0,0 +1,207 @@
+package usecase
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IGiftCardUsecase interface {
+	IssueGiftCard(staffID uint, req model.GiftCardIssueRequest) (model.GiftCardIssueResponse, error)
+	GetGiftCardBalance(code string) (model.GiftCard, error)
+	GetGiftCardTransactions(code string) ([]model.GiftCardTransaction, error)
+	GetOwnStoreCredit(userID uint) (model.StoreCreditResponse, error)
+	GrantStoreCredit(actorID uint, req model.StoreCreditGrantRequest, referenceType string, referenceID uint) (model.StoreCreditTransaction, error)
+	Tender(userID uint, req model.TenderRequest) (model.TenderResponse, error)
+	ReverseTender(userID uint, reference string) ([]model.TenderApplied, error)
+	RefundTender(userID uint, reference string, amount int, actorID uint) ([]model.TenderApplied, error)
+}
+
+type giftCardUsecase struct {
+	gr repository.IGiftCardRepository
+	gv validator.IGiftCardValidator
+}
+
+func NewGiftCardUsecase(gr repository.IGiftCardRepository, gv validator.IGiftCardValidator) IGiftCardUsecase {
+	return &giftCardUsecase{gr, gv}
+}
+
+// ギフトカードの標準の有効期限
+const giftCardValidYears = 3
+
+// 店内クレジットは最後の付与・利用から2年で失効
+const storeCreditValidYears = 2
+
+// 見間違えやすい文字(0/O、1/I)を除いた32文字
+const giftCardAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+func (gu *giftCardUsecase) IssueGiftCard(staffID uint, req model.GiftCardIssueRequest) (model.GiftCardIssueResponse, error) {
+	if err := gu.gv.GiftCardIssueValidate(req); err != nil {
+		return model.GiftCardIssueResponse{}, err
+	}
+	expiresAt := time.Now().AddDate(giftCardValidYears, 0, 0)
+	if req.ExpiresAt != nil {
+		if !req.ExpiresAt.After(time.Now()) {
+			return model.GiftCardIssueResponse{}, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidState)
+		}
+		expiresAt = *req.ExpiresAt
+	}
+	code, err := newGiftCardCode()
+	if err != nil {
+		return model.GiftCardIssueResponse{}, err
+	}
+	normalized := normalizeGiftCardCode(code)
+	card := model.GiftCard{
+		CodeHash:      common.HashToken(normalized),
+		Last4:         normalized[len(normalized)-4:],
+		InitialAmount: req.Amount,
+		Balance:       req.Amount,
+		ExpiresAt:     expiresAt,
+		IssuedBy:      staffID,
+	}
+	if err := gu.gr.CreateGiftCard(&card, staffID); err != nil {
+		return model.GiftCardIssueResponse{}, err
+	}
+	return model.GiftCardIssueResponse{GiftCard: card, Code: code}, nil
+}
+
+func (gu *giftCardUsecase) GetGiftCardBalance(code string) (model.GiftCard, error) {
+	card := model.GiftCard{}
+	if err := gu.gr.GetGiftCardByCodeHash(&card, common.HashToken(normalizeGiftCardCode(code))); err != nil {
+		return model.GiftCard{}, err
+	}
+	return card, nil
+}
+
+func (gu *giftCardUsecase) GetGiftCardTransactions(code string) ([]model.GiftCardTransaction, error) {
+	card, err := gu.GetGiftCardBalance(code)
+	if err != nil {
+		return nil, err
+	}
+	return gu.gr.GetGiftCardTransactions(card.ID)
+}
+
+func (gu *giftCardUsecase) GetOwnStoreCredit(userID uint) (model.StoreCreditResponse, error) {
+	account, transactions, err := gu.gr.GetStoreCredit(userID)
+	if err != nil {
+		return model.StoreCreditResponse{}, err
+	}
+	if transactions == nil {
+		transactions = []model.StoreCreditTransaction{}
+	}
+	return model.StoreCreditResponse{Balance: account.Balance, ExpiresAt: account.ExpiresAt, Transactions: transactions}, nil
+}
+
+// スタッフによる付与の他、買取代金の店内クレジットでの支払からも呼ばれる
+// referenceType/referenceIDで付与の元を記録する(スタッフによる付与は空)
+func (gu *giftCardUsecase) GrantStoreCredit(actorID uint, req model.StoreCreditGrantRequest,
+	referenceType string, referenceID uint) (model.StoreCreditTransaction, error) {
+	if err := gu.gv.StoreCreditGrantValidate(req); err != nil {
+		return model.StoreCreditTransaction{}, err
+	}
+	entry := model.StoreCreditTransaction{
+		UserID:        req.UserID,
+		Type:          model.BalanceGrant,
+		Amount:        req.Amount,
+		ReferenceType: referenceType,
+		ReferenceID:   referenceID,
+		ActorID:       actorID,
+		Note:          req.Note,
+	}
+	if err := gu.gr.GrantStoreCredit(&entry, time.Now().AddDate(storeCreditValidYears, 0, 0)); err != nil {
+		return model.StoreCreditTransaction{}, err
+	}
+	return entry, nil
+}
+
+// チェックアウト時にギフトカード・店内クレジットを支払に充当する
+// 残高が足りない分はRemainingDueとして返し、カード決済などで支払ってもらう
+// カード決済が失敗した場合はReverseTenderで戻す(サーバ側の処理かスタッフのみ、顧客からは戻せない)
+func (gu *giftCardUsecase) Tender(userID uint, req model.TenderRequest) (model.TenderResponse, error) {
+	if err := gu.gv.TenderValidate(req); err != nil {
+		return model.TenderResponse{}, err
+	}
+	// 同じカードが重複して指定されても1回だけ使う
+	var codeHashes []string
+	seen := map[string]bool{}
+	for _, code := range req.GiftCardCodes {
+		codeHash := common.HashToken(normalizeGiftCardCode(code))
+		if !seen[codeHash] {
+			seen[codeHash] = true
+			codeHashes = append(codeHashes, codeHash)
+		}
+	}
+	now := time.Now()
+	applied, err := gu.gr.Redeem(userID, codeHashes, req.UseStoreCredit, req.AmountDue, req.Reference,
+		now, now.AddDate(storeCreditValidYears, 0, 0))
+	if err != nil {
+		return model.TenderResponse{}, balanceError(err)
+	}
+	res := model.TenderResponse{Reference: req.Reference, AmountDue: req.AmountDue, Applied: applied, RemainingDue: req.AmountDue}
+	for _, a := range applied {
+		res.RemainingDue -= a.Amount
+	}
+	return res, nil
+}
+
+// userID: 充当した利用者
+func (gu *giftCardUsecase) ReverseTender(userID uint, reference string) ([]model.TenderApplied, error) {
+	if userID == 0 || reference == "" {
+		return nil, gorm.ErrRecordNotFound
+	}
+	reversed, err := gu.gr.Reverse(userID, reference)
+	if err != nil {
+		return nil, balanceError(err)
+	}
+	return reversed, nil
+}
+
+// 返品の返金、referenceで充当したギフトカードにamountを戻す
+// userID: 充当した利用者、actorID: 返品を受付けたスタッフ
+func (gu *giftCardUsecase) RefundTender(userID uint, reference string, amount int, actorID uint) ([]model.TenderApplied, error) {
+	refunded, err := gu.gr.Refund(userID, reference, amount, actorID)
+	if err != nil {
+		if errors.Is(err, repository.ErrInsufficientBalance) {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		return nil, err
+	}
+	return refunded, nil
+}
+
+// 期限切れ・処理済みは利用者が状況を確認して再操作するものなので409にする
+func balanceError(err error) error {
+	if errors.Is(err, repository.ErrExpired) || errors.Is(err, repository.ErrDuplicateEvent) {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	return err
+}
+
+// XXXX-XXXX-XXXX-XXXX形式、32文字から16桁で80ビット
+func newGiftCardCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	var code strings.Builder
+	for i, v := range b {
+		if i > 0 && i%4 == 0 {
+			code.WriteByte('-')
+		}
+		code.WriteByte(giftCardAlphabet[int(v)%len(giftCardAlphabet)])
+	}
+	return code.String(), nil
+}
+
+// 大文字小文字・ハイフン・空白を区別しない
+func normalizeGiftCardCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(normalizeCode(code))
+}
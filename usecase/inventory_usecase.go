@@ -0,0 +1,226 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"time"
+)
+
+type IInventoryUsecase interface {
+	CreateLocation(location model.Location) (model.Location, error)
+	GetLocations() ([]model.Location, error)
+	GetStock(query model.StockQuery) ([]model.StockLevelResponse, error)
+	GetMovements(locationID uint, recordID uint) ([]model.StockMovement, error)
+	Adjust(staffID uint, req model.StockAdjustmentRequest) (model.StockMovement, error)
+	ApplyMovements(movements []model.StockMovement) error
+	CreateTransfer(staffID uint, order model.TransferOrder) (model.TransferOrder, error)
+	GetTransfers(status string) ([]model.TransferOrder, error)
+	GetTransfer(id uint) (model.TransferOrder, error)
+	ShipTransfer(staffID uint, id uint) (model.TransferOrder, error)
+	ReceiveTransfer(staffID uint, id uint) (model.TransferOrder, error)
+	CancelTransfer(staffID uint, id uint) (model.TransferOrder, error)
+}
+
+type inventoryUsecase struct {
+	ir repository.IInventoryRepository
+	iv validator.IInventoryValidator
+	rr repository.IRecordRepository
+	wu IWantListUsecase
+}
+
+func NewInventoryUsecase(ir repository.IInventoryRepository, iv validator.IInventoryValidator,
+	rr repository.IRecordRepository, wu IWantListUsecase) IInventoryUsecase {
+	return &inventoryUsecase{ir, iv, rr, wu}
+}
+
+func (iu *inventoryUsecase) CreateLocation(location model.Location) (model.Location, error) {
+	if err := iu.iv.LocationValidate(location); err != nil {
+		return model.Location{}, err
+	}
+	newLocation := model.Location{Code: location.Code, Name: location.Name, Type: location.Type}
+	if err := iu.ir.CreateLocation(&newLocation); err != nil {
+		return model.Location{}, err
+	}
+	return newLocation, nil
+}
+
+func (iu *inventoryUsecase) GetLocations() ([]model.Location, error) {
+	return iu.ir.GetLocations()
+}
+
+func (iu *inventoryUsecase) GetStock(query model.StockQuery) ([]model.StockLevelResponse, error) {
+	levels, err := iu.ir.GetStockLevels(query)
+	if err != nil {
+		return nil, err
+	}
+	if levels == nil {
+		levels = []model.StockLevelResponse{}
+	}
+	return levels, nil
+}
+
+func (iu *inventoryUsecase) GetMovements(locationID uint, recordID uint) ([]model.StockMovement, error) {
+	return iu.ir.GetMovements(locationID, recordID)
+}
+
+// 入荷・棚卸し差異・店頭販売などの手動での在庫の増減
+func (iu *inventoryUsecase) Adjust(staffID uint, req model.StockAdjustmentRequest) (model.StockMovement, error) {
+	if err := iu.iv.StockAdjustmentValidate(req); err != nil {
+		return model.StockMovement{}, err
+	}
+	location := model.Location{}
+	if err := iu.ir.GetLocationByID(&location, req.LocationID); err != nil {
+		return model.StockMovement{}, err
+	}
+	record := model.Record{}
+	if err := iu.rr.GetRecordByID(&record, req.RecordID); err != nil {
+		return model.StockMovement{}, err
+	}
+	reason := req.Reason
+	if reason == "" {
+		reason = model.MovementAdjust
+	}
+	movements := []model.StockMovement{{
+		LocationID: location.ID,
+		RecordID:   record.ID,
+		Grade:      req.Grade,
+		Delta:      req.Delta,
+		Reason:     reason,
+		ActorID:    staffID,
+		Note:       req.Note,
+	}}
+	if err := iu.ApplyMovements(movements); err != nil {
+		return model.StockMovement{}, err
+	}
+	return movements[0], nil
+}
+
+// 他の業務(買取、返品など)からの在庫の増減もここを通す
+// 在庫不足はErrInvalidStateとして返す
+// 店全体として在庫が増えた場合はウォントリストの照合に回す(拠点間の移動は対象外)
+func (iu *inventoryUsecase) ApplyMovements(movements []model.StockMovement) error {
+	if err := iu.ir.ApplyMovements(movements); err != nil {
+		return stockError(err)
+	}
+	for _, movement := range movements {
+		if movement.Delta > 0 && movement.Reason != model.MovementTransferIn && movement.Reason != model.MovementAdjust {
+			iu.wu.NotifyStockAdded(model.StockNotice{RecordID: movement.RecordID, Condition: movement.Grade})
+		}
+	}
+	return nil
+}
+
+func (iu *inventoryUsecase) CreateTransfer(staffID uint, order model.TransferOrder) (model.TransferOrder, error) {
+	if err := iu.iv.TransferOrderValidate(order); err != nil {
+		return model.TransferOrder{}, err
+	}
+	for _, id := range []uint{order.FromLocationID, order.ToLocationID} {
+		if err := iu.ir.GetLocationByID(&model.Location{}, id); err != nil {
+			return model.TransferOrder{}, err
+		}
+	}
+	newOrder := model.TransferOrder{
+		FromLocationID: order.FromLocationID,
+		ToLocationID:   order.ToLocationID,
+		Status:         model.TransferPending,
+		CreatedBy:      staffID,
+	}
+	for _, item := range order.Items {
+		record := model.Record{}
+		if err := iu.rr.GetRecordByID(&record, item.RecordID); err != nil {
+			return model.TransferOrder{}, err
+		}
+		newOrder.Items = append(newOrder.Items, model.TransferOrderItem{
+			RecordID: record.ID,
+			Grade:    item.Grade,
+			Quantity: item.Quantity,
+		})
+	}
+	if err := iu.ir.CreateTransfer(&newOrder); err != nil {
+		return model.TransferOrder{}, err
+	}
+	return newOrder, nil
+}
+
+func (iu *inventoryUsecase) GetTransfers(status string) ([]model.TransferOrder, error) {
+	return iu.ir.GetTransfers(status)
+}
+
+func (iu *inventoryUsecase) GetTransfer(id uint) (model.TransferOrder, error) {
+	order := model.TransferOrder{}
+	if err := iu.ir.GetTransferByID(&order, id); err != nil {
+		return model.TransferOrder{}, err
+	}
+	return order, nil
+}
+
+// 出庫、移動元の在庫を減らして輸送中にする
+func (iu *inventoryUsecase) ShipTransfer(staffID uint, id uint) (model.TransferOrder, error) {
+	return iu.transferTransition(staffID, id, model.TransferPending, model.TransferInTransit, func(order *model.TransferOrder, now time.Time) []model.StockMovement {
+		order.ShippedAt = &now
+		return transferMovements(*order, order.FromLocationID, -1, model.MovementTransferOut, staffID)
+	})
+}
+
+// 入庫、移動先の在庫を増やす
+func (iu *inventoryUsecase) ReceiveTransfer(staffID uint, id uint) (model.TransferOrder, error) {
+	return iu.transferTransition(staffID, id, model.TransferInTransit, model.TransferReceived, func(order *model.TransferOrder, now time.Time) []model.StockMovement {
+		order.ReceivedAt = &now
+		return transferMovements(*order, order.ToLocationID, 1, model.MovementTransferIn, staffID)
+	})
+}
+
+// 取消できるのは出庫前のみ
+func (iu *inventoryUsecase) CancelTransfer(staffID uint, id uint) (model.TransferOrder, error) {
+	return iu.transferTransition(staffID, id, model.TransferPending, model.TransferCancelled, nil)
+}
+
+// from -> to への状態変更、movementsで状態変更と同時に在庫を増減させる
+func (iu *inventoryUsecase) transferTransition(staffID uint, id uint, from string, to string,
+	movements func(order *model.TransferOrder, now time.Time) []model.StockMovement) (model.TransferOrder, error) {
+	order := model.TransferOrder{}
+	if err := iu.ir.GetTransferByID(&order, id); err != nil {
+		return model.TransferOrder{}, err
+	}
+	if order.Status != from {
+		return model.TransferOrder{}, fmt.Errorf("%w: transfer order is %s", ErrInvalidState, order.Status)
+	}
+	order.Status = to
+	var stockMovements []model.StockMovement
+	if movements != nil {
+		stockMovements = movements(&order, time.Now())
+	}
+	if err := iu.ir.UpdateTransferStatus(&order, from, stockMovements); err != nil {
+		return model.TransferOrder{}, stockError(err)
+	}
+	return order, nil
+}
+
+// 移動指示の明細から、指定の拠点の在庫移動を作る、signで増減を指定する
+func transferMovements(order model.TransferOrder, locationID uint, sign int, reason string, actorID uint) []model.StockMovement {
+	var movements []model.StockMovement
+	for _, item := range order.Items {
+		movements = append(movements, model.StockMovement{
+			LocationID:    locationID,
+			RecordID:      item.RecordID,
+			Grade:         item.Grade,
+			Delta:         sign * item.Quantity,
+			Reason:        reason,
+			ReferenceType: "transfer_order",
+			ReferenceID:   order.ID,
+			ActorID:       actorID,
+		})
+	}
+	return movements
+}
+
+// 在庫不足と同時更新はどちらも利用者が状況を確認して再操作するものなので409にする
+func stockError(err error) error {
+	if errors.Is(err, repository.ErrInsufficientStock) || errors.Is(err, repository.ErrStaleObject) {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package usecase
+
+import (
+	"fmt"
+	"log"
+	"record-shop-rest-api/model"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ログインの総当たり対策
+// アカウント(メールアドレス)単位とIP単位で連続失敗を数え、閾値を超えたら一定時間ロックする
+// ロック時間は閾値を超えた回数ごとに倍にする(上限あり)、最後の失敗からloginFailureWindow経つと数え直す
+const (
+	loginAccountThreshold = 5
+	loginIPThreshold      = 20
+	loginLockBase         = 30 * time.Second
+	loginLockMax          = time.Hour
+	loginFailureWindow    = 24 * time.Hour
+)
+
+// 存在しないアドレスでも、パスワードの照合と同じくらい時間をかけるためのハッシュ
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), 10)
+
+type loginThrottleKey struct {
+	key       string
+	threshold int
+}
+
+func loginThrottleKeys(email string, ip string) []loginThrottleKey {
+	return []loginThrottleKey{
+		{"email:" + strings.ToLower(strings.TrimSpace(email)), loginAccountThreshold},
+		{"ip:" + ip, loginIPThreshold},
+	}
+}
+
+// ログイン後の操作(2段階認証の無効化など)ではアカウント単位のみ数える
+func accountThrottleKeys(email string) []loginThrottleKey {
+	return loginThrottleKeys(email, "")[:1]
+}
+
+// 閾値を超えた回数に応じたロック時間、閾値未満は0
+func loginLockDuration(failures int, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	lock := loginLockBase
+	for i := threshold; i < failures && lock < loginLockMax; i++ {
+		lock *= 2
+	}
+	return min(lock, loginLockMax)
+}
+
+// ロック中ならRetryLaterErrorを返す、パスワードの照合はしない
+func (uu *userUsecase) checkLoginThrottle(email string, ip string, keys []loginThrottleKey) error {
+	names := make([]string, 0, len(keys))
+	for _, k := range keys {
+		names = append(names, k.key)
+	}
+	throttles, err := uu.sr.GetLoginThrottles(names)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var lockedUntil time.Time
+	for _, t := range throttles {
+		if t.LockedUntil != nil && t.LockedUntil.After(lockedUntil) {
+			lockedUntil = *t.LockedUntil
+		}
+	}
+	if !lockedUntil.After(now) {
+		return nil
+	}
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventLoginBlocked, Email: email, IP: ip,
+		Details: fmt.Sprintf("locked until %s", lockedUntil.Format(time.RFC3339))})
+	return &RetryLaterError{RetryAfter: lockedUntil.Sub(now)}
+}
+
+// 認証の失敗は理由に関わらず同じエラーを返す(アカウントの有無やどこで失敗したかを区別させない)
+var (
+	errInvalidCredentials  = fmt.Errorf("%w: invalid email or password", ErrUnauthorized)
+	errInvalidSecondFactor = fmt.Errorf("%w: invalid two-factor code", ErrUnauthorized)
+)
+
+// 失敗を記録して、閾値を超えたらロックする
+// 回数の記録に失敗してもログインの失敗は変わらないので、ログに残して続ける
+func (uu *userUsecase) recordLoginFailure(userID *uint, email string, ip string, keys []loginThrottleKey, reason string) {
+	now := time.Now()
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventLoginFailed, UserID: userID, Email: email, IP: ip,
+		Details: reason})
+	for _, k := range keys {
+		throttle := model.LoginThrottle{Key: k.key}
+		if err := uu.sr.RecordLoginFailure(&throttle, now, loginFailureWindow); err != nil {
+			log.Printf("recording login failure for %s failed: %v", k.key, err)
+			continue
+		}
+		lock := loginLockDuration(throttle.Failures, k.threshold)
+		if lock == 0 {
+			continue
+		}
+		if err := uu.sr.LockLogin(k.key, now.Add(lock)); err != nil {
+			log.Printf("locking login for %s failed: %v", k.key, err)
+			continue
+		}
+		uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventLoginLocked, UserID: userID, Email: email, IP: ip,
+			Details: fmt.Sprintf("%s locked for %s after %d failures", k.key, lock, throttle.Failures)})
+	}
+}
+
+// 監査ログの記録、失敗しても本来の処理は止めない
+func (uu *userUsecase) securityEvent(event model.SecurityEvent) {
+	if err := uu.sr.CreateSecurityEvent(&event); err != nil {
+		log.Printf("recording security event %s failed: %v", event.Type, err)
+	}
+}
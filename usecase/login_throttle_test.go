@@ -0,0 +1,92 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"record-shop-rest-api/model"
+	"testing"
+	"time"
+)
+
+func loginWith(f userFixture, email string, password string, ip string) error {
+	_, err := f.uu.Login(model.User{Email: email, Password: password}, ip)
+	return err
+}
+
+func TestLoginLocksAccountAfterFailures(t *testing.T) {
+	f := newUserFixture(t, nil, newTestUser(t, 1, "alice@example.com"))
+	for i := 0; i < loginAccountThreshold; i++ {
+		if err := loginWith(f, "alice@example.com", "wrong-password", "192.0.2.1"); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("attempt %d: got %v, want ErrUnauthorized", i+1, err)
+		}
+	}
+	// ロック中は正しいパスワードでも、別のIPからでもログインできない
+	for _, ip := range []string{"192.0.2.1", "198.51.100.1"} {
+		err := loginWith(f, "alice@example.com", testPassword, ip)
+		var retry *RetryLaterError
+		if !errors.As(err, &retry) || !errors.Is(err, ErrTooManyRequests) {
+			t.Fatalf("locked account from %s: got %v, want RetryLaterError", ip, err)
+		}
+		if retry.RetryAfter <= 0 || retry.RetryAfter > loginLockBase {
+			t.Fatalf("retry after %s, want within %s", retry.RetryAfter, loginLockBase)
+		}
+	}
+	if f.security.countEvents(model.SecurityEventLoginLocked) != 1 {
+		t.Fatal("the lock should be recorded as a security event")
+	}
+	if f.security.countEvents(model.SecurityEventLoginBlocked) != 2 {
+		t.Fatal("blocked attempts should be recorded as security events")
+	}
+	// ロックが解けたらログインでき、失敗回数は数え直す
+	past := time.Now().Add(-time.Second)
+	f.security.throttles["email:alice@example.com"].LockedUntil = &past
+	if err := loginWith(f, "alice@example.com", testPassword, "192.0.2.1"); err != nil {
+		t.Fatalf("after the lock expired: %v", err)
+	}
+	if _, ok := f.security.throttles["email:alice@example.com"]; ok {
+		t.Fatal("a successful login should reset the account's failures")
+	}
+}
+
+func TestLoginCountsUnknownEmail(t *testing.T) {
+	f := newUserFixture(t, nil)
+	for i := 0; i < loginAccountThreshold; i++ {
+		loginWith(f, "nobody@example.com", "wrong-password", "192.0.2.1")
+	}
+	// 存在しないアカウントも同じくロックする(ロックの有無でアカウントの有無が分からないように)
+	if err := loginWith(f, "nobody@example.com", "wrong-password", "192.0.2.1"); !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("got %v, want ErrTooManyRequests", err)
+	}
+}
+
+func TestLoginLocksIPAfterFailures(t *testing.T) {
+	f := newUserFixture(t, nil, newTestUser(t, 1, "alice@example.com"))
+	// アカウントを変えながらの試行(パスワードスプレー)はIP単位で止める
+	for i := 0; i < loginIPThreshold; i++ {
+		loginWith(f, fmt.Sprintf("user%d@example.com", i), "wrong-password", "192.0.2.1")
+	}
+	if err := loginWith(f, "alice@example.com", testPassword, "192.0.2.1"); !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("locked IP: got %v, want ErrTooManyRequests", err)
+	}
+	if err := loginWith(f, "alice@example.com", testPassword, "198.51.100.1"); err != nil {
+		t.Fatalf("another IP should not be locked: %v", err)
+	}
+}
+
+func TestLoginLockDuration(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{loginAccountThreshold - 1, 0},
+		{loginAccountThreshold, loginLockBase},
+		{loginAccountThreshold + 1, 2 * loginLockBase},
+		{loginAccountThreshold + 3, 8 * loginLockBase},
+		{loginAccountThreshold + 100, loginLockMax},
+	}
+	for _, tt := range tests {
+		if got := loginLockDuration(tt.failures, loginAccountThreshold); got != tt.want {
+			t.Errorf("loginLockDuration(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/payment"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ILoyaltyUsecase interface {
+	CreateLoyaltyRule(rule model.LoyaltyRule) (model.LoyaltyRule, error)
+	GetLoyaltyRules() ([]model.LoyaltyRule, error)
+	GetOwnPoints(userID uint) (model.PointAccountResponse, error)
+	Earn(req model.PointEarnRequest) (model.PointTransaction, error)
+	EarnForPosSale(saleID uint) (model.PointTransaction, error)
+	EarnForOrder(paymentID uint) (model.PointTransaction, error)
+	Redeem(userID uint, req model.PointRedeemRequest) (model.PointTransaction, error)
+	ReverseRedeem(userID uint, reference string) (model.PointTransaction, error)
+	ClawbackForRefund(paymentID uint) error
+	ClawbackForPosSale(saleID uint) error
+	StartExpiryJob(interval time.Duration)
+}
+
+type loyaltyUsecase struct {
+	lr  repository.ILoyaltyRepository
+	lv  validator.ILoyaltyValidator
+	pr  repository.IPaymentRepository
+	rr  repository.IRecordRepository
+	rtr repository.IReturnRepository
+	psr repository.IPosRepository
+	or  repository.IOrderRepository
+}
+
+func NewLoyaltyUsecase(lr repository.ILoyaltyRepository, lv validator.ILoyaltyValidator,
+	pr repository.IPaymentRepository, rr repository.IRecordRepository,
+	rtr repository.IReturnRepository, psr repository.IPosRepository, or repository.IOrderRepository) ILoyaltyUsecase {
+	return &loyaltyUsecase{lr, lv, pr, rr, rtr, psr, or}
+}
+
+// ポイントは最後の付与から1年で失効
+const pointValidYears = 1
+
+func (lu *loyaltyUsecase) CreateLoyaltyRule(rule model.LoyaltyRule) (model.LoyaltyRule, error) {
+	if err := lu.lv.LoyaltyRuleValidate(rule); err != nil {
+		return model.LoyaltyRule{}, err
+	}
+	newRule := model.LoyaltyRule{
+		Name:              rule.Name,
+		Genre:             rule.Genre,
+		MultiplierPercent: rule.MultiplierPercent,
+		StartsAt:          rule.StartsAt,
+		EndsAt:            rule.EndsAt,
+	}
+	if err := lu.lr.CreateLoyaltyRule(&newRule); err != nil {
+		return model.LoyaltyRule{}, err
+	}
+	return newRule, nil
+}
+
+func (lu *loyaltyUsecase) GetLoyaltyRules() ([]model.LoyaltyRule, error) {
+	return lu.lr.GetLoyaltyRules()
+}
+
+func (lu *loyaltyUsecase) GetOwnPoints(userID uint) (model.PointAccountResponse, error) {
+	account, transactions, err := lu.lr.GetPointAccount(userID)
+	if err != nil {
+		return model.PointAccountResponse{}, err
+	}
+	if transactions == nil {
+		transactions = []model.PointTransaction{}
+	}
+	return model.PointAccountResponse{Balance: account.Balance, ExpiresAt: account.ExpiresAt, Transactions: transactions}, nil
+}
+
+// スタッフ用、売上確定済みのオンラインの決済に対して決済の所有者にポイントを付与する、1決済につき1回のみ
+// 明細ごとに(小計 × 倍率)を合計し、LOYALTY_YEN_PER_POINT円ごとに1ポイント(端数切捨て)
+// ジャンルは明細の自己申告ではなくレコードの登録内容を使う
+// 明細の合計が決済額を超える場合は、決済額まで按分して縮める
+// レジのカード決済はスタッフ名義なので受付けない、レジの販売はEarnForPosSaleで会員に付与する
+func (lu *loyaltyUsecase) Earn(req model.PointEarnRequest) (model.PointTransaction, error) {
+	if err := lu.lv.PointEarnValidate(req); err != nil {
+		return model.PointTransaction{}, err
+	}
+	storedPayment := model.Payment{}
+	if err := lu.pr.GetPaymentByID(&storedPayment, req.PaymentID); err != nil {
+		return model.PointTransaction{}, err
+	}
+	if storedPayment.Status != payment.StatusCaptured {
+		return model.PointTransaction{}, fmt.Errorf("%w: payment is %s", ErrInvalidState, storedPayment.Status)
+	}
+	err := lu.psr.GetPosSaleByCardPayment(&model.PosSale{}, storedPayment.ID)
+	if err == nil {
+		return model.PointTransaction{}, fmt.Errorf("%w: payment belongs to a pos sale", ErrInvalidState)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.PointTransaction{}, err
+	}
+	var lines []pointLine
+	for _, line := range req.Lines {
+		lines = append(lines, pointLine{RecordID: line.RecordID, Amount: line.UnitPrice * line.Quantity})
+	}
+	return lu.earn(model.PointTransaction{UserID: storedPayment.UserID, PaymentID: &storedPayment.ID}, lines, storedPayment.Amount)
+}
+
+// レジの販売の完了時に、会員を指定した販売の会員にポイントを付与する、1販売につき1回のみ
+// 明細は販売の記録から値引後の金額で計算し、ギフトカードで払った分には付与しない
+func (lu *loyaltyUsecase) EarnForPosSale(saleID uint) (model.PointTransaction, error) {
+	sale := model.PosSale{}
+	if err := lu.psr.GetPosSaleByID(&sale, saleID); err != nil {
+		return model.PointTransaction{}, err
+	}
+	if sale.Status != model.PosSaleCompleted {
+		return model.PointTransaction{}, fmt.Errorf("%w: sale is %s", ErrInvalidState, sale.Status)
+	}
+	if sale.CustomerID == nil {
+		return model.PointTransaction{}, fmt.Errorf("%w: sale has no customer", ErrInvalidState)
+	}
+	var lines []pointLine
+	for _, line := range sale.Lines {
+		lines = append(lines, pointLine{RecordID: line.RecordID, Amount: line.UnitPrice*line.Quantity - line.Discount})
+	}
+	return lu.earn(model.PointTransaction{UserID: *sale.CustomerID, PosSaleID: &sale.ID}, lines, sale.Total-sale.GiftCardAmount)
+}
+
+// オンライン注文の支払の売上確定時に、注文の明細から決済の所有者にポイントを付与する、1決済につき1回のみ
+// ポイントを充当した分はカードで払っていないので、決済額まで按分して縮める
+func (lu *loyaltyUsecase) EarnForOrder(paymentID uint) (model.PointTransaction, error) {
+	storedPayment := model.Payment{}
+	if err := lu.pr.GetPaymentByID(&storedPayment, paymentID); err != nil {
+		return model.PointTransaction{}, err
+	}
+	if storedPayment.Status != payment.StatusCaptured {
+		return model.PointTransaction{}, fmt.Errorf("%w: payment is %s", ErrInvalidState, storedPayment.Status)
+	}
+	order := model.Order{}
+	if err := lu.or.GetOrderByPayment(&order, storedPayment.ID); err != nil {
+		return model.PointTransaction{}, err
+	}
+	var lines []pointLine
+	for _, line := range order.Lines {
+		lines = append(lines, pointLine{RecordID: line.RecordID, Amount: line.UnitPrice * line.Quantity})
+	}
+	return lu.earn(model.PointTransaction{UserID: storedPayment.UserID, PaymentID: &storedPayment.ID}, lines, storedPayment.Amount)
+}
+
+// 付与の計算の元にする明細、Amountは値引後の金額
+type pointLine struct {
+	RecordID uint
+	Amount   int
+}
+
+// 明細の合計がpaidを超える場合は、paidまで按分して縮める
+func (lu *loyaltyUsecase) earn(entry model.PointTransaction, lines []pointLine, paid int) (model.PointTransaction, error) {
+	now := time.Now()
+	rules, err := lu.lr.GetActiveLoyaltyRules(now)
+	if err != nil {
+		return model.PointTransaction{}, err
+	}
+	subtotal := 0
+	weighted := 0
+	for _, line := range lines {
+		record := model.Record{}
+		if err := lu.rr.GetRecordByID(&record, line.RecordID); err != nil {
+			return model.PointTransaction{}, err
+		}
+		subtotal += line.Amount
+		weighted += line.Amount * pointMultiplier(rules, record.Genre) / 100
+	}
+	if subtotal > paid {
+		weighted = weighted * max(paid, 0) / subtotal
+	}
+	points := weighted / yenPerPoint()
+	if points == 0 {
+		return model.PointTransaction{}, fmt.Errorf("%w: no points for this purchase", ErrInvalidState)
+	}
+	entry.Type = model.PointEarn
+	entry.Points = points
+	if err := lu.lr.Earn(&entry, now.AddDate(pointValidYears, 0, 0)); err != nil {
+		return model.PointTransaction{}, pointError(err)
+	}
+	return entry, nil
+}
+
+// 1ポイント = 1円として支払前の注文に充当する、利用の識別子は注文から決める
+// 先にポイントを使い、注文に充当できなかった(支払済み・充当済み等)場合は戻す
+// 他人の注文は存在しないものとして扱う
+func (lu *loyaltyUsecase) Redeem(userID uint, req model.PointRedeemRequest) (model.PointTransaction, error) {
+	if err := lu.lv.PointRedeemValidate(req); err != nil {
+		return model.PointTransaction{}, err
+	}
+	order := model.Order{}
+	if err := lu.or.GetOrderByID(&order, req.OrderID); err != nil {
+		return model.PointTransaction{}, err
+	}
+	if order.UserID != userID {
+		return model.PointTransaction{}, gorm.ErrRecordNotFound
+	}
+	entry := model.PointTransaction{
+		UserID:    userID,
+		Type:      model.PointRedeem,
+		Points:    -req.Points,
+		Reference: model.OrderPointReference(order.ID),
+	}
+	if err := lu.lr.Redeem(&entry, time.Now()); err != nil {
+		return model.PointTransaction{}, pointError(err)
+	}
+	if err := lu.or.RedeemOrderPoints(userID, order.ID, req.Points); err != nil {
+		if _, reverseErr := lu.lr.Reverse(userID, entry.Reference); reverseErr != nil {
+			err = errors.Join(err, reverseErr)
+		}
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.PointTransaction{}, fmt.Errorf("%w: points can be used once on an unpaid order, for less than its total", ErrInvalidState)
+		}
+		return model.PointTransaction{}, err
+	}
+	return entry, nil
+}
+
+// サーバ側の処理用(注文の取消など)、充当したポイントを戻す
+func (lu *loyaltyUsecase) ReverseRedeem(userID uint, reference string) (model.PointTransaction, error) {
+	if reference == "" {
+		return model.PointTransaction{}, gorm.ErrRecordNotFound
+	}
+	entry, err := lu.lr.Reverse(userID, reference)
+	if err != nil {
+		return model.PointTransaction{}, pointError(err)
+	}
+	return entry, nil
+}
+
+// 返品・返金の後に呼ぶ、返金と店内クレジットでの返品の累計の割合に応じて付与済みのポイントを取消す
+// 返金のたびに呼んでも、取消済みの分は差し引くので二重に取消さない
+// ポイントの付与が無い決済では何もしない
+func (lu *loyaltyUsecase) ClawbackForRefund(paymentID uint) error {
+	storedPayment := model.Payment{}
+	if err := lu.pr.GetPaymentByID(&storedPayment, paymentID); err != nil {
+		return err
+	}
+	credited, err := lu.rtr.SumStoreCreditByPayment(paymentID)
+	if err != nil {
+		return err
+	}
+	returned := min(storedPayment.RefundedAmount+credited, storedPayment.Amount)
+	entry := model.PointTransaction{
+		UserID:    storedPayment.UserID,
+		PaymentID: &storedPayment.ID,
+		Note:      fmt.Sprintf("returned %d of %d", returned, storedPayment.Amount),
+	}
+	return ignoreNoClawback(lu.lr.Clawback(&entry, func(earned int, clawedBack int) int {
+		return earned*returned/storedPayment.Amount - clawedBack
+	}))
+}
+
+// レジでの返品・取消の後に呼ぶ、返品累計の割合に応じて(取消は全部)付与済みのポイントを取消す
+// 会員の指定やポイントの付与が無い販売では何もしない
+func (lu *loyaltyUsecase) ClawbackForPosSale(saleID uint) error {
+	sale := model.PosSale{}
+	if err := lu.psr.GetPosSaleByID(&sale, saleID); err != nil {
+		return err
+	}
+	if sale.CustomerID == nil || sale.Total == 0 {
+		return nil
+	}
+	returned := sale.RefundedAmount
+	if sale.Status == model.PosSaleVoided {
+		returned = sale.Total
+	}
+	entry := model.PointTransaction{
+		UserID:    *sale.CustomerID,
+		PosSaleID: &sale.ID,
+		Note:      fmt.Sprintf("returned %d of %d", returned, sale.Total),
+	}
+	return ignoreNoClawback(lu.lr.Clawback(&entry, func(earned int, clawedBack int) int {
+		return earned*returned/sale.Total - clawedBack
+	}))
+}
+
+// 取消すポイントが無い場合はエラーにしない
+func ignoreNoClawback(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// 一定間隔で有効期限切れのポイントを失効させるバックグラウンドジョブを開始する
+func (lu *loyaltyUsecase) StartExpiryJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			expired, err := lu.lr.ExpirePoints(time.Now())
+			if err != nil {
+				log.Printf("failed to expire points: %v", err)
+				continue
+			}
+			if expired > 0 {
+				log.Printf("expired points of %d account(s)", expired)
+			}
+		}
+	}()
+}
+
+// 当てはまる倍率のうち一番高いもの、無ければ等倍
+func pointMultiplier(rules []model.LoyaltyRule, genre string) int {
+	multiplier := 100
+	for _, rule := range rules {
+		if rule.Genre != "" && !strings.EqualFold(rule.Genre, genre) {
+			continue
+		}
+		multiplier = max(multiplier, rule.MultiplierPercent)
+	}
+	return multiplier
+}
+
+// 何円ごとに1ポイントか、LOYALTY_YEN_PER_POINTで変更(未設定は100円で1ポイント)
+func yenPerPoint() int {
+	if v, err := strconv.Atoi(os.Getenv("LOYALTY_YEN_PER_POINT")); err == nil && v > 0 {
+		return v
+	}
+	return 100
+}
+
+// 残高不足・失効・処理済みは利用者が状況を確認して再操作するものなので409にする
+func pointError(err error) error {
+	if errors.Is(err, repository.ErrInsufficientBalance) || errors.Is(err, repository.ErrExpired) ||
+		errors.Is(err, repository.ErrDuplicateEvent) {
+		return fmt.Errorf("%w: %v", ErrInvalidState, err)
+	}
+	return err
+}
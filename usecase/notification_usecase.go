@@ -0,0 +1,55 @@
+package usecase
+
+import (
+	"log"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/notification"
+	"record-shop-rest-api/repository"
+	"time"
+)
+
+type INotificationUsecase interface {
+	Send(userID uint, subject string, body string) error
+	GetOwnNotifications(userID uint) ([]model.Notification, error)
+	MarkRead(userID uint, id uint) error
+}
+
+type notificationUsecase struct {
+	nr        repository.INotificationRepository
+	ur        repository.IUserRepository
+	notifiers []notification.INotifier
+}
+
+func NewNotificationUsecase(nr repository.INotificationRepository, ur repository.IUserRepository,
+	notifiers []notification.INotifier) INotificationUsecase {
+	return &notificationUsecase{nr, ur, notifiers}
+}
+
+// 登録されている全てのチャネルに通知する
+// 1つのチャネルの失敗で他のチャネルへの通知を止めないように、失敗はログに残して続ける
+func (nu *notificationUsecase) Send(userID uint, subject string, body string) error {
+	user := model.User{}
+	if err := nu.ur.GetUserByID(&user, userID); err != nil {
+		return err
+	}
+	msg := notification.Message{
+		UserID:  userID,
+		Email:   user.Email,
+		Subject: subject,
+		Body:    body,
+	}
+	for _, notifier := range nu.notifiers {
+		if err := notifier.Notify(msg); err != nil {
+			log.Printf("notification via %s to user %d failed: %v", notifier.Channel(), userID, err)
+		}
+	}
+	return nil
+}
+
+func (nu *notificationUsecase) GetOwnNotifications(userID uint) ([]model.Notification, error) {
+	return nu.nr.GetNotificationsByUser(userID)
+}
+
+func (nu *notificationUsecase) MarkRead(userID uint, id uint) error {
+	return nu.nr.MarkRead(userID, id, time.Now())
+}
@@ -0,0 +1,110 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+
+	"gorm.io/gorm"
+)
+
+type IOrderUsecase interface {
+	CreateOrder(userID uint, req model.OrderRequest) (model.Order, error)
+	GetOwnOrders(userID uint) ([]model.Order, error)
+	GetOwnOrder(userID uint, id uint) (model.Order, error)
+	CancelOrder(userID uint, id uint) error
+}
+
+type orderUsecase struct {
+	or  repository.IOrderRepository
+	ov  validator.IOrderValidator
+	psr repository.IPosRepository
+	rr  repository.IRecordRepository
+	lu  ILoyaltyUsecase
+}
+
+func NewOrderUsecase(or repository.IOrderRepository, ov validator.IOrderValidator, psr repository.IPosRepository,
+	rr repository.IRecordRepository, lu ILoyaltyUsecase) IOrderUsecase {
+	return &orderUsecase{or, ov, psr, rr, lu}
+}
+
+// 注文の作成、売価はSKUごとの店頭価格を使いクライアントからは受取らない
+// 支払は作成した注文のIDを指定してPOST /paymentsで行う
+// 委託品(1点もの)はレジでのみ販売する
+func (ou *orderUsecase) CreateOrder(userID uint, req model.OrderRequest) (model.Order, error) {
+	if err := ou.ov.OrderValidate(req); err != nil {
+		return model.Order{}, err
+	}
+	order := model.Order{UserID: userID, Status: model.OrderPending}
+	for _, l := range req.Lines {
+		item := model.PosItem{}
+		if err := ou.psr.GetPosItemByCode(&item, l.SKU); err != nil {
+			return model.Order{}, fmt.Errorf("%s: %w", l.SKU, err)
+		}
+		if item.ConsignmentItemID != nil {
+			return model.Order{}, fmt.Errorf("%w: %s is a consigned item and is sold in store only", ErrInvalidState, l.SKU)
+		}
+		record := model.Record{}
+		if err := ou.rr.GetRecordByID(&record, item.RecordID); err != nil {
+			return model.Order{}, err
+		}
+		order.Lines = append(order.Lines, model.OrderLine{
+			PosItemID: item.ID,
+			RecordID:  item.RecordID,
+			Grade:     item.Grade,
+			SKU:       item.SKU,
+			Title:     record.Title,
+			UnitPrice: item.Price,
+			Quantity:  l.Quantity,
+		})
+		order.Total += item.Price * l.Quantity
+	}
+	if order.Total <= 0 {
+		return model.Order{}, fmt.Errorf("%w: order total must be positive", ErrInvalidState)
+	}
+	if err := ou.or.CreateOrder(&order); err != nil {
+		return model.Order{}, err
+	}
+	return order, nil
+}
+
+func (ou *orderUsecase) GetOwnOrders(userID uint) ([]model.Order, error) {
+	return ou.or.GetOrdersByUser(userID)
+}
+
+// 他人の注文は存在しないものとして扱う
+func (ou *orderUsecase) GetOwnOrder(userID uint, id uint) (model.Order, error) {
+	order := model.Order{}
+	if err := ou.or.GetOrderByID(&order, id); err != nil {
+		return model.Order{}, err
+	}
+	if order.UserID != userID {
+		return model.Order{}, gorm.ErrRecordNotFound
+	}
+	return order, nil
+}
+
+// 充当したポイントは取消した後に戻す(取消後は充当できないので、取消後の注文を読んで確認する)
+func (ou *orderUsecase) CancelOrder(userID uint, id uint) error {
+	if _, err := ou.GetOwnOrder(userID, id); err != nil {
+		return err
+	}
+	if err := ou.or.CancelOrder(userID, id); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return fmt.Errorf("%w: only unpaid orders can be cancelled", ErrInvalidState)
+		}
+		return err
+	}
+	order := model.Order{}
+	if err := ou.or.GetOrderByID(&order, id); err != nil {
+		return err
+	}
+	if order.PointsRedeemed > 0 {
+		if _, err := ou.lu.ReverseRedeem(userID, model.OrderPointReference(order.ID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
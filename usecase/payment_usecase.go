@@ -0,0 +1,353 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/payment"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+
+	"gorm.io/gorm"
+)
+
+type IPaymentUsecase interface {
+	Authorize(userID uint, req model.PaymentRequest) (model.PaymentResponse, error)
+	AuthorizeOrder(userID uint, order model.Order, cardToken string) (model.PaymentResponse, error)
+	AuthorizeAmount(userID uint, amount int, cardToken string) (model.PaymentResponse, error)
+	Capture(userID uint, id uint) (model.PaymentResponse, error)
+	Refund(id uint, req model.RefundRequest) (model.PaymentResponse, error)
+	RefundPayment(id uint, amount int) (model.PaymentResponse, error)
+	VoidPayment(id uint) (model.PaymentResponse, error)
+	HandleWebhook(payload []byte, signature string) error
+}
+
+type paymentUsecase struct {
+	pr repository.IPaymentRepository
+	pv validator.IPaymentValidator
+	pp payment.IPaymentProvider
+	or repository.IOrderRepository
+	lu ILoyaltyUsecase
+}
+
+func NewPaymentUsecase(pr repository.IPaymentRepository, pv validator.IPaymentValidator, pp payment.IPaymentProvider,
+	or repository.IOrderRepository, lu ILoyaltyUsecase) IPaymentUsecase {
+	return &paymentUsecase{pr, pv, pp, or, lu}
+}
+
+// 注文の支払、金額は注文の合計(充当したポイントを除く)でクライアントからは指定させない
+// 与信拒否の注文は別のカードで支払い直せる、非同期確認中(pending)の間は支払い直せない
+// 他人の注文は存在しないものとして扱う
+func (pu *paymentUsecase) Authorize(userID uint, req model.PaymentRequest) (model.PaymentResponse, error) {
+	if err := pu.pv.PaymentValidate(req); err != nil {
+		return model.PaymentResponse{
+			Error: &model.ErrorResponse{
+				Code:    "ValidationError",
+				Message: common.HandleValidationError(err),
+				Details: "Payment validation failed.",
+			},
+		}, err
+	}
+	order := model.Order{}
+	if err := pu.or.GetOrderByID(&order, req.OrderID); err != nil {
+		return model.PaymentResponse{}, err
+	}
+	if order.UserID != userID {
+		return model.PaymentResponse{}, gorm.ErrRecordNotFound
+	}
+	if order.AuctionListingID != nil {
+		stateErr := fmt.Errorf("order is paid from the auction checkout of listing %d", *order.AuctionListingID)
+		return model.PaymentResponse{Error: invalidPaymentStateError(stateErr)}, stateErr
+	}
+	return pu.AuthorizeOrder(userID, order, req.CardToken)
+}
+
+// 読込み・本人確認済みの注文の与信、支払待ちか与信拒否の注文のみ
+func (pu *paymentUsecase) AuthorizeOrder(userID uint, order model.Order, cardToken string) (model.PaymentResponse, error) {
+	if !(order.Status == model.OrderPending && order.PaymentID == nil) && order.Status != model.OrderPaymentFailed {
+		stateErr := fmt.Errorf("order is %s", order.Status)
+		return model.PaymentResponse{Error: invalidPaymentStateError(stateErr)}, stateErr
+	}
+	newPayment, err := pu.authorize(userID, &order.ID, order.AmountDue(), cardToken)
+	if err != nil {
+		return model.PaymentResponse{}, err
+	}
+	if err := pu.pr.AttachOrderPayment(&newPayment); err != nil {
+		// 同時に別の決済で支払われた、こちらの与信は売上確定しないままプロバイダ側で期限切れになる
+		if errors.Is(err, repository.ErrStaleObject) {
+			stateErr := fmt.Errorf("order is already being paid")
+			return model.PaymentResponse{Error: invalidPaymentStateError(stateErr)}, stateErr
+		}
+		return model.PaymentResponse{}, err
+	}
+	return toPaymentResponse(newPayment), nil
+}
+
+// 注文に紐付かない決済、レジ・予約の内金など金額をサーバ側で決める処理から呼ぶ
+// クライアントから金額を受取るエンドポイントからは呼ばない
+func (pu *paymentUsecase) AuthorizeAmount(userID uint, amount int, cardToken string) (model.PaymentResponse, error) {
+	newPayment, err := pu.authorize(userID, nil, amount, cardToken)
+	if err != nil {
+		return model.PaymentResponse{}, err
+	}
+	return toPaymentResponse(newPayment), nil
+}
+
+// 拒否された場合も履歴として残す
+func (pu *paymentUsecase) authorize(userID uint, orderID *uint, amount int, cardToken string) (model.Payment, error) {
+	result, err := pu.pp.Authorize(payment.AuthorizeRequest{
+		Amount:    amount,
+		Currency:  "JPY",
+		CardToken: cardToken,
+	})
+	if err != nil {
+		return model.Payment{}, err
+	}
+	newPayment := model.Payment{
+		UserID:            userID,
+		OrderID:           orderID,
+		Amount:            amount,
+		Currency:          "JPY",
+		Provider:          pu.pp.Name(),
+		ProviderPaymentID: result.ProviderPaymentID,
+		Status:            result.Status,
+		DeclineReason:     result.DeclineReason,
+	}
+	if err := pu.pr.CreatePayment(&newPayment); err != nil {
+		return model.Payment{}, err
+	}
+	return newPayment, nil
+}
+
+// 他人の決済は存在しないものとして扱う
+// プロバイダへの確定はDBのロックの外で行う、同時の確定はプロバイダ側で2回目が拒否される
+// 確定後のDBへの反映に失敗しても、プロバイダからのwebhook(payment.captured)で追いつく
+func (pu *paymentUsecase) Capture(userID uint, id uint) (model.PaymentResponse, error) {
+	storedPayment := model.Payment{}
+	if err := pu.pr.GetPaymentByID(&storedPayment, id); err != nil {
+		return model.PaymentResponse{}, err
+	}
+	if storedPayment.UserID != userID {
+		return model.PaymentResponse{}, gorm.ErrRecordNotFound
+	}
+	if storedPayment.Status != payment.StatusAuthorized {
+		stateErr := fmt.Errorf("payment is %s", storedPayment.Status)
+		return model.PaymentResponse{Error: invalidPaymentStateError(stateErr)}, stateErr
+	}
+	if err := pu.pp.Capture(storedPayment.ProviderPaymentID); err != nil {
+		return model.PaymentResponse{}, err
+	}
+	// webhookが先に届いて確定済みになっていれば、そのまま
+	err := pu.pr.LockPayment(id, func(p *model.Payment) error {
+		if p.Status == payment.StatusAuthorized {
+			p.Status = payment.StatusCaptured
+		}
+		storedPayment = *p
+		return nil
+	})
+	if err != nil {
+		return model.PaymentResponse{}, err
+	}
+	pu.earnPoints(storedPayment)
+	return toPaymentResponse(storedPayment), nil
+}
+
+// オンライン注文の支払の売上確定時にポイントを付与する
+// 確定は完了しているので、付与に失敗してもログに残すだけにする(付与済み・対象外は何もしない)
+func (pu *paymentUsecase) earnPoints(p model.Payment) {
+	if p.OrderID == nil || p.Status != payment.StatusCaptured {
+		return
+	}
+	if _, err := pu.lu.EarnForOrder(p.ID); err != nil && !errors.Is(err, ErrInvalidState) {
+		log.Printf("earning points for payment %d failed: %v", p.ID, err)
+	}
+}
+
+// スタッフ用、顧客の決済を返金する
+// 顧客からの返金の依頼は返品(RMA)の承認を経て、返品の受領時にRefundPaymentで返金する
+// 返金した割合に応じて付与済みのポイントを取消す
+func (pu *paymentUsecase) Refund(id uint, req model.RefundRequest) (model.PaymentResponse, error) {
+	if err := pu.pv.RefundValidate(req); err != nil {
+		return model.PaymentResponse{
+			Error: &model.ErrorResponse{
+				Code:    "ValidationError",
+				Message: common.HandleValidationError(err),
+				Details: "Refund validation failed.",
+			},
+		}, err
+	}
+	paymentRes, err := pu.RefundPayment(id, req.Amount)
+	if err != nil {
+		return paymentRes, err
+	}
+	// 返金は完了しているので、ポイントの取消に失敗してもログに残すだけにする
+	if err := pu.lu.ClawbackForRefund(id); err != nil {
+		log.Printf("point clawback for payment %d failed: %v", id, err)
+	}
+	return paymentRes, nil
+}
+
+// 所有者のチェックをせずに売上確定前の与信を取消す、予約の取消など店舗側の処理から呼ぶ
+// 同時の確定とはプロバイダ側で片方が拒否されるので、取消に成功した場合のみ反映する
+func (pu *paymentUsecase) VoidPayment(id uint) (model.PaymentResponse, error) {
+	storedPayment := model.Payment{}
+	if err := pu.pr.GetPaymentByID(&storedPayment, id); err != nil {
+		return model.PaymentResponse{}, err
+	}
+	if storedPayment.Status != payment.StatusAuthorized {
+		stateErr := fmt.Errorf("payment is %s", storedPayment.Status)
+		return model.PaymentResponse{Error: invalidPaymentStateError(stateErr)}, stateErr
+	}
+	if err := pu.pp.Void(storedPayment.ProviderPaymentID); err != nil {
+		return model.PaymentResponse{}, err
+	}
+	err := pu.pr.LockPayment(id, func(p *model.Payment) error {
+		if p.Status == payment.StatusAuthorized {
+			p.Status = payment.StatusVoided
+		}
+		storedPayment = *p
+		return nil
+	})
+	if err != nil {
+		return model.PaymentResponse{}, err
+	}
+	return toPaymentResponse(storedPayment), nil
+}
+
+// 所有者のチェックをせずに返金する、返品の承認など店舗側の処理から呼ぶ
+// 決済行をロックして返金額を予約(PendingRefundAmount)してから、ロックの外でプロバイダに返金を依頼する
+// 同時の返金で返金累計が決済額を超えないように、予約中の額も含めて確認する
+// 依頼の結果で予約を返金累計に移すか解除する、webhook(payment.refunded)が先に届いて移し済みならそのまま
+func (pu *paymentUsecase) RefundPayment(id uint, amount int) (model.PaymentResponse, error) {
+	var stateErr error
+	storedPayment := model.Payment{}
+	err := pu.pr.LockPayment(id, func(p *model.Payment) error {
+		if p.Status != payment.StatusCaptured {
+			stateErr = fmt.Errorf("payment is %s", p.Status)
+			return stateErr
+		}
+		if p.RefundedAmount+p.PendingRefundAmount+amount > p.Amount {
+			stateErr = fmt.Errorf("refund amount exceeds captured amount")
+			return stateErr
+		}
+		p.PendingRefundAmount += amount
+		storedPayment = *p
+		return nil
+	})
+	if stateErr != nil {
+		return model.PaymentResponse{Error: invalidPaymentStateError(stateErr)}, stateErr
+	}
+	if err != nil {
+		return model.PaymentResponse{}, err
+	}
+	refundErr := pu.pp.Refund(storedPayment.ProviderPaymentID, amount)
+	err = pu.pr.LockPayment(id, func(p *model.Payment) error {
+		settled := min(amount, p.PendingRefundAmount)
+		p.PendingRefundAmount -= settled
+		if refundErr == nil {
+			p.RefundedAmount = min(p.RefundedAmount+settled, p.Amount)
+			if p.RefundedAmount == p.Amount {
+				p.Status = payment.StatusRefunded
+			}
+		}
+		storedPayment = *p
+		return nil
+	})
+	if refundErr != nil {
+		if err != nil {
+			log.Printf("releasing refund reservation of payment %d failed: %v", id, err)
+		}
+		return model.PaymentResponse{}, refundErr
+	}
+	if err != nil {
+		// 返金はプロバイダ側で完了している、予約のまま残った分はwebhookで反映される
+		log.Printf("recording refund of payment %d failed: %v", id, err)
+		return model.PaymentResponse{}, err
+	}
+	return toPaymentResponse(storedPayment), nil
+}
+
+// プロバイダからのwebhookを反映する
+// 同じイベントが何度届いても結果が変わらないように(冪等)
+//   - 処理済みのEventIDは無視する
+//   - 既に先の状態に進んでいる場合は何もしない(イベントの到着順が前後しても巻き戻らない)
+func (pu *paymentUsecase) HandleWebhook(payload []byte, signature string) error {
+	event, err := pu.pp.VerifyWebhook(payload, signature)
+	if err != nil {
+		return err
+	}
+	paymentEvent := model.PaymentEvent{EventID: event.EventID, Type: event.Type}
+	var applied model.Payment
+	err = pu.pr.ApplyEvent(event.ProviderPaymentID, &paymentEvent, func(p *model.Payment) error {
+		applyPaymentEvent(p, event)
+		applied = *p
+		return nil
+	})
+	if errors.Is(err, repository.ErrDuplicateEvent) {
+		log.Printf("payment webhook %s already processed", event.EventID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	// 確定をこちらのDBに反映できなかった場合は、webhookで確定した時に付与する
+	if event.Type == payment.EventCaptured {
+		pu.earnPoints(applied)
+	}
+	return nil
+}
+
+// 状態遷移表
+// pending -> authorized | declined
+// authorized -> captured
+// captured -> refunded
+func applyPaymentEvent(p *model.Payment, event payment.WebhookEvent) {
+	switch event.Type {
+	case payment.EventAuthorized:
+		if p.Status == payment.StatusPending {
+			p.Status = payment.StatusAuthorized
+		}
+	case payment.EventDeclined:
+		if p.Status == payment.StatusPending {
+			p.Status = payment.StatusDeclined
+		}
+	case payment.EventCaptured:
+		if p.Status == payment.StatusAuthorized {
+			p.Status = payment.StatusCaptured
+		}
+	case payment.EventRefunded:
+		// Amountはその時点での返金累計なので、大きい方を採用すれば二重計上にならない
+		// 増えた分はこちらから依頼中の返金なので、予約から差引く
+		if p.Status == payment.StatusCaptured && event.Amount > p.RefundedAmount {
+			p.PendingRefundAmount -= min(event.Amount-p.RefundedAmount, p.PendingRefundAmount)
+			p.RefundedAmount = min(event.Amount, p.Amount)
+			if p.RefundedAmount == p.Amount {
+				p.Status = payment.StatusRefunded
+			}
+		}
+	default:
+		log.Printf("unknown payment webhook type: %s", event.Type)
+	}
+}
+
+func invalidPaymentStateError(err error) *model.ErrorResponse {
+	return &model.ErrorResponse{
+		Code:    "InvalidState",
+		Message: err.Error(),
+		Details: "The payment cannot be changed in its current status.",
+	}
+}
+
+func toPaymentResponse(p model.Payment) model.PaymentResponse {
+	return model.PaymentResponse{
+		ID:             p.ID,
+		OrderID:        p.OrderID,
+		Amount:         p.Amount,
+		RefundedAmount: p.RefundedAmount,
+		Currency:       p.Currency,
+		Status:         p.Status,
+		DeclineReason:  p.DeclineReason,
+	}
+}
@@ -0,0 +1,515 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/payment"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IPosUsecase interface {
+	CreatePosItem(item model.PosItem) (model.PosItem, error)
+	GetPosItemByCode(code string) (model.PosItem, error)
+	Sell(staffID uint, req model.PosSaleRequest) (model.PosSale, error)
+	GetPosSale(id uint) (model.PosSale, error)
+	Void(staffID uint, id uint) (model.PosSale, error)
+	Return(staffID uint, id uint, req model.PosReturnRequest) (model.PosReturn, error)
+}
+
+type posUsecase struct {
+	pr  repository.IPosRepository
+	pv  validator.IPosValidator
+	rr  repository.IRecordRepository
+	iu  IInventoryUsecase
+	pu  IPaymentUsecase
+	gu  IGiftCardUsecase
+	pmu IPromotionUsecase
+	ur  repository.IUserRepository
+	lu  ILoyaltyUsecase
+	tu  ITaxUsecase
+	cu  IConsignmentUsecase
+}
+
+func NewPosUsecase(pr repository.IPosRepository, pv validator.IPosValidator, rr repository.IRecordRepository,
+	iu IInventoryUsecase, pu IPaymentUsecase, gu IGiftCardUsecase, pmu IPromotionUsecase,
+	ur repository.IUserRepository, lu ILoyaltyUsecase, tu ITaxUsecase, cu IConsignmentUsecase) IPosUsecase {
+	return &posUsecase{pr, pv, rr, iu, pu, gu, pmu, ur, lu, tu, cu}
+}
+
+func (pu *posUsecase) CreatePosItem(item model.PosItem) (model.PosItem, error) {
+	if err := pu.pv.PosItemValidate(item); err != nil {
+		return model.PosItem{}, err
+	}
+	if err := pu.rr.GetRecordByID(&model.Record{}, item.RecordID); err != nil {
+		return model.PosItem{}, err
+	}
+	// 委託品のSKUは、販売中の委託品と同じレコード・盤質でのみ登録できる
+	if item.ConsignmentItemID != nil {
+		consigned, err := pu.cu.GetItem(*item.ConsignmentItemID)
+		if err != nil {
+			return model.PosItem{}, fmt.Errorf("consignment item: %w", err)
+		}
+		if consigned.Status != model.ConsignmentAvailable {
+			return model.PosItem{}, fmt.Errorf("%w: consignment item is %s", ErrInvalidState, consigned.Status)
+		}
+		if consigned.RecordID != item.RecordID || consigned.Grade != item.Grade {
+			return model.PosItem{}, fmt.Errorf("%w: record or grade does not match the consignment item", ErrInvalidState)
+		}
+	}
+	newItem := model.PosItem{
+		SKU:               item.SKU,
+		Barcode:           item.Barcode,
+		RecordID:          item.RecordID,
+		Grade:             item.Grade,
+		Format:            item.Format,
+		Condition:         item.Condition,
+		Price:             item.Price,
+		ConsignmentItemID: item.ConsignmentItemID,
+	}
+	if err := pu.pr.CreatePosItem(&newItem); err != nil {
+		return model.PosItem{}, err
+	}
+	return newItem, nil
+}
+
+func (pu *posUsecase) GetPosItemByCode(code string) (model.PosItem, error) {
+	item := model.PosItem{}
+	if err := pu.pr.GetPosItemByCode(&item, code); err != nil {
+		return model.PosItem{}, err
+	}
+	return item, nil
+}
+
+// レジでの販売
+// プロモーションの値引を計算して利用回数を加算し、在庫を引当ててから、ギフトカード -> カード -> 現金の順に支払を充当する
+// 会員を指定した場合は、完了後に販売の記録からポイントを付与する
+// 委託品は在庫台帳ではなく、委託品の販売として値引後の金額で記録する
+// 途中で失敗した場合は、それまでに行ったプロモーションの利用・在庫の引当・委託品の販売・ギフトカードの充当を戻して販売をfailedにする
+func (pu *posUsecase) Sell(staffID uint, req model.PosSaleRequest) (model.PosSale, error) {
+	if err := pu.pv.PosSaleValidate(req); err != nil {
+		return model.PosSale{}, err
+	}
+	if req.CustomerID != nil {
+		if err := pu.ur.GetUserByID(&model.User{}, *req.CustomerID); err != nil {
+			return model.PosSale{}, fmt.Errorf("customer: %w", err)
+		}
+	}
+	sale := model.PosSale{
+		LocationID: req.LocationID,
+		CustomerID: req.CustomerID,
+		Status:     model.PosSalePending,
+		CreatedBy:  staffID,
+	}
+	var pricingLines []model.LineItem
+	for _, l := range req.Lines {
+		item := model.PosItem{}
+		if err := pu.pr.GetPosItemByCode(&item, l.Code); err != nil {
+			return model.PosSale{}, fmt.Errorf("%s: %w", l.Code, err)
+		}
+		if item.ConsignmentItemID != nil && l.Quantity != 1 {
+			return model.PosSale{}, fmt.Errorf("%w: %s is a consigned item and can only be sold one at a time", ErrInvalidState, l.Code)
+		}
+		record := model.Record{}
+		if err := pu.rr.GetRecordByID(&record, item.RecordID); err != nil {
+			return model.PosSale{}, err
+		}
+		sale.Lines = append(sale.Lines, model.PosSaleLine{
+			PosItemID:         item.ID,
+			RecordID:          item.RecordID,
+			Grade:             item.Grade,
+			SKU:               item.SKU,
+			Title:             record.Title,
+			UnitPrice:         item.Price,
+			Quantity:          l.Quantity,
+			ConsignmentItemID: item.ConsignmentItemID,
+		})
+		// 値引の対象の判定には、スキャンした商品の登録内容を使う
+		pricingLines = append(pricingLines, model.LineItem{
+			RecordID:  item.RecordID,
+			Genre:     record.Genre,
+			Format:    item.Format,
+			Condition: item.Condition,
+			UnitPrice: item.Price,
+			Quantity:  l.Quantity,
+		})
+	}
+	pricing, err := pu.pmu.Evaluate(model.PricingRequest{Lines: pricingLines, Codes: req.PromotionCodes})
+	if err != nil {
+		return model.PosSale{}, err
+	}
+	// 入力されたクーポンが存在しない・期間外の場合は、打ち間違いの可能性があるので販売しない
+	for _, skipped := range pricing.Skipped {
+		if skipped.PromotionID == 0 {
+			return model.PosSale{}, fmt.Errorf("%w: promotion code %s: %s", ErrInvalidState, skipped.Code, skipped.Reason)
+		}
+	}
+	sale.Subtotal = pricing.Subtotal
+	sale.Discount = pricing.Discount
+	sale.Total = pricing.Total
+	allocatePosDiscount(sale.Lines, sale.Discount)
+	for _, applied := range pricing.Applied {
+		sale.Discounts = append(sale.Discounts, model.PosSaleDiscount{
+			PromotionID: applied.PromotionID,
+			Name:        applied.Name,
+			Code:        applied.Code,
+			Amount:      applied.Amount,
+		})
+	}
+	// 売価は税込なので、値引後の明細の金額から税率ごとに内税で計算する
+	var taxLines []model.TaxLineItem
+	for _, line := range sale.Lines {
+		taxLines = append(taxLines, model.TaxLineItem{LineItem: model.LineItem{
+			RecordID:  line.RecordID,
+			UnitPrice: line.UnitPrice*line.Quantity - line.Discount,
+			Quantity:  1,
+		}})
+	}
+	taxRes, err := pu.tu.Calculate(model.TaxRequest{Lines: taxLines, PricesIncludeTax: true})
+	if err != nil {
+		return model.PosSale{}, err
+	}
+	for _, breakdown := range taxRes.Breakdown {
+		sale.Taxes = append(sale.Taxes, model.PosSaleTax{
+			TaxCategory:        breakdown.TaxCategory,
+			Percent:            breakdown.Percent,
+			AmountExcludingTax: breakdown.AmountExcludingTax,
+			Tax:                breakdown.Tax,
+			AmountIncludingTax: breakdown.AmountIncludingTax,
+		})
+	}
+	// ギフトカードを使わない場合は、在庫を引当てる前に支払が足りるか確認できる
+	if req.CardAmount > sale.Total {
+		return model.PosSale{}, fmt.Errorf("%w: card amount exceeds total %d", ErrInvalidState, sale.Total)
+	}
+	if len(req.GiftCardCodes) == 0 && req.CardAmount+req.CashReceived < sale.Total {
+		return model.PosSale{}, fmt.Errorf("%w: payment is short by %d", ErrInvalidState, sale.Total-req.CardAmount-req.CashReceived)
+	}
+	if err := pu.pr.CreatePosSale(&sale); err != nil {
+		return model.PosSale{}, err
+	}
+	reference := posSaleReference(sale.ID)
+	redeemed := false
+	stocked := false
+	var consigned []uint
+	fail := func(cause error) (model.PosSale, error) {
+		for _, id := range consigned {
+			if _, err := pu.cu.CancelSale(staffID, id, "pos sale failed"); err != nil {
+				cause = errors.Join(cause, err)
+			}
+		}
+		if redeemed {
+			if err := pu.pmu.Release(reference); err != nil {
+				cause = errors.Join(cause, err)
+			}
+		}
+		if sale.GiftCardAmount > 0 {
+			if _, err := pu.gu.ReverseTender(staffID, reference); err != nil {
+				cause = errors.Join(cause, err)
+			}
+		}
+		if stocked {
+			if err := pu.iu.ApplyMovements(posSaleMovements(sale, staffID, 1, model.MovementAdjust, "pos sale failed")); err != nil {
+				cause = errors.Join(cause, err)
+			}
+		}
+		sale.Status = model.PosSaleFailed
+		sale.FailureReason = cause.Error()
+		if err := pu.pr.UpdatePosSale(&sale, model.PosSalePending); err != nil {
+			cause = errors.Join(cause, err)
+		}
+		return model.PosSale{}, cause
+	}
+
+	// 利用上限は他の販売と取り合いになるので、在庫より先に確保する
+	if err := pu.pmu.Redeem(pricing.Applied, req.CustomerID, reference); err != nil {
+		return fail(err)
+	}
+	redeemed = len(pricing.Applied) > 0
+	if err := pu.iu.ApplyMovements(posSaleMovements(sale, staffID, -1, model.MovementSale, "")); err != nil {
+		return fail(err)
+	}
+	stocked = true
+	for _, line := range sale.Lines {
+		if line.ConsignmentItemID == nil {
+			continue
+		}
+		if _, err := pu.cu.RecordSale(staffID, *line.ConsignmentItemID, line.UnitPrice-line.Discount,
+			fmt.Sprintf("pos sale #%d", sale.ID)); err != nil {
+			return fail(err)
+		}
+		consigned = append(consigned, *line.ConsignmentItemID)
+	}
+	// 全額値引された場合はギフトカードを使わない
+	if len(req.GiftCardCodes) > 0 && sale.Total > 0 {
+		tenderRes, err := pu.gu.Tender(staffID, model.TenderRequest{
+			AmountDue:     sale.Total,
+			GiftCardCodes: req.GiftCardCodes,
+			Reference:     reference,
+		})
+		if err != nil {
+			return fail(err)
+		}
+		sale.GiftCardAmount = sale.Total - tenderRes.RemainingDue
+	}
+	remaining := sale.Total - sale.GiftCardAmount
+	if req.CardAmount > remaining {
+		return fail(fmt.Errorf("%w: card amount exceeds amount due %d", ErrInvalidState, remaining))
+	}
+	cashDue := remaining - req.CardAmount
+	if req.CashReceived < cashDue {
+		return fail(fmt.Errorf("%w: cash is short by %d", ErrInvalidState, cashDue-req.CashReceived))
+	}
+	if req.CardAmount > 0 {
+		authRes, err := pu.pu.AuthorizeAmount(staffID, req.CardAmount, req.CardToken)
+		if err != nil {
+			return fail(err)
+		}
+		// レジではその場で支払を確定するので、非同期確認(pending)は失敗として扱う
+		if authRes.Status != payment.StatusAuthorized {
+			return fail(fmt.Errorf("%w: card payment is %s %s", ErrInvalidState, authRes.Status, authRes.DeclineReason))
+		}
+		sale.CardPaymentID = &authRes.ID
+		if _, err := pu.pu.Capture(staffID, authRes.ID); err != nil {
+			return fail(err)
+		}
+		sale.CardAmount = req.CardAmount
+	}
+	sale.CashAmount = cashDue
+	sale.CashReceived = req.CashReceived
+	sale.Change = req.CashReceived - cashDue
+	sale.Status = model.PosSaleCompleted
+	if err := pu.pr.UpdatePosSale(&sale, model.PosSalePending); err != nil {
+		if sale.CardAmount > 0 {
+			if _, refundErr := pu.pu.RefundPayment(*sale.CardPaymentID, sale.CardAmount); refundErr != nil {
+				err = errors.Join(err, refundErr)
+			}
+		}
+		return fail(err)
+	}
+	// 会員を指定した販売はポイントを付与する、販売は完了しているので失敗してもログに残すだけにする
+	if sale.CustomerID != nil {
+		if _, err := pu.lu.EarnForPosSale(sale.ID); err != nil && !errors.Is(err, ErrInvalidState) {
+			log.Printf("point earn for pos sale %d failed: %v", sale.ID, err)
+		}
+	}
+	return sale, nil
+}
+
+func (pu *posUsecase) GetPosSale(id uint) (model.PosSale, error) {
+	sale := model.PosSale{}
+	if err := pu.pr.GetPosSaleByID(&sale, id); err != nil {
+		return model.PosSale{}, err
+	}
+	return sale, nil
+}
+
+// レジでの販売取消、打ち間違いやその場でのキャンセル用なので販売当日かつ返品前のみ
+// カードは全額返金、ギフトカードは残高に戻し、現金はCashAmountをお返しする
+func (pu *posUsecase) Void(staffID uint, id uint) (model.PosSale, error) {
+	sale := model.PosSale{}
+	if err := pu.pr.GetPosSaleByID(&sale, id); err != nil {
+		return model.PosSale{}, err
+	}
+	if sale.Status != model.PosSaleCompleted {
+		return model.PosSale{}, fmt.Errorf("%w: sale is %s", ErrInvalidState, sale.Status)
+	}
+	if sale.RefundedAmount > 0 {
+		return model.PosSale{}, fmt.Errorf("%w: sale has returns", ErrInvalidState)
+	}
+	now := time.Now()
+	if y, m, d := sale.CreatedAt.Date(); y != now.Year() || m != now.Month() || d != now.Day() {
+		return model.PosSale{}, fmt.Errorf("%w: only today's sales can be voided", ErrInvalidState)
+	}
+	sale.Status = model.PosSaleVoided
+	sale.VoidedBy = &staffID
+	sale.VoidedAt = &now
+	if err := pu.pr.UpdatePosSale(&sale, model.PosSaleCompleted); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.PosSale{}, fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		return model.PosSale{}, err
+	}
+	// カードの返金はプロバイダ側で失敗しうるので先に行い、失敗したら取消を戻す
+	if sale.CardAmount > 0 {
+		if _, refundErr := pu.pu.RefundPayment(*sale.CardPaymentID, sale.CardAmount); refundErr != nil {
+			sale.Status = model.PosSaleCompleted
+			sale.VoidedBy = nil
+			sale.VoidedAt = nil
+			if err := pu.pr.UpdatePosSale(&sale, model.PosSaleVoided); err != nil {
+				return model.PosSale{}, errors.Join(refundErr, err)
+			}
+			return model.PosSale{}, refundErr
+		}
+	}
+	// 返金は済んでいるので、ここから先が失敗しても取消は戻さずログに残して手動で直す
+	if sale.GiftCardAmount > 0 {
+		// ギフトカードの取引は販売したスタッフの操作として記録されている
+		if _, err := pu.gu.ReverseTender(sale.CreatedBy, posSaleReference(sale.ID)); err != nil {
+			log.Printf("gift card reversal for pos sale %d failed: %v", sale.ID, err)
+		}
+	}
+	if err := pu.iu.ApplyMovements(posSaleMovements(sale, staffID, 1, model.MovementVoid, "")); err != nil {
+		log.Printf("restock for voided pos sale %d failed: %v", sale.ID, err)
+	}
+	for _, line := range sale.Lines {
+		if line.ConsignmentItemID == nil {
+			continue
+		}
+		if _, err := pu.cu.CancelSale(staffID, *line.ConsignmentItemID, fmt.Sprintf("pos sale #%d voided", sale.ID)); err != nil {
+			log.Printf("consignment cancel for voided pos sale %d failed: %v", sale.ID, err)
+		}
+	}
+	// 取消した販売で使ったクーポンは、もう一度使えるように戻す
+	if err := pu.pmu.Release(posSaleReference(sale.ID)); err != nil {
+		log.Printf("promotion release for voided pos sale %d failed: %v", sale.ID, err)
+	}
+	if err := pu.lu.ClawbackForPosSale(sale.ID); err != nil {
+		log.Printf("point clawback for voided pos sale %d failed: %v", sale.ID, err)
+	}
+	return sale, nil
+}
+
+// レジでの返品、明細ごとに数量を指定する
+// 返品した分は販売した拠点の在庫に戻し、カードで払った分はカードに、ギフトカードで払った分はギフトカードに、残りは現金で返す
+func (pu *posUsecase) Return(staffID uint, id uint, req model.PosReturnRequest) (model.PosReturn, error) {
+	if err := pu.pv.PosReturnValidate(req); err != nil {
+		return model.PosReturn{}, err
+	}
+	sale := model.PosSale{}
+	if err := pu.pr.GetPosSaleByID(&sale, id); err != nil {
+		return model.PosReturn{}, err
+	}
+	if sale.Status != model.PosSaleCompleted {
+		return model.PosReturn{}, fmt.Errorf("%w: sale is %s", ErrInvalidState, sale.Status)
+	}
+	var line *model.PosSaleLine
+	for i := range sale.Lines {
+		if sale.Lines[i].ID == req.LineID {
+			line = &sale.Lines[i]
+		}
+	}
+	if line == nil {
+		return model.PosReturn{}, gorm.ErrRecordNotFound
+	}
+	if line.ReturnedQuantity+req.Quantity > line.Quantity {
+		return model.PosReturn{}, fmt.Errorf("%w: only %d left to return", ErrInvalidState, line.Quantity-line.ReturnedQuantity)
+	}
+	ret := model.PosReturn{
+		PosSaleID:     sale.ID,
+		PosSaleLineID: line.ID,
+		Quantity:      req.Quantity,
+		CreatedBy:     staffID,
+	}
+	if err := pu.pr.CreatePosReturn(&ret); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.PosReturn{}, fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		return model.PosReturn{}, err
+	}
+	cancel := func(cause error) error {
+		if err := pu.pr.CancelPosReturn(&ret); err != nil {
+			return errors.Join(cause, err)
+		}
+		return cause
+	}
+	// 委託品は在庫に戻す代わりに販売を取消して販売中に戻し、返金に失敗したら販売を記録し直す
+	restock := func(delta int, reason string, note string) error {
+		if line.ConsignmentItemID != nil {
+			if delta > 0 {
+				_, err := pu.cu.CancelSale(staffID, *line.ConsignmentItemID, fmt.Sprintf("pos return #%d", ret.ID))
+				return err
+			}
+			_, err := pu.cu.RecordSale(staffID, *line.ConsignmentItemID, line.UnitPrice-line.Discount,
+				fmt.Sprintf("pos sale #%d", sale.ID))
+			return err
+		}
+		return pu.iu.ApplyMovements([]model.StockMovement{{
+			LocationID:    sale.LocationID,
+			RecordID:      line.RecordID,
+			Grade:         line.Grade,
+			Delta:         delta,
+			Reason:        reason,
+			ReferenceType: "pos_return",
+			ReferenceID:   ret.ID,
+			ActorID:       staffID,
+			Note:          note,
+		}})
+	}
+	if err := restock(req.Quantity, model.MovementReturnRestock, ""); err != nil {
+		return model.PosReturn{}, cancel(err)
+	}
+	if ret.CardRefund > 0 {
+		if _, refundErr := pu.pu.RefundPayment(*sale.CardPaymentID, ret.CardRefund); refundErr != nil {
+			if err := restock(-req.Quantity, model.MovementAdjust, "refund failed"); err != nil {
+				refundErr = errors.Join(refundErr, err)
+			}
+			return model.PosReturn{}, cancel(refundErr)
+		}
+	}
+	// カードの返金は済んでいるので、ギフトカードへの返金に失敗しても返品は戻さずログに残して手動で直す
+	// ギフトカードの取引は販売したスタッフの操作として記録されている
+	if ret.GiftCardRefund > 0 {
+		if _, err := pu.gu.RefundTender(sale.CreatedBy, posSaleReference(sale.ID), ret.GiftCardRefund, staffID); err != nil {
+			log.Printf("gift card refund of %d for pos return %d failed: %v", ret.GiftCardRefund, ret.ID, err)
+		}
+	}
+	// 返金は完了しているので、ポイントの取消に失敗しても返品は戻さない
+	if err := pu.lu.ClawbackForPosSale(sale.ID); err != nil {
+		log.Printf("point clawback for pos sale %d failed: %v", sale.ID, err)
+	}
+	return ret, nil
+}
+
+// ギフトカードの充当・取消で使う支払の識別子
+func posSaleReference(id uint) string {
+	return fmt.Sprintf("pos_sale:%d", id)
+}
+
+// 値引額を明細の金額で按分してDiscountに割当てる、端数は最後の明細に寄せる
+func allocatePosDiscount(lines []model.PosSaleLine, discount int) {
+	subtotal := 0
+	for _, line := range lines {
+		subtotal += line.UnitPrice * line.Quantity
+	}
+	if subtotal == 0 {
+		return
+	}
+	remaining := discount
+	for i := range lines {
+		if i == len(lines)-1 {
+			lines[i].Discount = remaining
+			break
+		}
+		lines[i].Discount = discount * lines[i].UnitPrice * lines[i].Quantity / subtotal
+		remaining -= lines[i].Discount
+	}
+}
+
+// 販売の明細ごとの在庫移動、sign: -1で出庫、1で戻し
+// 委託品は在庫台帳で管理していないので含めない
+func posSaleMovements(sale model.PosSale, actorID uint, sign int, reason string, note string) []model.StockMovement {
+	var movements []model.StockMovement
+	for _, line := range sale.Lines {
+		if line.ConsignmentItemID != nil {
+			continue
+		}
+		movements = append(movements, model.StockMovement{
+			LocationID:    sale.LocationID,
+			RecordID:      line.RecordID,
+			Grade:         line.Grade,
+			Delta:         sign * line.Quantity,
+			Reason:        reason,
+			ReferenceType: "pos_sale",
+			ReferenceID:   sale.ID,
+			ActorID:       actorID,
+			Note:          note,
+		})
+	}
+	return movements
+}
@@ -0,0 +1,199 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/payment"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IPreOrderUsecase interface {
+	CreatePreOrder(userID uint, req model.PreOrderRequest) (model.PreOrder, error)
+	GetOwnPreOrders(userID uint) ([]model.PreOrder, error)
+	CancelPreOrder(userID uint, id uint) error
+	RegisterArrival(staffID uint, recordID uint, req model.PreOrderArrivalRequest) (model.PreOrderArrival, error)
+	AllocateArrivals() (int, error)
+	StartAllocationJob(interval time.Duration)
+}
+
+type preOrderUsecase struct {
+	por repository.IPreOrderRepository
+	pov validator.IPreOrderValidator
+	rr  repository.IRecordRepository
+	pr  repository.IPaymentRepository
+	pu  IPaymentUsecase
+	ir  repository.IInventoryRepository
+	wu  IWantListUsecase
+}
+
+func NewPreOrderUsecase(por repository.IPreOrderRepository, pov validator.IPreOrderValidator, rr repository.IRecordRepository,
+	pr repository.IPaymentRepository, pu IPaymentUsecase, ir repository.IInventoryRepository, wu IWantListUsecase) IPreOrderUsecase {
+	return &preOrderUsecase{por, pov, rr, pr, pu, ir, wu}
+}
+
+func (pu *preOrderUsecase) CreatePreOrder(userID uint, req model.PreOrderRequest) (model.PreOrder, error) {
+	if err := pu.pov.PreOrderValidate(req); err != nil {
+		return model.PreOrder{}, err
+	}
+	record := model.Record{}
+	if err := pu.rr.GetRecordByID(&record, req.RecordID); err != nil {
+		return model.PreOrder{}, err
+	}
+	if !record.PreOrder {
+		return model.PreOrder{}, fmt.Errorf("%w: record is not open for pre-order", ErrInvalidState)
+	}
+	newPreOrder := model.PreOrder{
+		UserID:   userID,
+		RecordID: req.RecordID,
+		Quantity: req.Quantity,
+		Status:   model.PreOrderPending,
+	}
+	// 内金は数量に応じた額でサーバ側から与信を取る、非同期確認(pending)は待てないので失敗として扱う
+	if req.DepositCardToken != "" {
+		newPreOrder.DepositAmount = req.Quantity * preOrderDepositPerUnit()
+		authRes, err := pu.pu.AuthorizeAmount(userID, newPreOrder.DepositAmount, req.DepositCardToken)
+		if err != nil {
+			return model.PreOrder{}, err
+		}
+		if authRes.Status != payment.StatusAuthorized || authRes.Amount != newPreOrder.DepositAmount {
+			return model.PreOrder{}, fmt.Errorf("%w: deposit payment is %s %s", ErrInvalidState, authRes.Status, authRes.DeclineReason)
+		}
+		newPreOrder.DepositPaymentID = &authRes.ID
+	}
+	if err := pu.por.CreatePreOrder(&newPreOrder); err != nil {
+		if newPreOrder.DepositPaymentID != nil {
+			if _, voidErr := pu.pu.VoidPayment(*newPreOrder.DepositPaymentID); voidErr != nil {
+				err = errors.Join(err, voidErr)
+			}
+		}
+		return model.PreOrder{}, err
+	}
+	return newPreOrder, nil
+}
+
+func (pu *preOrderUsecase) GetOwnPreOrders(userID uint) ([]model.PreOrder, error) {
+	return pu.por.GetPreOrdersByUser(userID)
+}
+
+// 先に取消しておき、同時の引当で内金が確定されないようにしてから内金を返す
+// 内金の返却に失敗した場合は入荷待ちに戻し、もう一度取消せるようにする
+func (pu *preOrderUsecase) CancelPreOrder(userID uint, id uint) error {
+	preOrder := model.PreOrder{}
+	if err := pu.por.GetPreOrderByID(&preOrder, id); err != nil {
+		return err
+	}
+	if preOrder.UserID != userID {
+		return gorm.ErrRecordNotFound
+	}
+	if err := pu.por.CancelPreOrder(userID, id); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return fmt.Errorf("%w: pre-order does not exist or is already allocated", ErrInvalidState)
+		}
+		return err
+	}
+	if preOrder.DepositPaymentID == nil {
+		return nil
+	}
+	if err := pu.releaseDeposit(*preOrder.DepositPaymentID); err != nil {
+		if reopenErr := pu.por.ReopenPreOrder(id); reopenErr != nil {
+			return errors.Join(err, reopenErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// 売上確定前なら与信を取消し、確定済みなら返金済みでない分を返金する
+func (pu *preOrderUsecase) releaseDeposit(paymentID uint) error {
+	deposit := model.Payment{}
+	if err := pu.pr.GetPaymentByID(&deposit, paymentID); err != nil {
+		return err
+	}
+	switch deposit.Status {
+	case payment.StatusAuthorized:
+		_, err := pu.pu.VoidPayment(paymentID)
+		return err
+	case payment.StatusCaptured:
+		_, err := pu.pu.RefundPayment(paymentID, deposit.Amount-deposit.RefundedAmount-deposit.PendingRefundAmount)
+		return err
+	}
+	return nil
+}
+
+// 入荷の登録と入荷した拠点への入庫、予約への引当はジョブで行う
+func (pu *preOrderUsecase) RegisterArrival(staffID uint, recordID uint, req model.PreOrderArrivalRequest) (model.PreOrderArrival, error) {
+	if err := pu.pov.ArrivalValidate(req); err != nil {
+		return model.PreOrderArrival{}, err
+	}
+	record := model.Record{}
+	if err := pu.rr.GetRecordByID(&record, recordID); err != nil {
+		return model.PreOrderArrival{}, err
+	}
+	if err := pu.ir.GetLocationByID(&model.Location{}, req.LocationID); err != nil {
+		return model.PreOrderArrival{}, err
+	}
+	arrival := model.PreOrderArrival{
+		RecordID:   recordID,
+		LocationID: req.LocationID,
+		Quantity:   req.Quantity,
+		Remaining:  req.Quantity,
+	}
+	if err := pu.por.CreateArrival(&arrival, staffID); err != nil {
+		return model.PreOrderArrival{}, err
+	}
+	// 新品の入荷なので盤質はM
+	pu.wu.NotifyStockAdded(model.StockNotice{RecordID: recordID, Condition: "M"})
+	return arrival, nil
+}
+
+// 引当てた予約の内金を売上確定する
+// 確定に失敗した内金(与信の期限切れ等)はログに残し、店頭での受取り時に精算する
+func (pu *preOrderUsecase) AllocateArrivals() (int, error) {
+	allocated, err := pu.por.AllocateArrivals(time.Now())
+	if err != nil {
+		return 0, err
+	}
+	for _, preOrder := range allocated {
+		if preOrder.DepositPaymentID == nil {
+			continue
+		}
+		if _, err := pu.pu.Capture(preOrder.UserID, *preOrder.DepositPaymentID); err != nil {
+			log.Printf("capturing deposit payment %d of pre-order %d failed: %v", *preOrder.DepositPaymentID, preOrder.ID, err)
+		}
+	}
+	return len(allocated), nil
+}
+
+// 予約1点あたりの内金、PREORDER_DEPOSIT_PER_UNITで設定(未設定は1000円)
+func preOrderDepositPerUnit() int {
+	if v, err := strconv.Atoi(os.Getenv("PREORDER_DEPOSIT_PER_UNIT")); err == nil && v > 0 {
+		return v
+	}
+	return 1000
+}
+
+// 一定間隔で入荷分を予約に引当てるバックグラウンドジョブを開始する
+func (pu *preOrderUsecase) StartAllocationJob(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			allocated, err := pu.AllocateArrivals()
+			if err != nil {
+				log.Printf("pre-order allocation failed: %v", err)
+				continue
+			}
+			if allocated > 0 {
+				log.Printf("allocated %d pre-order(s)", allocated)
+			}
+		}
+	}()
+}
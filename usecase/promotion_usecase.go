@@ -0,0 +1,251 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"sort"
+	"strings"
+	"time"
+)
+
+type IPromotionUsecase interface {
+	CreatePromotion(promotion model.Promotion) (model.PromotionResponse, error)
+	GetPromotionList() ([]model.Promotion, error)
+	Evaluate(req model.PricingRequest) (model.PricingResponse, error)
+	Redeem(applied []model.AppliedPromotion, userID *uint, reference string) error
+	Release(reference string) error
+}
+
+type promotionUsecase struct {
+	pr repository.IPromotionRepository
+	pv validator.IPromotionValidator
+}
+
+func NewPromotionUsecase(pr repository.IPromotionRepository, pv validator.IPromotionValidator) IPromotionUsecase {
+	return &promotionUsecase{pr, pv}
+}
+
+func (pu *promotionUsecase) CreatePromotion(promotion model.Promotion) (model.PromotionResponse, error) {
+	if err := pu.pv.PromotionValidate(promotion); err != nil {
+		return model.PromotionResponse{
+			Error: &model.ErrorResponse{
+				Code:    "ValidationError",
+				Message: common.HandleValidationError(err),
+				Details: "Promotion validation failed.",
+			},
+		}, err
+	}
+	newPromotion := promotion
+	newPromotion.ID = 0
+	newPromotion.UsedCount = 0
+	newPromotion.Code = normalizeCode(promotion.Code)
+	if err := pu.pr.CreatePromotion(&newPromotion); err != nil {
+		return model.PromotionResponse{}, err
+	}
+	return model.PromotionResponse{Promotion: newPromotion}, nil
+}
+
+func (pu *promotionUsecase) GetPromotionList() ([]model.Promotion, error) {
+	return pu.pr.GetPromotionList()
+}
+
+// カート・チェックアウト時に呼ばれ、適用するプロモーションと、その内訳を返す
+// 併用ルール: 併用可のもの全ての合計と、併用不可(Exclusive)のもの単独とで、値引額が大きい方を採用
+func (pu *promotionUsecase) Evaluate(req model.PricingRequest) (model.PricingResponse, error) {
+	if err := pu.pv.PricingValidate(req); err != nil {
+		return model.PricingResponse{
+			Error: &model.ErrorResponse{
+				Code:    "ValidationError",
+				Message: common.HandleValidationError(err),
+				Details: "Pricing request validation failed.",
+			},
+		}, err
+	}
+	codes := common.MapSlice(req.Codes, normalizeCode)
+	candidates, err := pu.pr.GetCandidatePromotions(codes, time.Now())
+	if err != nil {
+		return model.PricingResponse{}, err
+	}
+
+	res := model.PricingResponse{
+		Subtotal: lineSubtotal(req.Lines),
+		Applied:  []model.AppliedPromotion{},
+		Skipped:  []model.SkippedPromotion{},
+	}
+	// 入力されたのに候補に無いコードは、存在しないか期間外
+	matched := map[string]bool{}
+	for _, p := range candidates {
+		matched[p.Code] = true
+	}
+	for _, code := range codes {
+		if !matched[code] {
+			res.Skipped = append(res.Skipped, model.SkippedPromotion{Code: code, Reason: "code is invalid or expired"})
+		}
+	}
+
+	var stackable, exclusive []model.AppliedPromotion
+	for _, p := range candidates {
+		if p.UsageLimit > 0 && p.UsedCount >= p.UsageLimit {
+			res.Skipped = append(res.Skipped, skippedPromotion(p, "usage limit reached"))
+			continue
+		}
+		amount, explanation, reason := calcPromotion(p, req.Lines)
+		if amount == 0 {
+			res.Skipped = append(res.Skipped, skippedPromotion(p, reason))
+			continue
+		}
+		applied := model.AppliedPromotion{
+			PromotionID: p.ID,
+			Name:        p.Name,
+			Code:        p.Code,
+			Amount:      amount,
+			Explanation: explanation,
+		}
+		if p.Exclusive {
+			exclusive = append(exclusive, applied)
+		} else {
+			stackable = append(stackable, applied)
+		}
+	}
+
+	stackTotal := 0
+	for _, a := range stackable {
+		stackTotal += a.Amount
+	}
+	// 併用不可のものは一番値引額が大きいものだけが候補
+	sort.SliceStable(exclusive, func(i, j int) bool { return exclusive[i].Amount > exclusive[j].Amount })
+	if len(exclusive) > 0 && exclusive[0].Amount > stackTotal {
+		best := exclusive[0]
+		res.Applied = append(res.Applied, best)
+		for _, a := range append(exclusive[1:], stackable...) {
+			res.Skipped = append(res.Skipped, skippedApplied(a, fmt.Sprintf("not combinable with %q, which gives a larger discount", best.Name)))
+		}
+	} else {
+		res.Applied = append(res.Applied, stackable...)
+		for _, a := range exclusive {
+			res.Skipped = append(res.Skipped, skippedApplied(a, "cannot be combined with other promotions, which give a larger discount"))
+		}
+	}
+
+	for _, a := range res.Applied {
+		res.Discount += a.Amount
+	}
+	// 値引の合計が小計を超えないように
+	res.Discount = min(res.Discount, res.Subtotal)
+	res.Total = res.Subtotal - res.Discount
+	return res, nil
+}
+
+// 販売確定時に呼び、利用回数を加算して利用履歴を記録する
+// userID: 会員を特定できない販売ではnil、1人あたりの上限があるプロモーションは使えない
+// Evaluate後に他の販売で上限に達していた場合はエラーになるので、再計算させる
+func (pu *promotionUsecase) Redeem(applied []model.AppliedPromotion, userID *uint, reference string) error {
+	redemptions := common.MapSlice(applied, func(a model.AppliedPromotion) model.PromotionRedemption {
+		return model.PromotionRedemption{PromotionID: a.PromotionID, UserID: userID, Reference: reference}
+	})
+	if len(redemptions) == 0 {
+		return nil
+	}
+	if err := pu.pr.IncrementUsage(redemptions); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// 販売の取消・失敗時に呼び、Redeemで加算した利用回数を戻す
+func (pu *promotionUsecase) Release(reference string) error {
+	return pu.pr.DecrementUsage(reference)
+}
+
+// 値引額、適用時の説明、適用されなかった場合の理由を返す
+func calcPromotion(p model.Promotion, lines []model.LineItem) (int, string, string) {
+	var eligible []model.LineItem
+	for _, line := range lines {
+		if matchesFilter(p.Genre, line.Genre) && matchesFilter(p.Format, line.Format) && matchesFilter(p.Condition, line.Condition) {
+			eligible = append(eligible, line)
+		}
+	}
+	scope := promotionScope(p)
+	if len(eligible) == 0 {
+		return 0, "", fmt.Sprintf("no %s in cart", scope)
+	}
+	eligibleSubtotal := lineSubtotal(eligible)
+	if eligibleSubtotal < p.MinSubtotal {
+		return 0, "", fmt.Sprintf("requires ¥%d of %s (currently ¥%d)", p.MinSubtotal, scope, eligibleSubtotal)
+	}
+
+	switch p.Type {
+	case model.PromotionPercentOff:
+		// 円未満は切捨て
+		amount := eligibleSubtotal * p.PercentOff / 100
+		return amount, fmt.Sprintf("%d%% off %s (¥%d)", p.PercentOff, scope, eligibleSubtotal), ""
+	case model.PromotionFixedOff:
+		amount := min(p.AmountOff, eligibleSubtotal)
+		return amount, fmt.Sprintf("¥%d off %s over ¥%d", p.AmountOff, scope, p.MinSubtotal), ""
+	case model.PromotionBuyXGetY:
+		// 1点ずつに展開して安い順に並べ、(Buy+Free)点ごとに安い方からFree点を無料にする
+		var prices []int
+		for _, line := range eligible {
+			for i := 0; i < line.Quantity; i++ {
+				prices = append(prices, line.UnitPrice)
+			}
+		}
+		groupSize := p.BuyQuantity + p.FreeQuantity
+		freeCount := len(prices) / groupSize * p.FreeQuantity
+		if freeCount == 0 {
+			return 0, "", fmt.Sprintf("requires %d %s (currently %d)", groupSize, scope, len(prices))
+		}
+		sort.Ints(prices)
+		amount := 0
+		for _, price := range prices[:freeCount] {
+			amount += price
+		}
+		return amount, fmt.Sprintf("buy %d get %d free on %s: %d item(s) free", p.BuyQuantity, p.FreeQuantity, scope, freeCount), ""
+	}
+	return 0, "", fmt.Sprintf("unknown promotion type %s", p.Type)
+}
+
+// 条件が空なら全てに一致
+func matchesFilter(filter string, value string) bool {
+	return filter == "" || strings.EqualFold(filter, value)
+}
+
+// 説明文用の対象範囲、例: "used 7\" Jazz items"
+func promotionScope(p model.Promotion) string {
+	var words []string
+	for _, w := range []string{p.Condition, p.Format, p.Genre} {
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	words = append(words, "items")
+	return strings.Join(words, " ")
+}
+
+func lineSubtotal(lines []model.LineItem) int {
+	subtotal := 0
+	for _, line := range lines {
+		subtotal += line.UnitPrice * line.Quantity
+	}
+	return subtotal
+}
+
+// クーポンコードは大文字小文字・前後の空白を区別しない
+func normalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+func skippedPromotion(p model.Promotion, reason string) model.SkippedPromotion {
+	return model.SkippedPromotion{PromotionID: p.ID, Name: p.Name, Code: p.Code, Reason: reason}
+}
+
+func skippedApplied(a model.AppliedPromotion, reason string) model.SkippedPromotion {
+	return model.SkippedPromotion{PromotionID: a.PromotionID, Name: a.Name, Code: a.Code, Reason: reason}
+}
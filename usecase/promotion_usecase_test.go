@@ -0,0 +1,121 @@
+package usecase
+
+import (
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/validator"
+	"slices"
+	"testing"
+)
+
+func TestEvaluatePromotions(t *testing.T) {
+	// 小計 1995 + 1200*2 = 4395
+	lines := []model.LineItem{
+		{RecordID: 1, Genre: "Jazz", Format: "LP", Condition: "used", UnitPrice: 1995, Quantity: 1},
+		{RecordID: 2, Genre: "Rock", Format: "CD", Condition: "new", UnitPrice: 1200, Quantity: 2},
+	}
+	jazz10 := model.Promotion{ID: 1, Name: "jazz 10%", Type: model.PromotionPercentOff, PercentOff: 10, Genre: "jazz"}
+	cd300 := model.Promotion{ID: 2, Name: "cd 300", Type: model.PromotionFixedOff, AmountOff: 300, Format: "CD"}
+	tests := []struct {
+		name         string
+		promotions   []model.Promotion
+		codes        []string
+		wantDiscount int
+		wantApplied  []string
+		wantSkipped  int
+	}{
+		{
+			name:         "percent off rounds down to the yen",
+			promotions:   []model.Promotion{jazz10},
+			wantDiscount: 199,
+			wantApplied:  []string{"jazz 10%"},
+		},
+		{
+			name:         "fixed off is capped at the eligible subtotal",
+			promotions:   []model.Promotion{{ID: 1, Name: "jazz 3000", Type: model.PromotionFixedOff, AmountOff: 3000, Genre: "Jazz"}},
+			wantDiscount: 1995,
+			wantApplied:  []string{"jazz 3000"},
+		},
+		{
+			name:         "buy x get y frees the cheapest items",
+			promotions:   []model.Promotion{{ID: 1, Name: "b1g1", Type: model.PromotionBuyXGetY, BuyQuantity: 1, FreeQuantity: 1}},
+			wantDiscount: 1200,
+			wantApplied:  []string{"b1g1"},
+		},
+		{
+			name:        "minimum subtotal not reached",
+			promotions:  []model.Promotion{{ID: 1, Name: "500 over 5000", Type: model.PromotionFixedOff, AmountOff: 500, MinSubtotal: 5000}},
+			wantSkipped: 1,
+		},
+		{
+			name:         "stackable promotions add up",
+			promotions:   []model.Promotion{jazz10, cd300},
+			wantDiscount: 499,
+			wantApplied:  []string{"jazz 10%", "cd 300"},
+		},
+		{
+			name:         "exclusive promotion wins when it gives more than the stack",
+			promotions:   []model.Promotion{jazz10, cd300, {ID: 3, Name: "all 20%", Type: model.PromotionPercentOff, PercentOff: 20, Exclusive: true}},
+			wantDiscount: 879,
+			wantApplied:  []string{"all 20%"},
+			wantSkipped:  2,
+		},
+		{
+			name:         "stack wins over a smaller exclusive promotion",
+			promotions:   []model.Promotion{jazz10, cd300, {ID: 3, Name: "400 off", Type: model.PromotionFixedOff, AmountOff: 400, Exclusive: true}},
+			wantDiscount: 499,
+			wantApplied:  []string{"jazz 10%", "cd 300"},
+			wantSkipped:  1,
+		},
+		{
+			name:         "only the largest exclusive promotion applies",
+			promotions:   []model.Promotion{{ID: 1, Name: "400 off", Type: model.PromotionFixedOff, AmountOff: 400, Exclusive: true}, {ID: 2, Name: "600 off", Type: model.PromotionFixedOff, AmountOff: 600, Exclusive: true}},
+			wantDiscount: 600,
+			wantApplied:  []string{"600 off"},
+			wantSkipped:  1,
+		},
+		{
+			name: "discount never exceeds the subtotal",
+			promotions: []model.Promotion{
+				{ID: 1, Name: "3000 off", Type: model.PromotionFixedOff, AmountOff: 3000},
+				{ID: 2, Name: "another 3000 off", Type: model.PromotionFixedOff, AmountOff: 3000},
+			},
+			wantDiscount: 4395,
+			wantApplied:  []string{"3000 off", "another 3000 off"},
+		},
+		{
+			name:         "codes are normalized and unknown codes are skipped",
+			promotions:   []model.Promotion{{ID: 1, Name: "summer", Code: "SUMMER", Type: model.PromotionPercentOff, PercentOff: 5}},
+			codes:        []string{" summer ", "nope"},
+			wantDiscount: 219,
+			wantApplied:  []string{"summer"},
+			wantSkipped:  1,
+		},
+		{
+			name:        "usage limit reached",
+			promotions:  []model.Promotion{{ID: 1, Name: "limited", Type: model.PromotionFixedOff, AmountOff: 100, UsageLimit: 1, UsedCount: 1}},
+			wantSkipped: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pu := NewPromotionUsecase(&fakePromotionRepository{promotions: tt.promotions}, validator.NewPromotionValidator())
+			res, err := pu.Evaluate(model.PricingRequest{Lines: lines, Codes: tt.codes})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Subtotal != 4395 || res.Discount != tt.wantDiscount || res.Total != res.Subtotal-res.Discount {
+				t.Errorf("subtotal %d, discount %d, total %d, want discount %d", res.Subtotal, res.Discount, res.Total, tt.wantDiscount)
+			}
+			var applied []string
+			for _, a := range res.Applied {
+				applied = append(applied, a.Name)
+			}
+			if !slices.Equal(applied, tt.wantApplied) {
+				t.Errorf("applied %v, want %v", applied, tt.wantApplied)
+			}
+			if len(res.Skipped) != tt.wantSkipped {
+				t.Errorf("skipped %v, want %d", res.Skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
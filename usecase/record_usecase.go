@@ -46,6 +46,8 @@ func (ru *recordUsecase) CreateRecord(record model.Record) (model.RecordResponse
 		Genre:       record.Genre,
 		Style:       record.Style,
 		ReleaseYear: record.ReleaseYear,
+		PreOrder:    record.PreOrder,
+		ReleaseDate: record.ReleaseDate,
 	}
 	if err := ru.rr.CreateRecord(&newRecord); err != nil {
 		return model.RecordResponse{}, err
@@ -58,6 +60,8 @@ func (ru *recordUsecase) CreateRecord(record model.Record) (model.RecordResponse
 		Genre:       newRecord.Genre,
 		Style:       newRecord.Style,
 		ReleaseYear: newRecord.ReleaseYear,
+		PreOrder:    newRecord.PreOrder,
+		ReleaseDate: newRecord.ReleaseDate,
 	}
 	return resRecord, nil
 }
@@ -84,6 +88,8 @@ func (ru *recordUsecase) GetRecordList() ([]model.RecordResponse, error) {
 				Genre:       record.Genre,
 				Style:       record.Style,
 				ReleaseYear: record.ReleaseYear,
+				PreOrder:    record.PreOrder,
+				ReleaseDate: record.ReleaseDate,
 			})
 		}
 		return recordResponseList, nil
@@ -125,6 +131,8 @@ func (*recordUsecase) mapSlice(recordList []model.Record) ([]model.RecordRespons
 			Genre:       record.Genre,
 			Style:       record.Style,
 			ReleaseYear: record.ReleaseYear,
+			PreOrder:    record.PreOrder,
+			ReleaseDate: record.ReleaseDate,
 		}
 	})
 	return recordResponseList, nil
@@ -154,6 +162,8 @@ func (ru *recordUsecase) UpdateRecord(record model.Record) (model.RecordResponse
 		Genre:       record.Genre,
 		Style:       record.Style,
 		ReleaseYear: record.ReleaseYear,
+		PreOrder:    record.PreOrder,
+		ReleaseDate: record.ReleaseDate,
 	}
 	return resTask, nil
 }
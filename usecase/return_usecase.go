@@ -0,0 +1,266 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/payment"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+type IReturnUsecase interface {
+	CreateReturn(userID uint, req model.ReturnCreateRequest) (model.ReturnRequest, error)
+	GetOwnReturns(userID uint) ([]model.ReturnRequest, error)
+	GetOwnReturn(userID uint, id uint) (model.ReturnRequest, error)
+	GetPendingReturns() ([]model.ReturnRequest, error)
+	Approve(staffID uint, id uint, req model.ReturnDecisionRequest) (model.ReturnRequest, error)
+	Reject(staffID uint, id uint, req model.ReturnDecisionRequest) (model.ReturnRequest, error)
+	Receive(staffID uint, id uint, req model.ReturnDecisionRequest) (model.ReturnRequest, error)
+}
+
+type returnUsecase struct {
+	rr repository.IReturnRepository
+	rv validator.IReturnValidator
+	pr repository.IPaymentRepository
+	or repository.IOrderRepository
+	pu IPaymentUsecase
+	iu IInventoryUsecase
+	lu ILoyaltyUsecase
+	gu IGiftCardUsecase
+}
+
+func NewReturnUsecase(rr repository.IReturnRepository, rv validator.IReturnValidator, pr repository.IPaymentRepository,
+	or repository.IOrderRepository, pu IPaymentUsecase, iu IInventoryUsecase, lu ILoyaltyUsecase, gu IGiftCardUsecase) IReturnUsecase {
+	return &returnUsecase{rr, rv, pr, or, pu, iu, lu, gu}
+}
+
+func (ru *returnUsecase) CreateReturn(userID uint, req model.ReturnCreateRequest) (model.ReturnRequest, error) {
+	if err := ru.rv.ReturnCreateValidate(req); err != nil {
+		return model.ReturnRequest{}, err
+	}
+	// 返品できるのは自分の売上確定済みの決済のみ
+	storedPayment := model.Payment{}
+	if err := ru.pr.GetPaymentByID(&storedPayment, req.PaymentID); err != nil {
+		return model.ReturnRequest{}, err
+	}
+	if storedPayment.UserID != userID {
+		return model.ReturnRequest{}, gorm.ErrRecordNotFound
+	}
+	if storedPayment.Status != payment.StatusCaptured {
+		return model.ReturnRequest{}, fmt.Errorf("%w: payment is %s", ErrInvalidState, storedPayment.Status)
+	}
+	// 返品できるのは、その決済で支払った注文に含まれるレコードのみ
+	order := model.Order{}
+	if err := ru.or.GetOrderByPayment(&order, storedPayment.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.ReturnRequest{}, fmt.Errorf("%w: payment is not for an online order", ErrInvalidState)
+		}
+		return model.ReturnRequest{}, err
+	}
+	if !slices.ContainsFunc(order.Lines, func(l model.OrderLine) bool { return l.RecordID == req.RecordID }) {
+		return model.ReturnRequest{}, fmt.Errorf("%w: record %d was not bought with this payment", ErrInvalidState, req.RecordID)
+	}
+	resolution := req.Resolution
+	if resolution == "" {
+		resolution = model.ResolutionRefund
+	}
+	newReturn := model.ReturnRequest{
+		UserID:     userID,
+		PaymentID:  req.PaymentID,
+		RecordID:   req.RecordID,
+		Reason:     req.Reason,
+		Resolution: resolution,
+		Status:     model.ReturnRequested,
+		Photos: common.MapSlice(req.PhotoURLs, func(url string) model.ReturnPhoto {
+			return model.ReturnPhoto{URL: url}
+		}),
+	}
+	event := model.ReturnEvent{ToStatus: model.ReturnRequested, ActorID: userID}
+	if err := ru.rr.CreateReturn(&newReturn, &event); err != nil {
+		if errors.Is(err, repository.ErrDuplicateEvent) {
+			return model.ReturnRequest{}, fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		return model.ReturnRequest{}, err
+	}
+	newReturn.Events = []model.ReturnEvent{event}
+	return newReturn, nil
+}
+
+func (ru *returnUsecase) GetOwnReturns(userID uint) ([]model.ReturnRequest, error) {
+	return ru.rr.GetReturnsByUser(userID)
+}
+
+func (ru *returnUsecase) GetOwnReturn(userID uint, id uint) (model.ReturnRequest, error) {
+	returnRequest := model.ReturnRequest{}
+	if err := ru.rr.GetReturnByID(&returnRequest, id); err != nil {
+		return model.ReturnRequest{}, err
+	}
+	if returnRequest.UserID != userID {
+		return model.ReturnRequest{}, gorm.ErrRecordNotFound
+	}
+	return returnRequest, nil
+}
+
+// スタッフの承認待ち一覧
+func (ru *returnUsecase) GetPendingReturns() ([]model.ReturnRequest, error) {
+	return ru.rr.GetReturnsByStatus(model.ReturnRequested)
+}
+
+// 承認時に返金額を確定させる、実際の返金は商品の到着後(Receive)
+// 返金できる残額 = 決済額 - 承認済み・完了の返品の返金額(返金・店内クレジットとも) - 返品以外での返金(スタッフの直接の返金)
+// 完了した返金の返品は決済の返金累計にも含まれているので、二重に差引かない
+func (ru *returnUsecase) Approve(staffID uint, id uint, req model.ReturnDecisionRequest) (model.ReturnRequest, error) {
+	if err := ru.rv.ReturnApproveValidate(req); err != nil {
+		return model.ReturnRequest{}, err
+	}
+	returnRequest := model.ReturnRequest{}
+	if err := ru.rr.GetReturnByID(&returnRequest, id); err != nil {
+		return model.ReturnRequest{}, err
+	}
+	if returnRequest.Status != model.ReturnRequested {
+		return model.ReturnRequest{}, fmt.Errorf("%w: return request is %s", ErrInvalidState, returnRequest.Status)
+	}
+	returnRequest.Status = model.ReturnApproved
+	returnRequest.RefundAmount = req.RefundAmount
+	event := model.ReturnEvent{
+		ReturnRequestID: returnRequest.ID,
+		FromStatus:      model.ReturnRequested,
+		ToStatus:        model.ReturnApproved,
+		ActorID:         staffID,
+		Note:            req.Note,
+	}
+	err := ru.rr.ApproveReturn(&returnRequest, &event, func(p model.Payment, returned int, refundedByReturns int) error {
+		otherRefunds := max(p.RefundedAmount+p.PendingRefundAmount-refundedByReturns, 0)
+		if req.RefundAmount > p.Amount-returned-otherRefunds {
+			return fmt.Errorf("%w: refund amount exceeds refundable amount", ErrInvalidState)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.ReturnRequest{}, fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		return model.ReturnRequest{}, err
+	}
+	returnRequest.Events = append(returnRequest.Events, event)
+	return returnRequest, nil
+}
+
+func (ru *returnUsecase) Reject(staffID uint, id uint, req model.ReturnDecisionRequest) (model.ReturnRequest, error) {
+	return ru.transition(staffID, id, model.ReturnRequested, model.ReturnRejected, req.Note, nil)
+}
+
+// 返品された商品を受領し、扱い(在庫戻し/廃棄)を記録してから、顧客の選んだ方法で返金する
+// 先に状態を進めておき、同じ返品に二重に返金・入庫されないようにする
+// 入庫か返金(店内クレジットの付与)に失敗した場合は承認済みに戻す(入庫済みなら在庫も戻す)
+func (ru *returnUsecase) Receive(staffID uint, id uint, req model.ReturnDecisionRequest) (model.ReturnRequest, error) {
+	if err := ru.rv.ReturnReceiveValidate(req); err != nil {
+		return model.ReturnRequest{}, err
+	}
+	received, err := ru.transition(staffID, id, model.ReturnApproved, model.ReturnCompleted, req.Note, func(r *model.ReturnRequest) error {
+		r.Disposition = req.Disposition
+		if req.Disposition == model.DispositionRestock {
+			r.Grade = req.Grade
+		}
+		return nil
+	})
+	if err != nil {
+		return model.ReturnRequest{}, err
+	}
+	rollback := func(cause error, note string) error {
+		if _, err := ru.transition(staffID, id, model.ReturnCompleted, model.ReturnApproved, note, func(r *model.ReturnRequest) error {
+			r.Disposition = ""
+			r.Grade = ""
+			return nil
+		}); err != nil {
+			return errors.Join(cause, err)
+		}
+		return cause
+	}
+	restock := func(delta int, reason string, note string) error {
+		return ru.iu.ApplyMovements([]model.StockMovement{{
+			LocationID:    req.LocationID,
+			RecordID:      received.RecordID,
+			Grade:         received.Grade,
+			Delta:         delta,
+			Reason:        reason,
+			ReferenceType: "return_request",
+			ReferenceID:   received.ID,
+			ActorID:       staffID,
+			Note:          note,
+		}})
+	}
+	if received.Disposition == model.DispositionRestock {
+		if stockErr := restock(1, model.MovementReturnRestock, ""); stockErr != nil {
+			return model.ReturnRequest{}, rollback(stockErr, fmt.Sprintf("restock failed: %v", stockErr))
+		}
+	}
+	if refundErr := ru.refund(staffID, received); refundErr != nil {
+		if received.Disposition == model.DispositionRestock {
+			if err := restock(-1, model.MovementAdjust, "refund failed"); err != nil {
+				refundErr = errors.Join(refundErr, err)
+			}
+		}
+		return model.ReturnRequest{}, rollback(refundErr, fmt.Sprintf("refund failed: %v", refundErr))
+	}
+	// 返金は完了しているので、ポイントの取消に失敗しても返品は戻さない
+	// 店内クレジットでの返品も、返品した分として付与済みのポイントを取消す
+	if err := ru.lu.ClawbackForRefund(received.PaymentID); err != nil {
+		log.Printf("point clawback for payment %d failed: %v", received.PaymentID, err)
+	}
+	return received, nil
+}
+
+// 元の決済への返金か、店内クレジットの付与
+func (ru *returnUsecase) refund(staffID uint, r model.ReturnRequest) error {
+	if r.Resolution == model.ResolutionStoreCredit {
+		_, err := ru.gu.GrantStoreCredit(staffID, model.StoreCreditGrantRequest{
+			UserID: r.UserID,
+			Amount: r.RefundAmount,
+			Note:   fmt.Sprintf("return #%d", r.ID),
+		}, "return", r.ID)
+		return err
+	}
+	_, err := ru.pu.RefundPayment(r.PaymentID, r.RefundAmount)
+	return err
+}
+
+// from -> to への状態変更と監査ログの記録
+// applyで状態以外の項目を変更できる
+func (ru *returnUsecase) transition(actorID uint, id uint, from string, to string, note string,
+	apply func(r *model.ReturnRequest) error) (model.ReturnRequest, error) {
+	returnRequest := model.ReturnRequest{}
+	if err := ru.rr.GetReturnByID(&returnRequest, id); err != nil {
+		return model.ReturnRequest{}, err
+	}
+	if returnRequest.Status != from {
+		return model.ReturnRequest{}, fmt.Errorf("%w: return request is %s", ErrInvalidState, returnRequest.Status)
+	}
+	if apply != nil {
+		if err := apply(&returnRequest); err != nil {
+			return model.ReturnRequest{}, err
+		}
+	}
+	returnRequest.Status = to
+	event := model.ReturnEvent{
+		ReturnRequestID: returnRequest.ID,
+		FromStatus:      from,
+		ToStatus:        to,
+		ActorID:         actorID,
+		Note:            note,
+	}
+	if err := ru.rr.UpdateReturnStatus(&returnRequest, &event); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.ReturnRequest{}, fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		return model.ReturnRequest{}, err
+	}
+	returnRequest.Events = append(returnRequest.Events, event)
+	return returnRequest, nil
+}
@@ -0,0 +1,77 @@
+package usecase
+
+import (
+	"log"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"sync"
+	"time"
+)
+
+// 失効したトークンの一覧をメモリに持って、リクエストごとにDBを引かないようにする
+// 他のプロセスでの失効を拾うために、一定時間ごとにDBから読み直す
+// 読み直しに失敗した場合は、ログに残して手元の一覧で判定を続ける(次の読み直しは一定時間後)
+type revocationCache struct {
+	tr       repository.ITokenRepository
+	mu       sync.Mutex
+	loadedAt time.Time
+	tokens   map[string]time.Time // jti -> 有効期限
+	users    map[uint]time.Time   // user_id -> この時刻以前に発行されたトークンは無効
+}
+
+const revocationCacheTTL = 30 * time.Second
+
+func newRevocationCache(tr repository.ITokenRepository) *revocationCache {
+	return &revocationCache{
+		tr:     tr,
+		tokens: map[string]time.Time{},
+		users:  map[uint]time.Time{},
+	}
+}
+
+func (rc *revocationCache) isRevoked(jti string, userID uint, issuedAt time.Time) bool {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	now := time.Now()
+	if now.Sub(rc.loadedAt) > revocationCacheTTL {
+		rc.reload(now)
+	}
+	if _, ok := rc.tokens[jti]; ok {
+		return true
+	}
+	// iatは秒単位なので、失効と同じ秒に発行されたトークンも無効として扱う
+	if revokedBefore, ok := rc.users[userID]; ok && !issuedAt.After(revokedBefore.Truncate(time.Second)) {
+		return true
+	}
+	return false
+}
+
+func (rc *revocationCache) reload(now time.Time) {
+	rc.loadedAt = now
+	tokens, users, err := rc.tr.GetRevocations(now, now.Add(-accessTokenTTL))
+	if err != nil {
+		log.Printf("reloading token revocations failed: %v", err)
+		return
+	}
+	rc.tokens = map[string]time.Time{}
+	for _, t := range tokens {
+		rc.tokens[t.JTI] = t.ExpiresAt
+	}
+	rc.users = map[uint]time.Time{}
+	for _, u := range users {
+		rc.users[u.UserID] = u.RevokedBefore
+	}
+}
+
+// このプロセスで失効させたものは、DBの読み直しを待たずにすぐ反映する
+func (rc *revocationCache) addToken(revoked model.RevokedToken) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.tokens[revoked.JTI] = revoked.ExpiresAt
+}
+
+func (rc *revocationCache) addUser(revocation model.UserTokenRevocation) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.users[revocation.UserID] = revocation.RevokedBefore
+}
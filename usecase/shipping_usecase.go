@@ -0,0 +1,205 @@
+package usecase
+
+import (
+	"fmt"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+
+	"gorm.io/gorm"
+)
+
+type IShippingUsecase interface {
+	CreateShippingMethod(method model.ShippingMethod) (model.ShippingMethod, error)
+	GetShippingMethods() ([]model.ShippingMethod, error)
+	CreateShippingRate(methodID uint, rate model.ShippingRate) (model.ShippingRate, error)
+	Quote(req model.ShippingQuoteRequest) (model.ShippingQuoteResponse, error)
+	CreateShipment(shipment model.Shipment) (model.Shipment, error)
+	GetOwnShipments(userID uint) ([]model.Shipment, error)
+	GetOwnShipment(userID uint, id uint) (model.Shipment, error)
+	RecordShipmentEvent(userID uint, id uint, req model.ShipmentEventRequest) (model.Shipment, error)
+}
+
+type shippingUsecase struct {
+	sr repository.IShippingRepository
+	sv validator.IShippingValidator
+}
+
+func NewShippingUsecase(sr repository.IShippingRepository, sv validator.IShippingValidator) IShippingUsecase {
+	return &shippingUsecase{sr, sv}
+}
+
+// 形態ごとの1枚あたりの重量(g、ジャケット込み)と、必要な梱包
+// rankが大きい形態が1枚でも含まれていれば、その梱包にまとめる
+var formatSpecs = map[string]struct {
+	weightGrams int
+	packageType string
+	rank        int
+}{
+	"LP": {300, model.PackageLP, 3},
+	`7"`: {60, model.PackageSingle, 2},
+	"CD": {110, model.PackageCD, 1},
+}
+
+// 梱包材自体の重量(g)
+var packageWeightGrams = map[string]int{
+	model.PackageLP:     450,
+	model.PackageSingle: 150,
+	model.PackageCD:     50,
+}
+
+// 送料の見積りは業者をまたいで比較できるように、料金の登録がある配送方法ごとに返す
+func (su *shippingUsecase) Quote(req model.ShippingQuoteRequest) (model.ShippingQuoteResponse, error) {
+	if err := su.sv.ShippingQuoteValidate(req); err != nil {
+		return model.ShippingQuoteResponse{
+			Error: &model.ErrorResponse{
+				Code:    "ValidationError",
+				Message: common.HandleValidationError(err),
+				Details: "Shipping quote request validation failed.",
+			},
+		}, err
+	}
+	weight := 0
+	rank := 0
+	packageType := ""
+	for _, item := range req.Items {
+		spec := formatSpecs[item.Format]
+		weight += spec.weightGrams * item.Quantity
+		if spec.rank > rank {
+			rank = spec.rank
+			packageType = spec.packageType
+		}
+	}
+	weight += packageWeightGrams[packageType]
+
+	rates, err := su.sr.GetShippingRates(req.Region, packageType, weight)
+	if err != nil {
+		return model.ShippingQuoteResponse{}, err
+	}
+	res := model.ShippingQuoteResponse{Quotes: []model.ShippingQuote{}}
+	for _, rate := range rates {
+		res.Quotes = append(res.Quotes, model.ShippingQuote{
+			ShippingMethodID: rate.ShippingMethodID,
+			Carrier:          rate.ShippingMethod.Carrier,
+			Name:             rate.ShippingMethod.Name,
+			PackageType:      packageType,
+			WeightGrams:      weight,
+			Price:            rate.Price,
+		})
+	}
+	return res, nil
+}
+
+func (su *shippingUsecase) CreateShippingMethod(method model.ShippingMethod) (model.ShippingMethod, error) {
+	if err := su.sv.ShippingMethodValidate(method); err != nil {
+		return model.ShippingMethod{}, err
+	}
+	newMethod := model.ShippingMethod{Carrier: method.Carrier, Name: method.Name}
+	if err := su.sr.CreateShippingMethod(&newMethod); err != nil {
+		return model.ShippingMethod{}, err
+	}
+	return newMethod, nil
+}
+
+func (su *shippingUsecase) GetShippingMethods() ([]model.ShippingMethod, error) {
+	return su.sr.GetShippingMethods()
+}
+
+func (su *shippingUsecase) CreateShippingRate(methodID uint, rate model.ShippingRate) (model.ShippingRate, error) {
+	if err := su.sv.ShippingRateValidate(rate); err != nil {
+		return model.ShippingRate{}, err
+	}
+	newRate := model.ShippingRate{
+		ShippingMethodID: methodID,
+		Region:           rate.Region,
+		PackageType:      rate.PackageType,
+		MaxWeightGrams:   rate.MaxWeightGrams,
+		Price:            rate.Price,
+	}
+	if err := su.sr.CreateShippingRate(&newRate); err != nil {
+		return model.ShippingRate{}, err
+	}
+	return newRate, nil
+}
+
+func (su *shippingUsecase) CreateShipment(shipment model.Shipment) (model.Shipment, error) {
+	if err := su.sv.ShipmentValidate(shipment); err != nil {
+		return model.Shipment{}, err
+	}
+	newShipment := model.Shipment{
+		UserID:           shipment.UserID,
+		ShippingMethodID: shipment.ShippingMethodID,
+		TrackingNumber:   shipment.TrackingNumber,
+		Status:           model.ShipmentPreparing,
+	}
+	if err := su.sr.CreateShipment(&newShipment); err != nil {
+		return model.Shipment{}, err
+	}
+	return newShipment, nil
+}
+
+func (su *shippingUsecase) GetOwnShipments(userID uint) ([]model.Shipment, error) {
+	return su.sr.GetShipmentsByUser(userID)
+}
+
+// 他人の配送は存在しないものとして扱う
+func (su *shippingUsecase) GetOwnShipment(userID uint, id uint) (model.Shipment, error) {
+	shipment := model.Shipment{}
+	if err := su.sr.GetShipmentByID(&shipment, id); err != nil {
+		return model.Shipment{}, err
+	}
+	if shipment.UserID != userID {
+		return model.Shipment{}, gorm.ErrRecordNotFound
+	}
+	return shipment, nil
+}
+
+// 許可する状態遷移、同じ状態の記録(輸送中の経由地更新など)は許可する
+var shipmentTransitions = map[string][]string{
+	model.ShipmentPreparing: {model.ShipmentPreparing, model.ShipmentShipped},
+	model.ShipmentShipped:   {model.ShipmentInTransit, model.ShipmentDelivered, model.ShipmentReturned},
+	model.ShipmentInTransit: {model.ShipmentInTransit, model.ShipmentDelivered, model.ShipmentReturned},
+	model.ShipmentDelivered: {model.ShipmentReturned},
+	model.ShipmentReturned:  {},
+}
+
+func (su *shippingUsecase) RecordShipmentEvent(userID uint, id uint, req model.ShipmentEventRequest) (model.Shipment, error) {
+	if err := su.sv.ShipmentEventValidate(req); err != nil {
+		return model.Shipment{}, err
+	}
+	shipment := model.Shipment{}
+	if err := su.sr.GetShipmentByID(&shipment, id); err != nil {
+		return model.Shipment{}, err
+	}
+	if !canTransition(shipmentTransitions, shipment.Status, req.Status) {
+		return model.Shipment{}, fmt.Errorf("%w: cannot change shipment status from %s to %s", ErrInvalidState, shipment.Status, req.Status)
+	}
+	if req.TrackingNumber != "" {
+		shipment.TrackingNumber = req.TrackingNumber
+	}
+	if req.Status == model.ShipmentShipped && shipment.TrackingNumber == "" {
+		return model.Shipment{}, fmt.Errorf("%w: tracking number is required when shipped", ErrInvalidState)
+	}
+	shipment.Status = req.Status
+	event := model.ShipmentEvent{
+		ShipmentID: shipment.ID,
+		Status:     req.Status,
+		Note:       req.Note,
+		RecordedBy: userID,
+	}
+	if err := su.sr.AddShipmentEvent(&shipment, &event); err != nil {
+		return model.Shipment{}, err
+	}
+	shipment.Events = append(shipment.Events, event)
+	return shipment, nil
+}
+
+func canTransition(transitions map[string][]string, from string, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package usecase
+
+import (
+	"fmt"
+	"os"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"sort"
+)
+
+type ITaxUsecase interface {
+	GetTaxRates() ([]model.TaxRate, error)
+	UpdateTaxRate(rate model.TaxRate) (model.TaxRate, error)
+	Calculate(req model.TaxRequest) (model.TaxResponse, error)
+}
+
+type taxUsecase struct {
+	tr repository.ITaxRepository
+	tv validator.ITaxValidator
+}
+
+func NewTaxUsecase(tr repository.ITaxRepository, tv validator.ITaxValidator) ITaxUsecase {
+	return &taxUsecase{tr, tv}
+}
+
+func (tu *taxUsecase) GetTaxRates() ([]model.TaxRate, error) {
+	return tu.tr.GetTaxRates()
+}
+
+func (tu *taxUsecase) UpdateTaxRate(rate model.TaxRate) (model.TaxRate, error) {
+	if err := tu.tv.TaxRateValidate(rate); err != nil {
+		return model.TaxRate{}, err
+	}
+	newRate := model.TaxRate{Category: rate.Category, Percent: rate.Percent}
+	if err := tu.tr.UpsertTaxRate(&newRate); err != nil {
+		return model.TaxRate{}, err
+	}
+	return newRate, nil
+}
+
+// インボイス制度では、消費税額の端数処理は「1請求書につき税率ごとに1回」
+// 明細ごとに端数処理して合算するのは認められないので、税率ごとに対価を合計してから税額を出す
+func (tu *taxUsecase) Calculate(req model.TaxRequest) (model.TaxResponse, error) {
+	if err := tu.tv.TaxRequestValidate(req); err != nil {
+		return model.TaxResponse{
+			Error: &model.ErrorResponse{
+				Code:    "ValidationError",
+				Message: common.HandleValidationError(err),
+				Details: "Tax calculation request validation failed.",
+			},
+		}, err
+	}
+	rates, err := tu.tr.GetTaxRates()
+	if err != nil {
+		return model.TaxResponse{}, err
+	}
+	percents := map[string]int{}
+	for _, rate := range rates {
+		percents[rate.Category] = rate.Percent
+	}
+	rounding := taxRounding()
+
+	res := model.TaxResponse{}
+	// 税率区分ごとの対価の合計(単価が税込なら税込、税抜なら税抜)
+	sums := map[string]int{}
+	for _, line := range req.Lines {
+		category := line.TaxCategory
+		if category == "" {
+			category = model.TaxCategoryStandard
+		}
+		percent, ok := percents[category]
+		if !ok {
+			return model.TaxResponse{}, fmt.Errorf("tax rate for %s is not configured", category)
+		}
+		sums[category] += line.UnitPrice * line.Quantity
+
+		unitIncl := line.UnitPrice
+		if !req.PricesIncludeTax {
+			unitIncl += rounding(line.UnitPrice*percent, 100)
+		}
+		res.Lines = append(res.Lines, model.TaxedLine{
+			RecordID:              line.RecordID,
+			TaxCategory:           category,
+			Percent:               percent,
+			Quantity:              line.Quantity,
+			UnitPriceIncludingTax: unitIncl,
+		})
+	}
+
+	for category, sum := range sums {
+		percent := percents[category]
+		breakdown := model.TaxBreakdown{TaxCategory: category, Percent: percent}
+		if req.PricesIncludeTax {
+			// 税込額に含まれる税額 = 税込額 × 税率 / (100 + 税率)
+			breakdown.AmountIncludingTax = sum
+			breakdown.Tax = rounding(sum*percent, 100+percent)
+			breakdown.AmountExcludingTax = sum - breakdown.Tax
+		} else {
+			breakdown.AmountExcludingTax = sum
+			breakdown.Tax = rounding(sum*percent, 100)
+			breakdown.AmountIncludingTax = sum + breakdown.Tax
+		}
+		res.Breakdown = append(res.Breakdown, breakdown)
+		res.TotalExcludingTax += breakdown.AmountExcludingTax
+		res.TotalTax += breakdown.Tax
+		res.TotalIncludingTax += breakdown.AmountIncludingTax
+	}
+	// mapの順序は不定なので、税率の高い順に並べる
+	sort.Slice(res.Breakdown, func(i, j int) bool {
+		return res.Breakdown[i].Percent > res.Breakdown[j].Percent
+	})
+	return res, nil
+}
+
+// 端数処理の方法は事業者が選べる、TAX_ROUNDINGで切替(未設定は切捨て)
+//
+//	floor: 切捨て、ceil: 切上げ、round: 四捨五入
+func taxRounding() func(numerator int, denominator int) int {
+	switch os.Getenv("TAX_ROUNDING") {
+	case "ceil":
+		return func(n int, d int) int { return (n + d - 1) / d }
+	case "round":
+		return func(n int, d int) int { return (2*n + d) / (2 * d) }
+	default:
+		return func(n int, d int) int { return n / d }
+	}
+}
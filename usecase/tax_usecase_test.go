@@ -0,0 +1,95 @@
+package usecase
+
+import (
+	"errors"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/validator"
+	"testing"
+)
+
+func taxLine(unitPrice int, quantity int, category string) model.TaxLineItem {
+	return model.TaxLineItem{LineItem: model.LineItem{UnitPrice: unitPrice, Quantity: quantity}, TaxCategory: category}
+}
+
+func newTestTaxUsecase() ITaxUsecase {
+	rates := []model.TaxRate{{Category: model.TaxCategoryStandard, Percent: 10}, {Category: model.TaxCategoryReduced, Percent: 8}}
+	return NewTaxUsecase(&fakeTaxRepository{rates: rates}, validator.NewTaxValidator())
+}
+
+func TestCalculateTax(t *testing.T) {
+	tests := []struct {
+		name         string
+		rounding     string
+		includeTax   bool
+		lines        []model.TaxLineItem
+		wantExcl     int
+		wantTax      int
+		wantIncl     int
+		wantUnitIncl int
+	}{
+		// 税抜 1994 の10%は 199.4
+		{"exclusive, floor", "", false, []model.TaxLineItem{taxLine(1994, 1, "")}, 1994, 199, 2193, 2193},
+		{"exclusive, ceil", "ceil", false, []model.TaxLineItem{taxLine(1994, 1, "")}, 1994, 200, 2194, 2194},
+		{"exclusive, round down", "round", false, []model.TaxLineItem{taxLine(1994, 1, "")}, 1994, 199, 2193, 2193},
+		{"exclusive, round half up", "round", false, []model.TaxLineItem{taxLine(1995, 1, "")}, 1995, 200, 2195, 2195},
+		// 税込 1000 に含まれる10%の税は 90.9
+		{"inclusive, floor", "", true, []model.TaxLineItem{taxLine(1000, 1, "")}, 910, 90, 1000, 1000},
+		{"inclusive, ceil", "ceil", true, []model.TaxLineItem{taxLine(1000, 1, "")}, 909, 91, 1000, 1000},
+		{"inclusive, round", "round", true, []model.TaxLineItem{taxLine(1000, 1, "")}, 909, 91, 1000, 1000},
+		{"inclusive, exact", "", true, []model.TaxLineItem{taxLine(1100, 2, model.TaxCategoryStandard)}, 2000, 200, 2200, 1100},
+		{"reduced rate", "", false, []model.TaxLineItem{taxLine(1000, 1, model.TaxCategoryReduced)}, 1000, 80, 1080, 1080},
+		// 明細ごと(10.5 -> 10 を3回で30)ではなく、税率ごとの合計 315 に対して1回だけ端数処理する
+		{"rounds once per rate, not per line", "", false,
+			[]model.TaxLineItem{taxLine(105, 1, ""), taxLine(105, 1, ""), taxLine(105, 1, "")}, 315, 31, 346, 115},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TAX_ROUNDING", tt.rounding)
+			res, err := newTestTaxUsecase().Calculate(model.TaxRequest{Lines: tt.lines, PricesIncludeTax: tt.includeTax})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.TotalExcludingTax != tt.wantExcl || res.TotalTax != tt.wantTax || res.TotalIncludingTax != tt.wantIncl {
+				t.Errorf("excl %d, tax %d, incl %d, want %d, %d, %d",
+					res.TotalExcludingTax, res.TotalTax, res.TotalIncludingTax, tt.wantExcl, tt.wantTax, tt.wantIncl)
+			}
+			if got := res.Lines[0].UnitPriceIncludingTax; got != tt.wantUnitIncl {
+				t.Errorf("unit price including tax %d, want %d", got, tt.wantUnitIncl)
+			}
+		})
+	}
+}
+
+func TestCalculateTaxBreakdownByRate(t *testing.T) {
+	res, err := newTestTaxUsecase().Calculate(model.TaxRequest{Lines: []model.TaxLineItem{
+		taxLine(500, 1, model.TaxCategoryReduced),
+		taxLine(1000, 1, model.TaxCategoryStandard),
+		taxLine(300, 2, model.TaxCategoryReduced),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.TaxBreakdown{
+		{TaxCategory: model.TaxCategoryStandard, Percent: 10, AmountExcludingTax: 1000, Tax: 100, AmountIncludingTax: 1100},
+		{TaxCategory: model.TaxCategoryReduced, Percent: 8, AmountExcludingTax: 1100, Tax: 88, AmountIncludingTax: 1188},
+	}
+	if len(res.Breakdown) != len(want) {
+		t.Fatalf("breakdown %+v, want %+v", res.Breakdown, want)
+	}
+	for i := range want {
+		if res.Breakdown[i] != want[i] {
+			t.Errorf("breakdown[%d] = %+v, want %+v", i, res.Breakdown[i], want[i])
+		}
+	}
+	if res.TotalTax != 188 || res.TotalIncludingTax != 2288 {
+		t.Errorf("total tax %d, total %d, want 188, 2288", res.TotalTax, res.TotalIncludingTax)
+	}
+}
+
+func TestCalculateTaxUnconfiguredRate(t *testing.T) {
+	tu := NewTaxUsecase(&fakeTaxRepository{rates: []model.TaxRate{{Category: model.TaxCategoryStandard, Percent: 10}}}, validator.NewTaxValidator())
+	_, err := tu.Calculate(model.TaxRequest{Lines: []model.TaxLineItem{taxLine(1000, 1, model.TaxCategoryReduced)}})
+	if err == nil || errors.Is(err, ErrInvalidState) {
+		t.Fatalf("got %v, want a configuration error", err)
+	}
+}
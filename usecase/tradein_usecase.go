@@ -0,0 +1,313 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+
+	"gorm.io/gorm"
+)
+
+type ITradeInUsecase interface {
+	GetTradeInRules() ([]model.TradeInRule, error)
+	UpdateTradeInRule(rule model.TradeInRule) (model.TradeInRule, error)
+	CreateQuote(userID uint, req model.TradeInCreateRequest) (model.TradeInQuote, error)
+	GetOwnQuotes(userID uint) ([]model.TradeInQuote, error)
+	GetOwnQuote(userID uint, id uint) (model.TradeInQuote, error)
+	GetPendingQuotes() ([]model.TradeInQuote, error)
+	AdjustItem(staffID uint, id uint, itemID uint, req model.TradeInAdjustRequest) (model.TradeInQuote, error)
+	Accept(staffID uint, id uint, req model.TradeInDecisionRequest) (model.TradeInQuote, error)
+	Reject(staffID uint, id uint, req model.TradeInDecisionRequest) (model.TradeInQuote, error)
+}
+
+type tradeInUsecase struct {
+	tr repository.ITradeInRepository
+	tv validator.ITradeInValidator
+	rr repository.IRecordRepository
+	iu IInventoryUsecase
+	gu IGiftCardUsecase
+}
+
+func NewTradeInUsecase(tr repository.ITradeInRepository, tv validator.ITradeInValidator,
+	rr repository.IRecordRepository, iu IInventoryUsecase, gu IGiftCardUsecase) ITradeInUsecase {
+	return &tradeInUsecase{tr, tv, rr, iu, gu}
+}
+
+func (tu *tradeInUsecase) GetTradeInRules() ([]model.TradeInRule, error) {
+	return tu.tr.GetTradeInRules()
+}
+
+func (tu *tradeInUsecase) UpdateTradeInRule(rule model.TradeInRule) (model.TradeInRule, error) {
+	if err := tu.tv.TradeInRuleValidate(rule); err != nil {
+		return model.TradeInRule{}, err
+	}
+	newRule := model.TradeInRule{
+		Grade:               rule.Grade,
+		CashPercent:         rule.CashPercent,
+		CreditPercent:       rule.CreditPercent,
+		OverstockThreshold:  rule.OverstockThreshold,
+		OverstockCutPercent: rule.OverstockCutPercent,
+	}
+	if err := tu.tr.UpsertTradeInRule(&newRule); err != nil {
+		return model.TradeInRule{}, err
+	}
+	return newRule, nil
+}
+
+// 持込み・宅配買取の申込み、店頭価格とルールに従って明細ごとの査定額を出す
+// 店頭価格が無いレコードは査定額0で受付け、スタッフがAdjustItemで販売価格を付ける
+func (tu *tradeInUsecase) CreateQuote(userID uint, req model.TradeInCreateRequest) (model.TradeInQuote, error) {
+	if err := tu.tv.TradeInCreateValidate(req); err != nil {
+		return model.TradeInQuote{}, err
+	}
+	rules, err := tu.rulesByGrade()
+	if err != nil {
+		return model.TradeInQuote{}, err
+	}
+	quote := model.TradeInQuote{UserID: userID, Status: model.TradeInQuoted}
+	for _, itemReq := range req.Items {
+		record := model.Record{}
+		if err := tu.rr.GetRecordByID(&record, itemReq.RecordID); err != nil {
+			return model.TradeInQuote{}, err
+		}
+		sellPrice, err := tu.tr.GetReferencePrice(record.ID, itemReq.Grade)
+		if err != nil {
+			return model.TradeInQuote{}, err
+		}
+		item := model.TradeInItem{RecordID: record.ID, Grade: itemReq.Grade, SellPrice: sellPrice}
+		if err := tu.priceItem(&item, rules); err != nil {
+			return model.TradeInQuote{}, err
+		}
+		quote.Items = append(quote.Items, item)
+	}
+	sumOffers(&quote)
+	if err := tu.tr.CreateQuote(&quote); err != nil {
+		return model.TradeInQuote{}, err
+	}
+	return quote, nil
+}
+
+func (tu *tradeInUsecase) GetOwnQuotes(userID uint) ([]model.TradeInQuote, error) {
+	return tu.tr.GetQuotesByUser(userID)
+}
+
+func (tu *tradeInUsecase) GetOwnQuote(userID uint, id uint) (model.TradeInQuote, error) {
+	quote := model.TradeInQuote{}
+	if err := tu.tr.GetQuoteByID(&quote, id); err != nil {
+		return model.TradeInQuote{}, err
+	}
+	if quote.UserID != userID {
+		return model.TradeInQuote{}, gorm.ErrRecordNotFound
+	}
+	return quote, nil
+}
+
+// スタッフの査定待ち一覧
+func (tu *tradeInUsecase) GetPendingQuotes() ([]model.TradeInQuote, error) {
+	return tu.tr.GetQuotesByStatus(model.TradeInQuoted)
+}
+
+func (tu *tradeInUsecase) AdjustItem(staffID uint, id uint, itemID uint, req model.TradeInAdjustRequest) (model.TradeInQuote, error) {
+	if err := tu.tv.TradeInAdjustValidate(req); err != nil {
+		return model.TradeInQuote{}, err
+	}
+	quote, err := tu.getQuotedQuote(id)
+	if err != nil {
+		return model.TradeInQuote{}, err
+	}
+	var item *model.TradeInItem
+	for i := range quote.Items {
+		if quote.Items[i].ID == itemID {
+			item = &quote.Items[i]
+		}
+	}
+	if item == nil {
+		return model.TradeInQuote{}, gorm.ErrRecordNotFound
+	}
+	if req.Grade != "" || req.SellPrice > 0 {
+		if req.Grade != "" {
+			item.Grade = req.Grade
+		}
+		// 販売価格を指定しなければ、付け直したグレードの店頭価格を引き直す
+		if req.SellPrice > 0 {
+			item.SellPrice = req.SellPrice
+		} else {
+			sellPrice, err := tu.tr.GetReferencePrice(item.RecordID, item.Grade)
+			if err != nil {
+				return model.TradeInQuote{}, err
+			}
+			item.SellPrice = sellPrice
+		}
+		rules, err := tu.rulesByGrade()
+		if err != nil {
+			return model.TradeInQuote{}, err
+		}
+		if err := tu.priceItem(item, rules); err != nil {
+			return model.TradeInQuote{}, err
+		}
+		item.Adjusted = false
+	}
+	if req.CashOffer != nil {
+		item.CashOffer = *req.CashOffer
+		item.Adjusted = true
+	}
+	if req.CreditOffer != nil {
+		item.CreditOffer = *req.CreditOffer
+		item.Adjusted = true
+	}
+	sumOffers(&quote)
+	if err := tu.updateQuote(&quote, model.TradeInQuoted); err != nil {
+		return model.TradeInQuote{}, err
+	}
+	return quote, nil
+}
+
+// 買取成立、顧客が選んだ受取方法の金額で確定し、買取品を指定の拠点に入庫する
+// 店内クレジットで受取る場合は、顧客の店内クレジットに付与する
+// 先に状態を進めておき、同じ査定が二重に入庫・付与されないようにする
+// 入庫か付与に失敗した場合は査定中に戻す(入庫済みなら在庫も戻す)
+func (tu *tradeInUsecase) Accept(staffID uint, id uint, req model.TradeInDecisionRequest) (model.TradeInQuote, error) {
+	if err := tu.tv.TradeInAcceptValidate(req); err != nil {
+		return model.TradeInQuote{}, err
+	}
+	quote, err := tu.getQuotedQuote(id)
+	if err != nil {
+		return model.TradeInQuote{}, err
+	}
+	quote.Status = model.TradeInAccepted
+	quote.Payout = req.Payout
+	quote.PayoutAmount = quote.CashTotal
+	if req.Payout == model.PayoutStoreCredit {
+		quote.PayoutAmount = quote.CreditTotal
+	}
+	quote.DecidedBy = &staffID
+	quote.Note = req.Note
+	if err := tu.updateQuote(&quote, model.TradeInQuoted); err != nil {
+		return model.TradeInQuote{}, err
+	}
+	var movements []model.StockMovement
+	for _, item := range quote.Items {
+		movements = append(movements, model.StockMovement{
+			LocationID:    req.LocationID,
+			RecordID:      item.RecordID,
+			Grade:         item.Grade,
+			Delta:         1,
+			Reason:        model.MovementTradeIn,
+			ReferenceType: "trade_in_quote",
+			ReferenceID:   quote.ID,
+			ActorID:       staffID,
+		})
+	}
+	rollback := func(cause error, note string) error {
+		quote.Status = model.TradeInQuoted
+		quote.Payout = ""
+		quote.PayoutAmount = 0
+		quote.DecidedBy = nil
+		quote.Note = note
+		if err := tu.updateQuote(&quote, model.TradeInAccepted); err != nil {
+			return errors.Join(cause, err)
+		}
+		return cause
+	}
+	if stockErr := tu.iu.ApplyMovements(movements); stockErr != nil {
+		return model.TradeInQuote{}, rollback(stockErr, fmt.Sprintf("restock failed: %v", stockErr))
+	}
+	if quote.Payout == model.PayoutStoreCredit && quote.PayoutAmount > 0 {
+		grant := model.StoreCreditGrantRequest{UserID: quote.UserID, Amount: quote.PayoutAmount, Note: "trade-in payout"}
+		if _, creditErr := tu.gu.GrantStoreCredit(staffID, grant, "trade_in_quote", quote.ID); creditErr != nil {
+			for i := range movements {
+				movements[i].ID = 0
+				movements[i].Delta = -1
+				movements[i].Reason = model.MovementAdjust
+				movements[i].Note = "store credit payout failed"
+			}
+			if err := tu.iu.ApplyMovements(movements); err != nil {
+				creditErr = errors.Join(creditErr, err)
+			}
+			return model.TradeInQuote{}, rollback(creditErr, fmt.Sprintf("store credit payout failed: %v", creditErr))
+		}
+	}
+	return quote, nil
+}
+
+func (tu *tradeInUsecase) Reject(staffID uint, id uint, req model.TradeInDecisionRequest) (model.TradeInQuote, error) {
+	quote, err := tu.getQuotedQuote(id)
+	if err != nil {
+		return model.TradeInQuote{}, err
+	}
+	quote.Status = model.TradeInRejected
+	quote.DecidedBy = &staffID
+	quote.Note = req.Note
+	if err := tu.updateQuote(&quote, model.TradeInQuoted); err != nil {
+		return model.TradeInQuote{}, err
+	}
+	return quote, nil
+}
+
+// 調整・成立・不成立は査定額の提示中のみ
+func (tu *tradeInUsecase) getQuotedQuote(id uint) (model.TradeInQuote, error) {
+	quote := model.TradeInQuote{}
+	if err := tu.tr.GetQuoteByID(&quote, id); err != nil {
+		return model.TradeInQuote{}, err
+	}
+	if quote.Status != model.TradeInQuoted {
+		return model.TradeInQuote{}, fmt.Errorf("%w: trade-in quote is %s", ErrInvalidState, quote.Status)
+	}
+	return quote, nil
+}
+
+func (tu *tradeInUsecase) updateQuote(quote *model.TradeInQuote, fromStatus string) error {
+	if err := tu.tr.UpdateQuote(quote, fromStatus); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return fmt.Errorf("%w: %v", ErrInvalidState, err)
+		}
+		return err
+	}
+	return nil
+}
+
+func (tu *tradeInUsecase) rulesByGrade() (map[string]model.TradeInRule, error) {
+	rules, err := tu.tr.GetTradeInRules()
+	if err != nil {
+		return nil, err
+	}
+	byGrade := map[string]model.TradeInRule{}
+	for _, rule := range rules {
+		byGrade[rule.Grade] = rule
+	}
+	return byGrade, nil
+}
+
+// 販売価格 × グレードごとの割合、在庫が多ければ減額
+// 買取額は10円未満を切捨て
+func (tu *tradeInUsecase) priceItem(item *model.TradeInItem, rules map[string]model.TradeInRule) error {
+	rule, ok := rules[item.Grade]
+	if !ok {
+		return fmt.Errorf("trade-in rule for grade %s is not configured", item.Grade)
+	}
+	stock, err := tu.tr.CountStock(item.RecordID)
+	if err != nil {
+		return err
+	}
+	item.StockLevel = stock
+	cash := item.SellPrice * rule.CashPercent / 100
+	credit := item.SellPrice * rule.CreditPercent / 100
+	if rule.OverstockThreshold > 0 && stock >= rule.OverstockThreshold {
+		cash = cash * (100 - rule.OverstockCutPercent) / 100
+		credit = credit * (100 - rule.OverstockCutPercent) / 100
+	}
+	item.CashOffer = cash / 10 * 10
+	item.CreditOffer = credit / 10 * 10
+	return nil
+}
+
+func sumOffers(quote *model.TradeInQuote) {
+	quote.CashTotal = 0
+	quote.CreditTotal = 0
+	for _, item := range quote.Items {
+		quote.CashTotal += item.CashOffer
+		quote.CreditTotal += item.CreditOffer
+	}
+}
@@ -0,0 +1,187 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/model"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// ログイン中の操作でパスワードが合わない場合、セッションは有効なので401ではなく409にする
+var errWrongPassword = fmt.Errorf("%w: password is incorrect", ErrInvalidState)
+
+func (uu *userUsecase) GetMe(userID uint) (model.UserResponse, error) {
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, userID); err != nil {
+		return model.UserResponse{}, err
+	}
+	return userResponse(user), nil
+}
+
+// パスワードの変更、盗まれたセッションも使えなくなるように全端末のトークンを失効させる(ログインし直す)
+func (uu *userUsecase) ChangePassword(userID uint, req model.ChangePasswordRequest) error {
+	if err := uu.uv.ChangePasswordValidate(req); err != nil {
+		return err
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, userID); err != nil {
+		return err
+	}
+	if err := uu.verifyAccountPassword(user, req.CurrentPassword); err != nil {
+		return err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), 10)
+	if err != nil {
+		return err
+	}
+	if err := uu.ur.UpdatePassword(user.ID, string(hash)); err != nil {
+		return err
+	}
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventPasswordChanged, UserID: &user.ID, Email: user.Email})
+	if err := uu.RevokeAllTokens(user.ID, user.ID); err != nil {
+		return err
+	}
+	body := "The password for your account was changed.\n\n" +
+		"If you did not make this change, reset your password immediately from the login page."
+	if err := uu.ms.Send(user.Email, "Your password was changed", body); err != nil {
+		log.Printf("password change notice to user %d failed: %v", user.ID, err)
+	}
+	return nil
+}
+
+// メールアドレスの変更、新しいアドレスに確認リンクを送り、リンクを開くまでは今のアドレスのまま
+// 乗っ取りに気付けるように、今のアドレスにも変更の依頼があったことを知らせる
+// 未確認のユーザも使える(サインアップ時のアドレスの誤りを直すため)
+func (uu *userUsecase) ChangeEmail(userID uint, req model.ChangeEmailRequest) error {
+	if err := uu.uv.ChangeEmailValidate(req); err != nil {
+		return err
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, userID); err != nil {
+		return err
+	}
+	if err := uu.verifyAccountPassword(user, req.Password); err != nil {
+		return err
+	}
+	if req.Email == user.Email {
+		return fmt.Errorf("%w: this is already your email address", ErrInvalidState)
+	}
+	if err := uu.checkEmailAvailable(req.Email, user.ID); err != nil {
+		return err
+	}
+	latest := model.EmailVerificationToken{}
+	err := uu.tr.GetLatestVerificationToken(&latest, userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil && time.Since(latest.CreatedAt) < verificationResendInterval {
+		return fmt.Errorf("%w: verification mail was sent recently, try again later", ErrInvalidState)
+	}
+	rawToken, err := common.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	token := model.EmailVerificationToken{
+		UserID:    user.ID,
+		Email:     req.Email,
+		TokenHash: common.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(verificationTokenTTL),
+	}
+	if err := uu.tr.CreateVerificationToken(&token); err != nil {
+		return err
+	}
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventEmailChangeRequested, UserID: &user.ID, Email: user.Email,
+		Details: req.Email})
+	link := os.Getenv("FE_URL") + "/verify-email?token=" + rawToken
+	body := fmt.Sprintf("Please confirm your new email address by opening the link below (valid for %d hours).\n\n%s\n\n"+
+		"Your email address will not change until it is confirmed.", int(verificationTokenTTL.Hours()), link)
+	if err := uu.ms.Send(req.Email, "Confirm your new email address", body); err != nil {
+		return err
+	}
+	notice := fmt.Sprintf("A change of the email address for your account to %s was requested.\n\n"+
+		"If you did not request this, change your password immediately.", req.Email)
+	if err := uu.ms.Send(user.Email, "Email address change requested", notice); err != nil {
+		log.Printf("email change notice to user %d failed: %v", user.ID, err)
+	}
+	return nil
+}
+
+// 退会、全端末のトークンを失効させてからアカウントを消す
+// 外部のIDプロバイダでのみログインしていた場合は、パスワード再設定でパスワードを設定してから退会する
+// 最後の管理者は退会できない(管理者がいなくなるので)
+func (uu *userUsecase) DeleteAccount(userID uint, req model.DeleteAccountRequest) error {
+	if err := uu.uv.DeleteAccountValidate(req); err != nil {
+		return err
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, userID); err != nil {
+		return err
+	}
+	if err := uu.verifyAccountPassword(user, req.Password); err != nil {
+		return err
+	}
+	if user.Role == model.RoleAdmin {
+		admins, err := uu.ur.CountUsersByRole(model.RoleAdmin)
+		if err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return fmt.Errorf("%w: the last admin cannot delete the account", ErrInvalidState)
+		}
+	}
+	if err := uu.RevokeAllTokens(user.ID, user.ID); err != nil {
+		return err
+	}
+	if err := uu.ur.DeleteUser(&user, time.Now()); err != nil {
+		return err
+	}
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventAccountDeleted, UserID: &user.ID, Email: user.Email})
+	body := "Your account has been deleted. Thank you for shopping with us."
+	if err := uu.ms.Send(user.Email, "Your account was deleted", body); err != nil {
+		log.Printf("account deletion notice to user %d failed: %v", user.ID, err)
+	}
+	return nil
+}
+
+// ログイン中の操作でのパスワードの確認
+// 盗まれたセッションで総当たりされないように、間違いはアカウント単位で数えてロックの対象にする
+func (uu *userUsecase) verifyAccountPassword(user model.User, password string) error {
+	keys := accountThrottleKeys(user.Email)
+	if err := uu.checkLoginThrottle(user.Email, "", keys); err != nil {
+		return err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		uu.recordLoginFailure(&user.ID, user.Email, "", keys, "wrong password")
+		return errWrongPassword
+	}
+	return nil
+}
+
+// 他のユーザが使っているアドレスには変更できない
+func (uu *userUsecase) checkEmailAvailable(email string, userID uint) error {
+	other := model.User{}
+	err := uu.ur.GetUserByEmail(&other, email)
+	if err == nil && other.ID != userID {
+		return fmt.Errorf("%w: the email address is already in use", ErrInvalidState)
+	}
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	return nil
+}
+
+// レスポンス用、パスワードなどを含めない
+func userResponse(user model.User) model.UserResponse {
+	return model.UserResponse{
+		ID:            user.ID,
+		Email:         user.Email,
+		Role:          user.Role,
+		EmailVerified: user.EmailVerified,
+	}
+}
@@ -0,0 +1,248 @@
+package usecase
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/oidc"
+	"record-shop-rest-api/repository"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// 認可画面からコールバックまでに掛けられる時間
+const oidcLoginStateTTL = 10 * time.Minute
+
+// 外部のIDプロバイダでのログインを始める、戻り値は認可画面のURLとCookieに入れるstate
+func (uu *userUsecase) StartOIDCLogin(providerName string, loginHint string) (string, string, error) {
+	return uu.startOIDC(providerName, loginHint, nil)
+}
+
+// ログイン中の利用者のアカウントに、外部のIDプロバイダのアカウントを紐付ける
+// (メールアドレスが違う、または確認済みでないアカウントを紐付ける場合)
+func (uu *userUsecase) StartOIDCLink(userID uint, providerName string) (string, string, error) {
+	return uu.startOIDC(providerName, "", &userID)
+}
+
+func (uu *userUsecase) startOIDC(providerName string, loginHint string, linkUserID *uint) (string, string, error) {
+	provider, err := uu.oidcProvider(providerName)
+	if err != nil {
+		return "", "", err
+	}
+	state, err := common.RandomToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := common.RandomToken(16)
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", "", err
+	}
+	loginState := model.OIDCLoginState{
+		StateHash:    common.HashToken(state),
+		Provider:     providerName,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		ExpiresAt:    time.Now().Add(oidcLoginStateTTL),
+	}
+	if err := uu.ir.CreateLoginState(&loginState); err != nil {
+		return "", "", err
+	}
+	return provider.AuthCodeURL(state, nonce, oidc.CodeChallenge(verifier), loginHint), state, nil
+}
+
+// IDプロバイダからのコールバック
+// stateCookie: ブラウザに渡したstate、別のブラウザで始めたログインを完了させられないようにする(ログインCSRF対策)
+// 紐付け済みのアカウントならそのユーザで、無ければ確認済みのメールアドレスで既存のユーザに紐付けるか新規登録する
+// 2段階認証が有効なユーザは、パスワードでのログインと同じくチャレンジを返す
+func (uu *userUsecase) CompleteOIDCLogin(providerName string, code string, state string, stateCookie string, ip string) (model.OIDCCallbackResult, error) {
+	provider, err := uu.oidcProvider(providerName)
+	if err != nil {
+		return model.OIDCCallbackResult{}, err
+	}
+	if code == "" || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(stateCookie)) != 1 {
+		return model.OIDCCallbackResult{}, fmt.Errorf("%w: login state does not match", ErrUnauthorized)
+	}
+	loginState := model.OIDCLoginState{}
+	if err := uu.ir.GetLoginStateByHash(&loginState, common.HashToken(state)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.OIDCCallbackResult{}, fmt.Errorf("%w: login state is invalid", ErrUnauthorized)
+		}
+		return model.OIDCCallbackResult{}, err
+	}
+	now := time.Now()
+	if loginState.Provider != providerName || loginState.UsedAt != nil || !now.Before(loginState.ExpiresAt) {
+		return model.OIDCCallbackResult{}, fmt.Errorf("%w: login state is expired, log in again", ErrUnauthorized)
+	}
+	if err := uu.ir.UseLoginState(&loginState, now); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.OIDCCallbackResult{}, fmt.Errorf("%w: login state is already used", ErrUnauthorized)
+		}
+		return model.OIDCCallbackResult{}, err
+	}
+	claims, err := provider.Exchange(context.Background(), code, loginState.CodeVerifier, loginState.Nonce)
+	if err != nil {
+		log.Printf("oidc exchange with %s failed: %v", providerName, err)
+		return model.OIDCCallbackResult{}, fmt.Errorf("%w: could not verify the sign-in with %s", ErrUnauthorized, providerName)
+	}
+	if loginState.LinkUserID != nil {
+		if err := uu.linkIdentity(*loginState.LinkUserID, providerName, claims, ip); err != nil {
+			return model.OIDCCallbackResult{}, err
+		}
+		return model.OIDCCallbackResult{Linked: true}, nil
+	}
+	user, err := uu.resolveOIDCUser(providerName, claims, ip, now)
+	if err != nil {
+		return model.OIDCCallbackResult{}, err
+	}
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventOIDCLogin, UserID: &user.ID, Email: user.Email, IP: ip, Details: providerName})
+	twoFactor := model.TwoFactor{}
+	err = uu.fr.GetTwoFactor(&twoFactor, user.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.OIDCCallbackResult{}, err
+	}
+	if err == nil && twoFactor.Enabled {
+		result, err := uu.newLoginChallenge(user)
+		return model.OIDCCallbackResult{Login: result}, err
+	}
+	familyID, err := common.RandomToken(16)
+	if err != nil {
+		return model.OIDCCallbackResult{}, err
+	}
+	tokens, err := uu.issueTokens(user, familyID, false)
+	if err != nil {
+		return model.OIDCCallbackResult{}, err
+	}
+	return model.OIDCCallbackResult{Login: model.LoginResult{User: userResponse(user), Tokens: tokens}}, nil
+}
+
+// 紐付け済みならそのユーザ、無ければ確認済みのメールアドレスで既存のユーザに紐付けるか新規登録する
+// 確認済みでないアドレスで紐付けると、他人のアドレスを名乗ったアカウントで乗っ取れてしまうので受付けない
+// 既存のユーザ側も確認済みの場合のみ自動で紐付ける、未確認ならログインしてからの明示的な紐付け(StartOIDCLink)に回す
+func (uu *userUsecase) resolveOIDCUser(providerName string, claims oidc.Claims, ip string, now time.Time) (model.User, error) {
+	user := model.User{}
+	identity := model.UserIdentity{}
+	err := uu.ir.GetIdentity(&identity, providerName, claims.Subject)
+	if err == nil {
+		identity.Email = claims.Email
+		if err := uu.ir.TouchIdentity(&identity, now); err != nil {
+			log.Printf("updating identity %d failed: %v", identity.ID, err)
+		}
+		if err := uu.ur.GetUserByID(&user, identity.UserID); err != nil {
+			return model.User{}, err
+		}
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.User{}, err
+	}
+	if !claims.EmailVerified {
+		return model.User{}, fmt.Errorf("%w: the email address is not verified by %s, log in with your password and link the account from your settings", ErrInvalidState, providerName)
+	}
+	identity = model.UserIdentity{Provider: providerName, Subject: claims.Subject, Email: claims.Email, LastLoginAt: &now}
+	err = uu.ur.GetUserByEmail(&user, claims.Email)
+	if err == nil {
+		// こちらで未確認のアドレスは、アドレスを先に登録しただけの他人のアカウントかもしれないので自動では紐付けない
+		// (紐付けるとパスワードを知っている登録者と両方からログインできてしまう)
+		if !user.EmailVerified {
+			return model.User{}, fmt.Errorf("%w: an account with this email address exists but is not verified, log in with your password and link %s from your settings", ErrInvalidState, providerName)
+		}
+		identity.UserID = user.ID
+		if err := uu.ir.LinkIdentity(&identity, false, now); err != nil {
+			if errors.Is(err, repository.ErrStaleObject) {
+				return model.User{}, fmt.Errorf("%w: the account is being linked by another request, try again", ErrInvalidState)
+			}
+			return model.User{}, err
+		}
+		uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventIdentityLinked, UserID: &user.ID, Email: user.Email, IP: ip, Details: providerName + " (verified email)"})
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.User{}, err
+	}
+	// パスワードでログインできないように、誰も知らないランダムな値を入れる(必要ならパスワード再設定で設定する)
+	password, err := common.RandomToken(32)
+	if err != nil {
+		return model.User{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), 10)
+	if err != nil {
+		return model.User{}, err
+	}
+	user = model.User{
+		Email:           claims.Email,
+		Password:        string(hash),
+		Role:            model.RoleCustomer,
+		EmailVerified:   true,
+		EmailVerifiedAt: &now,
+	}
+	if err := uu.ir.CreateUserWithIdentity(&user, &identity); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.User{}, fmt.Errorf("%w: the account is being created by another request, try again", ErrInvalidState)
+		}
+		return model.User{}, err
+	}
+	return user, nil
+}
+
+// ログイン中の利用者への明示的な紐付け、アドレスが違っても紐付けられる
+// 既に別のユーザに紐付いているアカウントは付け替えない
+func (uu *userUsecase) linkIdentity(userID uint, providerName string, claims oidc.Claims, ip string) error {
+	identity := model.UserIdentity{}
+	err := uu.ir.GetIdentity(&identity, providerName, claims.Subject)
+	if err == nil {
+		if identity.UserID != userID {
+			return fmt.Errorf("%w: this %s account is linked to another user", ErrInvalidState, providerName)
+		}
+		return nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, userID); err != nil {
+		return err
+	}
+	identity = model.UserIdentity{UserID: userID, Provider: providerName, Subject: claims.Subject, Email: claims.Email}
+	verifyEmail := claims.EmailVerified && claims.Email == user.Email
+	if err := uu.ir.LinkIdentity(&identity, verifyEmail, time.Now()); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return fmt.Errorf("%w: this %s account is linked to another user", ErrInvalidState, providerName)
+		}
+		return err
+	}
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventIdentityLinked, UserID: &userID, Email: user.Email, IP: ip, Details: providerName})
+	return nil
+}
+
+func (uu *userUsecase) GetOwnIdentities(userID uint) ([]model.UserIdentity, error) {
+	return uu.ir.GetIdentitiesByUser(userID)
+}
+
+// 紐付けの解除、IDプロバイダでのみログインしていた場合はパスワード再設定でパスワードを設定できる
+func (uu *userUsecase) UnlinkIdentity(userID uint, id uint, ip string) error {
+	if err := uu.ir.DeleteIdentity(userID, id); err != nil {
+		return err
+	}
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventIdentityUnlinked, UserID: &userID, IP: ip, Details: strconv.FormatUint(uint64(id), 10)})
+	return nil
+}
+
+func (uu *userUsecase) oidcProvider(name string) (oidc.IProvider, error) {
+	provider, ok := uu.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown identity provider %q", gorm.ErrRecordNotFound, name)
+	}
+	return provider, nil
+}
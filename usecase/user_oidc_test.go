@@ -0,0 +1,180 @@
+package usecase
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/oidc"
+	"strings"
+	"testing"
+)
+
+// モックのIDプロバイダを相手にしたログイン
+type oidcFixture struct {
+	userFixture
+	idp *oidc.MockIdentityProvider
+}
+
+func newOIDCFixture(t *testing.T, users ...model.User) oidcFixture {
+	t.Helper()
+	idp, err := oidc.NewMockIdentityProvider("http://idp.test", "shop", "shop-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	providers := map[string]oidc.IProvider{"mock": idp.Provider("http://shop.test/auth/mock/callback")}
+	return oidcFixture{newUserFixture(t, providers, users...), idp}
+}
+
+// 認可画面を通して、コールバックに渡るcodeとstate、ブラウザのCookieに入れたstateを返す
+// verified: falseならフォームでemail_verifiedを外して送信する(未確認のアドレス)
+func (f oidcFixture) authorize(t *testing.T, email string, verified bool) (string, string, string) {
+	t.Helper()
+	authURL, stateCookie, err := f.uu.StartOIDCLogin("mock", email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, authURL, nil)
+	if !verified {
+		u, _ := url.Parse(authURL)
+		form := u.Query()
+		u.RawQuery = ""
+		req = httptest.NewRequest(http.MethodPost, u.String(), strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	rec := httptest.NewRecorder()
+	f.idp.ServeHTTP(rec, req)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("authorize: status %d: %s", rec.Code, rec.Body.String())
+	}
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return location.Query().Get("code"), location.Query().Get("state"), stateCookie
+}
+
+func TestCompleteOIDCLoginRejectsStateMismatch(t *testing.T) {
+	f := newOIDCFixture(t)
+	code, state, _ := f.authorize(t, "alice@example.com", true)
+	// 攻撃者が始めたログインのコールバックを、別のブラウザ(別のstateのCookie)で踏ませた場合
+	_, otherState, err := f.uu.StartOIDCLogin("mock", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.uu.CompleteOIDCLogin("mock", code, state, otherState, "192.0.2.1"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("state mismatch: got %v, want ErrUnauthorized", err)
+	}
+	if _, err := f.uu.CompleteOIDCLogin("mock", code, state, "", "192.0.2.1"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("missing state cookie: got %v, want ErrUnauthorized", err)
+	}
+	if len(f.users.users) != 0 || len(f.tokens.refreshTokens) != 0 {
+		t.Fatalf("no user or token should be created, got %d users and %d tokens", len(f.users.users), len(f.tokens.refreshTokens))
+	}
+}
+
+func TestCompleteOIDCLoginRejectsReusedState(t *testing.T) {
+	f := newOIDCFixture(t)
+	code, state, stateCookie := f.authorize(t, "alice@example.com", true)
+	if _, err := f.uu.CompleteOIDCLogin("mock", code, state, stateCookie, "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.uu.CompleteOIDCLogin("mock", code, state, stateCookie, "192.0.2.1"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("reused state: got %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestCompleteOIDCLoginRejectsNonceMismatch(t *testing.T) {
+	f := newOIDCFixture(t)
+	code, state, stateCookie := f.authorize(t, "alice@example.com", true)
+	// IDトークンのnonceが、このログインで渡したものと違う(別のログインのIDトークンの差込み)
+	f.identities.states[0].Nonce = "another-nonce"
+	if _, err := f.uu.CompleteOIDCLogin("mock", code, state, stateCookie, "192.0.2.1"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("nonce mismatch: got %v, want ErrUnauthorized", err)
+	}
+	if len(f.users.users) != 0 || len(f.tokens.refreshTokens) != 0 {
+		t.Fatalf("no user or token should be created, got %d users and %d tokens", len(f.users.users), len(f.tokens.refreshTokens))
+	}
+}
+
+func TestCompleteOIDCLoginRejectsWrongCodeVerifier(t *testing.T) {
+	f := newOIDCFixture(t)
+	code, state, stateCookie := f.authorize(t, "alice@example.com", true)
+	// 認可コードを横取りしても、code_verifierを知らなければ交換できない(PKCE)
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.identities.states[0].CodeVerifier = verifier
+	if _, err := f.uu.CompleteOIDCLogin("mock", code, state, stateCookie, "192.0.2.1"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("wrong code verifier: got %v, want ErrUnauthorized", err)
+	}
+	if len(f.users.users) != 0 || len(f.tokens.refreshTokens) != 0 {
+		t.Fatalf("no user or token should be created, got %d users and %d tokens", len(f.users.users), len(f.tokens.refreshTokens))
+	}
+}
+
+func TestCompleteOIDCLoginLinksVerifiedEmail(t *testing.T) {
+	existing := model.User{ID: 7, Email: "alice@example.com", Role: model.RoleCustomer, EmailVerified: true}
+	f := newOIDCFixture(t, existing)
+	code, state, stateCookie := f.authorize(t, "alice@example.com", true)
+	result, err := f.uu.CompleteOIDCLogin("mock", code, state, stateCookie, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Login.User.ID != existing.ID || result.Login.Tokens.AccessToken == "" {
+		t.Fatalf("should log in as the existing user, got %+v", result.Login.User)
+	}
+	if len(f.users.users) != 1 {
+		t.Fatalf("no new user should be created, got %d users", len(f.users.users))
+	}
+	if len(f.identities.identities) != 1 || f.identities.identities[0].UserID != existing.ID {
+		t.Fatalf("identity should be linked to user %d, got %+v", existing.ID, f.identities.identities)
+	}
+	if f.security.countEvents(model.SecurityEventIdentityLinked) != 1 {
+		t.Fatal("linking should be recorded as a security event")
+	}
+
+	// 2回目からは紐付け済みのアカウントとしてログインする
+	code, state, stateCookie = f.authorize(t, "alice@example.com", true)
+	result, err = f.uu.CompleteOIDCLogin("mock", code, state, stateCookie, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Login.User.ID != existing.ID || len(f.identities.identities) != 1 {
+		t.Fatalf("second login should reuse the linked identity, got user %d and %d identities", result.Login.User.ID, len(f.identities.identities))
+	}
+}
+
+func TestCompleteOIDCLoginRejectsUnverifiedExistingUser(t *testing.T) {
+	// アドレスを先に登録しただけで確認していないアカウント、登録者はパスワードを知っている
+	existing := model.User{ID: 7, Email: "alice@example.com", Role: model.RoleCustomer}
+	f := newOIDCFixture(t, existing)
+	code, state, stateCookie := f.authorize(t, "alice@example.com", true)
+	if _, err := f.uu.CompleteOIDCLogin("mock", code, state, stateCookie, "192.0.2.1"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("unverified existing user: got %v, want ErrInvalidState", err)
+	}
+	if len(f.identities.identities) != 0 || len(f.tokens.refreshTokens) != 0 {
+		t.Fatalf("nothing should be linked or issued, got %d identities and %d tokens", len(f.identities.identities), len(f.tokens.refreshTokens))
+	}
+	if f.users.users[existing.ID].EmailVerified {
+		t.Fatal("email should stay unverified")
+	}
+}
+
+func TestCompleteOIDCLoginRejectsUnverifiedEmail(t *testing.T) {
+	existing := model.User{ID: 7, Email: "alice@example.com", Role: model.RoleCustomer}
+	f := newOIDCFixture(t, existing)
+	// 他人のアドレスを名乗ったIDプロバイダのアカウントで、既存のユーザを乗っ取れないこと
+	code, state, stateCookie := f.authorize(t, "alice@example.com", false)
+	if _, err := f.uu.CompleteOIDCLogin("mock", code, state, stateCookie, "192.0.2.1"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("unverified email: got %v, want ErrInvalidState", err)
+	}
+	if len(f.identities.identities) != 0 || len(f.tokens.refreshTokens) != 0 {
+		t.Fatalf("nothing should be linked or issued, got %d identities and %d tokens", len(f.identities.identities), len(f.tokens.refreshTokens))
+	}
+	if f.users.users[existing.ID].EmailVerified {
+		t.Fatal("email should stay unverified")
+	}
+}
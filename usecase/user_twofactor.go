@@ -0,0 +1,330 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/totp"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// TOTPによる2段階認証
+// 認証アプリのコードは前後1ステップ(30秒)のずれまで許容する
+// 2段階目のコード入力は5分以内、5回まで(それ以上はパスワードからやり直し)
+const (
+	totpIssuer             = "Record Shop"
+	totpSkew               = 1
+	loginChallengeTTL      = 5 * time.Minute
+	loginChallengeAttempts = 5
+	recoveryCodeCount      = 10
+)
+
+// パスワード確認後のチャレンジを作る、トークンはCookieで渡してLoginTwoFactorで受取る
+func (uu *userUsecase) newLoginChallenge(user model.User) (model.LoginResult, error) {
+	rawToken, err := common.RandomToken(32)
+	if err != nil {
+		return model.LoginResult{}, err
+	}
+	challenge := model.LoginChallenge{
+		UserID:    user.ID,
+		TokenHash: common.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(loginChallengeTTL),
+	}
+	if err := uu.fr.CreateLoginChallenge(&challenge); err != nil {
+		return model.LoginResult{}, err
+	}
+	return model.LoginResult{
+		TwoFactorRequired:  true,
+		Challenge:          rawToken,
+		ChallengeExpiresAt: challenge.ExpiresAt,
+	}, nil
+}
+
+// 2段階目のログイン、コードが合えばJWTを発行する
+// 間違ったコードはパスワードの失敗と同じくアカウント・IP単位で数えてロックの対象にする
+func (uu *userUsecase) LoginTwoFactor(challengeToken string, req model.LoginTwoFactorRequest, ip string) (model.AuthTokens, error) {
+	if err := uu.uv.LoginTwoFactorValidate(req); err != nil {
+		return model.AuthTokens{}, err
+	}
+	if challengeToken == "" {
+		return model.AuthTokens{}, fmt.Errorf("%w: login challenge is missing", ErrUnauthorized)
+	}
+	challenge := model.LoginChallenge{}
+	if err := uu.fr.GetLoginChallengeByHash(&challenge, common.HashToken(challengeToken)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.AuthTokens{}, fmt.Errorf("%w: login challenge is invalid", ErrUnauthorized)
+		}
+		return model.AuthTokens{}, err
+	}
+	now := time.Now()
+	if challenge.UsedAt != nil || !now.Before(challenge.ExpiresAt) {
+		return model.AuthTokens{}, fmt.Errorf("%w: login challenge is expired, log in again", ErrUnauthorized)
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, challenge.UserID); err != nil {
+		return model.AuthTokens{}, err
+	}
+	keys := loginThrottleKeys(user.Email, ip)
+	if err := uu.checkLoginThrottle(user.Email, ip, keys); err != nil {
+		return model.AuthTokens{}, err
+	}
+	if err := uu.fr.CountChallengeAttempt(&challenge, loginChallengeAttempts); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.AuthTokens{}, fmt.Errorf("%w: too many attempts, log in again", ErrUnauthorized)
+		}
+		return model.AuthTokens{}, err
+	}
+	if err := uu.verifySecondFactor(user, req.Code, req.RecoveryCode, now); err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			uu.recordLoginFailure(&user.ID, user.Email, ip, keys, "wrong two-factor code")
+		}
+		return model.AuthTokens{}, err
+	}
+	if err := uu.fr.UseLoginChallenge(&challenge, now); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.AuthTokens{}, fmt.Errorf("%w: login challenge is expired, log in again", ErrUnauthorized)
+		}
+		return model.AuthTokens{}, err
+	}
+	familyID, err := common.RandomToken(16)
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
+	return uu.issueTokens(user, familyID, true)
+}
+
+// 登録の開始、秘密鍵を作って認証アプリに読込ませるURIを返す
+// 確認(ConfirmTwoFactor)するまでは有効にならない、有効化済みの場合は一度無効にしてからやり直す
+func (uu *userUsecase) EnrollTwoFactor(userID uint) (model.TwoFactorEnrollment, error) {
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, userID); err != nil {
+		return model.TwoFactorEnrollment{}, err
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return model.TwoFactorEnrollment{}, err
+	}
+	twoFactor := model.TwoFactor{UserID: userID, Secret: secret}
+	if err := uu.fr.SaveTwoFactorSecret(&twoFactor); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.TwoFactorEnrollment{}, fmt.Errorf("%w: two-factor authentication is already enabled", ErrInvalidState)
+		}
+		return model.TwoFactorEnrollment{}, err
+	}
+	uri := totp.URI(totpIssuer, user.Email, secret)
+	return model.TwoFactorEnrollment{Secret: secret, OtpauthURI: uri, QRPayload: uri}, nil
+}
+
+// 認証アプリのコードで登録を確認して有効にする、リカバリーコードはここで1回だけ返す
+// 今のセッションは2段階認証を済ませていない扱いなので、済ませたセッションのトークンを発行し直す
+func (uu *userUsecase) ConfirmTwoFactor(userID uint, req model.TwoFactorCodeRequest) (model.RecoveryCodesResponse, model.AuthTokens, error) {
+	if err := uu.uv.TwoFactorCodeValidate(req); err != nil {
+		return model.RecoveryCodesResponse{}, model.AuthTokens{}, err
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, userID); err != nil {
+		return model.RecoveryCodesResponse{}, model.AuthTokens{}, err
+	}
+	twoFactor := model.TwoFactor{}
+	if err := uu.fr.GetTwoFactor(&twoFactor, userID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.RecoveryCodesResponse{}, model.AuthTokens{}, fmt.Errorf("%w: enroll first", ErrInvalidState)
+		}
+		return model.RecoveryCodesResponse{}, model.AuthTokens{}, err
+	}
+	if twoFactor.Enabled {
+		return model.RecoveryCodesResponse{}, model.AuthTokens{}, fmt.Errorf("%w: two-factor authentication is already enabled", ErrInvalidState)
+	}
+	keys := accountThrottleKeys(user.Email)
+	if err := uu.checkLoginThrottle(user.Email, "", keys); err != nil {
+		return model.RecoveryCodesResponse{}, model.AuthTokens{}, err
+	}
+	now := time.Now()
+	step, ok := totp.Validate(twoFactor.Secret, req.Code, now, totpSkew)
+	if !ok {
+		uu.recordLoginFailure(&user.ID, user.Email, "", keys, "wrong two-factor code")
+		return model.RecoveryCodesResponse{}, model.AuthTokens{}, errWrongCode
+	}
+	rawCodes, codes, err := newRecoveryCodes(userID)
+	if err != nil {
+		return model.RecoveryCodesResponse{}, model.AuthTokens{}, err
+	}
+	if err := uu.fr.EnableTwoFactor(&twoFactor, step, codes, now); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.RecoveryCodesResponse{}, model.AuthTokens{}, fmt.Errorf("%w: two-factor authentication is already enabled", ErrInvalidState)
+		}
+		return model.RecoveryCodesResponse{}, model.AuthTokens{}, err
+	}
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventTwoFactorEnabled, UserID: &user.ID, Email: user.Email})
+	familyID, err := common.RandomToken(16)
+	if err != nil {
+		return model.RecoveryCodesResponse{}, model.AuthTokens{}, err
+	}
+	tokens, err := uu.issueTokens(user, familyID, true)
+	if err != nil {
+		return model.RecoveryCodesResponse{}, model.AuthTokens{}, err
+	}
+	return model.RecoveryCodesResponse{RecoveryCodes: rawCodes}, tokens, nil
+}
+
+// 無効化には認証アプリのコードかリカバリーコードが必要、ロールの設定で必須の場合は無効にできない
+func (uu *userUsecase) DisableTwoFactor(userID uint, req model.LoginTwoFactorRequest) error {
+	if err := uu.uv.LoginTwoFactorValidate(req); err != nil {
+		return err
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, userID); err != nil {
+		return err
+	}
+	required, err := uu.twoFactorRequired(user.Role)
+	if err != nil {
+		return err
+	}
+	if required {
+		return fmt.Errorf("%w: two-factor authentication is required for role %s", ErrInvalidState, user.Role)
+	}
+	if err := uu.verifyAccountSecondFactor(user, req.Code, req.RecoveryCode); err != nil {
+		return err
+	}
+	if err := uu.fr.DeleteTwoFactor(userID); err != nil {
+		return err
+	}
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventTwoFactorDisabled, UserID: &user.ID, Email: user.Email})
+	return nil
+}
+
+// リカバリーコードの再発行、古いコードは全て使えなくなる
+func (uu *userUsecase) RegenerateRecoveryCodes(userID uint, req model.TwoFactorCodeRequest) (model.RecoveryCodesResponse, error) {
+	if err := uu.uv.TwoFactorCodeValidate(req); err != nil {
+		return model.RecoveryCodesResponse{}, err
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, userID); err != nil {
+		return model.RecoveryCodesResponse{}, err
+	}
+	if err := uu.verifyAccountSecondFactor(user, req.Code, ""); err != nil {
+		return model.RecoveryCodesResponse{}, err
+	}
+	rawCodes, codes, err := newRecoveryCodes(userID)
+	if err != nil {
+		return model.RecoveryCodesResponse{}, err
+	}
+	if err := uu.fr.ReplaceRecoveryCodes(userID, codes); err != nil {
+		return model.RecoveryCodesResponse{}, err
+	}
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventRecoveryCodesReset, UserID: &user.ID, Email: user.Email})
+	return model.RecoveryCodesResponse{RecoveryCodes: rawCodes}, nil
+}
+
+func (uu *userUsecase) GetTwoFactorPolicies() ([]model.TwoFactorPolicy, error) {
+	return uu.fr.GetTwoFactorPolicies()
+}
+
+// 管理者によるロールごとの2段階認証の要否の設定
+func (uu *userUsecase) SetTwoFactorPolicy(adminID uint, role string, req model.TwoFactorPolicyRequest) (model.TwoFactorPolicy, error) {
+	if err := uu.uv.RoleValidate(model.RoleRequest{Role: role}); err != nil {
+		return model.TwoFactorPolicy{}, err
+	}
+	policy := model.TwoFactorPolicy{Role: role, Required: req.Required, UpdatedBy: adminID, UpdatedAt: time.Now()}
+	if err := uu.fr.SaveTwoFactorPolicy(&policy); err != nil {
+		return model.TwoFactorPolicy{}, err
+	}
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventTwoFactorPolicy, UserID: &adminID,
+		Details: fmt.Sprintf("role %s required=%t", role, req.Required)})
+	return policy, nil
+}
+
+// ロールの設定で2段階認証が必須か、設定が無ければ任意
+func (uu *userUsecase) twoFactorRequired(role string) (bool, error) {
+	policy := model.TwoFactorPolicy{}
+	if err := uu.fr.GetTwoFactorPolicy(&policy, role); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	return policy.Required, nil
+}
+
+// ログイン中の操作(確認・無効化・再発行)でコードが合わない場合、セッションは有効なので401ではなく409にする
+var errWrongCode = fmt.Errorf("%w: invalid two-factor code", ErrInvalidState)
+
+// ログイン中の操作でのコードの確認
+// 盗まれたセッションで総当たりして無効化されないように、間違いはアカウント単位で数えてロックの対象にする
+func (uu *userUsecase) verifyAccountSecondFactor(user model.User, code string, recoveryCode string) error {
+	keys := accountThrottleKeys(user.Email)
+	if err := uu.checkLoginThrottle(user.Email, "", keys); err != nil {
+		return err
+	}
+	if err := uu.verifySecondFactor(user, code, recoveryCode, time.Now()); err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			uu.recordLoginFailure(&user.ID, user.Email, "", keys, "wrong two-factor code")
+			return errWrongCode
+		}
+		return err
+	}
+	return nil
+}
+
+// 認証アプリのコード(優先)かリカバリーコードを確認して使用済みにする、合わなければerrInvalidSecondFactor
+func (uu *userUsecase) verifySecondFactor(user model.User, code string, recoveryCode string, now time.Time) error {
+	twoFactor := model.TwoFactor{}
+	if err := uu.fr.GetTwoFactor(&twoFactor, user.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: two-factor authentication is not enabled", ErrInvalidState)
+		}
+		return err
+	}
+	if !twoFactor.Enabled {
+		return fmt.Errorf("%w: two-factor authentication is not enabled", ErrInvalidState)
+	}
+	if code != "" {
+		step, ok := totp.Validate(twoFactor.Secret, code, now, totpSkew)
+		if !ok {
+			return errInvalidSecondFactor
+		}
+		// 使用済みのコード(同じステップ)の再利用も失敗にする
+		if err := uu.fr.UseTwoFactorStep(user.ID, step); err != nil {
+			if errors.Is(err, repository.ErrStaleObject) {
+				return errInvalidSecondFactor
+			}
+			return err
+		}
+		return nil
+	}
+	if err := uu.fr.UseRecoveryCode(user.ID, common.HashToken(normalizeRecoveryCode(recoveryCode)), now); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return errInvalidSecondFactor
+		}
+		return err
+	}
+	uu.securityEvent(model.SecurityEvent{Type: model.SecurityEventRecoveryCodeUsed, UserID: &user.ID, Email: user.Email})
+	return nil
+}
+
+// xxxxx-xxxxx形式(16進10桁)のリカバリーコードと、保存用のハッシュ
+func newRecoveryCodes(userID uint) ([]string, []model.RecoveryCode, error) {
+	rawCodes := make([]string, 0, recoveryCodeCount)
+	codes := make([]model.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw, err := common.RandomToken(5)
+		if err != nil {
+			return nil, nil, err
+		}
+		rawCodes = append(rawCodes, raw[:5]+"-"+raw[5:])
+		codes = append(codes, model.RecoveryCode{UserID: userID, CodeHash: common.HashToken(raw)})
+	}
+	return rawCodes, codes, nil
+}
+
+// 入力の揺れ(区切りの有無、大文字、空白)を吸収する
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
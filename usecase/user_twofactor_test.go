@@ -0,0 +1,99 @@
+package usecase
+
+import (
+	"errors"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/totp"
+	"testing"
+	"time"
+)
+
+// 2段階認証を有効にしたユーザ、戻り値は秘密鍵
+func enableTwoFactor(t *testing.T, f userFixture, userID uint) string {
+	t.Helper()
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.twoFactors.twoFactors[userID] = &model.TwoFactor{UserID: userID, Secret: secret, Enabled: true}
+	return secret
+}
+
+func totpCode(t *testing.T, secret string, step int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, step)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return code
+}
+
+// パスワードまで済ませたチャレンジ
+func loginChallenge(t *testing.T, f userFixture, email string) string {
+	t.Helper()
+	result, err := f.uu.Login(model.User{Email: email, Password: testPassword}, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.TwoFactorRequired || result.Challenge == "" || result.Tokens.AccessToken != "" {
+		t.Fatalf("login should return a challenge instead of tokens, got %+v", result)
+	}
+	return result.Challenge
+}
+
+func TestLoginTwoFactorRejectsReplayedCode(t *testing.T) {
+	f := newUserFixture(t, nil, newTestUser(t, 1, "alice@example.com"))
+	secret := enableTwoFactor(t, f, 1)
+	step := totp.Step(time.Now())
+	code := totpCode(t, secret, step)
+
+	tokens, err := f.uu.LoginTwoFactor(loginChallenge(t, f, "alice@example.com"), model.LoginTwoFactorRequest{Code: code}, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tokens.AccessToken == "" {
+		t.Fatal("tokens should be issued after the second factor")
+	}
+	// パスワードを知っている攻撃者が、盗み見た同じコードを有効期間内に使い回す
+	if _, err := f.uu.LoginTwoFactor(loginChallenge(t, f, "alice@example.com"), model.LoginTwoFactorRequest{Code: code}, "192.0.2.1"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("replayed code: got %v, want ErrUnauthorized", err)
+	}
+	// 使ったステップより前のコードも、時計のずれの許容範囲内でも使えない
+	if _, err := f.uu.LoginTwoFactor(loginChallenge(t, f, "alice@example.com"), model.LoginTwoFactorRequest{Code: totpCode(t, secret, step-1)}, "192.0.2.1"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("code of an earlier step: got %v, want ErrUnauthorized", err)
+	}
+	if f.security.countEvents(model.SecurityEventLoginFailed) != 2 {
+		t.Fatal("rejected codes should be counted as login failures")
+	}
+	// 次のステップのコードは使える
+	if _, err := f.uu.LoginTwoFactor(loginChallenge(t, f, "alice@example.com"), model.LoginTwoFactorRequest{Code: totpCode(t, secret, step+1)}, "192.0.2.1"); err != nil {
+		t.Fatalf("code of the next step: %v", err)
+	}
+}
+
+func TestLoginTwoFactorChallengeIsSingleUse(t *testing.T) {
+	f := newUserFixture(t, nil, newTestUser(t, 1, "alice@example.com"))
+	secret := enableTwoFactor(t, f, 1)
+	step := totp.Step(time.Now())
+	challenge := loginChallenge(t, f, "alice@example.com")
+	if _, err := f.uu.LoginTwoFactor(challenge, model.LoginTwoFactorRequest{Code: totpCode(t, secret, step)}, "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.uu.LoginTwoFactor(challenge, model.LoginTwoFactorRequest{Code: totpCode(t, secret, step+1)}, "192.0.2.1"); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("used challenge: got %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestLoginTwoFactorLimitsAttempts(t *testing.T) {
+	f := newUserFixture(t, nil, newTestUser(t, 1, "alice@example.com"))
+	secret := enableTwoFactor(t, f, 1)
+	challenge := loginChallenge(t, f, "alice@example.com")
+	for i := 0; i < loginChallengeAttempts; i++ {
+		f.uu.LoginTwoFactor(challenge, model.LoginTwoFactorRequest{Code: "000000"}, "192.0.2.1")
+	}
+	// 回数を超えたら、正しいコードでもパスワードからやり直し
+	code := totpCode(t, secret, totp.Step(time.Now()))
+	if _, err := f.uu.LoginTwoFactor(challenge, model.LoginTwoFactorRequest{Code: code}, "192.0.2.1"); err == nil {
+		t.Fatal("the challenge should be unusable after too many attempts")
+	}
+}
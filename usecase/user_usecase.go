@@ -1,41 +1,310 @@
 package usecase
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"os"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/mail"
 	"record-shop-rest-api/model"
+	"record-shop-rest-api/oidc"
 	"record-shop-rest-api/repository"
 	"record-shop-rest-api/validator"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type IUserUsecase interface {
-	Login(user model.User) (string, error)
+	Login(user model.User, ip string) (model.LoginResult, error)
+	LoginTwoFactor(challengeToken string, req model.LoginTwoFactorRequest, ip string) (model.AuthTokens, error)
+	Refresh(refreshToken string) (model.AuthTokens, error)
+	ParseAccessToken(tokenString string) (*jwt.Token, error)
+	Logout(accessToken string, refreshToken string) error
+	RevokeAllTokens(actorID uint, userID uint) error
 	SignUp(user model.User) (model.UserResponse, error)
+	VerifyEmail(req model.EmailVerificationRequest) error
+	ResendVerification(userID uint) error
+	ForgotPassword(req model.PasswordForgotRequest) error
+	ResetPassword(req model.PasswordResetRequest) error
+	AssignRole(adminID uint, userID uint, req model.RoleRequest) (model.UserResponse, error)
+	EnrollTwoFactor(userID uint) (model.TwoFactorEnrollment, error)
+	ConfirmTwoFactor(userID uint, req model.TwoFactorCodeRequest) (model.RecoveryCodesResponse, model.AuthTokens, error)
+	DisableTwoFactor(userID uint, req model.LoginTwoFactorRequest) error
+	RegenerateRecoveryCodes(userID uint, req model.TwoFactorCodeRequest) (model.RecoveryCodesResponse, error)
+	GetTwoFactorPolicies() ([]model.TwoFactorPolicy, error)
+	SetTwoFactorPolicy(adminID uint, role string, req model.TwoFactorPolicyRequest) (model.TwoFactorPolicy, error)
+	StartOIDCLogin(providerName string, loginHint string) (string, string, error)
+	StartOIDCLink(userID uint, providerName string) (string, string, error)
+	CompleteOIDCLogin(providerName string, code string, state string, stateCookie string, ip string) (model.OIDCCallbackResult, error)
+	GetOwnIdentities(userID uint) ([]model.UserIdentity, error)
+	UnlinkIdentity(userID uint, id uint, ip string) error
+	GetMe(userID uint) (model.UserResponse, error)
+	ChangePassword(userID uint, req model.ChangePasswordRequest) error
+	ChangeEmail(userID uint, req model.ChangeEmailRequest) error
+	DeleteAccount(userID uint, req model.DeleteAccountRequest) error
 }
 
 type userUsecase struct {
 	ur repository.IUserRepository
 	uv validator.IUserValidator
+	tr repository.ITokenRepository
+	rc *revocationCache
+	ms mail.IMailSender
+	sr repository.ISecurityRepository
+	fr repository.ITwoFactorRepository
+	ir repository.IIdentityRepository
+	// 外部のIDプロバイダ、キーはURLに使う名前(google、line等)
+	providers map[string]oidc.IProvider
 }
 
-func NewUserUsecase(ur repository.IUserRepository, uv validator.IUserValidator) IUserUsecase {
-	return &userUsecase{ur, uv}
+func NewUserUsecase(ur repository.IUserRepository, uv validator.IUserValidator, tr repository.ITokenRepository,
+	ms mail.IMailSender, sr repository.ISecurityRepository, fr repository.ITwoFactorRepository,
+	ir repository.IIdentityRepository, providers map[string]oidc.IProvider) IUserUsecase {
+	return &userUsecase{ur, uv, tr, newRevocationCache(tr), ms, sr, fr, ir, providers}
 }
 
-func (uu *userUsecase) Login(user model.User) (string, error) {
+// アクセストークンは短命にして、期限が切れたらリフレッシュトークンで取り直す
+const (
+	accessTokenTTL  = 15 * time.Minute
+	refreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// メールアドレス確認のリンクの有効期限と、再送できる間隔
+const (
+	verificationTokenTTL       = 24 * time.Hour
+	verificationResendInterval = time.Minute
+)
+
+// パスワード再設定のリンクの有効期限と、再発行できる間隔
+const (
+	passwordResetTokenTTL       = time.Hour
+	passwordResetResendInterval = time.Minute
+)
+
+// ip: 総当たり対策でIP単位の失敗回数を数えるのに使う
+// 2段階認証が有効なユーザはトークンを発行せず、2段階目(LoginTwoFactor)用のチャレンジを返す
+func (uu *userUsecase) Login(user model.User, ip string) (model.LoginResult, error) {
 	if err := uu.uv.UserValidate(user); err != nil {
-		return "", err
+		return model.LoginResult{}, err
+	}
+	keys := loginThrottleKeys(user.Email, ip)
+	if err := uu.checkLoginThrottle(user.Email, ip, keys); err != nil {
+		return model.LoginResult{}, err
 	}
 	storedUser := model.User{}
 	if err := uu.ur.GetUserByEmail(&storedUser, user.Email); err != nil {
-		return "", err
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.LoginResult{}, err
+		}
+		// 応答時間の差でアカウントの有無が分からないように、存在しない場合もパスワードを照合する
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(user.Password))
+		uu.recordLoginFailure(nil, user.Email, ip, keys, "unknown email")
+		return model.LoginResult{}, errInvalidCredentials
 	}
 	// テーブルのpwと、入力されたpw比較
 	// bcryptでハッシュ化されたパスワードと、それに相当する可能性のある平文とを比較
 	err := bcrypt.CompareHashAndPassword([]byte(storedUser.Password), []byte(user.Password))
+	if err != nil {
+		uu.recordLoginFailure(&storedUser.ID, user.Email, ip, keys, "wrong password")
+		return model.LoginResult{}, errInvalidCredentials
+	}
+	// 成功したらアカウントの失敗回数は消す(IPの方は他のアカウントへの試行もあり得るので残す)
+	if err := uu.sr.ResetLoginThrottle(keys[0].key); err != nil {
+		log.Printf("resetting login throttle for user %d failed: %v", storedUser.ID, err)
+	}
+	twoFactor := model.TwoFactor{}
+	err = uu.fr.GetTwoFactor(&twoFactor, storedUser.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return model.LoginResult{}, err
+	}
+	if err == nil && twoFactor.Enabled {
+		return uu.newLoginChallenge(storedUser)
+	}
+	// ログインごとに新しいリフレッシュトークンの系列を始める
+	familyID, err := common.RandomToken(16)
+	if err != nil {
+		return model.LoginResult{}, err
+	}
+	tokens, err := uu.issueTokens(storedUser, familyID, false)
+	if err != nil {
+		return model.LoginResult{}, err
+	}
+	return model.LoginResult{User: userResponse(storedUser), Tokens: tokens}, nil
+}
+
+// リフレッシュトークンを使って、アクセストークンとリフレッシュトークンを新しいものに交換する
+// 使用済みのトークンが提示された場合は、盗まれたトークンが使われたとみなして系列ごと失効させる
+// (正規の利用者も次のリフレッシュで失敗するので、再ログインが必要になる)
+func (uu *userUsecase) Refresh(refreshToken string) (model.AuthTokens, error) {
+	if refreshToken == "" {
+		return model.AuthTokens{}, ErrUnauthorized
+	}
+	stored := model.RefreshToken{}
+	if err := uu.tr.GetRefreshTokenByHash(&stored, common.HashToken(refreshToken)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.AuthTokens{}, ErrUnauthorized
+		}
+		return model.AuthTokens{}, err
+	}
+	now := time.Now()
+	if stored.RevokedAt != nil {
+		return model.AuthTokens{}, fmt.Errorf("%w: refresh token is revoked", ErrUnauthorized)
+	}
+	if stored.UsedAt != nil {
+		return model.AuthTokens{}, uu.revokeReusedFamily(stored, now)
+	}
+	if !now.Before(stored.ExpiresAt) {
+		return model.AuthTokens{}, fmt.Errorf("%w: refresh token is expired", ErrUnauthorized)
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, stored.UserID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return model.AuthTokens{}, ErrUnauthorized
+		}
+		return model.AuthTokens{}, err
+	}
+	tokens, next, err := uu.newTokens(user, stored.FamilyID, stored.MFA, now)
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
+	if err := uu.tr.RotateRefreshToken(&stored, &next, now); err != nil {
+		// 読込んだ後に別のリクエストで使われた(同じトークンの同時使用も再利用として扱う)
+		if errors.Is(err, repository.ErrStaleObject) {
+			return model.AuthTokens{}, uu.revokeReusedFamily(stored, now)
+		}
+		return model.AuthTokens{}, err
+	}
+	return tokens, nil
+}
+
+// JWTミドルウェアから呼ぶ、署名と有効期限に加えて失効していないかを確認する
+// jtiの無いトークン(失効の仕組みを入れる前に発行されたもの)は失効させられないので受付けない
+func (uu *userUsecase) ParseAccessToken(tokenString string) (*jwt.Token, error) {
+	token, err := parseAccessToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	claims := token.Claims.(jwt.MapClaims)
+	jti, _ := claims["jti"].(string)
+	userID, _ := claims["user_id"].(float64)
+	issuedAt, err := claims.GetIssuedAt()
+	if jti == "" || err != nil || issuedAt == nil {
+		return nil, fmt.Errorf("%w: token has no jti or iat", ErrUnauthorized)
+	}
+	if uu.rc.isRevoked(jti, uint(userID), issuedAt.Time) {
+		return nil, fmt.Errorf("%w: token is revoked", ErrUnauthorized)
+	}
+	return token, nil
+}
+
+// このトークンでのログアウト、アクセストークンを失効させて、リフレッシュトークンの系列も失効させる
+// 期限切れ・不正なアクセストークンは元々使えないので記録しない
+func (uu *userUsecase) Logout(accessToken string, refreshToken string) error {
+	if token, err := parseAccessToken(accessToken); err == nil {
+		claims := token.Claims.(jwt.MapClaims)
+		jti, _ := claims["jti"].(string)
+		userID, _ := claims["user_id"].(float64)
+		expiresAt, err := claims.GetExpirationTime()
+		if jti != "" && err == nil && expiresAt != nil {
+			revoked := model.RevokedToken{JTI: jti, UserID: uint(userID), ExpiresAt: expiresAt.Time}
+			if err := uu.tr.RevokeAccessToken(&revoked); err != nil {
+				return err
+			}
+			uu.rc.addToken(revoked)
+		}
+	}
+	if refreshToken == "" {
+		return nil
+	}
+	stored := model.RefreshToken{}
+	if err := uu.tr.GetRefreshTokenByHash(&stored, common.HashToken(refreshToken)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	return uu.tr.RevokeFamily(stored.FamilyID, time.Now())
+}
+
+// ユーザの全てのトークンとAPIキーを失効させる、全端末からのログアウト(actorIDが本人)・パスワードの変更・再設定と管理者による強制失効で使う
+func (uu *userUsecase) RevokeAllTokens(actorID uint, userID uint) error {
+	if err := uu.ur.GetUserByID(&model.User{}, userID); err != nil {
+		return err
+	}
+	revocation := model.UserTokenRevocation{
+		UserID:        userID,
+		RevokedBefore: time.Now(),
+		RevokedBy:     actorID,
+	}
+	if err := uu.tr.RevokeUserTokens(&revocation); err != nil {
+		return err
+	}
+	uu.rc.addUser(revocation)
+	return nil
+}
+
+func (uu *userUsecase) revokeReusedFamily(stored model.RefreshToken, now time.Time) error {
+	if err := uu.tr.RevokeFamily(stored.FamilyID, now); err != nil {
+		return err
+	}
+	return fmt.Errorf("%w: refresh token reuse detected", ErrUnauthorized)
+}
+
+// 新しいトークンの組を発行して、リフレッシュトークンを保存する
+// mfa: 2段階認証を済ませたセッションか
+func (uu *userUsecase) issueTokens(user model.User, familyID string, mfa bool) (model.AuthTokens, error) {
+	tokens, refreshToken, err := uu.newTokens(user, familyID, mfa, time.Now())
+	if err != nil {
+		return model.AuthTokens{}, err
+	}
+	if err := uu.tr.CreateRefreshToken(&refreshToken); err != nil {
+		return model.AuthTokens{}, err
+	}
+	return tokens, nil
+}
+
+// アクセストークン(JWT)とリフレッシュトークンを作る、リフレッシュトークンの保存は呼出し側で行う
+func (uu *userUsecase) newTokens(user model.User, familyID string, mfa bool, now time.Time) (model.AuthTokens, model.RefreshToken, error) {
+	mfaRequired, err := uu.twoFactorRequired(user.Role)
+	if err != nil {
+		return model.AuthTokens{}, model.RefreshToken{}, err
+	}
+	accessToken, err := newAccessToken(user, now.Add(accessTokenTTL), mfa, mfaRequired)
+	if err != nil {
+		return model.AuthTokens{}, model.RefreshToken{}, err
+	}
+	rawRefreshToken, err := common.RandomToken(32)
+	if err != nil {
+		return model.AuthTokens{}, model.RefreshToken{}, err
+	}
+	refreshToken := model.RefreshToken{
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: common.HashToken(rawRefreshToken),
+		ExpiresAt: now.Add(refreshTokenTTL),
+		MFA:       mfa,
+	}
+	return model.AuthTokens{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  now.Add(accessTokenTTL),
+		RefreshToken:     rawRefreshToken,
+		RefreshExpiresAt: refreshToken.ExpiresAt,
+	}, refreshToken, nil
+}
+
+// 署名(HS256のみ)と有効期限を検証する
+func parseAccessToken(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return []byte(os.Getenv("SECRET")), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+}
+
+func newAccessToken(user model.User, expiresAt time.Time, mfa bool, mfaRequired bool) (string, error) {
+	jti, err := common.RandomToken(16)
 	if err != nil {
 		return "", err
 	}
@@ -56,9 +325,21 @@ func (uu *userUsecase) Login(user model.User) (string, error) {
 		// aud (audience): トークンが意図する相手（例えば、特定のサービスやシステム）を示すためのクレーム
 		// iss (issuer): トークンの発行者を示します。どのシステムがこのトークンを発行したかを識別する
 		// scope: トークンに関連するアクセス権限（例えば、"read" や "write" など）を示すクレーム
-		"user_id": storedUser.ID,
-		// 現在時刻の12時間後をUNIXタイムスタンプで指定
-		"exp": time.Now().Add(time.Hour * 12).Unix(),
+		"user_id": user.ID,
+		// 権限の確認に使う、ロールの変更は次のログイン・リフレッシュから反映される
+		"role": user.Role,
+		// 未確認のユーザは読取り専用、確認後は次のリフレッシュから反映される
+		"email_verified": user.EmailVerified,
+		// mfa: 2段階認証を済ませたセッションか、mfa_required: ロールの設定で2段階認証が必須か
+		// 必須なのに済ませていないセッションは読取りのみ(ロールの設定の変更は次のリフレッシュから反映される)
+		"mfa":          mfa,
+		"mfa_required": mfaRequired,
+		// 有効期限をUNIXタイムスタンプで指定、短命にしてリフレッシュトークンで取り直す
+		"exp": expiresAt.Unix(),
+		// jti: トークンごとの識別子、ログアウトで個別に失効させるのに使う
+		// iat: 全端末からのログアウトで、それ以前に発行されたトークンをまとめて失効させるのに使う
+		"jti": jti,
+		"iat": time.Now().Unix(),
 	})
 	// *jwt.Token.SignedString: JWTが改竄されていないことを保証するために、署名をトークンに追加
 	// 署名は↑のjwt.SigningMethodHS256に基づいて行われる
@@ -84,14 +365,187 @@ func (uu *userUsecase) SignUp(user model.User) (model.UserResponse, error) {
 		return model.UserResponse{}, err
 	}
 	// これで新しいstructが出来る、idはGormが自動で入れる？
-	newUser := model.User{Email: user.Email, Password: string(hash)}
+	// ロールはリクエストの値を使わず、常にcustomerで作る(管理者がAssignRoleで変更する)
+	newUser := model.User{Email: user.Email, Password: string(hash), Role: model.RoleCustomer}
 	if err := uu.ur.CreateUser(&newUser); err != nil {
 		return model.UserResponse{}, err
 	}
+	// 確認メールが送れなくてもアカウントは作成済みなので、ログに残して再送(/email/verification/resend)に任せる
+	if err := uu.sendVerification(newUser); err != nil {
+		log.Printf("verification mail to user %d failed: %v", newUser.ID, err)
+	}
 	// CreateUserが成功すれば、newUser、つまり引数が新しいユーザになっている、それを詰めて返す
-	resUser := model.UserResponse{
-		ID:    newUser.ID,
-		Email: newUser.Email,
+	return userResponse(newUser), nil
+}
+
+// 確認メールのリンクに含まれるトークンでメールアドレスを確認済みにする(変更の場合は新しいアドレスに変える)
+// ログイン中のトークンのemail_verifiedは古いままなので、クライアントは/token/refreshで取り直す
+func (uu *userUsecase) VerifyEmail(req model.EmailVerificationRequest) error {
+	if err := uu.uv.EmailVerificationValidate(req); err != nil {
+		return err
+	}
+	stored := model.EmailVerificationToken{}
+	if err := uu.tr.GetVerificationTokenByHash(&stored, common.HashToken(req.Token)); err != nil {
+		return err
+	}
+	now := time.Now()
+	if stored.UsedAt != nil {
+		return fmt.Errorf("%w: verification link is already used", ErrInvalidState)
+	}
+	if !now.Before(stored.ExpiresAt) {
+		return fmt.Errorf("%w: verification link is expired", ErrInvalidState)
+	}
+	// メールアドレスの変更の場合、依頼から確認までの間に他のユーザが使い始めていないか
+	if stored.Email != "" {
+		if err := uu.checkEmailAvailable(stored.Email, stored.UserID); err != nil {
+			return err
+		}
+	}
+	if err := uu.tr.VerifyEmail(&stored, now); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return fmt.Errorf("%w: verification link is already used", ErrInvalidState)
+		}
+		return err
+	}
+	return nil
+}
+
+// 確認メールの再送、古いリンクは使えなくなる
+// 短時間に何度も送られないように、前回の送信から一定時間は受付けない
+func (uu *userUsecase) ResendVerification(userID uint) error {
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, userID); err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return fmt.Errorf("%w: email is already verified", ErrInvalidState)
+	}
+	latest := model.EmailVerificationToken{}
+	err := uu.tr.GetLatestVerificationToken(&latest, userID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil && time.Since(latest.CreatedAt) < verificationResendInterval {
+		return fmt.Errorf("%w: verification mail was sent recently, try again later", ErrInvalidState)
+	}
+	return uu.sendVerification(user)
+}
+
+// 確認トークンを作ってメールでリンクを送る、リンクはフロントエンドの確認画面(そこから/email/verifyを呼ぶ)
+func (uu *userUsecase) sendVerification(user model.User) error {
+	rawToken, err := common.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	token := model.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: common.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(verificationTokenTTL),
+	}
+	if err := uu.tr.CreateVerificationToken(&token); err != nil {
+		return err
+	}
+	link := os.Getenv("FE_URL") + "/verify-email?token=" + rawToken
+	body := fmt.Sprintf("Please confirm your email address by opening the link below (valid for %d hours).\n\n%s\n\n"+
+		"Until your address is confirmed you can browse, but not place orders or make changes.", int(verificationTokenTTL.Hours()), link)
+	return uu.ms.Send(user.Email, "Confirm your email address", body)
+}
+
+// パスワードを忘れた場合の再設定リンクの送信
+// 登録済みのアドレスかどうかを調べられないように、存在しない場合や間隔が短すぎる場合もエラーにしない
+// 応答時間の差でも分からないように、メールの送信は待たない
+func (uu *userUsecase) ForgotPassword(req model.PasswordForgotRequest) error {
+	if err := uu.uv.PasswordForgotValidate(req); err != nil {
+		return err
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByEmail(&user, req.Email); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	latest := model.PasswordResetToken{}
+	err := uu.tr.GetLatestPasswordResetToken(&latest, user.ID)
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return err
+	}
+	if err == nil && time.Since(latest.CreatedAt) < passwordResetResendInterval {
+		return nil
+	}
+	rawToken, err := common.RandomToken(32)
+	if err != nil {
+		return err
+	}
+	token := model.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: common.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(passwordResetTokenTTL),
+	}
+	if err := uu.tr.CreatePasswordResetToken(&token); err != nil {
+		return err
+	}
+	link := os.Getenv("FE_URL") + "/reset-password?token=" + rawToken
+	body := fmt.Sprintf("A password reset was requested for your account. Open the link below to choose a new password "+
+		"(valid for %d minutes).\n\n%s\n\nIf you did not request this, you can ignore this mail.",
+		int(passwordResetTokenTTL.Minutes()), link)
+	go func() {
+		if err := uu.ms.Send(user.Email, "Reset your password", body); err != nil {
+			log.Printf("password reset mail to user %d failed: %v", user.ID, err)
+		}
+	}()
+	return nil
+}
+
+// リンクのトークンでパスワードを再設定する
+// 盗まれたセッションが残らないように、再設定したユーザのトークンは全て失効させる
+func (uu *userUsecase) ResetPassword(req model.PasswordResetRequest) error {
+	if err := uu.uv.PasswordResetValidate(req); err != nil {
+		return err
+	}
+	stored := model.PasswordResetToken{}
+	if err := uu.tr.GetPasswordResetTokenByHash(&stored, common.HashToken(req.Token)); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: reset link is invalid", ErrInvalidState)
+		}
+		return err
+	}
+	now := time.Now()
+	if stored.UsedAt != nil {
+		return fmt.Errorf("%w: reset link is already used", ErrInvalidState)
+	}
+	if !now.Before(stored.ExpiresAt) {
+		return fmt.Errorf("%w: reset link is expired", ErrInvalidState)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), 10)
+	if err != nil {
+		return err
+	}
+	if err := uu.tr.ResetPassword(&stored, string(hash), now); err != nil {
+		if errors.Is(err, repository.ErrStaleObject) {
+			return fmt.Errorf("%w: reset link is already used", ErrInvalidState)
+		}
+		return err
+	}
+	return uu.RevokeAllTokens(stored.UserID, stored.UserID)
+}
+
+// 管理者によるロールの割当て
+// 管理者が自分のロールを外して管理者がいなくなることがないように、自分のロールは変更できない
+func (uu *userUsecase) AssignRole(adminID uint, userID uint, req model.RoleRequest) (model.UserResponse, error) {
+	if err := uu.uv.RoleValidate(req); err != nil {
+		return model.UserResponse{}, err
+	}
+	if adminID == userID {
+		return model.UserResponse{}, fmt.Errorf("%w: cannot change your own role", ErrInvalidState)
+	}
+	user := model.User{}
+	if err := uu.ur.GetUserByID(&user, userID); err != nil {
+		return model.UserResponse{}, err
+	}
+	if err := uu.ur.UpdateUserRole(&user, req.Role); err != nil {
+		return model.UserResponse{}, err
 	}
-	return resUser, nil
+	user.Role = req.Role
+	return userResponse(user), nil
 }
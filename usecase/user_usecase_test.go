@@ -0,0 +1,138 @@
+package usecase
+
+import (
+	"errors"
+	"record-shop-rest-api/model"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const testPassword = "correct-password"
+
+func newTestUser(t *testing.T, id uint, email string) model.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return model.User{ID: id, Email: email, Password: string(hash), Role: model.RoleCustomer, EmailVerified: true}
+}
+
+func login(t *testing.T, f userFixture, email string) model.AuthTokens {
+	t.Helper()
+	result, err := f.uu.Login(model.User{Email: email, Password: testPassword}, "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result.Tokens
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	f := newUserFixture(t, nil, newTestUser(t, 1, "alice@example.com"))
+	first := login(t, f, "alice@example.com")
+	second, err := f.uu.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.RefreshToken == first.RefreshToken || second.AccessToken == "" {
+		t.Fatal("refresh should issue a new token pair")
+	}
+	if _, err := f.uu.Refresh(second.RefreshToken); err != nil {
+		t.Fatalf("the new refresh token should be usable: %v", err)
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	f := newUserFixture(t, nil, newTestUser(t, 1, "alice@example.com"), newTestUser(t, 2, "bob@example.com"))
+	stolen := login(t, f, "alice@example.com")
+	other := login(t, f, "alice@example.com")
+	bob := login(t, f, "bob@example.com")
+	// 正規の利用者が先にリフレッシュした後、盗まれた(使用済みの)トークンが使われた
+	current, err := f.uu.Refresh(stolen.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.uu.Refresh(stolen.RefreshToken); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("reused token: got %v, want ErrUnauthorized", err)
+	}
+	// 系列ごと失効するので、正規の利用者の最新のトークンも使えない
+	if _, err := f.uu.Refresh(current.RefreshToken); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("token of the revoked family: got %v, want ErrUnauthorized", err)
+	}
+	// 別のログイン(別の系列)と他のユーザは巻込まない
+	if _, err := f.uu.Refresh(other.RefreshToken); err != nil {
+		t.Fatalf("another family of the same user should stay valid: %v", err)
+	}
+	if _, err := f.uu.Refresh(bob.RefreshToken); err != nil {
+		t.Fatalf("another user's family should stay valid: %v", err)
+	}
+}
+
+func TestRefreshRejectsUnknownToken(t *testing.T) {
+	f := newUserFixture(t, nil, newTestUser(t, 1, "alice@example.com"))
+	for _, token := range []string{"", "unknown-token"} {
+		if _, err := f.uu.Refresh(token); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("refresh %q: got %v, want ErrUnauthorized", token, err)
+		}
+	}
+}
+
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	f := newUserFixture(t, nil, newTestUser(t, 1, "alice@example.com"))
+	tokens := login(t, f, "alice@example.com")
+	other := login(t, f, "alice@example.com")
+	if _, err := f.uu.ParseAccessToken(tokens.AccessToken); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.uu.Logout(tokens.AccessToken, tokens.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.uu.ParseAccessToken(tokens.AccessToken); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("logged out access token: got %v, want ErrUnauthorized", err)
+	}
+	if _, err := f.uu.Refresh(tokens.RefreshToken); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("logged out refresh token: got %v, want ErrUnauthorized", err)
+	}
+	// 他の端末のセッションはそのまま
+	if _, err := f.uu.ParseAccessToken(other.AccessToken); err != nil {
+		t.Fatalf("another session should stay valid: %v", err)
+	}
+}
+
+func TestRevokeAllTokens(t *testing.T) {
+	f := newUserFixture(t, nil, newTestUser(t, 1, "alice@example.com"), newTestUser(t, 2, "bob@example.com"))
+	first := login(t, f, "alice@example.com")
+	second := login(t, f, "alice@example.com")
+	bob := login(t, f, "bob@example.com")
+	if err := f.uu.RevokeAllTokens(1, 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, tokens := range []model.AuthTokens{first, second} {
+		if _, err := f.uu.ParseAccessToken(tokens.AccessToken); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("revoked access token: got %v, want ErrUnauthorized", err)
+		}
+		if _, err := f.uu.Refresh(tokens.RefreshToken); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("revoked refresh token: got %v, want ErrUnauthorized", err)
+		}
+	}
+	if _, err := f.uu.ParseAccessToken(bob.AccessToken); err != nil {
+		t.Fatalf("another user's token should stay valid: %v", err)
+	}
+	if err := f.uu.RevokeAllTokens(1, 99); err == nil {
+		t.Fatal("revoking tokens of an unknown user should fail")
+	}
+}
+
+// 別のプロセスでの失効は、DBからの読込みで反映される
+func TestRevocationIsSharedBetweenInstances(t *testing.T) {
+	f := newUserFixture(t, nil, newTestUser(t, 1, "alice@example.com"))
+	loggedOut := login(t, f, "alice@example.com")
+	other := NewUserUsecase(f.users, f.uu.uv, f.tokens, nil, f.security, f.twoFactors, f.identities, nil)
+	if err := other.Logout(loggedOut.AccessToken, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.uu.ParseAccessToken(loggedOut.AccessToken); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("token revoked by another instance: got %v, want ErrUnauthorized", err)
+	}
+}
@@ -0,0 +1,134 @@
+package usecase
+
+import (
+	"fmt"
+	"log"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+	"strings"
+)
+
+type IWantListUsecase interface {
+	CreateEntry(userID uint, entry model.WantListEntry) (model.WantListEntry, error)
+	GetOwnEntries(userID uint) ([]model.WantListEntry, error)
+	DeleteEntry(userID uint, id uint) error
+	NotifyStockAdded(notice model.StockNotice)
+	StartMatcher()
+}
+
+type wantListUsecase struct {
+	wr repository.IWantListRepository
+	wv validator.IWantListValidator
+	rr repository.IRecordRepository
+	nu INotificationUsecase
+	// 入荷の処理をリクエストと切り離すためのキュー
+	notices chan model.StockNotice
+}
+
+func NewWantListUsecase(wr repository.IWantListRepository, wv validator.IWantListValidator,
+	rr repository.IRecordRepository, nu INotificationUsecase) IWantListUsecase {
+	return &wantListUsecase{wr, wv, rr, nu, make(chan model.StockNotice, 100)}
+}
+
+func (wu *wantListUsecase) CreateEntry(userID uint, entry model.WantListEntry) (model.WantListEntry, error) {
+	if err := wu.wv.WantListEntryValidate(entry); err != nil {
+		return model.WantListEntry{}, err
+	}
+	newEntry := model.WantListEntry{
+		UserID:       userID,
+		RecordID:     entry.RecordID,
+		Title:        entry.Title,
+		Artist:       entry.Artist,
+		Pressing:     entry.Pressing,
+		MaxPrice:     entry.MaxPrice,
+		MinCondition: entry.MinCondition,
+	}
+	if err := wu.wr.CreateEntry(&newEntry); err != nil {
+		return model.WantListEntry{}, err
+	}
+	return newEntry, nil
+}
+
+func (wu *wantListUsecase) GetOwnEntries(userID uint) ([]model.WantListEntry, error) {
+	return wu.wr.GetEntriesByUser(userID)
+}
+
+func (wu *wantListUsecase) DeleteEntry(userID uint, id uint) error {
+	return wu.wr.DeleteEntry(userID, id)
+}
+
+// 入荷をキューに積む、リクエストを待たせないようにキューが一杯なら捨ててログに残す
+func (wu *wantListUsecase) NotifyStockAdded(notice model.StockNotice) {
+	select {
+	case wu.notices <- notice:
+	default:
+		log.Printf("want-list queue is full, dropped stock notice for record %d", notice.RecordID)
+	}
+}
+
+// キューから入荷を取り出して欲しいものリストと突合せるバックグラウンド処理を開始する
+func (wu *wantListUsecase) StartMatcher() {
+	go func() {
+		for notice := range wu.notices {
+			if err := wu.match(notice); err != nil {
+				log.Printf("want-list matching for record %d failed: %v", notice.RecordID, err)
+			}
+		}
+	}()
+}
+
+func (wu *wantListUsecase) match(notice model.StockNotice) error {
+	record := model.Record{}
+	if err := wu.rr.GetRecordByID(&record, notice.RecordID); err != nil {
+		return err
+	}
+	entries, err := wu.wr.GetCandidateEntries(record)
+	if err != nil {
+		return err
+	}
+	// 同じユーザが似た登録を複数していても通知は1回にする
+	notified := map[uint]bool{}
+	for _, entry := range entries {
+		if notified[entry.UserID] || !entryMatches(entry, record, notice) {
+			continue
+		}
+		notified[entry.UserID] = true
+		subject := fmt.Sprintf("Now in stock: %s - %s", record.Artist, record.Title)
+		body := fmt.Sprintf("%s - %s (%d) is now in stock.", record.Artist, record.Title, record.ReleaseYear)
+		if notice.Condition != "" {
+			body += fmt.Sprintf("\nCondition: %s", notice.Condition)
+		}
+		if notice.Price > 0 {
+			body += fmt.Sprintf("\nPrice: ¥%d", notice.Price)
+		}
+		if err := wu.nu.Send(entry.UserID, subject, body); err != nil {
+			log.Printf("want-list notification to user %d failed: %v", entry.UserID, err)
+		}
+	}
+	return nil
+}
+
+// 登録で指定された条件を全て満たすか
+func entryMatches(entry model.WantListEntry, record model.Record, notice model.StockNotice) bool {
+	if entry.RecordID != nil && *entry.RecordID != record.ID {
+		return false
+	}
+	if entry.Title != "" && !strings.EqualFold(entry.Title, record.Title) {
+		return false
+	}
+	if entry.Artist != "" && !strings.EqualFold(entry.Artist, record.Artist) {
+		return false
+	}
+	if entry.Pressing != "" && !strings.Contains(strings.ToLower(notice.Pressing), strings.ToLower(entry.Pressing)) {
+		return false
+	}
+	if entry.MaxPrice > 0 && notice.Price > entry.MaxPrice {
+		return false
+	}
+	// 盤質が不明な入荷は、盤質の条件がある登録には通知しない
+	if entry.MinCondition != "" && model.GradeRank(notice.Condition) < model.GradeRank(entry.MinCondition) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,251 @@
+package usecase
+
+import (
+	"fmt"
+	"record-shop-rest-api/common"
+	"record-shop-rest-api/model"
+	"record-shop-rest-api/repository"
+	"record-shop-rest-api/validator"
+
+	"gorm.io/gorm"
+)
+
+type IWishlistUsecase interface {
+	CreateWishlist(userID uint, wishlist model.Wishlist) (model.WishlistResponse, error)
+	GetOwnWishlists(userID uint) ([]model.WishlistResponse, error)
+	GetOwnWishlist(userID uint, id uint) (model.WishlistResponse, error)
+	RenameWishlist(userID uint, id uint, wishlist model.Wishlist) (model.WishlistResponse, error)
+	DeleteWishlist(userID uint, id uint) error
+	AddItem(userID uint, id uint, req model.WishlistItemRequest) (model.WishlistResponse, error)
+	UpdateItemNote(userID uint, id uint, itemID uint, req model.WishlistItemRequest) (model.WishlistResponse, error)
+	DeleteItem(userID uint, id uint, itemID uint) (model.WishlistResponse, error)
+	ReorderItems(userID uint, id uint, req model.WishlistReorderRequest) (model.WishlistResponse, error)
+	Share(userID uint, id uint) (model.WishlistResponse, error)
+	Unshare(userID uint, id uint) (model.WishlistResponse, error)
+	GetSharedWishlist(token string) (model.WishlistResponse, error)
+}
+
+type wishlistUsecase struct {
+	wr repository.IWishlistRepository
+	wv validator.IWishlistValidator
+	rr repository.IRecordRepository
+}
+
+func NewWishlistUsecase(wr repository.IWishlistRepository, wv validator.IWishlistValidator,
+	rr repository.IRecordRepository) IWishlistUsecase {
+	return &wishlistUsecase{wr, wv, rr}
+}
+
+func (wu *wishlistUsecase) CreateWishlist(userID uint, wishlist model.Wishlist) (model.WishlistResponse, error) {
+	if err := wu.wv.WishlistValidate(wishlist); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	newWishlist := model.Wishlist{UserID: userID, Name: wishlist.Name}
+	if err := wu.wr.CreateWishlist(&newWishlist); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	return wu.toWishlistResponse(newWishlist, true)
+}
+
+func (wu *wishlistUsecase) GetOwnWishlists(userID uint) ([]model.WishlistResponse, error) {
+	wishlists, err := wu.wr.GetWishlistsByUser(userID)
+	if err != nil {
+		return nil, err
+	}
+	res := []model.WishlistResponse{}
+	for _, w := range wishlists {
+		wishlistRes, err := wu.toWishlistResponse(w, true)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, wishlistRes)
+	}
+	return res, nil
+}
+
+func (wu *wishlistUsecase) GetOwnWishlist(userID uint, id uint) (model.WishlistResponse, error) {
+	wishlist, err := wu.getOwnWishlist(userID, id)
+	if err != nil {
+		return model.WishlistResponse{}, err
+	}
+	return wu.toWishlistResponse(wishlist, true)
+}
+
+func (wu *wishlistUsecase) RenameWishlist(userID uint, id uint, wishlist model.Wishlist) (model.WishlistResponse, error) {
+	if err := wu.wv.WishlistValidate(wishlist); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	stored, err := wu.getOwnWishlist(userID, id)
+	if err != nil {
+		return model.WishlistResponse{}, err
+	}
+	stored.Name = wishlist.Name
+	if err := wu.wr.UpdateWishlist(&stored); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	return wu.toWishlistResponse(stored, true)
+}
+
+func (wu *wishlistUsecase) DeleteWishlist(userID uint, id uint) error {
+	if _, err := wu.getOwnWishlist(userID, id); err != nil {
+		return err
+	}
+	return wu.wr.DeleteWishlist(id)
+}
+
+func (wu *wishlistUsecase) AddItem(userID uint, id uint, req model.WishlistItemRequest) (model.WishlistResponse, error) {
+	if err := wu.wv.WishlistItemValidate(req); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	if _, err := wu.getOwnWishlist(userID, id); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	record := model.Record{}
+	if err := wu.rr.GetRecordByID(&record, req.RecordID); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	item := model.WishlistItem{WishlistID: id, RecordID: record.ID, Note: req.Note}
+	if err := wu.wr.AddItem(&item); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	return wu.GetOwnWishlist(userID, id)
+}
+
+func (wu *wishlistUsecase) UpdateItemNote(userID uint, id uint, itemID uint, req model.WishlistItemRequest) (model.WishlistResponse, error) {
+	if err := wu.wv.WishlistItemValidate(req); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	if _, err := wu.getOwnWishlist(userID, id); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	if err := wu.wr.UpdateItemNote(id, itemID, req.Note); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	return wu.GetOwnWishlist(userID, id)
+}
+
+func (wu *wishlistUsecase) DeleteItem(userID uint, id uint, itemID uint) (model.WishlistResponse, error) {
+	if _, err := wu.getOwnWishlist(userID, id); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	if err := wu.wr.DeleteItem(id, itemID); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	return wu.GetOwnWishlist(userID, id)
+}
+
+// 並べ替え後の全エントリのIDを受取る、過不足があればエラー
+func (wu *wishlistUsecase) ReorderItems(userID uint, id uint, req model.WishlistReorderRequest) (model.WishlistResponse, error) {
+	wishlist, err := wu.getOwnWishlist(userID, id)
+	if err != nil {
+		return model.WishlistResponse{}, err
+	}
+	current := map[uint]bool{}
+	for _, item := range wishlist.Items {
+		current[item.ID] = true
+	}
+	seen := map[uint]bool{}
+	for _, itemID := range req.ItemIDs {
+		if !current[itemID] || seen[itemID] {
+			return model.WishlistResponse{}, fmt.Errorf("%w: item ids must list every item exactly once", ErrInvalidState)
+		}
+		seen[itemID] = true
+	}
+	if len(seen) != len(current) {
+		return model.WishlistResponse{}, fmt.Errorf("%w: item ids must list every item exactly once", ErrInvalidState)
+	}
+	if err := wu.wr.ReorderItems(id, req.ItemIDs); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	return wu.GetOwnWishlist(userID, id)
+}
+
+// 共有リンク用のトークンを発行する、既に共有中なら作り直して以前のリンクを無効にする
+func (wu *wishlistUsecase) Share(userID uint, id uint) (model.WishlistResponse, error) {
+	wishlist, err := wu.getOwnWishlist(userID, id)
+	if err != nil {
+		return model.WishlistResponse{}, err
+	}
+	token, err := common.RandomToken(16)
+	if err != nil {
+		return model.WishlistResponse{}, err
+	}
+	wishlist.ShareToken = &token
+	if err := wu.wr.UpdateWishlist(&wishlist); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	return wu.toWishlistResponse(wishlist, true)
+}
+
+func (wu *wishlistUsecase) Unshare(userID uint, id uint) (model.WishlistResponse, error) {
+	wishlist, err := wu.getOwnWishlist(userID, id)
+	if err != nil {
+		return model.WishlistResponse{}, err
+	}
+	wishlist.ShareToken = nil
+	if err := wu.wr.UpdateWishlist(&wishlist); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	return wu.toWishlistResponse(wishlist, true)
+}
+
+// 共有リンクからの閲覧、読取り専用
+func (wu *wishlistUsecase) GetSharedWishlist(token string) (model.WishlistResponse, error) {
+	wishlist := model.Wishlist{}
+	if err := wu.wr.GetWishlistByShareToken(&wishlist, token); err != nil {
+		return model.WishlistResponse{}, err
+	}
+	return wu.toWishlistResponse(wishlist, false)
+}
+
+// 他人のリストは存在しないものとして扱う
+func (wu *wishlistUsecase) getOwnWishlist(userID uint, id uint) (model.Wishlist, error) {
+	wishlist := model.Wishlist{}
+	if err := wu.wr.GetWishlistByID(&wishlist, id); err != nil {
+		return model.Wishlist{}, err
+	}
+	if wishlist.UserID != userID {
+		return model.Wishlist{}, gorm.ErrRecordNotFound
+	}
+	return wishlist, nil
+}
+
+// isOwner: 所有者向けの場合のみ共有トークンを含める
+// 在庫と価格は表示のたびに変わるので、保存せずにその都度引く
+func (wu *wishlistUsecase) toWishlistResponse(wishlist model.Wishlist, isOwner bool) (model.WishlistResponse, error) {
+	availabilities, err := wu.wr.GetRecordAvailabilities(common.MapSlice(wishlist.Items, func(item model.WishlistItem) uint {
+		return item.RecordID
+	}))
+	if err != nil {
+		return model.WishlistResponse{}, err
+	}
+	res := model.WishlistResponse{
+		ID:   wishlist.ID,
+		Name: wishlist.Name,
+		Items: common.MapSlice(wishlist.Items, func(item model.WishlistItem) model.WishlistItemResponse {
+			availability := availabilities[item.RecordID]
+			return model.WishlistItemResponse{
+				ID:            item.ID,
+				RecordID:      item.RecordID,
+				Position:      item.Position,
+				Note:          item.Note,
+				Title:         item.Record.Title,
+				Artist:        item.Record.Artist,
+				ReleaseYear:   item.Record.ReleaseYear,
+				PreOrder:      item.Record.PreOrder,
+				ReleaseDate:   item.Record.ReleaseDate,
+				InStock:       availability.StockQuantity > 0,
+				StockQuantity: availability.StockQuantity,
+				Price:         availability.Price,
+			}
+		}),
+	}
+	// MapSliceは空の場合nilを返すので、JSONでnullにならないように
+	if res.Items == nil {
+		res.Items = []model.WishlistItemResponse{}
+	}
+	if isOwner {
+		res.ShareToken = wishlist.ShareToken
+	}
+	return res, nil
+}
@@ -0,0 +1,45 @@
+package validator
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type IAPIKeyValidator interface {
+	APIKeyValidate(req model.APIKeyRequest) error
+}
+
+type apiKeyValidator struct{}
+
+func NewAPIKeyValidator() IAPIKeyValidator {
+	return &apiKeyValidator{}
+}
+
+func (av *apiKeyValidator) APIKeyValidate(req model.APIKeyRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Name,
+			validation.Required.Error("name is required"),
+			validation.RuneLength(1, 50).Error("limited max 50 char"),
+		),
+		validation.Field(
+			&req.Scopes,
+			validation.Required.Error("at least one scope is required"),
+			validation.Each(validation.In(model.ScopeRecordsRead, model.ScopeRecordsWrite, model.ScopeInventoryWrite).
+				Error("scope must be records:read, records:write or inventory:write")),
+		),
+		validation.Field(
+			&req.ExpiresAt,
+			validation.By(func(value interface{}) error {
+				expiresAt, _ := value.(*time.Time)
+				if expiresAt != nil && !expiresAt.After(time.Now()) {
+					return fmt.Errorf("expires_at must be in the future")
+				}
+				return nil
+			}),
+		),
+	)
+}
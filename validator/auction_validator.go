@@ -0,0 +1,96 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+	"time"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type IAuctionValidator interface {
+	AuctionListingValidate(req model.AuctionListingRequest) error
+	AuctionAmountValidate(req model.AuctionAmountRequest) error
+	AuctionCheckoutValidate(req model.AuctionCheckoutRequest) error
+}
+
+type auctionValidator struct{}
+
+func NewAuctionValidator() IAuctionValidator {
+	return &auctionValidator{}
+}
+
+func (av *auctionValidator) AuctionListingValidate(req model.AuctionListingRequest) error {
+	isAuction := req.Type == model.ListingAuction
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Type,
+			validation.Required.Error("type is required."),
+			validation.In(model.ListingAuction, model.ListingBestOffer).Error("type must be auction or best_offer."),
+		),
+		validation.Field(
+			&req.RecordID,
+			validation.Required.Error("record id is required."),
+		),
+		validation.Field(
+			&req.Grade,
+			validation.Required.Error("grade is required."),
+			validation.By(ValidateGrade),
+		),
+		validation.Field(
+			&req.LocationID,
+			validation.Required.Error("location id is required."),
+		),
+		validation.Field(
+			&req.StartPrice,
+			validation.Required.Error("start price is required."),
+			validation.Min(1).Error("start price must be positive."),
+		),
+		validation.Field(
+			&req.ReservePrice,
+			validation.Min(0).Error("reserve price must not be negative."),
+		),
+		validation.Field(
+			&req.BidIncrement,
+			validation.When(isAuction,
+				validation.Required.Error("bid increment is required."),
+				validation.Min(1).Error("bid increment must be positive."),
+			),
+		),
+		validation.Field(
+			&req.ExtensionMinutes,
+			validation.Min(0).Error("extension minutes must not be negative."),
+			validation.Max(60).Error("extension minutes must be 60 or less."),
+		),
+		validation.Field(
+			&req.MinOfferPrice,
+			validation.Min(0).Error("min offer price must not be negative."),
+			validation.Max(req.StartPrice).Error("min offer price must not exceed start price."),
+		),
+		validation.Field(
+			&req.EndsAt,
+			validation.When(isAuction,
+				validation.Required.Error("ends at is required."),
+				validation.Min(time.Now()).Error("ends at must be in the future."),
+			),
+		),
+	)
+}
+
+func (av *auctionValidator) AuctionAmountValidate(req model.AuctionAmountRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Amount,
+			validation.Required.Error("amount is required."),
+			validation.Min(1).Error("amount must be positive."),
+		),
+	)
+}
+
+func (av *auctionValidator) AuctionCheckoutValidate(req model.AuctionCheckoutRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.CardToken,
+			validation.Required.Error("card token is required."),
+		),
+	)
+}
@@ -0,0 +1,88 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+type IConsignmentValidator interface {
+	ConsignorValidate(consignor model.Consignor) error
+	ConsignmentItemValidate(item model.ConsignmentItem) error
+	ConsignmentSaleValidate(req model.ConsignmentSaleRequest) error
+	ConsignmentPayoutValidate(req model.ConsignmentPayoutRequest) error
+}
+
+type consignmentValidator struct{}
+
+func NewConsignmentValidator() IConsignmentValidator {
+	return &consignmentValidator{}
+}
+
+func (cv *consignmentValidator) ConsignorValidate(consignor model.Consignor) error {
+	return validation.ValidateStruct(&consignor,
+		validation.Field(
+			&consignor.Name,
+			validation.Required.Error("name is required."),
+			validation.RuneLength(1, 100).Error("name must be 100 characters or less."),
+		),
+		validation.Field(
+			&consignor.Email,
+			is.Email.Error("is not valid email format."),
+		),
+		validation.Field(
+			&consignor.CommissionPercent,
+			validation.Min(0).Error("commission percent must not be negative."),
+			validation.Max(100).Error("commission percent must be 100 or less."),
+		),
+	)
+}
+
+func (cv *consignmentValidator) ConsignmentItemValidate(item model.ConsignmentItem) error {
+	return validation.ValidateStruct(&item,
+		validation.Field(
+			&item.RecordID,
+			validation.Required.Error("record id is required."),
+		),
+		validation.Field(
+			&item.Grade,
+			validation.Required.Error("grade is required."),
+			validation.By(ValidateGrade),
+		),
+		validation.Field(
+			&item.AskingPrice,
+			validation.Required.Error("asking price is required."),
+			validation.Min(1).Error("asking price must be positive."),
+		),
+		validation.Field(
+			&item.CommissionPercent,
+			validation.Min(0).Error("commission percent must not be negative."),
+			validation.Max(100).Error("commission percent must be 100 or less."),
+		),
+	)
+}
+
+func (cv *consignmentValidator) ConsignmentSaleValidate(req model.ConsignmentSaleRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.SalePrice,
+			validation.Required.Error("sale price is required."),
+			validation.Min(1).Error("sale price must be positive."),
+		),
+	)
+}
+
+func (cv *consignmentValidator) ConsignmentPayoutValidate(req model.ConsignmentPayoutRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Amount,
+			validation.Required.Error("amount is required."),
+			validation.Min(1).Error("amount must be positive."),
+		),
+		validation.Field(
+			&req.Method,
+			validation.Required.Error("method is required."),
+		),
+	)
+}
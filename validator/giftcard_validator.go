@@ -0,0 +1,65 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type IGiftCardValidator interface {
+	GiftCardIssueValidate(req model.GiftCardIssueRequest) error
+	StoreCreditGrantValidate(req model.StoreCreditGrantRequest) error
+	TenderValidate(req model.TenderRequest) error
+}
+
+type giftCardValidator struct{}
+
+func NewGiftCardValidator() IGiftCardValidator {
+	return &giftCardValidator{}
+}
+
+func (gv *giftCardValidator) GiftCardIssueValidate(req model.GiftCardIssueRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Amount,
+			validation.Required.Error("amount is required."),
+			validation.Min(1).Error("amount must be positive."),
+			validation.Max(100000).Error("amount must be 100000 or less."),
+		),
+	)
+}
+
+func (gv *giftCardValidator) StoreCreditGrantValidate(req model.StoreCreditGrantRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.UserID,
+			validation.Required.Error("user id is required."),
+		),
+		validation.Field(
+			&req.Amount,
+			validation.Required.Error("amount is required."),
+			validation.Min(1).Error("amount must be positive."),
+		),
+	)
+}
+
+func (gv *giftCardValidator) TenderValidate(req model.TenderRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.AmountDue,
+			validation.Required.Error("amount due is required."),
+			validation.Min(1).Error("amount due must be positive."),
+		),
+		validation.Field(
+			&req.GiftCardCodes,
+			validation.Length(0, 5).Error("up to 5 gift cards can be used at once."),
+			validation.When(!req.UseStoreCredit,
+				validation.Required.Error("gift card codes or use_store_credit is required.")),
+		),
+		validation.Field(
+			&req.Reference,
+			validation.Required.Error("reference is required."),
+			validation.RuneLength(1, 100).Error("reference must be 100 characters or less."),
+		),
+	)
+}
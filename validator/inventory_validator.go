@@ -0,0 +1,110 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+	"regexp"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type IInventoryValidator interface {
+	LocationValidate(location model.Location) error
+	StockAdjustmentValidate(req model.StockAdjustmentRequest) error
+	TransferOrderValidate(order model.TransferOrder) error
+}
+
+type inventoryValidator struct{}
+
+func NewInventoryValidator() IInventoryValidator {
+	return &inventoryValidator{}
+}
+
+// 拠点コードはURLのクエリに使うので英小文字・数字・ハイフンのみ
+var locationCodePattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+func (iv *inventoryValidator) LocationValidate(location model.Location) error {
+	return validation.ValidateStruct(&location,
+		validation.Field(
+			&location.Code,
+			validation.Required.Error("code is required."),
+			validation.RuneLength(1, 50).Error("code must be 50 characters or less."),
+			validation.Match(locationCodePattern).Error("code must contain only lowercase letters, digits and hyphens."),
+		),
+		validation.Field(
+			&location.Name,
+			validation.Required.Error("name is required."),
+			validation.RuneLength(1, 100).Error("name must be 100 characters or less."),
+		),
+		validation.Field(
+			&location.Type,
+			validation.Required.Error("type is required."),
+			validation.In(model.LocationShop, model.LocationWarehouse).Error("type must be shop or warehouse."),
+		),
+	)
+}
+
+func (iv *inventoryValidator) StockAdjustmentValidate(req model.StockAdjustmentRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.LocationID,
+			validation.Required.Error("location id is required."),
+		),
+		validation.Field(
+			&req.RecordID,
+			validation.Required.Error("record id is required."),
+		),
+		validation.Field(
+			&req.Grade,
+			validation.Required.Error("grade is required."),
+			validation.By(ValidateGrade),
+		),
+		validation.Field(
+			&req.Delta,
+			validation.Required.Error("delta is required and must not be zero."),
+		),
+		validation.Field(
+			&req.Reason,
+			validation.In(model.MovementReceive, model.MovementAdjust, model.MovementSale).
+				Error("reason must be receive, adjust or sale."),
+		),
+	)
+}
+
+func (iv *inventoryValidator) TransferOrderValidate(order model.TransferOrder) error {
+	return validation.ValidateStruct(&order,
+		validation.Field(
+			&order.FromLocationID,
+			validation.Required.Error("from location id is required."),
+		),
+		validation.Field(
+			&order.ToLocationID,
+			validation.Required.Error("to location id is required."),
+			validation.NotIn(order.FromLocationID).Error("to location must differ from from location."),
+		),
+		validation.Field(
+			&order.Items,
+			validation.Required.Error("items are required."),
+			validation.Each(validation.By(validateTransferOrderItem)),
+		),
+	)
+}
+
+func validateTransferOrderItem(value interface{}) error {
+	item, _ := value.(model.TransferOrderItem)
+	return validation.ValidateStruct(&item,
+		validation.Field(
+			&item.RecordID,
+			validation.Required.Error("record id is required."),
+		),
+		validation.Field(
+			&item.Grade,
+			validation.Required.Error("grade is required."),
+			validation.By(ValidateGrade),
+		),
+		validation.Field(
+			&item.Quantity,
+			validation.Required.Error("quantity is required."),
+			validation.Min(1).Error("quantity must be positive."),
+		),
+	)
+}
@@ -0,0 +1,74 @@
+package validator
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type ILoyaltyValidator interface {
+	LoyaltyRuleValidate(rule model.LoyaltyRule) error
+	PointEarnValidate(req model.PointEarnRequest) error
+	PointRedeemValidate(req model.PointRedeemRequest) error
+}
+
+type loyaltyValidator struct{}
+
+func NewLoyaltyValidator() ILoyaltyValidator {
+	return &loyaltyValidator{}
+}
+
+func (lv *loyaltyValidator) LoyaltyRuleValidate(rule model.LoyaltyRule) error {
+	return validation.ValidateStruct(&rule,
+		validation.Field(
+			&rule.Name,
+			validation.Required.Error("name is required."),
+			validation.RuneLength(1, 100).Error("name must be 100 characters or less."),
+		),
+		validation.Field(
+			&rule.MultiplierPercent,
+			validation.Required.Error("multiplier percent is required."),
+			validation.Min(100).Error("multiplier percent must be 100 or more."),
+			validation.Max(1000).Error("multiplier percent must be 1000 or less."),
+		),
+		validation.Field(
+			&rule.EndsAt,
+			validation.When(rule.StartsAt != nil && rule.EndsAt != nil,
+				validation.By(func(value interface{}) error {
+					if !rule.EndsAt.After(*rule.StartsAt) {
+						return fmt.Errorf("ends at must be after starts at")
+					}
+					return nil
+				})),
+		),
+	)
+}
+
+func (lv *loyaltyValidator) PointEarnValidate(req model.PointEarnRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.PaymentID,
+			validation.Required.Error("payment id is required."),
+		),
+		validation.Field(
+			&req.Lines,
+			validation.Required.Error("lines are required."),
+			validation.Each(validation.By(validateLineItem)),
+		),
+	)
+}
+
+func (lv *loyaltyValidator) PointRedeemValidate(req model.PointRedeemRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Points,
+			validation.Required.Error("points is required."),
+			validation.Min(1).Error("points must be positive."),
+		),
+		validation.Field(
+			&req.OrderID,
+			validation.Required.Error("order id is required."),
+		),
+	)
+}
@@ -0,0 +1,44 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type IOrderValidator interface {
+	OrderValidate(req model.OrderRequest) error
+}
+
+type orderValidator struct{}
+
+func NewOrderValidator() IOrderValidator {
+	return &orderValidator{}
+}
+
+func (ov *orderValidator) OrderValidate(req model.OrderRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Lines,
+			validation.Required.Error("lines are required."),
+			validation.Length(1, 50).Error("up to 50 lines can be ordered at once."),
+			validation.Each(validation.By(validateOrderLine)),
+		),
+	)
+}
+
+func validateOrderLine(value interface{}) error {
+	line, _ := value.(model.OrderLineRequest)
+	return validation.ValidateStruct(&line,
+		validation.Field(
+			&line.SKU,
+			validation.Required.Error("sku is required."),
+		),
+		validation.Field(
+			&line.Quantity,
+			validation.Required.Error("quantity is required."),
+			validation.Min(1).Error("quantity must be positive."),
+			validation.Max(10).Error("quantity must be 10 or less."),
+		),
+	)
+}
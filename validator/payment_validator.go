@@ -0,0 +1,41 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type IPaymentValidator interface {
+	PaymentValidate(req model.PaymentRequest) error
+	RefundValidate(req model.RefundRequest) error
+}
+
+type paymentValidator struct{}
+
+func NewPaymentValidator() IPaymentValidator {
+	return &paymentValidator{}
+}
+
+func (pv *paymentValidator) PaymentValidate(req model.PaymentRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.OrderID,
+			validation.Required.Error("order id is required."),
+		),
+		validation.Field(
+			&req.CardToken,
+			validation.Required.Error("card token is required."),
+		),
+	)
+}
+
+func (pv *paymentValidator) RefundValidate(req model.RefundRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Amount,
+			validation.Required.Error("amount is required."),
+			validation.Min(1).Error("amount must be positive."),
+		),
+	)
+}
@@ -0,0 +1,119 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type IPosValidator interface {
+	PosItemValidate(item model.PosItem) error
+	PosSaleValidate(req model.PosSaleRequest) error
+	PosReturnValidate(req model.PosReturnRequest) error
+}
+
+type posValidator struct{}
+
+func NewPosValidator() IPosValidator {
+	return &posValidator{}
+}
+
+func (pv *posValidator) PosItemValidate(item model.PosItem) error {
+	return validation.ValidateStruct(&item,
+		validation.Field(
+			&item.SKU,
+			validation.Required.Error("sku is required."),
+			validation.RuneLength(1, 50).Error("sku must be 50 characters or less."),
+		),
+		validation.Field(
+			&item.Barcode,
+			validation.RuneLength(0, 50).Error("barcode must be 50 characters or less."),
+		),
+		validation.Field(
+			&item.RecordID,
+			validation.Required.Error("record id is required."),
+		),
+		validation.Field(
+			&item.Grade,
+			validation.Required.Error("grade is required."),
+			validation.By(ValidateGrade),
+		),
+		validation.Field(
+			&item.Format,
+			validation.RuneLength(0, 20).Error("format must be 20 characters or less."),
+		),
+		validation.Field(
+			&item.Condition,
+			validation.In("new", "used").Error("condition must be new or used."),
+		),
+		validation.Field(
+			&item.Price,
+			validation.Required.Error("price is required."),
+			validation.Min(1).Error("price must be positive."),
+		),
+	)
+}
+
+func (pv *posValidator) PosSaleValidate(req model.PosSaleRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.LocationID,
+			validation.Required.Error("location id is required."),
+		),
+		validation.Field(
+			&req.Lines,
+			validation.Required.Error("lines are required."),
+			validation.Length(1, 100).Error("up to 100 lines can be sold at once."),
+			validation.Each(validation.By(validatePosSaleLine)),
+		),
+		validation.Field(
+			&req.PromotionCodes,
+			validation.Length(0, 5).Error("up to 5 promotion codes can be used at once."),
+		),
+		validation.Field(
+			&req.GiftCardCodes,
+			validation.Length(0, 5).Error("up to 5 gift cards can be used at once."),
+		),
+		validation.Field(
+			&req.CardAmount,
+			validation.Min(0).Error("card amount must not be negative."),
+		),
+		validation.Field(
+			&req.CardToken,
+			validation.When(req.CardAmount > 0, validation.Required.Error("card token is required.")),
+		),
+		validation.Field(
+			&req.CashReceived,
+			validation.Min(0).Error("cash received must not be negative."),
+		),
+	)
+}
+
+func validatePosSaleLine(value interface{}) error {
+	line, _ := value.(model.PosSaleLineRequest)
+	return validation.ValidateStruct(&line,
+		validation.Field(
+			&line.Code,
+			validation.Required.Error("code is required."),
+		),
+		validation.Field(
+			&line.Quantity,
+			validation.Required.Error("quantity is required."),
+			validation.Min(1).Error("quantity must be positive."),
+		),
+	)
+}
+
+func (pv *posValidator) PosReturnValidate(req model.PosReturnRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.LineID,
+			validation.Required.Error("line id is required."),
+		),
+		validation.Field(
+			&req.Quantity,
+			validation.Required.Error("quantity is required."),
+			validation.Min(1).Error("quantity must be positive."),
+		),
+	)
+}
@@ -0,0 +1,47 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type IPreOrderValidator interface {
+	PreOrderValidate(req model.PreOrderRequest) error
+	ArrivalValidate(req model.PreOrderArrivalRequest) error
+}
+
+type preOrderValidator struct{}
+
+func NewPreOrderValidator() IPreOrderValidator {
+	return &preOrderValidator{}
+}
+
+func (pv *preOrderValidator) PreOrderValidate(req model.PreOrderRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.RecordID,
+			validation.Required.Error("record id is required."),
+		),
+		validation.Field(
+			&req.Quantity,
+			validation.Required.Error("quantity is required."),
+			validation.Min(1).Error("quantity must be positive."),
+			validation.Max(10).Error("quantity must be 10 or less."),
+		),
+	)
+}
+
+func (pv *preOrderValidator) ArrivalValidate(req model.PreOrderArrivalRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.LocationID,
+			validation.Required.Error("location id is required."),
+		),
+		validation.Field(
+			&req.Quantity,
+			validation.Required.Error("quantity is required."),
+			validation.Min(1).Error("quantity must be positive."),
+		),
+	)
+}
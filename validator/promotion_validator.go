@@ -0,0 +1,108 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type IPromotionValidator interface {
+	PromotionValidate(promotion model.Promotion) error
+	PricingValidate(req model.PricingRequest) error
+}
+
+type promotionValidator struct{}
+
+func NewPromotionValidator() IPromotionValidator {
+	return &promotionValidator{}
+}
+
+func (pv *promotionValidator) PromotionValidate(promotion model.Promotion) error {
+	return validation.ValidateStruct(&promotion,
+		validation.Field(
+			&promotion.Name,
+			validation.Required.Error("name is required."),
+		),
+		validation.Field(
+			&promotion.Type,
+			validation.Required.Error("type is required."),
+			validation.In(model.PromotionPercentOff, model.PromotionFixedOff, model.PromotionBuyXGetY).
+				Error("type must be one of percent_off, fixed_off, buy_x_get_y."),
+		),
+		validation.Field(
+			&promotion.PercentOff,
+			validation.When(promotion.Type == model.PromotionPercentOff,
+				validation.Required.Error("percent off is required."),
+				validation.Min(1).Error("percent off must be positive."),
+				validation.Max(100).Error("percent off must be 100 or less."),
+			),
+		),
+		validation.Field(
+			&promotion.AmountOff,
+			validation.When(promotion.Type == model.PromotionFixedOff,
+				validation.Required.Error("amount off is required."),
+				validation.Min(1).Error("amount off must be positive."),
+			),
+		),
+		validation.Field(
+			&promotion.BuyQuantity,
+			validation.When(promotion.Type == model.PromotionBuyXGetY,
+				validation.Required.Error("buy quantity is required."),
+				validation.Min(1).Error("buy quantity must be positive."),
+			),
+		),
+		validation.Field(
+			&promotion.FreeQuantity,
+			validation.When(promotion.Type == model.PromotionBuyXGetY,
+				validation.Required.Error("free quantity is required."),
+				validation.Min(1).Error("free quantity must be positive."),
+			),
+		),
+		validation.Field(
+			&promotion.MinSubtotal,
+			validation.Min(0).Error("min subtotal must not be negative."),
+		),
+		validation.Field(
+			&promotion.UsageLimit,
+			validation.Min(0).Error("usage limit must not be negative."),
+		),
+		validation.Field(
+			&promotion.PerUserLimit,
+			validation.Min(0).Error("per user limit must not be negative."),
+		),
+		validation.Field(
+			&promotion.EndsAt,
+			validation.By(func(value interface{}) error {
+				if promotion.StartsAt != nil && promotion.EndsAt != nil && !promotion.EndsAt.After(*promotion.StartsAt) {
+					return validation.NewError("validation_ends_at", "ends at must be after starts at.")
+				}
+				return nil
+			}),
+		),
+	)
+}
+
+func (pv *promotionValidator) PricingValidate(req model.PricingRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Lines,
+			validation.Required.Error("lines are required."),
+			validation.Each(validation.By(validateLineItem)),
+		),
+	)
+}
+
+func validateLineItem(value interface{}) error {
+	line, _ := value.(model.LineItem)
+	return validation.ValidateStruct(&line,
+		validation.Field(
+			&line.UnitPrice,
+			validation.Min(0).Error("unit price must not be negative."),
+		),
+		validation.Field(
+			&line.Quantity,
+			validation.Required.Error("quantity is required."),
+			validation.Min(1).Error("quantity must be positive."),
+		),
+	)
+}
@@ -32,7 +32,23 @@ func ValidateReleaseYear(value interface{}) error {
 	return nil
 }
 
+// 予約商品は発売前なので、未来の年を許可する
+func ValidatePreOrderReleaseYear(value interface{}) error {
+	year, ok := value.(int)
+	if !ok {
+		return fmt.Errorf("release year must be an integer")
+	}
+	if year < 1000 || year > 9999 {
+		return fmt.Errorf("release year must be a 4-digit number")
+	}
+	return nil
+}
+
 func (rv *recordValidator) RecordValidate(record model.Record) error {
+	releaseYearRule := validation.By(ValidateReleaseYear)
+	if record.PreOrder {
+		releaseYearRule = validation.By(ValidatePreOrderReleaseYear)
+	}
 	// is.Digit、validation.Lengthは数値の評価が出来ない
 	// releaseYearStr := fmt.Sprintf("%d", record.ReleaseYear)
 	return validation.ValidateStruct(&record,
@@ -55,10 +71,22 @@ func (rv *recordValidator) RecordValidate(record model.Record) error {
 		validation.Field(
 			&record.ReleaseYear, // Fieldという縛りがあるので変数にできない
 			validation.Required.Error("release year is required."),
-			validation.By(ValidateReleaseYear), // カスタムバリデーションを適用
+			releaseYearRule, // カスタムバリデーションを適用
 			// is.Digit.Error("release year must be a numeric value."),
 			// validation.Length(4, 4).Error("release year must be a 4-digit number."),
 			// validation.Max(time.Now().Year()).Error("release year must not be in the future.\n"),
 		),
+		validation.Field(
+			&record.ReleaseDate,
+			validation.When(record.PreOrder,
+				validation.Required.Error("release date is required for pre-order."),
+				validation.By(func(value interface{}) error {
+					if record.ReleaseDate.Year() != record.ReleaseYear {
+						return fmt.Errorf("release date must be in the release year")
+					}
+					return nil
+				}),
+			),
+		),
 	)
 }
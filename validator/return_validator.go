@@ -0,0 +1,80 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/go-ozzo/ozzo-validation/v4/is"
+)
+
+type IReturnValidator interface {
+	ReturnCreateValidate(req model.ReturnCreateRequest) error
+	ReturnApproveValidate(req model.ReturnDecisionRequest) error
+	ReturnReceiveValidate(req model.ReturnDecisionRequest) error
+}
+
+type returnValidator struct{}
+
+func NewReturnValidator() IReturnValidator {
+	return &returnValidator{}
+}
+
+func (rv *returnValidator) ReturnCreateValidate(req model.ReturnCreateRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.PaymentID,
+			validation.Required.Error("payment id is required."),
+		),
+		validation.Field(
+			&req.RecordID,
+			validation.Required.Error("record id is required."),
+		),
+		validation.Field(
+			&req.Reason,
+			validation.Required.Error("reason is required."),
+			validation.RuneLength(1, 1000).Error("reason must be 1000 characters or less."),
+		),
+		validation.Field(
+			&req.PhotoURLs,
+			validation.Length(0, 5).Error("up to 5 photos can be attached."),
+			validation.Each(is.URL.Error("photo url is not valid.")),
+		),
+		validation.Field(
+			&req.Resolution,
+			validation.In(model.ResolutionRefund, model.ResolutionStoreCredit).
+				Error("resolution must be refund or store_credit."),
+		),
+	)
+}
+
+func (rv *returnValidator) ReturnApproveValidate(req model.ReturnDecisionRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.RefundAmount,
+			validation.Required.Error("refund amount is required."),
+			validation.Min(1).Error("refund amount must be positive."),
+		),
+	)
+}
+
+func (rv *returnValidator) ReturnReceiveValidate(req model.ReturnDecisionRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Disposition,
+			validation.Required.Error("disposition is required."),
+			validation.In(model.DispositionRestock, model.DispositionWriteOff).
+				Error("disposition must be restock or write_off."),
+		),
+		validation.Field(
+			&req.Grade,
+			validation.When(req.Disposition == model.DispositionRestock,
+				validation.Required.Error("grade is required to restock.")),
+			validation.By(ValidateGrade),
+		),
+		validation.Field(
+			&req.LocationID,
+			validation.When(req.Disposition == model.DispositionRestock,
+				validation.Required.Error("location id is required to restock.")),
+		),
+	)
+}
@@ -0,0 +1,114 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// 送料計算で扱えるレコードの形態
+var ShippingFormats = []interface{}{"LP", `7"`, "CD"}
+
+type IShippingValidator interface {
+	ShippingMethodValidate(method model.ShippingMethod) error
+	ShippingRateValidate(rate model.ShippingRate) error
+	ShippingQuoteValidate(req model.ShippingQuoteRequest) error
+	ShipmentValidate(shipment model.Shipment) error
+	ShipmentEventValidate(req model.ShipmentEventRequest) error
+}
+
+type shippingValidator struct{}
+
+func NewShippingValidator() IShippingValidator {
+	return &shippingValidator{}
+}
+
+func (sv *shippingValidator) ShippingMethodValidate(method model.ShippingMethod) error {
+	return validation.ValidateStruct(&method,
+		validation.Field(
+			&method.Carrier,
+			validation.Required.Error("carrier is required."),
+		),
+		validation.Field(
+			&method.Name,
+			validation.Required.Error("name is required."),
+		),
+	)
+}
+
+func (sv *shippingValidator) ShippingRateValidate(rate model.ShippingRate) error {
+	return validation.ValidateStruct(&rate,
+		validation.Field(
+			&rate.Region,
+			validation.Required.Error("region is required."),
+		),
+		validation.Field(
+			&rate.PackageType,
+			validation.Required.Error("package type is required."),
+			validation.In(model.PackageLP, model.PackageSingle, model.PackageCD).
+				Error("package type must be one of lp, single, cd."),
+		),
+		validation.Field(
+			&rate.MaxWeightGrams,
+			validation.Required.Error("max weight is required."),
+			validation.Min(1).Error("max weight must be positive."),
+		),
+		validation.Field(
+			&rate.Price,
+			validation.Min(0).Error("price must not be negative."),
+		),
+	)
+}
+
+func (sv *shippingValidator) ShippingQuoteValidate(req model.ShippingQuoteRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Region,
+			validation.Required.Error("region is required."),
+		),
+		validation.Field(
+			&req.Items,
+			validation.Required.Error("items are required."),
+			validation.Each(validation.By(func(value interface{}) error {
+				item, _ := value.(model.ShippingItem)
+				return validation.ValidateStruct(&item,
+					validation.Field(
+						&item.Format,
+						validation.Required.Error("format is required."),
+						validation.In(ShippingFormats...).Error(`format must be one of LP, 7", CD.`),
+					),
+					validation.Field(
+						&item.Quantity,
+						validation.Required.Error("quantity is required."),
+						validation.Min(1).Error("quantity must be positive."),
+					),
+				)
+			})),
+		),
+	)
+}
+
+func (sv *shippingValidator) ShipmentValidate(shipment model.Shipment) error {
+	return validation.ValidateStruct(&shipment,
+		validation.Field(
+			&shipment.UserID,
+			validation.Required.Error("user id is required."),
+		),
+		validation.Field(
+			&shipment.ShippingMethodID,
+			validation.Required.Error("shipping method id is required."),
+		),
+	)
+}
+
+func (sv *shippingValidator) ShipmentEventValidate(req model.ShipmentEventRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Status,
+			validation.Required.Error("status is required."),
+			validation.In(model.ShipmentPreparing, model.ShipmentShipped, model.ShipmentInTransit,
+				model.ShipmentDelivered, model.ShipmentReturned).
+				Error("status is not a valid shipment status."),
+		),
+	)
+}
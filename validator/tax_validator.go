@@ -0,0 +1,53 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type ITaxValidator interface {
+	TaxRateValidate(rate model.TaxRate) error
+	TaxRequestValidate(req model.TaxRequest) error
+}
+
+type taxValidator struct{}
+
+func NewTaxValidator() ITaxValidator {
+	return &taxValidator{}
+}
+
+func (tv *taxValidator) TaxRateValidate(rate model.TaxRate) error {
+	return validation.ValidateStruct(&rate,
+		validation.Field(
+			&rate.Category,
+			validation.Required.Error("category is required."),
+			validation.In(model.TaxCategoryStandard, model.TaxCategoryReduced).
+				Error("category must be standard or reduced."),
+		),
+		validation.Field(
+			&rate.Percent,
+			validation.Min(0).Error("percent must not be negative."),
+			validation.Max(100).Error("percent must be 100 or less."),
+		),
+	)
+}
+
+func (tv *taxValidator) TaxRequestValidate(req model.TaxRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Lines,
+			validation.Required.Error("lines are required."),
+			validation.Each(validation.By(func(value interface{}) error {
+				line, _ := value.(model.TaxLineItem)
+				if err := validateLineItem(line.LineItem); err != nil {
+					return err
+				}
+				return validation.Validate(line.TaxCategory,
+					validation.In(model.TaxCategoryStandard, model.TaxCategoryReduced).
+						Error("tax category must be standard or reduced."),
+				)
+			})),
+		),
+	)
+}
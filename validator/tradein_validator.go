@@ -0,0 +1,111 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type ITradeInValidator interface {
+	TradeInRuleValidate(rule model.TradeInRule) error
+	TradeInCreateValidate(req model.TradeInCreateRequest) error
+	TradeInAdjustValidate(req model.TradeInAdjustRequest) error
+	TradeInAcceptValidate(req model.TradeInDecisionRequest) error
+}
+
+type tradeInValidator struct{}
+
+func NewTradeInValidator() ITradeInValidator {
+	return &tradeInValidator{}
+}
+
+func (tv *tradeInValidator) TradeInRuleValidate(rule model.TradeInRule) error {
+	return validation.ValidateStruct(&rule,
+		validation.Field(
+			&rule.Grade,
+			validation.Required.Error("grade is required."),
+			validation.By(ValidateGrade),
+		),
+		validation.Field(
+			&rule.CashPercent,
+			validation.Min(0).Error("cash percent must not be negative."),
+			validation.Max(100).Error("cash percent must be 100 or less."),
+		),
+		validation.Field(
+			&rule.CreditPercent,
+			validation.Min(0).Error("credit percent must not be negative."),
+			validation.Max(100).Error("credit percent must be 100 or less."),
+		),
+		validation.Field(
+			&rule.OverstockThreshold,
+			validation.Min(0).Error("overstock threshold must not be negative."),
+		),
+		validation.Field(
+			&rule.OverstockCutPercent,
+			validation.Min(0).Error("overstock cut percent must not be negative."),
+			validation.Max(100).Error("overstock cut percent must be 100 or less."),
+		),
+	)
+}
+
+func (tv *tradeInValidator) TradeInCreateValidate(req model.TradeInCreateRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Items,
+			validation.Required.Error("items are required."),
+			validation.Length(1, 200).Error("up to 200 items can be submitted at once."),
+			validation.Each(validation.By(validateTradeInItem)),
+		),
+	)
+}
+
+func validateTradeInItem(value interface{}) error {
+	item, _ := value.(model.TradeInItemRequest)
+	return validation.ValidateStruct(&item,
+		validation.Field(
+			&item.RecordID,
+			validation.Required.Error("record id is required."),
+		),
+		validation.Field(
+			&item.Grade,
+			validation.Required.Error("grade is required."),
+			validation.By(ValidateGrade),
+		),
+	)
+}
+
+func (tv *tradeInValidator) TradeInAdjustValidate(req model.TradeInAdjustRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Grade,
+			validation.By(ValidateGrade),
+		),
+		validation.Field(
+			&req.SellPrice,
+			validation.Min(0).Error("sell price must not be negative."),
+		),
+		validation.Field(
+			&req.CashOffer,
+			validation.Min(0).Error("cash offer must not be negative."),
+		),
+		validation.Field(
+			&req.CreditOffer,
+			validation.Min(0).Error("credit offer must not be negative."),
+		),
+	)
+}
+
+func (tv *tradeInValidator) TradeInAcceptValidate(req model.TradeInDecisionRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Payout,
+			validation.Required.Error("payout is required."),
+			validation.In(model.PayoutCash, model.PayoutStoreCredit).
+				Error("payout must be cash or store_credit."),
+		),
+		validation.Field(
+			&req.LocationID,
+			validation.Required.Error("location id is required."),
+		),
+	)
+}
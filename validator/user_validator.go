@@ -1,7 +1,9 @@
 package validator
 
 import (
+	"errors"
 	"record-shop-rest-api/model"
+	"regexp"
 
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 	"github.com/go-ozzo/ozzo-validation/v4/is"
@@ -9,6 +11,15 @@ import (
 
 type IUserValidator interface {
 	UserValidate(record model.User) error
+	RoleValidate(req model.RoleRequest) error
+	EmailVerificationValidate(req model.EmailVerificationRequest) error
+	PasswordForgotValidate(req model.PasswordForgotRequest) error
+	PasswordResetValidate(req model.PasswordResetRequest) error
+	TwoFactorCodeValidate(req model.TwoFactorCodeRequest) error
+	LoginTwoFactorValidate(req model.LoginTwoFactorRequest) error
+	ChangePasswordValidate(req model.ChangePasswordRequest) error
+	ChangeEmailValidate(req model.ChangeEmailRequest) error
+	DeleteAccountValidate(req model.DeleteAccountRequest) error
 }
 
 type userValidator struct{}
@@ -19,16 +30,100 @@ func NewUserValidator() IUserValidator {
 
 func (uv *userValidator) UserValidate(user model.User) error {
 	return validation.ValidateStruct(&user,
+		validation.Field(&user.Email, emailRules...),
+		validation.Field(&user.Password, passwordRules...),
+	)
+}
+
+// サインアップ・パスワード再設定などで共通のルール
+var (
+	emailRules = []validation.Rule{
+		validation.Required.Error("email is required"),
+		validation.RuneLength(1, 30).Error("limited max 30 char"),
+		is.Email.Error("is not valid email format"),
+	}
+	passwordRules = []validation.Rule{
+		validation.Required.Error("password is required"),
+		validation.RuneLength(6, 30).Error("limited min 6 max 30 char"),
+	}
+)
+
+func (uv *userValidator) RoleValidate(req model.RoleRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Role,
+			validation.Required.Error("role is required"),
+			validation.In(model.RoleAdmin, model.RoleStaff, model.RoleCustomer).Error("role must be admin, staff or customer"),
+		),
+	)
+}
+
+func (uv *userValidator) EmailVerificationValidate(req model.EmailVerificationRequest) error {
+	return validation.ValidateStruct(&req,
 		validation.Field(
-			&user.Email,
-			validation.Required.Error("email is required"),
-			validation.RuneLength(1, 30).Error("limited max 30 char"),
-			is.Email.Error("is not valid email format"),
+			&req.Token,
+			validation.Required.Error("token is required"),
 		),
+	)
+}
+
+func (uv *userValidator) PasswordForgotValidate(req model.PasswordForgotRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Email, emailRules...),
+	)
+}
+
+func (uv *userValidator) PasswordResetValidate(req model.PasswordResetRequest) error {
+	return validation.ValidateStruct(&req,
 		validation.Field(
-			&user.Password,
-			validation.Required.Error("password is required"),
-			validation.RuneLength(6, 30).Error("limited min 6 max 30 char"),
+			&req.Token,
+			validation.Required.Error("token is required"),
 		),
+		validation.Field(&req.Password, passwordRules...),
+	)
+}
+
+var totpCodeRule = validation.Match(regexp.MustCompile(`^[0-9]{6}$`)).Error("code must be 6 digits")
+
+func (uv *userValidator) TwoFactorCodeValidate(req model.TwoFactorCodeRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Code,
+			validation.Required.Error("code is required"),
+			totpCodeRule,
+		),
+	)
+}
+
+func (uv *userValidator) LoginTwoFactorValidate(req model.LoginTwoFactorRequest) error {
+	if req.Code == "" && req.RecoveryCode == "" {
+		return validation.Errors{"code": errors.New("code or recovery_code is required")}
+	}
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Code, totpCodeRule),
+		validation.Field(&req.RecoveryCode, validation.RuneLength(0, 32).Error("recovery_code is too long")),
+	)
+}
+
+// 現在のパスワードは長さのルールを変える前に設定したものもあり得るので、必須のみ確認する
+var currentPasswordRule = validation.Required.Error("password is required")
+
+func (uv *userValidator) ChangePasswordValidate(req model.ChangePasswordRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.CurrentPassword, validation.Required.Error("current_password is required")),
+		validation.Field(&req.NewPassword, passwordRules...),
+	)
+}
+
+func (uv *userValidator) ChangeEmailValidate(req model.ChangeEmailRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Email, emailRules...),
+		validation.Field(&req.Password, currentPasswordRule),
+	)
+}
+
+func (uv *userValidator) DeleteAccountValidate(req model.DeleteAccountRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(&req.Password, currentPasswordRule),
 	)
 }
@@ -0,0 +1,45 @@
+package validator
+
+import (
+	"fmt"
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type IWantListValidator interface {
+	WantListEntryValidate(entry model.WantListEntry) error
+}
+
+type wantListValidator struct{}
+
+func NewWantListValidator() IWantListValidator {
+	return &wantListValidator{}
+}
+
+func ValidateGrade(value interface{}) error {
+	grade, _ := value.(string)
+	if grade != "" && !model.IsValidGrade(grade) {
+		return fmt.Errorf("condition must be one of M, NM, VG+, VG, G+, G, F, P")
+	}
+	return nil
+}
+
+func (wv *wantListValidator) WantListEntryValidate(entry model.WantListEntry) error {
+	return validation.ValidateStruct(&entry,
+		validation.Field(
+			&entry.Title,
+			validation.When(entry.RecordID == nil && entry.Artist == "",
+				validation.Required.Error("record id, title or artist is required."),
+			),
+		),
+		validation.Field(
+			&entry.MaxPrice,
+			validation.Min(0).Error("max price must not be negative."),
+		),
+		validation.Field(
+			&entry.MinCondition,
+			validation.By(ValidateGrade),
+		),
+	)
+}
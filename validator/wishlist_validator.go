@@ -0,0 +1,37 @@
+package validator
+
+import (
+	"record-shop-rest-api/model"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+type IWishlistValidator interface {
+	WishlistValidate(wishlist model.Wishlist) error
+	WishlistItemValidate(req model.WishlistItemRequest) error
+}
+
+type wishlistValidator struct{}
+
+func NewWishlistValidator() IWishlistValidator {
+	return &wishlistValidator{}
+}
+
+func (wv *wishlistValidator) WishlistValidate(wishlist model.Wishlist) error {
+	return validation.ValidateStruct(&wishlist,
+		validation.Field(
+			&wishlist.Name,
+			validation.Required.Error("name is required."),
+			validation.RuneLength(1, 100).Error("name must be 100 characters or less."),
+		),
+	)
+}
+
+func (wv *wishlistValidator) WishlistItemValidate(req model.WishlistItemRequest) error {
+	return validation.ValidateStruct(&req,
+		validation.Field(
+			&req.Note,
+			validation.RuneLength(0, 500).Error("note must be 500 characters or less."),
+		),
+	)
+}